@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -24,9 +25,13 @@ Commands in interactive mode:
   /status   - Show mesh status
   /agent ID - Switch to specific agent
   /mesh     - Switch back to mesh mode
+  /approvals - List pending approvals
+  /approve ID [comment] - Approve a pending tool call
+  /deny ID [comment]    - Deny a pending tool call
   /quit     - Exit interactive mode
 
-Any other input will be sent to the mesh (or selected agent).`,
+Any other input will be sent to the mesh (or selected agent). While a
+request runs, tool calls waiting for approval are shown for a decision.`,
 	RunE: runInteractive,
 }
 
@@ -83,7 +88,7 @@ func runInteractive(cmd *cobra.Command, args []string) error {
 		}
 
 		// Send to mesh or agent
-		if err := sendRequest(input, currentAgent); err != nil {
+		if err := sendWithApprovals(reader, input, currentAgent); err != nil {
 			fmt.Printf("Error: %v\n\n", err)
 		}
 	}
@@ -118,6 +123,16 @@ func handleCommand(input string, currentAgent *string) bool {
 		*currentAgent = ""
 		fmt.Println("Switched to mesh mode")
 
+	case "/approvals":
+		listApprovals()
+
+	case "/approve", "/deny":
+		if len(parts) < 2 {
+			fmt.Printf("Usage: %s <approval-id> [comment]\n", cmd)
+		} else if err := decideApproval(parts[1], cmd == "/approve", strings.Join(parts[2:], " ")); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+
 	case "/quit", "/exit", "/q":
 		return false
 
@@ -136,6 +151,9 @@ func printHelp() {
 	fmt.Println("  /status   - Show mesh status")
 	fmt.Println("  /agent ID - Switch to specific agent")
 	fmt.Println("  /mesh     - Switch back to mesh mode")
+	fmt.Println("  /approvals - List pending approvals")
+	fmt.Println("  /approve ID [comment] - Approve a pending tool call")
+	fmt.Println("  /deny ID [comment]    - Deny a pending tool call")
 	fmt.Println("  /quit     - Exit interactive mode")
 	fmt.Println()
 	fmt.Println("Any other input will be sent to the mesh or selected agent.")
@@ -213,6 +231,142 @@ func showStatus() {
 	}
 }
 
+// approvalPollInterval is how often pending approvals are checked while a
+// request runs.
+const approvalPollInterval = 500 * time.Millisecond
+
+// pendingApproval is the part of an approval shown to the user.
+type pendingApproval struct {
+	ID     string          `json:"id"`
+	Agent  string          `json:"agent"`
+	Tool   string          `json:"tool"`
+	Params json.RawMessage `json:"params"`
+	Reason string          `json:"reason"`
+}
+
+// sendWithApprovals sends a request and, while it runs, asks the user to
+// decide the tool calls waiting for approval.
+func sendWithApprovals(reader *bufio.Reader, input, agentID string) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- sendRequest(input, agentID)
+	}()
+
+	ticker := time.NewTicker(approvalPollInterval)
+	defer ticker.Stop()
+
+	asked := make(map[string]bool)
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+		}
+
+		pending, err := fetchApprovals()
+		if err != nil {
+			// Approvals are not enabled on the server
+			return <-done
+		}
+
+		for _, a := range pending {
+			if asked[a.ID] {
+				continue
+			}
+			asked[a.ID] = true
+
+			printApproval(a)
+			fmt.Print("Approve? [y/N] ")
+			answer, err := reader.ReadString('\n')
+			if err != nil {
+				return <-done
+			}
+
+			approve := strings.EqualFold(strings.TrimSpace(answer), "y") ||
+				strings.EqualFold(strings.TrimSpace(answer), "yes")
+			if err := decideApproval(a.ID, approve, ""); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		}
+	}
+}
+
+// fetchApprovals returns the pending approvals.
+func fetchApprovals() ([]pendingApproval, error) {
+	resp, err := doRequest("GET", serverURL+"/approvals", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request failed: %s", string(body))
+	}
+
+	var result struct {
+		Approvals []pendingApproval `json:"approvals"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return result.Approvals, nil
+}
+
+func listApprovals() {
+	pending, err := fetchApprovals()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if len(pending) == 0 {
+		fmt.Println("No pending approvals")
+		return
+	}
+	for _, a := range pending {
+		printApproval(a)
+	}
+}
+
+func printApproval(a pendingApproval) {
+	fmt.Println()
+	fmt.Printf("Approval %s: %s wants to call %s\n", a.ID, a.Agent, a.Tool)
+	if a.Reason != "" {
+		fmt.Printf("  Reason: %s\n", a.Reason)
+	}
+	if len(a.Params) > 0 {
+		fmt.Printf("  Params: %s\n", string(a.Params))
+	}
+}
+
+// decideApproval approves or denies a pending approval.
+func decideApproval(id string, approve bool, comment string) error {
+	action := "deny"
+	if approve {
+		action = "approve"
+	}
+
+	reqBody, _ := json.Marshal(map[string]string{"comment": comment})
+	resp, err := doRequest("POST", serverURL+"/approvals/"+id+"/"+action, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("request failed: %s", string(body))
+	}
+
+	if approve {
+		fmt.Printf("Approved %s\n", id)
+	} else {
+		fmt.Printf("Denied %s\n", id)
+	}
+	return nil
+}
+
 func sendRequest(input, agentID string) error {
 	var url string
 	if agentID != "" {
@@ -2,6 +2,9 @@ package main
 
 import (
 	"os"
+
+	// Registers the "pgx" driver for the postgres storage backend
+	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
 func main() {
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/storo/lattice/pkg/approval"
+	"github.com/storo/lattice/pkg/config"
+	"github.com/storo/lattice/pkg/mesh"
+	"github.com/storo/lattice/pkg/protocol/mcp"
+	"github.com/storo/lattice/pkg/security"
+	"github.com/storo/lattice/pkg/storage"
+	"github.com/storo/lattice/pkg/tool"
+)
+
+var (
+	mcpTransport    string
+	mcpAddr         string
+	mcpExportTools  bool
+	mcpAllowedHosts []string
+)
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Model Context Protocol operations",
+	Long:  `Expose the agent mesh to MCP clients such as IDE assistants.`,
+}
+
+var mcpServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Start an MCP server",
+	Long: `Start an MCP server exposing the mesh's agents and tools.
+
+Each agent is exposed as an "ask_<agent>" tool and each capability as a
+"delegate_to_<capability>" tool. The agents' own tools, such as shell and
+fs, are only exposed with --export-tools: clients then call them directly,
+outside any agent. Calls matching the config's approval rules wait, in the
+configured storage, for a decision from lattice serve or lattice
+interactive sharing it; with memory storage they time out and are denied.
+
+With --transport stdio (the default) the server talks JSON-RPC over
+stdin/stdout, for clients that launch it as a subprocess. With
+--transport http it serves the streamable HTTP transport at /mcp, on
+localhost unless --addr says otherwise. To guard against DNS rebinding,
+requests must be addressed to localhost, the --addr host or an
+--allowed-host, such as the name clients use to reach the server.`,
+	RunE: runMCPServe,
+}
+
+func init() {
+	mcpServeCmd.Flags().StringVar(&mcpTransport, "transport", "stdio", "transport (stdio, http)")
+	mcpServeCmd.Flags().StringVar(&mcpAddr, "addr", "127.0.0.1:8081", "listen address for the http transport")
+	mcpServeCmd.Flags().BoolVar(&mcpExportTools, "export-tools", false, "also expose the agents' own tools")
+	mcpServeCmd.Flags().StringSliceVar(&mcpAllowedHosts, "allowed-host", nil, "host name the http transport also accepts requests for (repeatable)")
+
+	mcpCmd.AddCommand(mcpServeCmd)
+}
+
+func runMCPServe(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Approvals wait in the configured store, where lattice serve or
+	// lattice interactive sharing it can decide them
+	var store storage.Store
+	if len(cfg.Approvals.Rules) > 0 || memoryEnabled(cfg) {
+		store, err = config.NewStore(cfg.Storage)
+		if err != nil {
+			return fmt.Errorf("failed to create storage: %w", err)
+		}
+		defer store.Close()
+	}
+	gate, err := config.NewApprovalGate(cfg.Approvals, store)
+	if err != nil {
+		return err
+	}
+
+	m, cleanup, err := newMeshFromConfig(ctx, cfg, store)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	executor, err := newMCPExecutor(ctx, m, mcpExportTools, gate)
+	if err != nil {
+		return err
+	}
+
+	server := mcp.NewServer(executor,
+		mcp.WithServerInfo("lattice", Version),
+		mcp.WithAllowedHosts(mcpHosts()...),
+	)
+
+	switch mcpTransport {
+	case "stdio":
+		log.Printf("MCP server listening on stdio")
+		return server.ServeStdio(ctx, os.Stdin, os.Stdout)
+	case "http":
+		return serveMCPHTTP(ctx, server, newAuthFromConfig(cfg))
+	default:
+		return fmt.Errorf("unknown transport: %s", mcpTransport)
+	}
+}
+
+// newMCPExecutor registers the mesh tools, and every agent's own tools if
+// exportTools is set. Calls to those tools go through gate, which may be
+// nil, as they would from the agent.
+func newMCPExecutor(ctx context.Context, m *mesh.Mesh, exportTools bool, gate *approval.Gate) (*mcp.ToolExecutor, error) {
+	tools, err := m.Tools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mesh tools: %w", err)
+	}
+
+	if exportTools {
+		agents, err := m.ListAgents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list agents: %w", err)
+		}
+		for _, a := range agents {
+			if gate != nil {
+				tools = append(tools, gate.Wrap(a.Tools()...)...)
+			} else {
+				tools = append(tools, a.Tools()...)
+			}
+		}
+	}
+
+	executor := mcp.NewToolExecutor()
+	seen := make(map[string]bool)
+	for _, t := range tools {
+		if seen[t.Name()] {
+			continue
+		}
+		seen[t.Name()] = true
+		executor.Register(tool.ToMCP(t))
+		log.Printf("Exposing tool: %s", t.Name())
+	}
+
+	return executor, nil
+}
+
+// mcpHosts returns the hosts the http transport accepts requests for,
+// besides localhost: the --addr host, unless it is a wildcard, and the
+// --allowed-host values.
+func mcpHosts() []string {
+	hosts := slices.Clone(mcpAllowedHosts)
+	if host, _, err := net.SplitHostPort(mcpAddr); err == nil {
+		if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// serveMCPHTTP serves the streamable HTTP transport until ctx is done.
+func serveMCPHTTP(ctx context.Context, server *mcp.Server, auth *security.Auth) error {
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", requireAuth(auth, server))
+
+	httpServer := &http.Server{
+		Addr:        mcpAddr,
+		Handler:     mux,
+		ReadTimeout: 30 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("MCP server listening on %s/mcp", mcpAddr)
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return httpServer.Shutdown(shutdownCtx)
+}
+
+// requireAuth rejects requests that fail authentication.
+func requireAuth(auth *security.Auth, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := auth.AuthenticateRequest(r.Context(), r); err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -37,6 +37,8 @@ func init() {
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(authCmd)
 	rootCmd.AddCommand(interactiveCmd)
+	rootCmd.AddCommand(mcpCmd)
+	rootCmd.AddCommand(workflowCmd)
 }
 
 func getEnv(key, defaultValue string) string {
@@ -6,17 +6,26 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/storo/lattice/pkg/agent"
+	"github.com/storo/lattice/pkg/approval"
 	"github.com/storo/lattice/pkg/config"
 	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/jobs"
+	"github.com/storo/lattice/pkg/knowledge"
+	"github.com/storo/lattice/pkg/memory"
 	"github.com/storo/lattice/pkg/mesh"
 	"github.com/storo/lattice/pkg/protocol/http"
+	"github.com/storo/lattice/pkg/protocol/mcp"
 	"github.com/storo/lattice/pkg/provider"
 	"github.com/storo/lattice/pkg/security"
+	"github.com/storo/lattice/pkg/storage"
+	"github.com/storo/lattice/pkg/tool/builtin"
 )
 
 var serveAddr string
@@ -33,7 +42,104 @@ func init() {
 }
 
 func runServe(cmd *cobra.Command, args []string) error {
-	// Load config
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// Override addr if specified
+	if serveAddr != "" {
+		cfg.Server.Addr = serveAddr
+	}
+
+	// Jobs and approvals live in the configured store so that replicas
+	// sharing it can pick them up
+	store, err := config.NewStore(cfg.Storage)
+	if err != nil {
+		return fmt.Errorf("failed to create storage: %w", err)
+	}
+	defer store.Close()
+
+	m, cleanup, err := newMeshFromConfig(context.Background(), cfg, store)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	auth := newAuthFromConfig(cfg)
+
+	jobOpts := []jobs.Option{jobs.WithWebhookSecret(cfg.Jobs.WebhookSecret)}
+	if cfg.Jobs.Workers > 0 {
+		jobOpts = append(jobOpts, jobs.WithWorkers(cfg.Jobs.Workers))
+	}
+	if cfg.Jobs.WebhookPrivateNetworks {
+		jobOpts = append(jobOpts, jobs.WithWebhookPolicy(builtin.NewEgressPolicy(
+			builtin.WithAllowedMethods("POST"),
+			builtin.WithPrivateNetworks(),
+		)))
+	}
+	atomicStore, ok := store.(storage.AtomicStore)
+	if !ok {
+		return fmt.Errorf("jobs need a storage backend with atomic operations")
+	}
+	queue := jobs.NewQueue(atomicStore, http.JobRunner(m), jobOpts...)
+	queue.Start(context.Background())
+
+	// Create HTTP server
+	approvals := approval.NewQueue(store, approval.WithTimeout(cfg.Approvals.Timeout))
+	server := http.NewServer(m,
+		http.WithAuth(auth),
+		http.WithJobs(queue),
+		http.WithApprovals(approvals),
+		http.WithMemory(config.NewMemoryStore(cfg.Memory, store)),
+	)
+
+	// Start server in goroutine
+	go func() {
+		log.Printf("Lattice server starting on %s", cfg.Server.Addr)
+		log.Println("Endpoints:")
+		log.Println("  GET  /health        - Health check (no auth)")
+		log.Println("  GET  /agents        - List agents")
+		log.Println("  GET  /agents/{id}   - Get agent info")
+		log.Println("  POST /agents/{id}/run - Run specific agent")
+		log.Println("  POST /mesh/run      - Run on mesh (auto-select)")
+		log.Println("  POST /jobs          - Submit an async job")
+		log.Println("  GET  /jobs/{id}     - Get job status")
+		log.Println("  DELETE /jobs/{id}   - Cancel a job")
+		log.Println("  GET  /approvals     - List pending approvals")
+		log.Println("  POST /approvals/{id}/approve - Approve a call")
+		log.Println("  POST /approvals/{id}/deny    - Deny a call")
+		log.Println("  GET  /memories      - List memories (?agent=, ?user=)")
+		log.Println("  DELETE /memories?user= - Forget a user")
+		log.Println("  DELETE /memories/{id} - Forget a memory")
+
+		if err := server.ListenAndServe(cfg.Server.Addr); err != nil {
+			log.Printf("Server error: %v", err)
+		}
+	}()
+
+	// Wait for shutdown signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutting down...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown error: %v", err)
+	}
+	queue.Stop()
+
+	log.Println("Server stopped")
+	return nil
+}
+
+// loadConfig loads the config file, falling back to defaults when it
+// does not exist.
+func loadConfig() (*config.Config, error) {
 	configPath := cfgFile
 	if configPath == "" {
 		configPath = "lattice.yaml"
@@ -44,24 +150,65 @@ func runServe(cmd *cobra.Command, args []string) error {
 		// Use default config if file doesn't exist
 		if os.IsNotExist(err) {
 			log.Printf("Config file not found, using defaults")
-			cfg = config.DefaultConfig()
-		} else {
-			return fmt.Errorf("failed to load config: %w", err)
+			return config.DefaultConfig(), nil
 		}
+		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Override addr if specified
-	if serveAddr != "" {
-		cfg.Server.Addr = serveAddr
-	}
+	return cfg, nil
+}
 
+// newMeshFromConfig creates the provider, the mesh and its agents.
+// Approvals configured for tool calls and agent memories are kept in
+// store; when store is nil one is opened from the config. The returned cleanup function disconnects
+// the agents' MCP servers and closes any store or knowledge base it opened.
+func newMeshFromConfig(ctx context.Context, cfg *config.Config, store storage.Store) (*mesh.Mesh, func(), error) {
 	// Create provider using factory
 	llmProvider, err := config.NewProvider(cfg.Provider)
 	if err != nil {
-		return fmt.Errorf("failed to create provider: %w", err)
+		return nil, nil, fmt.Errorf("failed to create provider: %w", err)
+	}
+
+	var closers []func() error
+	if store == nil && (len(cfg.Approvals.Rules) > 0 || memoryEnabled(cfg)) {
+		store, err = config.NewStore(cfg.Storage)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create storage: %w", err)
+		}
+		closers = append(closers, store.Close)
+	}
+	gate, err := config.NewApprovalGate(cfg.Approvals, store)
+	if err != nil {
+		for _, c := range closers {
+			c()
+		}
+		return nil, nil, err
 	}
 	log.Printf("Using %s provider", llmProvider.Name())
 
+	var mem *memory.Store
+	if memoryEnabled(cfg) {
+		mem = config.NewMemoryStore(cfg.Memory, store)
+	}
+
+	kb, err := newKnowledgeBase(ctx, cfg)
+	if err != nil {
+		for _, c := range closers {
+			c()
+		}
+		return nil, nil, err
+	}
+	var kbTool core.Tool
+	if kb != nil {
+		closers = append(closers, kb.Close)
+
+		var opts []builtin.KnowledgeOption
+		if cfg.Knowledge.Description != "" {
+			opts = append(opts, builtin.WithKnowledgeDescription(cfg.Knowledge.Description))
+		}
+		kbTool = builtin.NewKnowledgeTool(kb, opts...)
+	}
+
 	// Create mesh
 	var meshOpts []mesh.Option
 	meshOpts = append(meshOpts, mesh.WithMaxHops(cfg.Mesh.MaxHops))
@@ -77,16 +224,36 @@ func runServe(cmd *cobra.Command, args []string) error {
 
 	m := mesh.New(meshOpts...)
 
+	var clients []*mcp.Client
+	cleanup := func() {
+		for _, c := range clients {
+			c.Close()
+		}
+		for _, c := range closers {
+			c()
+		}
+	}
+
 	// Create and register agents
 	for _, agentCfg := range cfg.Agents {
-		a := createAgentFromConfig(agentCfg, llmProvider)
+		a, agentClients, err := createAgentFromConfig(ctx, agentCfg, llmProvider, gate, kbTool, mem)
+		clients = append(clients, agentClients...)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
 		if err := m.Register(a); err != nil {
-			return fmt.Errorf("failed to register agent %s: %w", agentCfg.Name, err)
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to register agent %s: %w", agentCfg.Name, err)
 		}
 		log.Printf("Registered agent: %s", agentCfg.Name)
 	}
 
-	// Setup authentication
+	return m, cleanup, nil
+}
+
+// newAuthFromConfig sets up API key authentication from the config.
+func newAuthFromConfig(cfg *config.Config) *security.Auth {
 	apiKeyAuth := security.NewAPIKeyAuth()
 	for _, key := range cfg.Auth.Keys {
 		apiKeyAuth.RegisterKey(key.ID, &security.KeyEntry{
@@ -95,45 +262,50 @@ func runServe(cmd *cobra.Command, args []string) error {
 			Permissions: key.Permissions,
 		})
 	}
-	auth := security.NewAuth(security.WithAPIKeyAuth(apiKeyAuth))
-
-	// Create HTTP server
-	server := http.NewServer(m, http.WithAuth(auth))
-
-	// Start server in goroutine
-	go func() {
-		log.Printf("Lattice server starting on %s", cfg.Server.Addr)
-		log.Println("Endpoints:")
-		log.Println("  GET  /health        - Health check (no auth)")
-		log.Println("  GET  /agents        - List agents")
-		log.Println("  GET  /agents/{id}   - Get agent info")
-		log.Println("  POST /agents/{id}/run - Run specific agent")
-		log.Println("  POST /mesh/run      - Run on mesh (auto-select)")
+	return security.NewAuth(security.WithAPIKeyAuth(apiKeyAuth))
+}
 
-		if err := server.ListenAndServe(cfg.Server.Addr); err != nil {
-			log.Printf("Server error: %v", err)
+// memoryEnabled reports whether any agent has memory enabled.
+func memoryEnabled(cfg *config.Config) bool {
+	for _, a := range cfg.Agents {
+		if a.Memory {
+			return true
 		}
-	}()
-
-	// Wait for shutdown signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	log.Println("Shutting down...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	}
+	return false
+}
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Shutdown error: %v", err)
+// newKnowledgeBase opens the knowledge base and syncs it with its sources
+// when an agent has knowledge enabled. Returns nil otherwise.
+func newKnowledgeBase(ctx context.Context, cfg *config.Config) (*knowledge.Base, error) {
+	enabled := false
+	for _, a := range cfg.Agents {
+		enabled = enabled || a.Knowledge
+	}
+	if !enabled {
+		return nil, nil
 	}
 
-	log.Println("Server stopped")
-	return nil
+	kb, err := config.NewKnowledgeBase(cfg.Knowledge)
+	if err != nil {
+		return nil, err
+	}
+	// Only changed files are embedded again
+	indexed, deleted, err := kb.Sync(ctx, cfg.Knowledge.Sources)
+	if err != nil {
+		kb.Close()
+		return nil, fmt.Errorf("knowledge: %w", err)
+	}
+	log.Printf("Knowledge: indexed %d documents and removed %d from %v", indexed, deleted, cfg.Knowledge.Sources)
+	return kb, nil
 }
 
-func createAgentFromConfig(cfg config.AgentConfig, prov provider.Provider) core.Agent {
+// createAgentFromConfig builds an agent, connecting to its MCP servers.
+// Tool calls matching the gate's policy wait for approval; gate may be nil.
+// Agents with knowledge enabled get kbTool, and agents with memory
+// enabled get mem; either may be nil.
+// The MCP clients are returned so they can be closed, even on error.
+func createAgentFromConfig(ctx context.Context, cfg config.AgentConfig, prov provider.Provider, gate *approval.Gate, kbTool core.Tool, mem *memory.Store) (core.Agent, []*mcp.Client, error) {
 	builder := agent.New(cfg.Name).
 		Model(prov).
 		System(cfg.System)
@@ -150,5 +322,92 @@ func createAgentFromConfig(cfg config.AgentConfig, prov provider.Provider) core.
 		builder.Needs(core.Capability(cap))
 	}
 
-	return builder.Build()
+	if cfg.ContextStrategy != "" {
+		strategy, err := agent.ParseContextStrategy(cfg.ContextStrategy)
+		if err != nil {
+			return nil, nil, fmt.Errorf("agent %s: %w", cfg.Name, err)
+		}
+		builder.ContextStrategy(strategy)
+	}
+
+	if gate != nil {
+		builder.Approvals(gate)
+	}
+
+	if cfg.Knowledge && kbTool != nil {
+		builder.Tools(kbTool)
+	}
+
+	if cfg.Memory && mem != nil {
+		var opts []memory.ToolsOption
+		if cfg.SharedMemory {
+			opts = append(opts, memory.WithSharedWrites())
+		}
+		builder.Memory(mem, opts...)
+	}
+
+	// The agent is built after its MCP servers connect; tools a server
+	// adds or removes later are applied through this pointer. mounted
+	// holds the names of the tools each server put on the agent.
+	var built atomic.Pointer[agent.Agent]
+	syncTools := func(mounted map[string]bool) func([]core.Tool) {
+		var mu sync.Mutex
+		return func(tools []core.Tool) {
+			a := built.Load()
+			if a == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+
+			have := make(map[string]bool)
+			for _, t := range a.Tools() {
+				have[t.Name()] = true
+			}
+			current := make(map[string]bool, len(tools))
+			for _, t := range tools {
+				switch {
+				case mounted[t.Name()]:
+					current[t.Name()] = true
+				case !have[t.Name()]:
+					a.AddTools(t)
+					current[t.Name()] = true
+					log.Printf("Agent %s: added tool %s", cfg.Name, t.Name())
+				}
+			}
+			for name := range mounted {
+				if !current[name] {
+					a.RemoveTools(name)
+					log.Printf("Agent %s: removed tool %s", cfg.Name, name)
+				}
+			}
+			mounted = current
+		}
+	}
+
+	var clients []*mcp.Client
+	for _, serverCfg := range cfg.MCPServers {
+		mounted := make(map[string]bool)
+		client, err := config.NewMCPClient(serverCfg, mcp.WithClientInfo("lattice", Version), mcp.WithToolsChanged(syncTools(mounted)))
+		if err != nil {
+			return nil, clients, fmt.Errorf("agent %s: %w", cfg.Name, err)
+		}
+		clients = append(clients, client)
+
+		if err := client.Connect(ctx); err != nil {
+			return nil, clients, fmt.Errorf("agent %s: mcp server %s: %w", cfg.Name, serverCfg.Name, err)
+		}
+
+		tools := client.Tools()
+		for _, t := range tools {
+			mounted[t.Name()] = true
+		}
+		builder.Tools(tools...)
+		log.Printf("Agent %s: mounted %d tools from mcp server %s", cfg.Name, len(tools), serverCfg.Name)
+	}
+
+	a := builder.Build()
+	built.Store(a)
+
+	return a, clients, nil
 }
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/storo/lattice/pkg/approval"
+	"github.com/storo/lattice/pkg/config"
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/mesh"
+	"github.com/storo/lattice/pkg/storage"
+	"github.com/storo/lattice/pkg/tool/builtin"
+	"github.com/storo/lattice/pkg/workflow"
+)
+
+var (
+	workflowInput string
+	workflowFile  string
+)
+
+var workflowCmd = &cobra.Command{
+	Use:   "workflow",
+	Short: "Workflow operations",
+	Long: `Run workflow graphs of agents, tools and capabilities.
+
+With a sqlite, redis or postgres storage backend in the config, every run
+is checkpointed after each node and can be listed, inspected, resumed and
+cancelled by ID.`,
+}
+
+var workflowRunCmd = &cobra.Command{
+	Use:   "run <file>",
+	Short: "Run a workflow",
+	Long: `Run a workflow defined in YAML on the configured mesh.
+
+Agent nodes refer to agents from the config by name, capability nodes are
+delegated through the mesh, and tool nodes may use the agents' tools or
+the default built-in tools. Tool calls matching the config's approval
+rules wait for approval, as the agents' own calls do. Use --input - to
+read the input from stdin.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runWorkflow,
+}
+
+var workflowListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List workflow runs",
+	RunE:  runWorkflowList,
+}
+
+var workflowInspectCmd = &cobra.Command{
+	Use:   "inspect <run-id>",
+	Short: "Show a workflow run",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runWorkflowInspect,
+}
+
+var workflowResumeCmd = &cobra.Command{
+	Use:   "resume <run-id>",
+	Short: "Resume a workflow run",
+	Long: `Resume a failed, cancelled or interrupted workflow run. Nodes that
+completed keep their outputs; the rest run again. The workflow is loaded
+from the file the run was started with, unless --file is given.
+
+A run is leased to the process executing it. A run whose process crashed
+can be resumed once its lease expires, 30 seconds after the crash.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runWorkflowResume,
+}
+
+var workflowCancelCmd = &cobra.Command{
+	Use:   "cancel <run-id>",
+	Short: "Cancel a workflow run",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runWorkflowCancel,
+}
+
+func init() {
+	workflowRunCmd.Flags().StringVar(&workflowInput, "input", "", "workflow input (- reads stdin)")
+	workflowResumeCmd.Flags().StringVar(&workflowFile, "file", "", "workflow file (default: the file the run was started with)")
+
+	workflowCmd.AddCommand(workflowRunCmd)
+	workflowCmd.AddCommand(workflowListCmd)
+	workflowCmd.AddCommand(workflowInspectCmd)
+	workflowCmd.AddCommand(workflowResumeCmd)
+	workflowCmd.AddCommand(workflowCancelCmd)
+}
+
+func runWorkflow(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	m, gate, cleanup, err := newWorkflowMesh(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	checkpoints, closeStore, err := newCheckpointsFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	path, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+
+	opts := []workflow.Option{workflow.WithToolApprovals(gate)}
+	if checkpoints != nil {
+		opts = append(opts,
+			workflow.WithCheckpoints(checkpoints),
+			workflow.WithLabels(map[string]string{"file": path}),
+		)
+	}
+
+	w, err := loadWorkflow(ctx, m, path, opts...)
+	if err != nil {
+		return err
+	}
+
+	input := workflowInput
+	if input == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		input = string(data)
+	}
+
+	runID := uuid.New().String()
+	if checkpoints != nil {
+		fmt.Fprintf(os.Stderr, "Run: %s\n", runID)
+	}
+
+	result, runErr := w.RunWithID(ctx, runID, input)
+	return printWorkflowResult(result, runErr)
+}
+
+func runWorkflowResume(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	checkpoints, closeStore, err := requireCheckpoints(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	state, err := checkpoints.Load(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	path := workflowFile
+	if path == "" {
+		path = state.Labels["file"]
+	}
+	if path == "" {
+		return fmt.Errorf("run %s has no workflow file; use --file", state.ID)
+	}
+
+	m, gate, cleanup, err := newWorkflowMesh(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	w, err := loadWorkflow(ctx, m, path,
+		workflow.WithCheckpoints(checkpoints),
+		workflow.WithLabels(state.Labels),
+		workflow.WithToolApprovals(gate),
+	)
+	if err != nil {
+		return err
+	}
+
+	result, runErr := w.Resume(ctx, state.ID)
+	return printWorkflowResult(result, runErr)
+}
+
+func runWorkflowList(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	checkpoints, closeStore, err := requireCheckpoints(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	runs, err := checkpoints.List(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		return printJSON(runs)
+	}
+
+	if len(runs) == 0 {
+		fmt.Println("No workflow runs")
+		return nil
+	}
+
+	fmt.Printf("%-36s  %-20s  %-10s  %s\n", "ID", "WORKFLOW", "STATUS", "UPDATED")
+	for _, r := range runs {
+		fmt.Printf("%-36s  %-20s  %-10s  %s\n", r.ID, r.Workflow, r.Status, r.UpdatedAt.Local().Format(time.DateTime))
+	}
+	return nil
+}
+
+func runWorkflowInspect(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	checkpoints, closeStore, err := requireCheckpoints(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	state, err := checkpoints.Load(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		return printJSON(state)
+	}
+
+	fmt.Printf("Run:      %s\n", state.ID)
+	fmt.Printf("Workflow: %s\n", state.Workflow)
+	fmt.Printf("Status:   %s\n", state.Status)
+	if file := state.Labels["file"]; file != "" {
+		fmt.Printf("File:     %s\n", file)
+	}
+	fmt.Printf("Started:  %s\n", state.CreatedAt.Local().Format(time.DateTime))
+	fmt.Printf("Updated:  %s\n", state.UpdatedAt.Local().Format(time.DateTime))
+	fmt.Printf("Tokens:   %d in, %d out\n", state.TokensIn, state.TokensOut)
+	if state.Error != "" {
+		fmt.Printf("Error:    %s\n", state.Error)
+	}
+	fmt.Println()
+	printNodeReports(os.Stdout, state.Nodes)
+	if state.Output != "" {
+		fmt.Printf("\n%s\n", state.Output)
+	}
+	return nil
+}
+
+func runWorkflowCancel(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	checkpoints, closeStore, err := requireCheckpoints(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	if err := checkpoints.Cancel(context.Background(), args[0]); err != nil {
+		return err
+	}
+
+	fmt.Printf("Cancelled run %s\n", args[0])
+	return nil
+}
+
+// newWorkflowMesh creates the mesh for running workflows, and the gate
+// that tool nodes' calls go through. Both keep approvals in the same
+// store, so that they are decided like the agents' own.
+func newWorkflowMesh(ctx context.Context, cfg *config.Config) (*mesh.Mesh, *approval.Gate, func(), error) {
+	var store storage.Store
+	if len(cfg.Approvals.Rules) > 0 || memoryEnabled(cfg) {
+		var err error
+		store, err = config.NewStore(cfg.Storage)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to create storage: %w", err)
+		}
+	}
+	closeStore := func() {
+		if store != nil {
+			store.Close()
+		}
+	}
+
+	gate, err := config.NewApprovalGate(cfg.Approvals, store)
+	if err != nil {
+		closeStore()
+		return nil, nil, nil, err
+	}
+
+	m, cleanup, err := newMeshFromConfig(ctx, cfg, store)
+	if err != nil {
+		closeStore()
+		return nil, nil, nil, err
+	}
+	return m, gate, func() { cleanup(); closeStore() }, nil
+}
+
+// loadWorkflow loads a YAML workflow, resolving names against the mesh.
+func loadWorkflow(ctx context.Context, m *mesh.Mesh, path string, opts ...workflow.Option) (*workflow.Workflow, error) {
+	agents, err := m.ListAgents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agents: %w", err)
+	}
+
+	tools := builtin.DefaultTools()
+	for _, a := range agents {
+		tools = append(tools, a.Tools()...)
+	}
+
+	w, err := workflow.LoadFile(path,
+		workflow.WithAgents(agents...),
+		workflow.WithTools(tools...),
+		workflow.WithOptions(append([]workflow.Option{workflow.WithDelegator(m)}, opts...)...),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workflow: %w", err)
+	}
+	return w, nil
+}
+
+// newCheckpointsFromConfig opens the configured store for workflow
+// checkpoints. Returns nil checkpoints for the in-memory store, which
+// does not outlive the process.
+func newCheckpointsFromConfig(cfg *config.Config) (*workflow.Checkpoints, func(), error) {
+	if cfg.Storage.Type == "" || cfg.Storage.Type == "memory" {
+		return nil, func() {}, nil
+	}
+
+	store, err := config.NewStore(cfg.Storage)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open storage: %w", err)
+	}
+	return workflow.NewCheckpoints(store), func() { store.Close() }, nil
+}
+
+// requireCheckpoints is newCheckpointsFromConfig for commands that need
+// persisted runs.
+func requireCheckpoints(cfg *config.Config) (*workflow.Checkpoints, func(), error) {
+	checkpoints, closeStore, err := newCheckpointsFromConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if checkpoints == nil {
+		return nil, nil, fmt.Errorf("workflow runs are only persisted with sqlite, redis or postgres storage")
+	}
+	return checkpoints, closeStore, nil
+}
+
+// printWorkflowResult prints a run's report and output, returning the
+// run's error.
+func printWorkflowResult(result *core.Result, runErr error) error {
+	if result == nil {
+		return runErr
+	}
+	report := result.Metadata["report"].(*workflow.Report)
+
+	if output == "json" {
+		if err := printJSON(map[string]any{
+			"run_id": result.Metadata["run_id"],
+			"output": result.Output,
+			"report": report,
+		}); err != nil {
+			return err
+		}
+		return runErr
+	}
+
+	printNodeReports(os.Stderr, report.Nodes)
+	fmt.Fprintf(os.Stderr, "Tokens: %d in, %d out\n\n", report.TokensIn, report.TokensOut)
+
+	fmt.Println(result.Output)
+	return runErr
+}
+
+// printNodeReports prints one line per node.
+func printNodeReports(w io.Writer, nodes []*workflow.NodeReport) {
+	for _, n := range nodes {
+		line := fmt.Sprintf("%-20s %-8s", n.ID, n.Status)
+		if n.Attempts > 1 {
+			line += fmt.Sprintf(" attempts=%d", n.Attempts)
+		}
+		if n.Duration > 0 {
+			line += " " + n.Duration.Round(time.Millisecond).String()
+		}
+		if n.Error != "" {
+			line += " error: " + n.Error
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
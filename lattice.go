@@ -28,6 +28,7 @@ import (
 	"github.com/storo/lattice/pkg/provider"
 	"github.com/storo/lattice/pkg/registry"
 	"github.com/storo/lattice/pkg/security"
+	"github.com/storo/lattice/pkg/workflow"
 )
 
 // Re-export core types for convenience
@@ -116,6 +117,18 @@ var (
 
 	// NewParallel creates a parallel executor.
 	NewParallel = patterns.NewParallel
+
+	// NewPlanExecute creates a Plan-and-Execute pattern.
+	NewPlanExecute = patterns.NewPlanExecute
+
+	// NewDebate creates a debate between agents, decided by a judge.
+	NewDebate = patterns.NewDebate
+
+	// NewCriticRefine creates a Critic/Refine loop.
+	NewCriticRefine = patterns.NewCriticRefine
+
+	// NewWorkflow creates a workflow graph.
+	NewWorkflow = workflow.New
 )
 
 // Security constructors
@@ -134,6 +147,9 @@ var (
 var (
 	// SchemaFromStruct generates JSON Schema from a struct.
 	SchemaFromStruct = core.SchemaFromStruct
+
+	// ValidateJSON validates a JSON document against a JSON Schema.
+	ValidateJSON = core.ValidateJSON
 )
 
 // Context utilities
@@ -2,12 +2,16 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/storo/lattice/pkg/approval"
 	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/memory"
 	"github.com/storo/lattice/pkg/provider"
 	"github.com/storo/lattice/pkg/storage"
 )
@@ -32,6 +36,15 @@ type Agent struct {
 	temperature float64
 	card        *core.AgentCard
 
+	contextStrategy ContextStrategy
+	contextWindow   int
+
+	outputSchema json.RawMessage
+	maxRepairs   int
+
+	approvals *approval.Gate
+	memory    *memory.Store
+
 	mu       sync.Mutex
 	cancelFn context.CancelFunc
 }
@@ -63,6 +76,14 @@ func (a *Agent) Needs() []core.Capability {
 
 // Tools returns the tools available to this agent.
 func (a *Agent) Tools() []core.Tool {
+	return slices.Clone(a.toolList())
+}
+
+// toolList returns the agent's current tools. Tools can be added and
+// removed while the agent runs, so the slice must not be modified.
+func (a *Agent) toolList() []core.Tool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	return a.tools
 }
 
@@ -72,7 +93,39 @@ func (a *Agent) Card() *core.AgentCard {
 }
 
 // Run executes the agent with the given input.
+// If the agent has an output schema, the output is validated JSON.
+// Metadata holds the conversation as "messages" ([]core.Message).
 func (a *Agent) Run(ctx context.Context, input string) (*core.Result, error) {
+	return a.run(ctx, input, a.outputSchema, true)
+}
+
+// WithoutTools returns a view of the agent whose runs offer the model no
+// tool definitions. Patterns that describe the tools in the prompt, such
+// as ReAct, use it with models that have no native tool calling.
+func (a *Agent) WithoutTools() core.Agent {
+	return toollessAgent{a}
+}
+
+// toollessAgent runs an agent without sending its tools to the model.
+type toollessAgent struct {
+	*Agent
+}
+
+// Run executes the agent without its tools.
+func (t toollessAgent) Run(ctx context.Context, input string) (*core.Result, error) {
+	return t.run(ctx, input, t.outputSchema, false)
+}
+
+// RunStream executes the agent with streaming output, without its tools.
+func (t toollessAgent) RunStream(ctx context.Context, input string) (<-chan core.StreamChunk, error) {
+	return t.runStream(ctx, input, false)
+}
+
+// run executes the agentic loop. When schema is set, the final reply must
+// be JSON matching it; invalid replies are sent back to the model for up
+// to maxRepairs corrections. The model is offered the agent's tools only
+// when tools is set.
+func (a *Agent) run(ctx context.Context, input string, schema json.RawMessage, tools bool) (*core.Result, error) {
 	start := time.Now()
 
 	if a.provider == nil {
@@ -88,23 +141,42 @@ func (a *Agent) Run(ctx context.Context, input string) (*core.Result, error) {
 	}
 
 	// Build tool definitions
-	toolDefs := a.buildToolDefinitions()
+	var toolDefs []provider.ToolDefinition
+	if tools {
+		toolDefs = a.buildToolDefinitions()
+	}
+
+	system := a.systemPrompt(ctx, input)
+	if schema != nil {
+		system = structuredSystemPrompt(system, schema)
+	}
 
 	// Execute the agentic loop
 	var totalInputTokens, totalOutputTokens int
 	var finalContent string
+	var repairs int
 
 	for {
 		// Create the request
 		req := &provider.ChatRequest{
-			Model:       "", // Will be set by provider
-			System:      a.system,
-			Messages:    messages,
-			Tools:       toolDefs,
-			MaxTokens:   a.maxTokens,
-			Temperature: a.temperature,
+			Model:          "", // Will be set by provider
+			System:         system,
+			Messages:       messages,
+			Tools:          toolDefs,
+			MaxTokens:      a.maxTokens,
+			Temperature:    a.temperature,
+			ResponseSchema: schema,
 		}
 
+		// Keep the history within the model's context window
+		usage, err := a.fitContext(ctx, req)
+		totalInputTokens += usage.InputTokens
+		totalOutputTokens += usage.OutputTokens
+		if err != nil {
+			return nil, err
+		}
+		messages = req.Messages
+
 		// Call the provider
 		resp, err := a.provider.Chat(ctx, req)
 		if err != nil {
@@ -147,21 +219,51 @@ func (a *Agent) Run(ctx context.Context, input string) (*core.Result, error) {
 
 		// No more tool calls, we're done
 		finalContent = resp.Content
+
+		if schema != nil {
+			output, err := parseStructuredOutput(schema, resp.Content)
+			if err != nil {
+				if repairs >= a.maxRepairs {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidOutput, err)
+				}
+				repairs++
+				messages = append(messages,
+					core.Message{Role: core.RoleAssistant, Content: resp.Content},
+					core.Message{Role: core.RoleUser, Content: repairPrompt(err)},
+				)
+				continue
+			}
+			finalContent = string(output)
+		}
 		break
 	}
 
-	return &core.Result{
+	result := &core.Result{
 		Output:    finalContent,
 		TokensIn:  totalInputTokens,
 		TokensOut: totalOutputTokens,
 		Duration:  time.Since(start),
 		TraceID:   core.TraceID(ctx),
 		CallChain: core.CallChain(ctx),
-	}, nil
+		Metadata: map[string]any{
+			"messages": append(messages, core.Message{Role: core.RoleAssistant, Content: finalContent}),
+		},
+	}
+	if schema != nil {
+		result.Metadata["repair_attempts"] = repairs
+	}
+
+	return result, nil
 }
 
 // RunStream executes the agent with streaming output.
 func (a *Agent) RunStream(ctx context.Context, input string) (<-chan core.StreamChunk, error) {
+	return a.runStream(ctx, input, true)
+}
+
+// runStream streams one model call, offering the agent's tools only when
+// tools is set.
+func (a *Agent) runStream(ctx context.Context, input string, tools bool) (<-chan core.StreamChunk, error) {
 	if a.provider == nil {
 		return nil, ErrNoProvider
 	}
@@ -185,18 +287,26 @@ func (a *Agent) RunStream(ctx context.Context, input string) (<-chan core.Stream
 		}
 
 		// Build tool definitions
-		toolDefs := a.buildToolDefinitions()
+		var toolDefs []provider.ToolDefinition
+		if tools {
+			toolDefs = a.buildToolDefinitions()
+		}
 
 		// Create the request
 		req := &provider.ChatRequest{
 			Model:       "",
-			System:      a.system,
+			System:      a.systemPrompt(ctx, input),
 			Messages:    messages,
 			Tools:       toolDefs,
 			MaxTokens:   a.maxTokens,
 			Temperature: a.temperature,
 		}
 
+		if _, err := a.fitContext(ctx, req); err != nil {
+			ch <- core.StreamChunk{Error: err}
+			return
+		}
+
 		// Get stream from provider
 		stream, err := a.provider.ChatStream(ctx, req)
 		if err != nil {
@@ -240,10 +350,22 @@ func (a *Agent) Stop() error {
 	return nil
 }
 
+// systemPrompt returns the system prompt for a run, with the memories
+// relevant to input when the agent has memory. Memories that cannot be
+// loaded are left out rather than failing the run.
+func (a *Agent) systemPrompt(ctx context.Context, input string) string {
+	if a.memory == nil {
+		return a.system
+	}
+	system, _ := a.memory.SystemPrompt(ctx, a.name, a.system, input)
+	return system
+}
+
 // buildToolDefinitions converts core.Tool to provider.ToolDefinition.
 func (a *Agent) buildToolDefinitions() []provider.ToolDefinition {
-	defs := make([]provider.ToolDefinition, len(a.tools))
-	for i, tool := range a.tools {
+	tools := a.toolList()
+	defs := make([]provider.ToolDefinition, len(tools))
+	for i, tool := range tools {
 		defs[i] = provider.ToolDefinition{
 			Name:        tool.Name(),
 			Description: tool.Description(),
@@ -253,22 +375,73 @@ func (a *Agent) buildToolDefinitions() []provider.ToolDefinition {
 	return defs
 }
 
+// ExecuteTool runs a tool call the way the agent's own loop does, for
+// patterns that parse tool calls from text: parameters are validated and,
+// with an approval gate, the call waits for approval.
+func (a *Agent) ExecuteTool(ctx context.Context, call core.ToolCall) (string, error) {
+	return a.executeTool(ctx, call)
+}
+
 // executeTool finds and executes a tool by name.
+// Parameters are validated against the tool's schema first, so invalid
+// calls never reach the tool and the model gets the schema errors back.
+// Calls that need approval then wait for a decision.
 func (a *Agent) executeTool(ctx context.Context, call core.ToolCall) (string, error) {
-	for _, tool := range a.tools {
+	for _, tool := range a.toolList() {
 		if tool.Name() == call.Name {
-			return tool.Execute(ctx, call.Params)
+			params := call.Params
+			if len(params) == 0 || string(params) == "null" {
+				params = json.RawMessage(`{}`)
+			}
+
+			if schema := tool.Schema(); len(schema) > 0 {
+				if err := core.ValidateJSON(schema, params); err != nil {
+					return "", fmt.Errorf("invalid parameters for tool %s: %w", call.Name, err)
+				}
+			}
+
+			if a.approvals != nil {
+				if err := a.approvals.Check(ctx, a.name, call.Name, params); err != nil {
+					return "", fmt.Errorf("tool call not approved: %w", err)
+				}
+			}
+
+			return tool.Execute(ctx, params)
 		}
 	}
 	return "", fmt.Errorf("tool not found: %s", call.Name)
 }
 
-// AddTools adds tools to the agent dynamically.
-// This is used by the mesh to inject delegation tools.
+// AddTools adds tools to the agent dynamically, replacing those it
+// already has with the same names. This is used by the mesh to inject
+// delegation tools.
 func (a *Agent) AddTools(tools ...core.Tool) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	a.tools = append(a.tools, tools...)
+
+	// Runs in progress may still hold the old slice
+	result := slices.Clone(a.tools)
+	for _, t := range tools {
+		i := slices.IndexFunc(result, func(have core.Tool) bool { return have.Name() == t.Name() })
+		if i >= 0 {
+			result[i] = t
+		} else {
+			result = append(result, t)
+		}
+	}
+	a.tools = result
+}
+
+// RemoveTools removes the named tools from the agent, such as those an MCP
+// server no longer offers.
+func (a *Agent) RemoveTools(names ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Runs in progress may still hold the old slice
+	a.tools = slices.DeleteFunc(slices.Clone(a.tools), func(t core.Tool) bool {
+		return slices.Contains(names, t.Name())
+	})
 }
 
 // Verify Agent implements core.Agent
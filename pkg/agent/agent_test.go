@@ -3,10 +3,15 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/storo/lattice/pkg/approval"
 	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/memory"
 	"github.com/storo/lattice/pkg/provider"
+	"github.com/storo/lattice/pkg/storage"
 )
 
 func TestAgent_Run_Basic(t *testing.T) {
@@ -162,6 +167,166 @@ func TestAgent_CallChain(t *testing.T) {
 	}
 }
 
+func TestAgent_Run_InvalidToolParams(t *testing.T) {
+	ctx := context.Background()
+
+	var toolResult *core.ToolResult
+	callCount := 0
+	mockProvider := &provider.MockProvider{
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			callCount++
+			if callCount == 1 {
+				return &provider.ChatResponse{
+					StopReason: provider.StopReasonToolUse,
+					ToolCalls: []core.ToolCall{
+						{ID: "call-1", Name: "test_tool", Params: json.RawMessage(`{"count": "three"}`)},
+					},
+				}, nil
+			}
+			toolResult = req.Messages[len(req.Messages)-1].ToolResult
+			return &provider.ChatResponse{Content: "done", StopReason: provider.StopReasonEndTurn}, nil
+		},
+	}
+
+	executed := false
+	testTool := &testToolImpl{
+		name:   "test_tool",
+		schema: json.RawMessage(`{"type":"object","properties":{"count":{"type":"integer"}},"required":["count"]}`),
+		executeFunc: func(ctx context.Context, params json.RawMessage) (string, error) {
+			executed = true
+			return "ok", nil
+		},
+	}
+
+	agent := New("test-agent").Model(mockProvider).Tools(testTool).Build()
+
+	if _, err := agent.Run(ctx, "Use the tool"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if executed {
+		t.Error("tool should not run with invalid parameters")
+	}
+	if toolResult == nil || !toolResult.IsError {
+		t.Fatal("expected an error tool result")
+	}
+	if !strings.Contains(toolResult.Content, "$.count: expected integer, got string") {
+		t.Errorf("expected schema error in tool result, got %q", toolResult.Content)
+	}
+}
+
+func TestAgent_Run_ToolApproval(t *testing.T) {
+	ctx := context.Background()
+
+	for _, decision := range []approval.Status{approval.StatusApproved, approval.StatusDenied} {
+		var toolResult *core.ToolResult
+		callCount := 0
+		mockProvider := &provider.MockProvider{
+			ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+				callCount++
+				if callCount == 1 {
+					return &provider.ChatResponse{
+						StopReason: provider.StopReasonToolUse,
+						ToolCalls: []core.ToolCall{
+							{ID: "call-1", Name: "shell", Params: json.RawMessage(`{"command": "rm -rf build"}`)},
+						},
+					}, nil
+				}
+				toolResult = req.Messages[len(req.Messages)-1].ToolResult
+				return &provider.ChatResponse{Content: "done", StopReason: provider.StopReasonEndTurn}, nil
+			},
+		}
+
+		executed := false
+		shell := &testToolImpl{
+			name: "shell",
+			executeFunc: func(ctx context.Context, params json.RawMessage) (string, error) {
+				executed = true
+				return "removed", nil
+			},
+		}
+
+		// Decide every approval as soon as it is requested
+		var queue *approval.Queue
+		queue = approval.NewQueue(storage.NewMemoryStore(),
+			approval.WithPollInterval(time.Millisecond),
+			approval.WithNotify(func(a *approval.Approval) {
+				go func() {
+					if decision == approval.StatusApproved {
+						queue.Approve(ctx, a.ID, "tester", "")
+					} else {
+						queue.Deny(ctx, a.ID, "tester", "not today")
+					}
+				}()
+			}),
+		)
+		policy, _ := approval.NewPolicy(approval.Rule{Tool: "shell", Param: "command", Match: `^rm `})
+
+		agent := New("test-agent").
+			Model(mockProvider).
+			Tools(shell).
+			Approvals(approval.NewGate(policy, queue)).
+			Build()
+
+		if _, err := agent.Run(ctx, "Clean up"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		approvals, _ := queue.List(ctx, decision)
+		if len(approvals) != 1 || approvals[0].Agent != "test-agent" || approvals[0].Tool != "shell" {
+			t.Errorf("unexpected approvals %+v", approvals)
+		}
+
+		if decision == approval.StatusApproved {
+			if !executed || toolResult.IsError {
+				t.Errorf("approved call should run, got %+v", toolResult)
+			}
+			continue
+		}
+		if executed {
+			t.Error("denied call should not run")
+		}
+		if !toolResult.IsError || !strings.Contains(toolResult.Content, "not today") {
+			t.Errorf("expected a denied tool result, got %+v", toolResult)
+		}
+	}
+}
+
+func TestAgent_Run_Memory(t *testing.T) {
+	ctx := core.WithUserID(context.Background(), "alice")
+	mem := memory.New(storage.NewMemoryStore())
+	mem.Remember(ctx, "test-agent", "alice", "Alice prefers short answers")
+	mem.Remember(ctx, "test-agent", "bob", "Bob prefers long answers")
+
+	var system string
+	mockProvider := &provider.MockProvider{
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			system = req.System
+			return &provider.ChatResponse{Content: "ok", StopReason: provider.StopReasonEndTurn}, nil
+		},
+	}
+
+	agent := New("test-agent").
+		Model(mockProvider).
+		System("You are a helpful assistant").
+		Memory(mem).
+		Build()
+
+	if _, err := agent.Run(ctx, "How should you answer?"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(system, "You are a helpful assistant") || !strings.Contains(system, "Alice prefers short answers") {
+		t.Errorf("expected alice's memory in the system prompt, got %q", system)
+	}
+	if strings.Contains(system, "Bob") {
+		t.Errorf("expected no memories about other users, got %q", system)
+	}
+	if tools := agent.Card().Tools; len(tools) != 3 || tools[0] != "remember" {
+		t.Errorf("expected the memory tools, got %v", tools)
+	}
+}
+
 // testToolImpl is a test implementation of core.Tool
 type testToolImpl struct {
 	name        string
@@ -191,3 +356,28 @@ func (t *testToolImpl) Execute(ctx context.Context, params json.RawMessage) (str
 	}
 	return "executed", nil
 }
+
+func TestAgent_ToolsChangeDuringRun(t *testing.T) {
+	p := toolLoopProvider(20, nil)
+	a := New("test-agent").Model(p).Tools(bigTool).Build()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		extra := &testToolImpl{name: "extra"}
+		for range 100 {
+			a.AddTools(extra)
+			a.RemoveTools("extra")
+		}
+	}()
+
+	if _, err := a.Run(context.Background(), "go"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-done
+
+	tools := a.Tools()
+	if len(tools) != 1 || tools[0].Name() != "big_tool" {
+		t.Errorf("expected only big_tool to remain, got %d tools", len(tools))
+	}
+}
@@ -2,7 +2,9 @@ package agent
 
 import (
 	"github.com/google/uuid"
+	"github.com/storo/lattice/pkg/approval"
 	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/memory"
 	"github.com/storo/lattice/pkg/provider"
 	"github.com/storo/lattice/pkg/storage"
 )
@@ -11,6 +13,7 @@ import (
 const (
 	DefaultMaxTokens   = 4096
 	DefaultTemperature = 0.7
+	DefaultMaxRepairs  = 2
 )
 
 // Builder is a fluent builder for creating agents.
@@ -27,6 +30,9 @@ func New(name string) *Builder {
 			maxTokens:   DefaultMaxTokens,
 			temperature: DefaultTemperature,
 			store:       storage.NewMemoryStore(),
+
+			contextStrategy: ContextTruncate,
+			maxRepairs:      DefaultMaxRepairs,
 		},
 	}
 }
@@ -85,6 +91,51 @@ func (b *Builder) Temperature(t float64) *Builder {
 	return b
 }
 
+// ContextStrategy sets how the agent handles history that no longer fits
+// in the model's context window. Defaults to ContextTruncate.
+func (b *Builder) ContextStrategy(s ContextStrategy) *Builder {
+	b.agent.contextStrategy = s
+	return b
+}
+
+// ContextWindow overrides the context window reported by the provider.
+func (b *Builder) ContextWindow(n int) *Builder {
+	b.agent.contextWindow = n
+	return b
+}
+
+// OutputSchema requires the agent to reply with JSON matching the schema
+// generated from v (see core.SchemaFromStruct).
+func (b *Builder) OutputSchema(v any) *Builder {
+	b.agent.outputSchema = core.SchemaFromStruct(v)
+	return b
+}
+
+// MaxRepairs sets how many times an invalid structured reply is sent back
+// to the model for correction.
+func (b *Builder) MaxRepairs(n int) *Builder {
+	b.agent.maxRepairs = n
+	return b
+}
+
+// Approvals holds the agent's tool calls that match the gate's policy
+// until a human approves them. Denied calls are returned to the model as
+// tool errors.
+func (b *Builder) Approvals(g *approval.Gate) *Builder {
+	b.agent.approvals = g
+	return b
+}
+
+// Memory gives the agent long-term memory: the remember, recall and forget
+// tools, and the memories relevant to each run added to its system prompt.
+// Memories are kept under the agent's name, per user (see core.WithUserID).
+// Options configure the tools, such as memory.WithSharedWrites.
+func (b *Builder) Memory(m *memory.Store, opts ...memory.ToolsOption) *Builder {
+	b.agent.memory = m
+	b.agent.tools = append(b.agent.tools, memory.Tools(m, b.agent.name, opts...)...)
+	return b
+}
+
 // Build creates the agent and generates its card.
 func (b *Builder) Build() *Agent {
 	b.generateCard()
@@ -107,6 +158,7 @@ func (b *Builder) generateCard() {
 			Needs:     b.agent.needs,
 			Streaming: true,
 		},
-		Tools: toolNames,
+		Tools:        toolNames,
+		OutputSchema: b.agent.outputSchema,
 	}
 }
@@ -0,0 +1,218 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/provider"
+)
+
+// ErrContextWindowExceeded is returned when the conversation no longer fits
+// in the model's context window and the strategy cannot shrink it.
+var ErrContextWindowExceeded = errors.New("context window exceeded")
+
+// ContextStrategy defines how an agent keeps its conversation history
+// within the model's context window.
+type ContextStrategy string
+
+const (
+	// ContextTruncate replaces the oldest tool results with a short
+	// placeholder until the conversation fits.
+	ContextTruncate ContextStrategy = "truncate"
+
+	// ContextSummarize asks the model to summarize earlier turns and
+	// replaces them with the summary.
+	ContextSummarize ContextStrategy = "summarize"
+
+	// ContextFail returns ErrContextWindowExceeded as soon as the
+	// conversation does not fit.
+	ContextFail ContextStrategy = "fail"
+)
+
+// ParseContextStrategy returns the strategy named s, or an error if there is
+// none.
+func ParseContextStrategy(s string) (ContextStrategy, error) {
+	switch cs := ContextStrategy(s); cs {
+	case ContextTruncate, ContextSummarize, ContextFail:
+		return cs, nil
+	}
+	return "", fmt.Errorf("unknown context strategy %q (want truncate, summarize or fail)", s)
+}
+
+// truncatedToolResult replaces tool results dropped by ContextTruncate.
+const truncatedToolResult = "[tool result truncated to fit the context window]"
+
+// summarizePrompt is the system prompt used by ContextSummarize.
+const summarizePrompt = "You compress agent conversations. Summarize the transcript below, " +
+	"keeping every fact, tool result and decision needed to finish the task. " +
+	"Reply with the summary only."
+
+// summaryHeader separates the input from the summary ContextSummarize
+// appends to it.
+const summaryHeader = "\n\nSummary of progress so far:\n"
+
+// contextBudget returns the number of input tokens available for a request
+// and the number of output tokens reserved for the reply. ok is false if the
+// provider does not report a context window.
+func (a *Agent) contextBudget() (budget, reserve int, ok bool) {
+	window := a.contextWindow
+	if window <= 0 {
+		window = a.provider.ContextWindow()
+	}
+	if window <= 0 {
+		return 0, 0, false
+	}
+
+	// A max_tokens as large as the window, like the 4096 of both the
+	// default agent and Ollama, would leave no room for the input, so
+	// the reply gets at most half of it.
+	reserve = min(a.maxTokens, window/2)
+	return window - reserve, reserve, true
+}
+
+// fitContext applies the agent's context strategy to req.Messages so the
+// request fits in the context window. It returns the token usage of any
+// extra provider calls made while doing so.
+func (a *Agent) fitContext(ctx context.Context, req *provider.ChatRequest) (provider.Usage, error) {
+	var usage provider.Usage
+
+	budget, reserve, ok := a.contextBudget()
+	if !ok {
+		return usage, nil
+	}
+	req.MaxTokens = min(req.MaxTokens, reserve)
+
+	count := a.provider.CountTokens(req)
+	if count <= budget {
+		return usage, nil
+	}
+
+	switch a.contextStrategy {
+	case ContextFail:
+		// Handled below.
+
+	case ContextSummarize:
+		messages, u, err := a.summarizeMessages(ctx, req.Messages, budget)
+		if err != nil {
+			return usage, err
+		}
+		usage = u
+		req.Messages = messages
+		count = a.provider.CountTokens(req)
+
+	default:
+		messages := copyMessages(req.Messages)
+		for i := range messages {
+			if count <= budget {
+				break
+			}
+			if messages[i].ToolResult == nil || messages[i].ToolResult.Content == truncatedToolResult {
+				continue
+			}
+			result := *messages[i].ToolResult
+			result.Content = truncatedToolResult
+			messages[i].ToolResult = &result
+			req.Messages = messages
+			count = a.provider.CountTokens(req)
+		}
+	}
+
+	if count > budget {
+		return usage, fmt.Errorf("%w: request needs ~%d tokens, %d available", ErrContextWindowExceeded, count, budget)
+	}
+
+	return usage, nil
+}
+
+// copyMessages returns a copy of messages that can be modified without
+// touching the caller's slice.
+func copyMessages(messages []core.Message) []core.Message {
+	result := make([]core.Message, len(messages))
+	copy(result, messages)
+	return result
+}
+
+// summarizeMessages replaces every turn before the latest assistant turn
+// with a model-written summary. The original input is kept verbatim so the
+// model never loses sight of the task. A summary from an earlier call is
+// folded into the new one, which replaces it.
+func (a *Agent) summarizeMessages(ctx context.Context, messages []core.Message, budget int) ([]core.Message, provider.Usage, error) {
+	var usage provider.Usage
+
+	// Keep the most recent assistant turn (and its tool results) intact so
+	// tool_use/tool_result pairs are never split.
+	split := -1
+	for i := len(messages) - 1; i > 0; i-- {
+		if messages[i].Role == core.RoleAssistant {
+			split = i
+			break
+		}
+	}
+	if split <= 1 {
+		return messages, usage, nil
+	}
+
+	input, previous, _ := strings.Cut(messages[0].Content, summaryHeader)
+	transcript := formatTranscript(messages[1:split])
+	if previous != "" {
+		transcript = "summary of earlier turns: " + previous + "\n" + transcript
+	}
+
+	// The transcript itself has to fit in a request (roughly four
+	// characters per token); keep the most recent part.
+	transcript = tail(transcript, budget*4)
+
+	resp, err := a.provider.Chat(ctx, &provider.ChatRequest{
+		System:      summarizePrompt,
+		Messages:    []core.Message{{Role: core.RoleUser, Content: transcript}},
+		MaxTokens:   a.maxTokens,
+		Temperature: 0,
+	})
+	if err != nil {
+		return nil, usage, fmt.Errorf("summarize context: %w", err)
+	}
+	usage = resp.Usage
+
+	first := messages[0]
+	first.Content = input + summaryHeader + resp.Content
+
+	result := make([]core.Message, 0, len(messages)-split+1)
+	result = append(result, first)
+	result = append(result, messages[split:]...)
+	return result, usage, nil
+}
+
+// tail returns the end of s, at most n bytes long, without splitting a
+// rune.
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := len(s) - n
+	for cut < len(s) && !utf8.RuneStart(s[cut]) {
+		cut++
+	}
+	return s[cut:]
+}
+
+// formatTranscript renders messages as plain text for summarization.
+func formatTranscript(messages []core.Message) string {
+	var sb strings.Builder
+	for _, m := range messages {
+		switch {
+		case m.ToolResult != nil:
+			fmt.Fprintf(&sb, "tool result: %s\n", m.ToolResult.Content)
+		case len(m.ToolCalls) > 0:
+			for _, tc := range m.ToolCalls {
+				fmt.Fprintf(&sb, "%s called %s with %s\n", m.Role, tc.Name, string(tc.Params))
+			}
+		default:
+			fmt.Fprintf(&sb, "%s: %s\n", m.Role, m.Content)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,256 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/provider"
+)
+
+// toolLoopProvider requests the tool `calls` times, then answers.
+// Every request is passed to inspect before responding.
+func toolLoopProvider(calls int, inspect func(req *provider.ChatRequest)) *provider.MockProvider {
+	n := 0
+	return &provider.MockProvider{
+		ContextWindowSize: 1000,
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			if inspect != nil {
+				inspect(req)
+			}
+			if req.System == summarizePrompt {
+				return &provider.ChatResponse{
+					Content:    "the tool was called several times",
+					StopReason: provider.StopReasonEndTurn,
+					Usage:      provider.Usage{InputTokens: 5, OutputTokens: 7},
+				}, nil
+			}
+			n++
+			if n <= calls {
+				return &provider.ChatResponse{
+					StopReason: provider.StopReasonToolUse,
+					ToolCalls: []core.ToolCall{
+						{ID: "call", Name: "big_tool", Params: json.RawMessage(`{}`)},
+					},
+				}, nil
+			}
+			return &provider.ChatResponse{Content: "done", StopReason: provider.StopReasonEndTurn}, nil
+		},
+	}
+}
+
+// bigTool returns roughly 250 tokens per call.
+var bigTool = &testToolImpl{
+	name: "big_tool",
+	executeFunc: func(ctx context.Context, params json.RawMessage) (string, error) {
+		return strings.Repeat("x", 1000), nil
+	},
+}
+
+func TestAgent_ContextTruncate(t *testing.T) {
+	var lastReq *provider.ChatRequest
+	p := toolLoopProvider(5, func(req *provider.ChatRequest) { lastReq = req })
+
+	a := New("test-agent").
+		Model(p).
+		Tools(bigTool).
+		MaxTokens(100).
+		Build()
+
+	result, err := a.Run(context.Background(), "go")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Output != "done" {
+		t.Errorf("expected 'done', got '%s'", result.Output)
+	}
+
+	if n := p.CountTokens(lastReq); n > 900 {
+		t.Errorf("expected request to fit in 900 tokens, got %d", n)
+	}
+
+	truncated := 0
+	for _, m := range lastReq.Messages {
+		if m.ToolResult != nil && m.ToolResult.Content == truncatedToolResult {
+			truncated++
+		}
+	}
+	if truncated == 0 {
+		t.Error("expected some tool results to be truncated")
+	}
+
+	// The most recent tool result must be kept
+	last := lastReq.Messages[len(lastReq.Messages)-1]
+	if last.ToolResult == nil || last.ToolResult.Content == truncatedToolResult {
+		t.Error("expected the latest tool result to be kept")
+	}
+}
+
+func TestAgent_ContextFail(t *testing.T) {
+	p := toolLoopProvider(5, nil)
+
+	a := New("test-agent").
+		Model(p).
+		Tools(bigTool).
+		MaxTokens(100).
+		ContextStrategy(ContextFail).
+		Build()
+
+	_, err := a.Run(context.Background(), "go")
+	if !errors.Is(err, ErrContextWindowExceeded) {
+		t.Errorf("expected ErrContextWindowExceeded, got %v", err)
+	}
+}
+
+func TestAgent_ContextSummarize(t *testing.T) {
+	summarized := 0
+	var lastReq *provider.ChatRequest
+	p := toolLoopProvider(8, func(req *provider.ChatRequest) {
+		if req.System == summarizePrompt {
+			summarized++
+			return
+		}
+		lastReq = req
+	})
+
+	a := New("test-agent").
+		Model(p).
+		Tools(bigTool).
+		MaxTokens(100).
+		ContextStrategy(ContextSummarize).
+		Build()
+
+	result, err := a.Run(context.Background(), "go")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if summarized < 2 {
+		t.Fatalf("expected several summarization requests, got %d", summarized)
+	}
+
+	first := lastReq.Messages[0]
+	if !strings.HasPrefix(first.Content, "go") || !strings.Contains(first.Content, "the tool was called several times") {
+		t.Errorf("expected input followed by summary, got '%s'", first.Content)
+	}
+
+	// Each summary replaces the one before
+	if n := strings.Count(first.Content, summaryHeader); n != 1 {
+		t.Errorf("expected one summary, got %d in '%s'", n, first.Content)
+	}
+	if lastReq.Messages[1].Role != core.RoleAssistant {
+		t.Errorf("expected assistant turn after summary, got %s", lastReq.Messages[1].Role)
+	}
+	if result.TokensOut < 7 {
+		t.Errorf("expected summarization tokens to be counted, got %d", result.TokensOut)
+	}
+}
+
+func TestAgent_ContextWindowOverride(t *testing.T) {
+	p := toolLoopProvider(1, nil)
+
+	a := New("test-agent").
+		Model(p).
+		Tools(bigTool).
+		MaxTokens(100).
+		ContextWindow(150).
+		ContextStrategy(ContextFail).
+		Build()
+
+	_, err := a.Run(context.Background(), "go")
+	if !errors.Is(err, ErrContextWindowExceeded) {
+		t.Errorf("expected ErrContextWindowExceeded, got %v", err)
+	}
+}
+
+func TestAgent_ContextMaxTokensFillWindow(t *testing.T) {
+	var lastReq *provider.ChatRequest
+	p := toolLoopProvider(5, func(req *provider.ChatRequest) { lastReq = req })
+
+	// As with Ollama's defaults, max tokens alone fills the window
+	a := New("test-agent").
+		Model(p).
+		Tools(bigTool).
+		MaxTokens(1000).
+		Build()
+
+	if _, err := a.Run(context.Background(), "go"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lastReq.MaxTokens != 500 {
+		t.Errorf("expected max tokens to be cut to 500, got %d", lastReq.MaxTokens)
+	}
+	if n := p.CountTokens(lastReq); n > 500 {
+		t.Errorf("expected request to fit in 500 tokens, got %d", n)
+	}
+}
+
+func TestParseContextStrategy(t *testing.T) {
+	for _, s := range []ContextStrategy{ContextTruncate, ContextSummarize, ContextFail} {
+		if got, err := ParseContextStrategy(string(s)); err != nil || got != s {
+			t.Errorf("ParseContextStrategy(%q) = %q, %v", s, got, err)
+		}
+	}
+	if _, err := ParseContextStrategy("sumarize"); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+func TestTail(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "llo"},
+		{"añb", 3, "ñb"},
+		{"añb", 2, "b"},
+		{"日本語", 4, "語"},
+	}
+	for _, tt := range tests {
+		got := tail(tt.s, tt.n)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("tail(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestAgent_RunStream_ContextFail(t *testing.T) {
+	streamed := false
+	p := &provider.MockProvider{
+		ContextWindowSize: 150,
+		ChatStreamFunc: func(ctx context.Context, req *provider.ChatRequest) (<-chan provider.StreamEvent, error) {
+			streamed = true
+			ch := make(chan provider.StreamEvent)
+			close(ch)
+			return ch, nil
+		},
+	}
+
+	a := New("test-agent").
+		Model(p).
+		MaxTokens(100).
+		ContextStrategy(ContextFail).
+		Build()
+
+	stream, err := a.RunStream(context.Background(), strings.Repeat("x", 1000))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var streamErr error
+	for chunk := range stream {
+		if chunk.Error != nil {
+			streamErr = chunk.Error
+		}
+	}
+	if !errors.Is(streamErr, ErrContextWindowExceeded) {
+		t.Errorf("expected ErrContextWindowExceeded, got %v", streamErr)
+	}
+	if streamed {
+		t.Error("expected no request to the provider")
+	}
+}
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/storo/lattice/pkg/core"
+)
+
+// ErrInvalidOutput is returned when the model's reply still does not match
+// the output schema after all repair attempts.
+var ErrInvalidOutput = errors.New("output does not match schema")
+
+// RunStructured executes the agent and decodes its reply into out, which
+// must be a pointer. The reply is validated against the agent's output
+// schema, or a schema generated from out if the agent has none.
+func (a *Agent) RunStructured(ctx context.Context, input string, out any) (*core.Result, error) {
+	schema := a.outputSchema
+	if schema == nil {
+		schema = core.SchemaFromStruct(out)
+	}
+
+	result, err := a.run(ctx, input, schema, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(result.Output), out); err != nil {
+		return nil, fmt.Errorf("failed to decode output: %w", err)
+	}
+
+	return result, nil
+}
+
+// structuredSystemPrompt appends output format instructions to the system
+// prompt, for providers without native structured output.
+func structuredSystemPrompt(system string, schema json.RawMessage) string {
+	instructions := "Respond only with a JSON value that matches this JSON Schema, without any other text:\n" + string(schema)
+	if system == "" {
+		return instructions
+	}
+	return system + "\n\n" + instructions
+}
+
+// repairPrompt asks the model to correct an invalid reply.
+func repairPrompt(err error) string {
+	return fmt.Sprintf("Your reply did not match the required JSON Schema:\n%v\n\nReply again with only the corrected JSON.", err)
+}
+
+// parseStructuredOutput extracts the JSON value from a reply and validates
+// it against schema. Returns the compacted JSON.
+func parseStructuredOutput(schema json.RawMessage, content string) (json.RawMessage, error) {
+	raw := core.ExtractJSON(content)
+	if raw == nil {
+		return nil, errors.New("reply is not valid JSON")
+	}
+
+	if err := core.ValidateJSON(schema, raw); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/provider"
+)
+
+type sentiment struct {
+	Label      string  `json:"label" schema:"positive, negative or neutral"`
+	Confidence float64 `json:"confidence"`
+}
+
+func TestAgent_RunStructured(t *testing.T) {
+	var gotReq *provider.ChatRequest
+	mockProvider := &provider.MockProvider{
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			gotReq = req
+			return &provider.ChatResponse{
+				Content:    "```json\n{\"label\": \"positive\", \"confidence\": 0.9}\n```",
+				StopReason: provider.StopReasonEndTurn,
+			}, nil
+		},
+	}
+
+	a := New("classifier").Model(mockProvider).Build()
+
+	var out sentiment
+	result, err := a.RunStructured(context.Background(), "I love it", &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if out.Label != "positive" || out.Confidence != 0.9 {
+		t.Errorf("unexpected output: %+v", out)
+	}
+	if result.Output != `{"label":"positive","confidence":0.9}` {
+		t.Errorf("expected compacted JSON output, got %s", result.Output)
+	}
+	if gotReq.ResponseSchema == nil {
+		t.Error("expected response schema to be sent to the provider")
+	}
+	if !strings.Contains(gotReq.System, `"confidence"`) {
+		t.Error("expected schema in system prompt")
+	}
+}
+
+func TestAgent_RunStructured_Repair(t *testing.T) {
+	calls := 0
+	var repairMsg string
+	mockProvider := &provider.MockProvider{
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			calls++
+			if calls == 1 {
+				return &provider.ChatResponse{Content: `{"label": "positive"}`, StopReason: provider.StopReasonEndTurn}, nil
+			}
+			repairMsg = req.Messages[len(req.Messages)-1].Content
+			return &provider.ChatResponse{Content: `{"label": "positive", "confidence": 1}`, StopReason: provider.StopReasonEndTurn}, nil
+		},
+	}
+
+	a := New("classifier").Model(mockProvider).Build()
+
+	var out sentiment
+	result, err := a.RunStructured(context.Background(), "I love it", &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("expected 2 provider calls, got %d", calls)
+	}
+	if !strings.Contains(repairMsg, `missing required field "confidence"`) {
+		t.Errorf("expected validation error in repair message, got %q", repairMsg)
+	}
+	if result.Metadata["repair_attempts"] != 1 {
+		t.Errorf("expected 1 repair attempt, got %v", result.Metadata["repair_attempts"])
+	}
+}
+
+func TestAgent_RunStructured_RepairsExhausted(t *testing.T) {
+	calls := 0
+	mockProvider := &provider.MockProvider{
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			calls++
+			return &provider.ChatResponse{Content: "I think it is positive", StopReason: provider.StopReasonEndTurn}, nil
+		},
+	}
+
+	a := New("classifier").Model(mockProvider).MaxRepairs(1).Build()
+
+	var out sentiment
+	_, err := a.RunStructured(context.Background(), "I love it", &out)
+	if !errors.Is(err, ErrInvalidOutput) {
+		t.Errorf("expected ErrInvalidOutput, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 provider calls, got %d", calls)
+	}
+}
+
+func TestBuilder_OutputSchema(t *testing.T) {
+	mockProvider := provider.NewMockWithResponse(`Here you go: {"label": "neutral", "confidence": 0.5}`)
+
+	a := New("classifier").
+		Model(mockProvider).
+		OutputSchema(sentiment{}).
+		Build()
+
+	if a.Card().OutputSchema == nil {
+		t.Error("expected output schema on card")
+	}
+
+	result, err := a.Run(context.Background(), "meh")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Output != `{"label":"neutral","confidence":0.5}` {
+		t.Errorf("expected extracted JSON, got %s", result.Output)
+	}
+}
+
+// Verify the structured result is recorded with the agent's call chain.
+func TestAgent_RunStructured_CallChain(t *testing.T) {
+	a := New("classifier").
+		Model(provider.NewMockWithResponse(`{"label": "neutral", "confidence": 0}`)).
+		Build()
+
+	var out sentiment
+	result, err := a.RunStructured(core.WithTraceID(context.Background(), "trace-1"), "meh", &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.TraceID != "trace-1" || len(result.CallChain) != 1 {
+		t.Errorf("unexpected trace info: %s %v", result.TraceID, result.CallChain)
+	}
+}
@@ -0,0 +1,334 @@
+// Package approval pauses tool calls and workflow steps until a human
+// approves or denies them. Pending approvals are kept in a storage.Store,
+// so they can be decided from any process sharing it, such as the HTTP
+// server or the interactive CLI.
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/storo/lattice/pkg/storage"
+)
+
+// Approval errors
+var (
+	ErrDenied           = errors.New("denied by approver")
+	ErrNotFound         = errors.New("approval not found")
+	ErrAlreadyDecided   = errors.New("approval already decided")
+	ErrApprovalTimedOut = errors.New("approval timed out")
+)
+
+// Status is the state of an approval.
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusDenied   Status = "denied"
+)
+
+// Approval is a request for a human to allow a tool call or workflow step.
+type Approval struct {
+	ID string `json:"id"`
+
+	// Agent is the agent making the call, or "workflow:<name>" for a
+	// workflow step.
+	Agent string `json:"agent,omitempty"`
+
+	// Tool is the tool, or workflow node, waiting for approval.
+	Tool string `json:"tool"`
+
+	// Params are the call's JSON parameters.
+	Params json.RawMessage `json:"params,omitempty"`
+
+	// Reason explains why approval is needed.
+	Reason string `json:"reason,omitempty"`
+
+	TraceID string `json:"trace_id,omitempty"`
+	Status  Status `json:"status"`
+
+	// DecidedBy and Comment are set by the approver.
+	DecidedBy string `json:"decided_by,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	DecidedAt time.Time `json:"decided_at,omitzero"`
+}
+
+// keyPrefix is the storage key prefix of approvals.
+const keyPrefix = "approval:"
+
+// Defaults
+const (
+	DefaultPollInterval = 500 * time.Millisecond
+	DefaultTTL          = 24 * time.Hour
+)
+
+// Queue stores approvals and waits for their decisions.
+type Queue struct {
+	store        storage.Store
+	pollInterval time.Duration
+	timeout      time.Duration
+	ttl          time.Duration
+	notify       func(*Approval)
+}
+
+// Option configures a Queue.
+type Option func(*Queue)
+
+// NewQueue creates an approval queue.
+func NewQueue(store storage.Store, opts ...Option) *Queue {
+	q := &Queue{
+		store:        store,
+		pollInterval: DefaultPollInterval,
+		ttl:          DefaultTTL,
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	return q
+}
+
+// WithPollInterval sets how often Wait checks for a decision.
+func WithPollInterval(d time.Duration) Option {
+	return func(q *Queue) {
+		q.pollInterval = d
+	}
+}
+
+// WithTimeout denies approvals nobody decided within d (default: wait
+// until the caller's context is done).
+func WithTimeout(d time.Duration) Option {
+	return func(q *Queue) {
+		q.timeout = d
+	}
+}
+
+// WithTTL sets how long decided approvals are kept (0 keeps them forever).
+func WithTTL(d time.Duration) Option {
+	return func(q *Queue) {
+		q.ttl = d
+	}
+}
+
+// WithNotify calls fn with every new pending approval.
+func WithNotify(fn func(*Approval)) Option {
+	return func(q *Queue) {
+		q.notify = fn
+	}
+}
+
+// Request stores a pending approval and returns it with its ID set.
+func (q *Queue) Request(ctx context.Context, a *Approval) (*Approval, error) {
+	pending := *a
+	pending.ID = uuid.New().String()
+	pending.Status = StatusPending
+	pending.CreatedAt = time.Now().UTC()
+
+	if err := q.save(ctx, &pending, 0); err != nil {
+		return nil, err
+	}
+
+	if q.notify != nil {
+		q.notify(&pending)
+	}
+	return &pending, nil
+}
+
+// Wait blocks until an approval is decided and returns it. An approval
+// that outlives the queue's timeout is denied with ErrApprovalTimedOut.
+func (q *Queue) Wait(ctx context.Context, id string) (*Approval, error) {
+	if q.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.timeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		a, err := q.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if a.Status != StatusPending {
+			return a, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				// Nobody decided in time: close the approval
+				storeCtx := context.WithoutCancel(ctx)
+				if a, err := q.Deny(storeCtx, id, "", ErrApprovalTimedOut.Error()); err == nil {
+					return a, nil
+				}
+				if a, err := q.Get(storeCtx, id); err == nil && a.Status != StatusPending {
+					return a, nil
+				}
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Authorize requests an approval and waits for it. It returns nil once
+// approved, and an error wrapping ErrDenied if denied or timed out.
+func (q *Queue) Authorize(ctx context.Context, a *Approval) error {
+	pending, err := q.Request(ctx, a)
+	if err != nil {
+		return err
+	}
+
+	decided, err := q.Wait(ctx, pending.ID)
+	if err != nil {
+		return err
+	}
+	if decided.Status == StatusApproved {
+		return nil
+	}
+
+	if decided.Comment != "" {
+		return fmt.Errorf("%s: %w: %s", a.Tool, ErrDenied, decided.Comment)
+	}
+	return fmt.Errorf("%s: %w", a.Tool, ErrDenied)
+}
+
+// Get returns an approval by ID.
+func (q *Queue) Get(ctx context.Context, id string) (*Approval, error) {
+	data, err := q.store.Get(ctx, keyPrefix+id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return nil, err
+	}
+
+	var a Approval
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("failed to decode approval %s: %w", id, err)
+	}
+	return &a, nil
+}
+
+// List returns the approvals with the given status, or all of them when
+// status is empty, oldest first.
+func (q *Queue) List(ctx context.Context, status Status) ([]*Approval, error) {
+	keys, err := q.store.Keys(ctx, keyPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+
+	approvals := make([]*Approval, 0, len(keys))
+	for _, key := range keys {
+		a, err := q.Get(ctx, strings.TrimPrefix(key, keyPrefix))
+		if err != nil {
+			// Expired between Keys and Get
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if status == "" || a.Status == status {
+			approvals = append(approvals, a)
+		}
+	}
+
+	sort.Slice(approvals, func(i, j int) bool {
+		return approvals[i].CreatedAt.Before(approvals[j].CreatedAt)
+	})
+	return approvals, nil
+}
+
+// Approve allows a pending call to proceed.
+func (q *Queue) Approve(ctx context.Context, id, by, comment string) (*Approval, error) {
+	return q.decide(ctx, id, StatusApproved, by, comment)
+}
+
+// Deny rejects a pending call. The comment is passed back to the caller.
+func (q *Queue) Deny(ctx context.Context, id, by, comment string) (*Approval, error) {
+	return q.decide(ctx, id, StatusDenied, by, comment)
+}
+
+// decide records a decision on a pending approval. With a
+// storage.AtomicStore, the approval is only written if nobody decided it
+// meanwhile, so concurrent decisions, and Wait's timeout, never overwrite
+// one another.
+func (q *Queue) decide(ctx context.Context, id string, status Status, by, comment string) (*Approval, error) {
+	store, ok := q.store.(storage.AtomicStore)
+	if !ok {
+		a, err := q.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if a.Status != StatusPending {
+			return a, fmt.Errorf("%w: %s is %s", ErrAlreadyDecided, id, a.Status)
+		}
+		a.setDecision(status, by, comment)
+		if err := q.save(ctx, a, q.ttl); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+
+	for {
+		data, version, err := store.GetVersion(ctx, keyPrefix+id)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+			}
+			return nil, err
+		}
+
+		var a Approval
+		if err := json.Unmarshal(data, &a); err != nil {
+			return nil, fmt.Errorf("failed to decode approval %s: %w", id, err)
+		}
+		if a.Status != StatusPending {
+			return &a, fmt.Errorf("%w: %s is %s", ErrAlreadyDecided, id, a.Status)
+		}
+		a.setDecision(status, by, comment)
+
+		data, err = json.Marshal(&a)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode approval: %w", err)
+		}
+		_, err = store.CompareAndSwap(ctx, keyPrefix+id, data, version, q.ttl)
+		if errors.Is(err, storage.ErrConflict) {
+			// Changed meanwhile: read the decision that won
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &a, nil
+	}
+}
+
+// setDecision records a decision.
+func (a *Approval) setDecision(status Status, by, comment string) {
+	a.Status = status
+	a.DecidedBy = by
+	a.Comment = comment
+	a.DecidedAt = time.Now().UTC()
+}
+
+// save stores an approval.
+func (q *Queue) save(ctx context.Context, a *Approval, ttl time.Duration) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to encode approval: %w", err)
+	}
+	return q.store.Set(ctx, keyPrefix+a.ID, data, ttl)
+}
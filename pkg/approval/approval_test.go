@@ -0,0 +1,247 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/storage"
+	"github.com/storo/lattice/pkg/tool/builtin"
+)
+
+func TestPolicy_Match(t *testing.T) {
+	policy, err := NewPolicy(
+		Rule{Tool: "shell"},
+		Rule{Tool: "fs", Param: "operation", Match: "^(write|delete)$", Reason: "modifies files"},
+		Rule{Tool: "github_*", Param: "force"},
+		Rule{Tool: "*", Match: "(?i)password"},
+		Rule{Tool: "exec", Match: `rm -rf`},
+	)
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+
+	tests := []struct {
+		tool   string
+		params string
+		want   bool
+	}{
+		{"shell", `{"command":"ls"}`, true},
+		{"fs", `{"operation":"delete","path":"a"}`, true},
+		{"fs", `{"operation":"read","path":"a"}`, false},
+		{"github_push", `{"force":true}`, true},
+		{"github_push", `{}`, false},
+		{"http", `{"body":"Password=123"}`, true},
+		{"http", `{"url":"https://example.com"}`, false},
+
+		// Parameters are checked as tools decode them
+		{"fs", `{"operation":"read","path":"a","OPERATION":"delete"}`, true},
+		{"fs", `{"operation":"delete","operation":"read"}`, true},
+		{"fs", `{"operation":"d\u0065lete"}`, true},
+		{"github_push", `{"Force":true}`, true},
+		{"exec", `{"command":"\u0072m -rf /"}`, true},
+		{"exec", `{"command":"rm -r\u0066 /"}`, true},
+		{"exec", `{"command":"ls -rf"}`, false},
+	}
+
+	for _, tt := range tests {
+		rule, got := policy.Match(tt.tool, json.RawMessage(tt.params))
+		if got != tt.want {
+			t.Errorf("%s %s: expected %v, got %v", tt.tool, tt.params, tt.want, got)
+		}
+		if got && tt.tool == "fs" && rule.Reason != "modifies files" {
+			t.Errorf("unexpected rule %+v", rule)
+		}
+	}
+
+	if _, err := NewPolicy(Rule{Tool: "fs", Match: "("}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+	if _, err := NewPolicy(Rule{Match: "x"}); err == nil {
+		t.Error("expected error for rule without tool")
+	}
+}
+
+func TestQueue_Decisions(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueue(storage.NewMemoryStore())
+
+	a, err := q.Request(ctx, &Approval{Tool: "shell", Params: json.RawMessage(`{"command":"ls"}`)})
+	if err != nil {
+		t.Fatalf("failed to request: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	b, _ := q.Request(ctx, &Approval{Tool: "fs"})
+
+	pending, _ := q.List(ctx, StatusPending)
+	if len(pending) != 2 || pending[0].ID != a.ID {
+		t.Fatalf("unexpected pending approvals %+v", pending)
+	}
+
+	approved, err := q.Approve(ctx, a.ID, "alice", "fine")
+	if err != nil || approved.Status != StatusApproved || approved.DecidedBy != "alice" || approved.DecidedAt.IsZero() {
+		t.Fatalf("unexpected approval %+v, %v", approved, err)
+	}
+	if _, err := q.Deny(ctx, a.ID, "bob", ""); !errors.Is(err, ErrAlreadyDecided) {
+		t.Errorf("expected ErrAlreadyDecided, got %v", err)
+	}
+	if _, err := q.Approve(ctx, "missing", "", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	q.Deny(ctx, b.ID, "bob", "no")
+	if pending, _ := q.List(ctx, StatusPending); len(pending) != 0 {
+		t.Errorf("expected no pending approvals, got %d", len(pending))
+	}
+	if all, _ := q.List(ctx, ""); len(all) != 2 {
+		t.Errorf("expected 2 approvals, got %d", len(all))
+	}
+}
+
+func TestQueue_ConcurrentDecisions(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueue(storage.NewMemoryStore())
+
+	a, err := q.Request(ctx, &Approval{Tool: "shell"})
+	if err != nil {
+		t.Fatalf("failed to request: %v", err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		decided atomic.Int32
+		winner  atomic.Value
+	)
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			decide, by := q.Approve, "approver-"+strconv.Itoa(i)
+			if i%2 == 1 {
+				decide, by = q.Deny, "denier-"+strconv.Itoa(i)
+			}
+			_, err := decide(ctx, a.ID, by, "")
+			switch {
+			case err == nil:
+				decided.Add(1)
+				winner.Store(by)
+			case !errors.Is(err, ErrAlreadyDecided):
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := decided.Load(); n != 1 {
+		t.Fatalf("expected exactly one decision to win, got %d", n)
+	}
+	got, _ := q.Get(ctx, a.ID)
+	if got.DecidedBy != winner.Load() {
+		t.Errorf("expected the stored decision by %v, got %s", winner.Load(), got.DecidedBy)
+	}
+}
+
+func TestQueue_AuthorizeTimeout(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueue(storage.NewMemoryStore(), WithPollInterval(time.Millisecond), WithTimeout(20*time.Millisecond))
+
+	err := q.Authorize(ctx, &Approval{Tool: "shell"})
+	if !errors.Is(err, ErrDenied) || !strings.Contains(err.Error(), ErrApprovalTimedOut.Error()) {
+		t.Errorf("expected a timed out denial, got %v", err)
+	}
+
+	// The approval is closed, not left pending
+	if pending, _ := q.List(ctx, StatusPending); len(pending) != 0 {
+		t.Errorf("expected no pending approvals, got %d", len(pending))
+	}
+}
+
+func TestGate_Wrap(t *testing.T) {
+	store := storage.NewMemoryStore()
+	policy, _ := NewPolicy(Rule{Tool: "echo", Param: "text", Match: "secret"})
+
+	var q *Queue
+	q = NewQueue(store, WithPollInterval(time.Millisecond), WithNotify(func(a *Approval) {
+		go q.Deny(context.Background(), a.ID, "", "contains a secret")
+	}))
+	tool := NewGate(policy, q).Wrap(&echoTool{})[0]
+
+	ctx := core.WithCallChain(context.Background(), "agent-1")
+
+	if out, err := tool.Execute(ctx, json.RawMessage(`{"text":"hello"}`)); err != nil || out != "hello" {
+		t.Errorf("unmatched call should run, got %q, %v", out, err)
+	}
+
+	_, err := tool.Execute(ctx, json.RawMessage(`{"text":"my secret"}`))
+	if !errors.Is(err, ErrDenied) || !strings.Contains(err.Error(), "contains a secret") {
+		t.Errorf("expected denial, got %v", err)
+	}
+
+	denied, _ := q.List(ctx, StatusDenied)
+	if len(denied) != 1 || denied[0].Agent != "agent-1" {
+		t.Errorf("unexpected approvals %+v", denied)
+	}
+}
+
+func TestGate_FSRule(t *testing.T) {
+	// The fs rule from the Rule documentation
+	policy, err := NewPolicy(Rule{Tool: "fs", Param: "action", Match: "^(write_file|delete_file)$"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var q *Queue
+	q = NewQueue(storage.NewMemoryStore(), WithPollInterval(time.Millisecond), WithNotify(func(a *Approval) {
+		go q.Deny(context.Background(), a.ID, "", "no writes")
+	}))
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.txt")
+	os.WriteFile(file, []byte("hello"), 0o644)
+	fs := NewGate(policy, q).Wrap(builtin.NewFSTool(builtin.WithAllowedPaths(dir)))[0]
+	ctx := context.Background()
+
+	params, _ := json.Marshal(map[string]string{"action": "read_file", "path": file})
+	if out, err := fs.Execute(ctx, params); err != nil || !strings.Contains(out, "hello") {
+		t.Errorf("expected the read to run, got %q, %v", out, err)
+	}
+
+	for _, action := range []string{"write_file", "delete_file"} {
+		params, _ := json.Marshal(map[string]string{"action": action, "path": file, "content": "changed"})
+		if _, err := fs.Execute(ctx, params); !errors.Is(err, ErrDenied) {
+			t.Errorf("%s: expected denial, got %v", action, err)
+		}
+	}
+
+	// A case-variant key overrides the action when the tool decodes it
+	params = []byte(`{"action":"read_file","path":` + strconv.Quote(file) + `,"ACTION":"delete_file"}`)
+	if _, err := fs.Execute(ctx, params); !errors.Is(err, ErrDenied) {
+		t.Errorf("case-variant action: expected denial, got %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "hello" {
+		t.Errorf("expected the file to be unchanged, got %q", data)
+	}
+}
+
+// echoTool returns its text parameter.
+type echoTool struct{}
+
+func (t *echoTool) Name() string            { return "echo" }
+func (t *echoTool) Description() string     { return "Echoes text" }
+func (t *echoTool) Schema() json.RawMessage { return json.RawMessage(`{"type":"object"}`) }
+func (t *echoTool) Execute(ctx context.Context, params json.RawMessage) (string, error) {
+	var p struct {
+		Text string `json:"text"`
+	}
+	json.Unmarshal(params, &p)
+	return p.Text, nil
+}
@@ -0,0 +1,236 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/storo/lattice/pkg/core"
+)
+
+// Rule marks tool calls that need approval.
+//
+//	{Tool: "shell"}                                                    every call
+//	{Tool: "fs", Param: "action", Match: "^(write_file|delete_file)$"}   matching parameter
+//	{Tool: "*", Match: "(?i)password"}                                 any call whose params match
+type Rule struct {
+	// Tool is the tool name, or a path.Match glob such as "github_*".
+	Tool string
+
+	// Param is a top-level parameter to check. Without Match, the rule
+	// applies when the parameter is present.
+	Param string
+
+	// Match is a regular expression matched against Param's value, or,
+	// when Param is empty, against the whole JSON parameters and each of
+	// their keys and string values.
+	Match string
+
+	// Reason is shown to the approver.
+	Reason string
+}
+
+// Policy decides which tool calls need approval.
+type Policy struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	match *regexp.Regexp
+}
+
+// NewPolicy creates a policy from rules. A call needs approval if any rule
+// matches it.
+func NewPolicy(rules ...Rule) (*Policy, error) {
+	p := &Policy{}
+	for _, r := range rules {
+		if r.Tool == "" {
+			return nil, fmt.Errorf("approval rule needs a tool")
+		}
+		if _, err := path.Match(r.Tool, ""); err != nil {
+			return nil, fmt.Errorf("invalid tool pattern %q: %w", r.Tool, err)
+		}
+
+		cr := compiledRule{Rule: r}
+		if r.Match != "" {
+			re, err := regexp.Compile(r.Match)
+			if err != nil {
+				return nil, fmt.Errorf("invalid match pattern %q: %w", r.Match, err)
+			}
+			cr.match = re
+		}
+		p.rules = append(p.rules, cr)
+	}
+	return p, nil
+}
+
+// Match returns the first rule that applies to a call. Parameters are
+// checked as tools decode them: escapes are resolved, and Param matches
+// top-level keys case-insensitively, as encoding/json matches struct
+// fields, with every value given under such a key checked.
+func (p *Policy) Match(tool string, params json.RawMessage) (Rule, bool) {
+	var call *callParams
+
+	for _, r := range p.rules {
+		if ok, _ := path.Match(r.Tool, tool); !ok {
+			continue
+		}
+		if r.match == nil && r.Param == "" {
+			return r.Rule, true
+		}
+		if call == nil {
+			call = decodeParams(params)
+		}
+
+		if r.Param == "" {
+			if r.match.Match(params) || slices.ContainsFunc(call.strings, r.match.MatchString) {
+				return r.Rule, true
+			}
+			continue
+		}
+
+		for _, f := range call.fields {
+			if !strings.EqualFold(f.key, r.Param) {
+				continue
+			}
+			if r.match == nil || r.match.MatchString(paramString(f.value)) {
+				return r.Rule, true
+			}
+		}
+	}
+	return Rule{}, false
+}
+
+// callParams is a call's parameters as tools see them.
+type callParams struct {
+	// fields are the top-level parameters in order, repeated keys included.
+	fields []callParam
+
+	// strings are every key and string value, unescaped.
+	strings []string
+}
+
+// callParam is a top-level parameter.
+type callParam struct {
+	key   string
+	value json.RawMessage
+}
+
+// decodeParams decodes a call's parameters. Whatever does not decode is
+// left out; rules without Param still see the raw JSON.
+func decodeParams(params json.RawMessage) *callParams {
+	call := &callParams{}
+
+	dec := json.NewDecoder(bytes.NewReader(params))
+	if tok, err := dec.Token(); err == nil && tok == json.Delim('{') {
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				break
+			}
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				break
+			}
+			call.fields = append(call.fields, callParam{key: tok.(string), value: value})
+		}
+	}
+
+	dec = json.NewDecoder(bytes.NewReader(params))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		if s, ok := tok.(string); ok {
+			call.strings = append(call.strings, s)
+		}
+	}
+
+	return call
+}
+
+// paramString returns a string parameter unquoted, and others as JSON.
+func paramString(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// Gate holds tool calls that match a policy until they are approved.
+type Gate struct {
+	policy *Policy
+	queue  *Queue
+}
+
+// NewGate creates a gate.
+func NewGate(policy *Policy, queue *Queue) *Gate {
+	return &Gate{policy: policy, queue: queue}
+}
+
+// Queue returns the gate's approval queue.
+func (g *Gate) Queue() *Queue {
+	return g.queue
+}
+
+// Check returns nil if a call may run: either no rule matches it or it was
+// approved. A denied call returns an error wrapping ErrDenied with the
+// approver's comment.
+func (g *Gate) Check(ctx context.Context, agent, tool string, params json.RawMessage) error {
+	rule, ok := g.policy.Match(tool, params)
+	if !ok {
+		return nil
+	}
+
+	reason := rule.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("tool %s requires approval", tool)
+	}
+
+	return g.queue.Authorize(ctx, &Approval{
+		Agent:   agent,
+		Tool:    tool,
+		Params:  params,
+		Reason:  reason,
+		TraceID: core.TraceID(ctx),
+	})
+}
+
+// Wrap returns the tools with their calls checked by the gate. The calling
+// agent is taken from the context's call chain.
+func (g *Gate) Wrap(tools ...core.Tool) []core.Tool {
+	wrapped := make([]core.Tool, len(tools))
+	for i, t := range tools {
+		wrapped[i] = &gatedTool{Tool: t, gate: g}
+	}
+	return wrapped
+}
+
+// gatedTool is a tool whose calls go through a gate.
+type gatedTool struct {
+	core.Tool
+	gate *Gate
+}
+
+func (t *gatedTool) Execute(ctx context.Context, params json.RawMessage) (string, error) {
+	var agent string
+	if chain := core.CallChain(ctx); len(chain) > 0 {
+		agent = chain[len(chain)-1]
+	}
+
+	if err := t.gate.Check(ctx, agent, t.Name(), params); err != nil {
+		return "", err
+	}
+	return t.Tool.Execute(ctx, params)
+}
+
+// Verify gatedTool implements core.Tool
+var _ core.Tool = (*gatedTool)(nil)
@@ -2,18 +2,23 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config is the main configuration structure.
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Mesh     MeshConfig     `yaml:"mesh"`
-	Provider ProviderConfig `yaml:"provider"`
-	Storage  StorageConfig  `yaml:"storage"`
-	Agents   []AgentConfig  `yaml:"agents"`
-	Auth     AuthConfig     `yaml:"auth"`
+	Server    ServerConfig    `yaml:"server"`
+	Mesh      MeshConfig      `yaml:"mesh"`
+	Provider  ProviderConfig  `yaml:"provider"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Agents    []AgentConfig   `yaml:"agents"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Jobs      JobsConfig      `yaml:"jobs"`
+	Approvals ApprovalsConfig `yaml:"approvals"`
+	Knowledge KnowledgeConfig `yaml:"knowledge"`
+	Memory    MemoryConfig    `yaml:"memory"`
 }
 
 // ServerConfig contains HTTP server settings.
@@ -37,11 +42,12 @@ type ProviderConfig struct {
 
 // StorageConfig contains storage backend settings.
 type StorageConfig struct {
-	Type     string `yaml:"type"`     // memory | redis | sqlite
+	Type     string `yaml:"type"`     // memory | redis | sqlite | postgres
 	Path     string `yaml:"path"`     // SQLite database path
 	Address  string `yaml:"address"`  // Redis address
 	Password string `yaml:"password"` // Redis password
 	DB       int    `yaml:"db"`       // Redis DB number
+	DSN      string `yaml:"dsn"`      // Postgres connection string
 }
 
 // AgentConfig defines an agent.
@@ -51,6 +57,35 @@ type AgentConfig struct {
 	System      string   `yaml:"system"`
 	Provides    []string `yaml:"provides"`
 	Needs       []string `yaml:"needs"`
+
+	// ContextStrategy is truncate | summarize | fail (default: truncate).
+	ContextStrategy string `yaml:"context_strategy,omitempty"`
+
+	// MCPServers are external MCP servers whose tools the agent can use.
+	MCPServers []MCPServerConfig `yaml:"mcp_servers,omitempty"`
+
+	// Knowledge gives the agent the search_knowledge tool.
+	Knowledge bool `yaml:"knowledge,omitempty"`
+
+	// Memory gives the agent long-term memory across sessions.
+	Memory bool `yaml:"memory,omitempty"`
+
+	// SharedMemory lets the agent save and forget memories shared by every
+	// user, not only the current user's.
+	SharedMemory bool `yaml:"shared_memory,omitempty"`
+}
+
+// MCPServerConfig defines an external MCP server. Set Command for a stdio
+// server started as a subprocess, or URL for a streamable HTTP server.
+// Env and header values may reference environment variables as ${VAR}.
+type MCPServerConfig struct {
+	Name       string            `yaml:"name"`
+	Command    string            `yaml:"command,omitempty"`
+	Args       []string          `yaml:"args,omitempty"`
+	Env        map[string]string `yaml:"env,omitempty"`
+	URL        string            `yaml:"url,omitempty"`
+	Headers    map[string]string `yaml:"headers,omitempty"`
+	ToolPrefix string            `yaml:"tool_prefix,omitempty"`
 }
 
 // AuthConfig contains authentication settings.
@@ -65,6 +100,57 @@ type KeyConfig struct {
 	Permissions []string `yaml:"permissions"`
 }
 
+// JobsConfig contains asynchronous job settings. Jobs are kept in the
+// configured storage backend.
+type JobsConfig struct {
+	Workers                int    `yaml:"workers"`                  // Concurrent jobs per server
+	WebhookSecret          string `yaml:"webhook_secret"`           // Signs webhook bodies
+	WebhookPrivateNetworks bool   `yaml:"webhook_private_networks"` // Let webhooks reach private addresses
+}
+
+// ApprovalsConfig marks tool calls that wait for human approval.
+type ApprovalsConfig struct {
+	Rules   []ApprovalRuleConfig `yaml:"rules"`
+	Timeout time.Duration        `yaml:"timeout"` // Deny undecided calls after this long (0 = wait)
+}
+
+// ApprovalRuleConfig defines an approval rule.
+type ApprovalRuleConfig struct {
+	Tool   string `yaml:"tool"`             // Tool name or glob
+	Param  string `yaml:"param,omitempty"`  // Parameter to check
+	Match  string `yaml:"match,omitempty"`  // Regular expression for the parameter, or the whole params
+	Reason string `yaml:"reason,omitempty"` // Shown to the approver
+}
+
+// KnowledgeConfig contains the knowledge base that agents with
+// knowledge enabled can search.
+type KnowledgeConfig struct {
+	Index        string         `yaml:"index"`         // memory | sqlite
+	Path         string         `yaml:"path"`          // SQLite index path
+	Embedder     EmbedderConfig `yaml:"embedder"`      // How chunks are embedded
+	Sources      []string       `yaml:"sources"`       // Directories indexed at startup
+	ChunkSize    int            `yaml:"chunk_size"`    // Characters per chunk
+	ChunkOverlap int            `yaml:"chunk_overlap"` // Characters shared by adjacent chunks
+	Description  string         `yaml:"description"`   // What the documents are about, for the model
+}
+
+// MemoryConfig contains long-term memory settings for agents with memory
+// enabled. Memories are kept in the configured storage backend.
+type MemoryConfig struct {
+	TTL        time.Duration `yaml:"ttl"`          // Forget memories not updated for this long (0 = never)
+	HalfLife   time.Duration `yaml:"half_life"`    // Recall weight halves after this long unused
+	Inject     int           `yaml:"inject"`       // Memories added to the system prompt (-1 = none)
+	MaxPerUser int           `yaml:"max_per_user"` // Memories kept per agent and user
+}
+
+// EmbedderConfig contains embedding model settings.
+type EmbedderConfig struct {
+	Type    string `yaml:"type"` // ollama | openai | hash
+	BaseURL string `yaml:"base_url"`
+	APIKey  string `yaml:"api_key"`
+	Model   string `yaml:"model"`
+}
+
 // Load reads a configuration file.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
@@ -2,7 +2,13 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"sort"
 
+	"github.com/storo/lattice/pkg/approval"
+	"github.com/storo/lattice/pkg/knowledge"
+	"github.com/storo/lattice/pkg/memory"
+	"github.com/storo/lattice/pkg/protocol/mcp"
 	"github.com/storo/lattice/pkg/provider"
 	"github.com/storo/lattice/pkg/provider/anthropic"
 	"github.com/storo/lattice/pkg/provider/ollama"
@@ -69,7 +75,157 @@ func NewStore(cfg StorageConfig) (storage.Store, error) {
 		}
 		return storage.NewSQLiteStore(path)
 
+	case "postgres":
+		if cfg.DSN == "" {
+			return nil, fmt.Errorf("postgres storage requires dsn")
+		}
+		return storage.NewPostgresStore(cfg.DSN)
+
 	default:
 		return nil, fmt.Errorf("unknown storage type: %s", cfg.Type)
 	}
 }
+
+// NewMCPClient creates a client for an external MCP server from
+// configuration. The client connects on first use.
+func NewMCPClient(cfg MCPServerConfig, opts ...mcp.ClientOption) (*mcp.Client, error) {
+	if cfg.ToolPrefix != "" {
+		opts = append(opts, mcp.WithToolPrefix(cfg.ToolPrefix))
+	}
+
+	switch {
+	case cfg.Command != "" && cfg.URL != "":
+		return nil, fmt.Errorf("mcp server %s: set either command or url, not both", cfg.Name)
+
+	case cfg.Command != "":
+		keys := make([]string, 0, len(cfg.Env))
+		for k := range cfg.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			opts = append(opts, mcp.WithEnv(k+"="+os.ExpandEnv(cfg.Env[k])))
+		}
+		return mcp.NewStdioClient(cfg.Command, cfg.Args, opts...), nil
+
+	case cfg.URL != "":
+		for k, v := range cfg.Headers {
+			opts = append(opts, mcp.WithHeader(k, os.ExpandEnv(v)))
+		}
+		return mcp.NewHTTPClient(cfg.URL, opts...), nil
+
+	default:
+		return nil, fmt.Errorf("mcp server %s: command or url is required", cfg.Name)
+	}
+}
+
+// NewApprovalGate creates the approval gate for the configured rules,
+// keeping pending approvals in store. Returns nil when there are no rules.
+func NewApprovalGate(cfg ApprovalsConfig, store storage.Store) (*approval.Gate, error) {
+	if len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+
+	rules := make([]approval.Rule, len(cfg.Rules))
+	for i, r := range cfg.Rules {
+		rules[i] = approval.Rule{Tool: r.Tool, Param: r.Param, Match: r.Match, Reason: r.Reason}
+	}
+	policy, err := approval.NewPolicy(rules...)
+	if err != nil {
+		return nil, fmt.Errorf("approvals: %w", err)
+	}
+
+	var opts []approval.Option
+	if cfg.Timeout > 0 {
+		opts = append(opts, approval.WithTimeout(cfg.Timeout))
+	}
+	return approval.NewGate(policy, approval.NewQueue(store, opts...)), nil
+}
+
+// NewEmbedder creates an embedder from configuration.
+func NewEmbedder(cfg EmbedderConfig) (knowledge.Embedder, error) {
+	var opts []knowledge.EmbedderOption
+	if cfg.BaseURL != "" {
+		opts = append(opts, knowledge.WithEmbedBaseURL(cfg.BaseURL))
+	}
+	if cfg.Model != "" {
+		opts = append(opts, knowledge.WithEmbedModel(cfg.Model))
+	}
+	if cfg.APIKey != "" {
+		opts = append(opts, knowledge.WithEmbedAPIKey(os.ExpandEnv(cfg.APIKey)))
+	}
+
+	switch cfg.Type {
+	case "ollama", "":
+		return knowledge.NewOllamaEmbedder(opts...), nil
+
+	case "openai":
+		if cfg.APIKey == "" {
+			opts = append(opts, knowledge.WithEmbedAPIKey(os.Getenv("OPENAI_API_KEY")))
+		}
+		return knowledge.NewOpenAIEmbedder(opts...), nil
+
+	case "hash":
+		return knowledge.NewHashEmbedder(0), nil
+
+	default:
+		return nil, fmt.Errorf("unknown embedder type: %s", cfg.Type)
+	}
+}
+
+// NewKnowledgeBase creates the knowledge base from configuration. Sources
+// are not indexed; see knowledge.Base.Sync.
+func NewKnowledgeBase(cfg KnowledgeConfig) (*knowledge.Base, error) {
+	embedder, err := NewEmbedder(cfg.Embedder)
+	if err != nil {
+		return nil, fmt.Errorf("knowledge: %w", err)
+	}
+
+	var index knowledge.Index
+	switch cfg.Index {
+	case "memory", "":
+		index = knowledge.NewMemoryIndex()
+
+	case "sqlite":
+		path := cfg.Path
+		if path == "" {
+			path = "./knowledge.db"
+		}
+		index, err = knowledge.NewSQLiteIndex(path)
+		if err != nil {
+			return nil, fmt.Errorf("knowledge: %w", err)
+		}
+
+	default:
+		return nil, fmt.Errorf("knowledge: unknown index type: %s", cfg.Index)
+	}
+
+	// Documents embedded by another embedder are indexed again
+	opts := []knowledge.Option{knowledge.WithFingerprint(cfg.Embedder.Type + "|" + cfg.Embedder.BaseURL + "|" + cfg.Embedder.Model)}
+	if cfg.ChunkSize > 0 {
+		opts = append(opts, knowledge.WithChunkSize(cfg.ChunkSize))
+	}
+	if cfg.ChunkOverlap > 0 {
+		opts = append(opts, knowledge.WithChunkOverlap(cfg.ChunkOverlap))
+	}
+	return knowledge.New(index, embedder, opts...), nil
+}
+
+// NewMemoryStore creates the long-term memory store, keeping memories in
+// store.
+func NewMemoryStore(cfg MemoryConfig, store storage.Store) *memory.Store {
+	var opts []memory.Option
+	if cfg.TTL > 0 {
+		opts = append(opts, memory.WithTTL(cfg.TTL))
+	}
+	if cfg.HalfLife > 0 {
+		opts = append(opts, memory.WithHalfLife(cfg.HalfLife))
+	}
+	if cfg.Inject != 0 {
+		opts = append(opts, memory.WithInjectLimit(max(cfg.Inject, 0)))
+	}
+	if cfg.MaxPerUser > 0 {
+		opts = append(opts, memory.WithMaxPerScope(cfg.MaxPerUser))
+	}
+	return memory.New(store, opts...)
+}
@@ -10,6 +10,7 @@ const (
 	hopCountKey         contextKey = "lattice.hop_count"
 	traceIDKey          contextKey = "lattice.trace_id"
 	remainingTimeoutKey contextKey = "lattice.remaining_timeout"
+	userIDKey           contextKey = "lattice.user_id"
 )
 
 // CallChain returns the chain of agent IDs that have been called.
@@ -83,3 +84,18 @@ func RemainingTimeout(ctx context.Context) int64 {
 func WithRemainingTimeout(ctx context.Context, timeoutMs int64) context.Context {
 	return context.WithValue(ctx, remainingTimeoutKey, timeoutMs)
 }
+
+// UserID returns the ID of the end user a run is for.
+// Returns empty string if no user is set.
+func UserID(ctx context.Context) string {
+	if id, ok := ctx.Value(userIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// WithUserID sets the end user a run is for and returns a new context.
+// Agents with memory remember facts per user.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
@@ -137,3 +137,15 @@ func TestCallChain_DoesNotMutateOriginal(t *testing.T) {
 		t.Errorf("expected chain2 length 2, got %d", len(chain2))
 	}
 }
+
+func TestWithUserID_SetsUserID(t *testing.T) {
+	ctx := context.Background()
+	if id := UserID(ctx); id != "" {
+		t.Errorf("expected empty user ID, got %s", id)
+	}
+
+	ctx = WithUserID(ctx, "user-42")
+	if id := UserID(ctx); id != "user-42" {
+		t.Errorf("expected user-42, got %s", id)
+	}
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ExtractJSON finds the JSON value in a model reply. It accepts bare JSON,
+// JSON in a Markdown code fence, and JSON surrounded by prose.
+// Returns nil if no valid JSON is found.
+func ExtractJSON(content string) json.RawMessage {
+	content = strings.TrimSpace(content)
+
+	// Strip Markdown code fences
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```")
+		if nl := strings.IndexByte(content, '\n'); nl >= 0 {
+			content = content[nl+1:]
+		}
+		content = strings.TrimSuffix(strings.TrimSpace(content), "```")
+		content = strings.TrimSpace(content)
+	}
+
+	if json.Valid([]byte(content)) {
+		return json.RawMessage(content)
+	}
+
+	// Fall back to the outermost object or array
+	for _, pair := range [][2]string{{"{", "}"}, {"[", "]"}} {
+		start := strings.Index(content, pair[0])
+		end := strings.LastIndex(content, pair[1])
+		if start >= 0 && end > start {
+			candidate := content[start : end+1]
+			if json.Valid([]byte(candidate)) {
+				return json.RawMessage(candidate)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package core
+
+import "testing"
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"a": 1}`, `{"a": 1}`},
+		{"```json\n{\"a\": 1}\n```", `{"a": 1}`},
+		{`The answer is {"a": 1}.`, `{"a": 1}`},
+		{`["x", "y"]`, `["x", "y"]`},
+		{`no json here`, ``},
+	}
+
+	for _, tt := range tests {
+		got := ExtractJSON(tt.input)
+		if string(got) != tt.expected {
+			t.Errorf("ExtractJSON(%q) = %q, expected %q", tt.input, string(got), tt.expected)
+		}
+	}
+}
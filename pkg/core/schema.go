@@ -4,17 +4,28 @@ import (
 	"encoding/json"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // SchemaProperty represents a property in a JSON Schema.
 // Supports nested objects with their own properties.
+// An empty Type accepts any JSON value.
 type SchemaProperty struct {
-	Type        string                    `json:"type"`
-	Description string                    `json:"description,omitempty"`
-	Properties  map[string]SchemaProperty `json:"properties,omitempty"`
-	Required    []string                  `json:"required,omitempty"`
-	Items       *SchemaProperty           `json:"items,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Properties           map[string]SchemaProperty `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *SchemaProperty           `json:"items,omitempty"`
+	AdditionalProperties *SchemaProperty           `json:"additionalProperties,omitempty"`
+	Ref                  string                    `json:"$ref,omitempty"`
+	Enum                 []any                     `json:"enum,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	Default              any                       `json:"default,omitempty"`
 }
 
 // Schema represents a JSON Schema object.
@@ -22,6 +33,7 @@ type Schema struct {
 	Type       string                    `json:"type"`
 	Properties map[string]SchemaProperty `json:"properties,omitempty"`
 	Required   []string                  `json:"required,omitempty"`
+	Defs       map[string]SchemaProperty `json:"$defs,omitempty"`
 }
 
 // ToJSON converts the schema to json.RawMessage with sorted keys.
@@ -52,12 +64,26 @@ func (s *Schema) toOrderedMap() map[string]any {
 		result["required"] = s.Required
 	}
 
+	if len(s.Defs) > 0 {
+		defs := make(map[string]any)
+		for name, def := range s.Defs {
+			defs[name] = propToOrderedMap(def)
+		}
+		result["$defs"] = defs
+	}
+
 	return result
 }
 
 func propToOrderedMap(p SchemaProperty) map[string]any {
-	result := map[string]any{
-		"type": p.Type,
+	result := map[string]any{}
+
+	if p.Type != "" {
+		result["type"] = p.Type
+	}
+
+	if p.Ref != "" {
+		result["$ref"] = p.Ref
 	}
 
 	if p.Description != "" {
@@ -81,6 +107,34 @@ func propToOrderedMap(p SchemaProperty) map[string]any {
 		result["items"] = propToOrderedMap(*p.Items)
 	}
 
+	if p.AdditionalProperties != nil {
+		result["additionalProperties"] = propToOrderedMap(*p.AdditionalProperties)
+	}
+
+	if len(p.Enum) > 0 {
+		result["enum"] = p.Enum
+	}
+
+	if p.Format != "" {
+		result["format"] = p.Format
+	}
+
+	if p.Pattern != "" {
+		result["pattern"] = p.Pattern
+	}
+
+	if p.Minimum != nil {
+		result["minimum"] = *p.Minimum
+	}
+
+	if p.Maximum != nil {
+		result["maximum"] = *p.Maximum
+	}
+
+	if p.Default != nil {
+		result["default"] = p.Default
+	}
+
 	return result
 }
 
@@ -123,8 +177,23 @@ func (b *SchemaBuilder) Build() json.RawMessage {
 // SchemaFromStruct generates a JSON Schema from a Go struct using reflection.
 // It uses `json` tags for property names and `schema` tags for descriptions.
 // Fields without json tags or with json:"-" are ignored.
-// Fields with json:",omitempty" are not marked as required.
-// Nested structs are recursively processed.
+// Fields with json:",omitempty" and pointer fields are not marked as required.
+//
+// Nested structs, slices, arrays and maps are described recursively, and
+// time.Time becomes a "date-time" string. Recursive types are emitted once
+// under "$defs" and referenced with "$ref".
+//
+// These optional tags add constraints to a field (for slices and arrays
+// they apply to the items):
+//
+//	enum:"low,medium,high"  allowed values, comma separated
+//	minimum:"0"             lowest allowed number
+//	maximum:"100"           highest allowed number
+//	pattern:"^[a-z]+$"      regular expression strings must match
+//	format:"email"          string format
+//	default:"medium"        default value
+//
+// Tag values that cannot be parsed for the field's type are ignored.
 func SchemaFromStruct(v any) json.RawMessage {
 	t := reflect.TypeOf(v)
 	if t.Kind() == reflect.Ptr {
@@ -138,7 +207,7 @@ func SchemaFromStruct(v any) json.RawMessage {
 // generateSchemaForType creates a Schema from a reflect.Type.
 func generateSchemaForType(t reflect.Type) *Schema {
 	// Handle pointer types
-	if t.Kind() == reflect.Ptr {
+	for t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
 
@@ -152,13 +221,61 @@ func generateSchemaForType(t reflect.Type) *Schema {
 		return schema
 	}
 
+	g := newSchemaGenerator(t)
+	prop := g.structProperty(t)
+	schema.Properties = prop.Properties
+	schema.Required = prop.Required
+	if len(g.defs) > 0 {
+		schema.Defs = g.defs
+	}
+
+	return schema
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaGenerator tracks the struct types being described so that
+// recursive types can be turned into references.
+type schemaGenerator struct {
+	root       reflect.Type
+	inProgress map[reflect.Type]bool
+	names      map[reflect.Type]string
+	defs       map[string]SchemaProperty
+}
+
+func newSchemaGenerator(root reflect.Type) *schemaGenerator {
+	return &schemaGenerator{
+		root:       root,
+		inProgress: make(map[reflect.Type]bool),
+		names:      make(map[reflect.Type]string),
+		defs:       make(map[string]SchemaProperty),
+	}
+}
+
+// structProperty describes a struct type as an object property.
+func (g *schemaGenerator) structProperty(t reflect.Type) SchemaProperty {
+	// Already emitted under $defs, or recursing into a type we are still
+	// describing: reference it instead.
+	if _, ok := g.names[t]; ok || g.inProgress[t] {
+		return SchemaProperty{Ref: g.ref(t)}
+	}
+
+	g.inProgress[t] = true
+	defer delete(g.inProgress, t)
+
+	prop := SchemaProperty{
+		Type:       "object",
+		Properties: make(map[string]SchemaProperty),
+		Required:   []string{},
+	}
+
 	// Collect field names and sort them for deterministic order
 	type fieldInfo struct {
-		name       string
 		jsonName   string
-		options    string
-		fieldType  reflect.Type
-		desc       string
+		field      reflect.StructField
 		isRequired bool
 	}
 
@@ -179,17 +296,11 @@ func generateSchemaForType(t reflect.Type) *Schema {
 			continue
 		}
 
-		// Get description from schema tag
-		desc := field.Tag.Get("schema")
-
-		isRequired := !strings.Contains(options, "omitempty")
+		isRequired := !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr
 
 		fields = append(fields, fieldInfo{
-			name:       field.Name,
 			jsonName:   name,
-			options:    options,
-			fieldType:  field.Type,
-			desc:       desc,
+			field:      field,
 			isRequired: isRequired,
 		})
 	}
@@ -200,52 +311,176 @@ func generateSchemaForType(t reflect.Type) *Schema {
 	})
 
 	for _, f := range fields {
-		prop := generatePropertyForType(f.fieldType, f.desc)
-		schema.Properties[f.jsonName] = prop
+		prop.Properties[f.jsonName] = g.fieldProperty(f.field)
 
 		if f.isRequired {
-			schema.Required = append(schema.Required, f.jsonName)
+			prop.Required = append(prop.Required, f.jsonName)
 		}
 	}
 
-	// Required is already sorted because fields are sorted
-	return schema
+	// A reference back to this type was made while describing it
+	if name, ok := g.names[t]; ok && t != g.root {
+		g.defs[name] = prop
+	}
+
+	return prop
 }
 
-// generatePropertyForType creates a SchemaProperty for a reflect.Type.
-func generatePropertyForType(t reflect.Type, desc string) SchemaProperty {
+// fieldProperty describes a struct field, applying its description and
+// constraint tags.
+func (g *schemaGenerator) fieldProperty(field reflect.StructField) SchemaProperty {
+	prop := g.typeProperty(field.Type)
+	prop.Description = field.Tag.Get("schema")
+
+	t := field.Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if value, ok := field.Tag.Lookup("default"); ok {
+		if v, ok := parseTagValue(t, value); ok {
+			prop.Default = v
+		}
+	}
+
+	// Value constraints on a list apply to its items
+	target := &prop
+	if (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && prop.Items != nil {
+		target = prop.Items
+		t = t.Elem()
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+	applyConstraintTags(target, t, field.Tag)
+
+	return prop
+}
+
+// typeProperty describes a Go type.
+func (g *schemaGenerator) typeProperty(t reflect.Type) SchemaProperty {
 	// Handle pointer types
-	if t.Kind() == reflect.Ptr {
+	for t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
 
-	prop := SchemaProperty{
-		Type:        goTypeToJSONType(t),
-		Description: desc,
+	switch {
+	case t == timeType:
+		return SchemaProperty{Type: "string", Format: "date-time"}
+	case t == rawMessageType || t.Kind() == reflect.Interface:
+		// Any JSON value
+		return SchemaProperty{}
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Uint8:
+		// encoding/json encodes byte slices as base64 strings
+		return SchemaProperty{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return g.structProperty(t)
+	case reflect.Slice, reflect.Array:
+		items := g.typeProperty(t.Elem())
+		return SchemaProperty{Type: "array", Items: &items}
+	case reflect.Map:
+		values := g.typeProperty(t.Elem())
+		return SchemaProperty{Type: "object", AdditionalProperties: &values}
+	default:
+		return SchemaProperty{Type: goTypeToJSONType(t)}
+	}
+}
+
+// ref returns the $ref for a recursive type, registering it under $defs.
+func (g *schemaGenerator) ref(t reflect.Type) string {
+	if t == g.root {
+		return "#"
 	}
 
-	// Handle nested structs
-	if t.Kind() == reflect.Struct {
-		nestedSchema := generateSchemaForType(t)
-		prop.Properties = nestedSchema.Properties
-		prop.Required = nestedSchema.Required
+	name, ok := g.names[t]
+	if !ok {
+		name = g.defName(t)
+		g.names[t] = name
 	}
+	return "#/$defs/" + name
+}
 
-	// Handle slices/arrays of structs
-	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
-		elemType := t.Elem()
-		if elemType.Kind() == reflect.Ptr {
-			elemType = elemType.Elem()
+// defName picks a unique $defs name for a type.
+func (g *schemaGenerator) defName(t reflect.Type) string {
+	base := t.Name()
+	if base == "" {
+		base = "Type"
+	}
+
+	taken := func(name string) bool {
+		for _, n := range g.names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	name := base
+	for i := 2; taken(name); i++ {
+		name = base + strconv.Itoa(i)
+	}
+	return name
+}
+
+// applyConstraintTags sets enum, range, pattern and format constraints
+// from struct tags.
+func applyConstraintTags(prop *SchemaProperty, t reflect.Type, tag reflect.StructTag) {
+	if value, ok := tag.Lookup("enum"); ok {
+		for _, item := range strings.Split(value, ",") {
+			if v, ok := parseTagValue(t, strings.TrimSpace(item)); ok {
+				prop.Enum = append(prop.Enum, v)
+			}
 		}
-		if elemType.Kind() == reflect.Struct {
-			itemProp := generatePropertyForType(elemType, "")
-			prop.Items = &itemProp
-		} else {
-			prop.Items = &SchemaProperty{Type: goTypeToJSONType(elemType)}
+	}
+
+	if value, ok := tag.Lookup("minimum"); ok {
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			prop.Minimum = &n
 		}
 	}
 
-	return prop
+	if value, ok := tag.Lookup("maximum"); ok {
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			prop.Maximum = &n
+		}
+	}
+
+	if value, ok := tag.Lookup("pattern"); ok {
+		prop.Pattern = value
+	}
+
+	if value, ok := tag.Lookup("format"); ok {
+		prop.Format = value
+	}
+}
+
+// parseTagValue converts a tag value to the JSON value for type t.
+// Non-scalar types expect the value as JSON.
+func parseTagValue(t reflect.Type, value string) (any, bool) {
+	switch t.Kind() {
+	case reflect.String:
+		return value, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		return n, err == nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		return n, err == nil
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		return n, err == nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		return b, err == nil
+	default:
+		var v any
+		err := json.Unmarshal([]byte(value), &v)
+		return v, err == nil
+	}
 }
 
 // parseJSONTag parses a json tag into name and options.
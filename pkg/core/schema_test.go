@@ -2,7 +2,9 @@ package core
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSchemaFromStruct_BasicTypes(t *testing.T) {
@@ -318,3 +320,172 @@ func TestSchemaFromStruct_PointerToNestedStruct(t *testing.T) {
 		t.Error("expected config to have nested properties")
 	}
 }
+
+func TestSchemaFromStruct_TypedItemsAndMaps(t *testing.T) {
+	type Point struct {
+		X int `json:"x"`
+	}
+	type TestStruct struct {
+		Points  []Point          `json:"points"`
+		Matrix  [][]float64      `json:"matrix"`
+		Counts  map[string]int   `json:"counts"`
+		Nested  map[string]Point `json:"nested"`
+		Raw     json.RawMessage  `json:"raw"`
+		Payload []byte           `json:"payload"`
+	}
+
+	var parsed Schema
+	if err := json.Unmarshal(SchemaFromStruct(TestStruct{}), &parsed); err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+
+	points := parsed.Properties["points"]
+	if points.Items == nil || points.Items.Properties["x"].Type != "integer" {
+		t.Errorf("expected points items to describe Point, got %+v", points.Items)
+	}
+
+	matrix := parsed.Properties["matrix"]
+	if matrix.Items == nil || matrix.Items.Items == nil || matrix.Items.Items.Type != "number" {
+		t.Errorf("expected matrix of numbers, got %+v", matrix)
+	}
+
+	counts := parsed.Properties["counts"]
+	if counts.AdditionalProperties == nil || counts.AdditionalProperties.Type != "integer" {
+		t.Errorf("expected integer map values, got %+v", counts.AdditionalProperties)
+	}
+
+	nested := parsed.Properties["nested"]
+	if nested.AdditionalProperties == nil || nested.AdditionalProperties.Type != "object" {
+		t.Errorf("expected object map values, got %+v", nested.AdditionalProperties)
+	}
+
+	if raw := parsed.Properties["raw"]; raw.Type != "" {
+		t.Errorf("expected raw to accept any value, got type %s", raw.Type)
+	}
+	if payload := parsed.Properties["payload"]; payload.Type != "string" {
+		t.Errorf("expected payload type string, got %s", payload.Type)
+	}
+}
+
+func TestSchemaFromStruct_TimeAndPointers(t *testing.T) {
+	type TestStruct struct {
+		Created time.Time  `json:"created"`
+		Expires *time.Time `json:"expires"`
+		Limit   *int       `json:"limit"`
+	}
+
+	var parsed Schema
+	if err := json.Unmarshal(SchemaFromStruct(TestStruct{}), &parsed); err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+
+	created := parsed.Properties["created"]
+	if created.Type != "string" || created.Format != "date-time" {
+		t.Errorf("expected date-time string, got %+v", created)
+	}
+
+	if len(parsed.Required) != 1 || parsed.Required[0] != "created" {
+		t.Errorf("expected only created to be required, got %v", parsed.Required)
+	}
+}
+
+func TestSchemaFromStruct_ConstraintTags(t *testing.T) {
+	type TestStruct struct {
+		Priority string   `json:"priority" enum:"low,medium,high" default:"medium"`
+		Level    int      `json:"level" enum:"1,2,3"`
+		Score    float64  `json:"score" minimum:"0" maximum:"1.5"`
+		Code     string   `json:"code" pattern:"^[A-Z]{3}$"`
+		Email    string   `json:"email" format:"email"`
+		Tags     []string `json:"tags" enum:"a,b"`
+		Bad      int      `json:"bad" minimum:"abc"`
+	}
+
+	var parsed Schema
+	if err := json.Unmarshal(SchemaFromStruct(TestStruct{}), &parsed); err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+
+	priority := parsed.Properties["priority"]
+	if len(priority.Enum) != 3 || priority.Enum[1] != "medium" || priority.Default != "medium" {
+		t.Errorf("unexpected priority schema: %+v", priority)
+	}
+
+	level := parsed.Properties["level"]
+	if len(level.Enum) != 3 || level.Enum[0] != float64(1) {
+		t.Errorf("expected numeric enum for level, got %v", level.Enum)
+	}
+
+	score := parsed.Properties["score"]
+	if score.Minimum == nil || *score.Minimum != 0 || score.Maximum == nil || *score.Maximum != 1.5 {
+		t.Errorf("unexpected score range: %+v", score)
+	}
+
+	if code := parsed.Properties["code"]; code.Pattern != "^[A-Z]{3}$" {
+		t.Errorf("unexpected code pattern: %q", code.Pattern)
+	}
+	if email := parsed.Properties["email"]; email.Format != "email" {
+		t.Errorf("unexpected email format: %q", email.Format)
+	}
+
+	tags := parsed.Properties["tags"]
+	if len(tags.Enum) != 0 || tags.Items == nil || len(tags.Items.Enum) != 2 {
+		t.Errorf("expected enum on tag items, got %+v", tags)
+	}
+
+	if bad := parsed.Properties["bad"]; bad.Minimum != nil {
+		t.Errorf("expected invalid minimum to be ignored, got %v", *bad.Minimum)
+	}
+}
+
+type treeNode struct {
+	Name     string      `json:"name"`
+	Children []*treeNode `json:"children,omitempty"`
+	Meta     *treeMeta   `json:"meta,omitempty"`
+}
+
+type treeMeta struct {
+	Owner *treeNode  `json:"owner,omitempty"`
+	Links []treeLink `json:"links,omitempty"`
+}
+
+type treeLink struct {
+	Next *treeLink `json:"next,omitempty"`
+}
+
+func TestSchemaFromStruct_RecursiveTypes(t *testing.T) {
+	schema := SchemaFromStruct(treeNode{})
+
+	var parsed Schema
+	if err := json.Unmarshal(schema, &parsed); err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+
+	children := parsed.Properties["children"]
+	if children.Items == nil || children.Items.Ref != "#" {
+		t.Errorf("expected children to reference the root, got %+v", children.Items)
+	}
+
+	meta := parsed.Properties["meta"]
+	if meta.Properties["owner"].Ref != "#" {
+		t.Errorf("expected owner to reference the root, got %+v", meta.Properties["owner"])
+	}
+
+	link, ok := parsed.Defs["treeLink"]
+	if !ok {
+		t.Fatalf("expected treeLink in $defs, got %v", parsed.Defs)
+	}
+	if link.Properties["next"].Ref != "#/$defs/treeLink" {
+		t.Errorf("expected next to reference treeLink, got %+v", link.Properties["next"])
+	}
+
+	valid := `{"name":"a","children":[{"name":"b","meta":{"links":[{"next":{"next":{}}}]}}]}`
+	if err := ValidateJSON(schema, json.RawMessage(valid)); err != nil {
+		t.Errorf("expected recursive value to validate, got %v", err)
+	}
+
+	invalid := `{"name":"a","children":[{"name":1}]}`
+	err := ValidateJSON(schema, json.RawMessage(invalid))
+	if err == nil || !strings.Contains(err.Error(), "$.children[0].name: expected string") {
+		t.Errorf("expected nested validation error, got %v", err)
+	}
+}
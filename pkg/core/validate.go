@@ -0,0 +1,456 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError reports every way a value fails to match a JSON Schema.
+type ValidationError struct {
+	// Errors lists the problems found, each prefixed with the JSON path
+	// of the offending value (e.g. "$.items[2].name: expected string").
+	Errors []string
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return "schema validation failed: " + strings.Join(e.Errors, "; ")
+}
+
+// ValidateJSON validates a JSON document against a JSON Schema.
+// Returns a *ValidationError if the document does not match.
+func ValidateJSON(schema, data json.RawMessage) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return &ValidationError{Errors: []string{"$: invalid JSON: " + err.Error()}}
+	}
+
+	return ValidateValue(schema, value)
+}
+
+// ValidateValue validates an already decoded JSON value (as produced by
+// encoding/json into an any) against a JSON Schema.
+func ValidateValue(schema json.RawMessage, value any) error {
+	var s map[string]any
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+
+	v := &validator{root: s}
+	v.validate(s, value, "$")
+
+	if len(v.errors) > 0 {
+		return &ValidationError{Errors: v.errors}
+	}
+	return nil
+}
+
+// maxRefDepth bounds the $ref hops made without descending into the value,
+// so that a schema which refers to itself without consuming any of the
+// value cannot recurse forever. Recursion that descends always ends.
+const maxRefDepth = 64
+
+// validator walks a schema and a value together, collecting errors.
+type validator struct {
+	root     map[string]any
+	refDepth int
+	errors   []string
+}
+
+func (v *validator) addError(path, format string, args ...any) {
+	v.errors = append(v.errors, path+": "+fmt.Sprintf(format, args...))
+}
+
+// validate checks value against schema s.
+func (v *validator) validate(s map[string]any, value any, path string) {
+	if ref, ok := s["$ref"].(string); ok {
+		v.validateRef(ref, value, path)
+	}
+
+	if types := schemaTypes(s); len(types) > 0 {
+		if !matchesAnyType(types, value) {
+			v.addError(path, "expected %s, got %s", strings.Join(types, " or "), jsonTypeOf(value))
+			return
+		}
+	}
+
+	if enum, ok := s["enum"].([]any); ok {
+		if !containsValue(enum, value) {
+			v.addError(path, "must be one of %s", formatValues(enum))
+		}
+	}
+
+	if c, ok := s["const"]; ok && !jsonEqual(c, value) {
+		v.addError(path, "must be %s", formatValues([]any{c}))
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		v.validateObject(s, val, path)
+	case []any:
+		v.validateArray(s, val, path)
+	case string:
+		v.validateString(s, val, path)
+	case json.Number, float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		v.validateNumber(s, numberValue(val), path)
+	}
+}
+
+// validateRef validates value against the schema a $ref points to.
+func (v *validator) validateRef(ref string, value any, path string) {
+	target, ok := resolveRef(v.root, ref)
+	if !ok {
+		v.addError(path, "unresolvable $ref %q in schema", ref)
+		return
+	}
+
+	if v.refDepth >= maxRefDepth {
+		v.addError(path, "$ref %q nested too deeply", ref)
+		return
+	}
+
+	v.refDepth++
+	v.validate(target, value, path)
+	v.refDepth--
+}
+
+// validateChild validates a property or item of the value. It starts a new
+// count of $ref hops.
+func (v *validator) validateChild(s map[string]any, value any, path string) {
+	depth := v.refDepth
+	v.refDepth = 0
+	v.validate(s, value, path)
+	v.refDepth = depth
+}
+
+// resolveRef resolves a local reference ("#" or a JSON pointer such as
+// "#/$defs/Node") against the root schema.
+func resolveRef(root map[string]any, ref string) (map[string]any, bool) {
+	if ref == "#" {
+		return root, true
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, false
+	}
+
+	current := root
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		next, ok := current[token].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+// validateString checks length and pattern constraints.
+func (v *validator) validateString(s map[string]any, str string, path string) {
+	length := utf8.RuneCountInString(str)
+
+	if min, ok := schemaNumber(s, "minLength"); ok && float64(length) < min {
+		v.addError(path, "must be at least %s characters", formatNumber(min))
+	}
+	if max, ok := schemaNumber(s, "maxLength"); ok && float64(length) > max {
+		v.addError(path, "must be at most %s characters", formatNumber(max))
+	}
+
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			v.addError(path, "invalid pattern %q in schema", pattern)
+		} else if !re.MatchString(str) {
+			v.addError(path, "must match pattern %q", pattern)
+		}
+	}
+}
+
+// validateNumber checks range constraints.
+func (v *validator) validateNumber(s map[string]any, n float64, path string) {
+	if min, ok := schemaNumber(s, "minimum"); ok && n < min {
+		v.addError(path, "must be >= %s", formatNumber(min))
+	}
+	if max, ok := schemaNumber(s, "maximum"); ok && n > max {
+		v.addError(path, "must be <= %s", formatNumber(max))
+	}
+	if min, ok := schemaNumber(s, "exclusiveMinimum"); ok && n <= min {
+		v.addError(path, "must be > %s", formatNumber(min))
+	}
+	if max, ok := schemaNumber(s, "exclusiveMaximum"); ok && n >= max {
+		v.addError(path, "must be < %s", formatNumber(max))
+	}
+	if m, ok := schemaNumber(s, "multipleOf"); ok && m > 0 {
+		if q := n / m; q != math.Trunc(q) {
+			v.addError(path, "must be a multiple of %s", formatNumber(m))
+		}
+	}
+}
+
+// validateObject checks required fields, property schemas and
+// additional properties.
+func (v *validator) validateObject(s map[string]any, obj map[string]any, path string) {
+	if required, ok := s["required"].([]any); ok {
+		for _, r := range required {
+			name, ok := r.(string)
+			if !ok {
+				continue
+			}
+			if _, exists := obj[name]; !exists {
+				v.addError(path, "missing required field %q", name)
+			}
+		}
+	}
+
+	props, _ := s["properties"].(map[string]any)
+
+	// Walk keys in sorted order for deterministic error messages
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if propSchema, ok := props[k].(map[string]any); ok {
+			v.validateChild(propSchema, obj[k], path+"."+k)
+			continue
+		}
+
+		// Not a declared property: check additionalProperties
+		switch additional := s["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.addError(path, "unexpected property %q", k)
+			}
+		case map[string]any:
+			v.validateChild(additional, obj[k], path+"."+k)
+		}
+	}
+
+	if min, ok := schemaNumber(s, "minProperties"); ok && float64(len(obj)) < min {
+		v.addError(path, "must have at least %s properties", formatNumber(min))
+	}
+	if max, ok := schemaNumber(s, "maxProperties"); ok && float64(len(obj)) > max {
+		v.addError(path, "must have at most %s properties", formatNumber(max))
+	}
+}
+
+// validateArray checks item schemas, length and uniqueness.
+func (v *validator) validateArray(s map[string]any, arr []any, path string) {
+	if min, ok := schemaNumber(s, "minItems"); ok && float64(len(arr)) < min {
+		v.addError(path, "must have at least %s items", formatNumber(min))
+	}
+	if max, ok := schemaNumber(s, "maxItems"); ok && float64(len(arr)) > max {
+		v.addError(path, "must have at most %s items", formatNumber(max))
+	}
+
+	if unique, _ := s["uniqueItems"].(bool); unique {
+		for i := 1; i < len(arr); i++ {
+			if containsValue(arr[:i], arr[i]) {
+				v.addError(fmt.Sprintf("%s[%d]", path, i), "duplicate item")
+			}
+		}
+	}
+
+	items, ok := s["items"].(map[string]any)
+	if !ok {
+		return
+	}
+	for i, item := range arr {
+		v.validateChild(items, item, fmt.Sprintf("%s[%d]", path, i))
+	}
+}
+
+// schemaNumber reads a numeric keyword from a schema.
+func schemaNumber(s map[string]any, key string) (float64, bool) {
+	n, ok := s[key].(float64)
+	return n, ok
+}
+
+// formatNumber formats a number without a trailing ".0".
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// formatValues renders values as a JSON list for error messages.
+func formatValues(values []any) string {
+	parts := make([]string, len(values))
+	for i, val := range values {
+		data, _ := json.Marshal(val)
+		parts[i] = string(data)
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// containsValue reports whether values contains a value equal to target.
+func containsValue(values []any, target any) bool {
+	for _, val := range values {
+		if jsonEqual(val, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonEqual compares two decoded JSON values. Numbers compare by value
+// regardless of their Go representation.
+func jsonEqual(a, b any) bool {
+	if isNumber(a) && isNumber(b) {
+		return numberValue(a) == numberValue(b)
+	}
+
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, val := range av {
+			other, exists := bv[k]
+			if !exists || !jsonEqual(val, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+// isNumber reports whether a decoded value is numeric.
+func isNumber(value any) bool {
+	switch value.(type) {
+	case json.Number, float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	}
+	return false
+}
+
+// numberValue converts a decoded numeric value to float64.
+func numberValue(value any) float64 {
+	switch n := value.(type) {
+	case json.Number:
+		f, _ := n.Float64()
+		return f
+	case float64:
+		return n
+	}
+	return toFloat(value)
+}
+
+// schemaTypes returns the allowed types of a schema ("type" may be a
+// string or an array of strings).
+func schemaTypes(s map[string]any) []string {
+	switch t := s["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, item := range t {
+			if str, ok := item.(string); ok {
+				types = append(types, str)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// matchesAnyType reports whether value is one of the given JSON types.
+func matchesAnyType(types []string, value any) bool {
+	actual := jsonTypeOf(value)
+	for _, t := range types {
+		if t == actual {
+			return true
+		}
+		if t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTypeOf returns the JSON Schema type name of a decoded value.
+// Whole numbers are reported as "integer".
+func jsonTypeOf(value any) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := val.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	case float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return jsonTypeOf(toFloat(val))
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// toFloat converts Go numeric types to float64.
+func toFloat(value any) float64 {
+	switch n := value.(type) {
+	case float32:
+		return float64(n)
+	case int:
+		return float64(n)
+	case int8:
+		return float64(n)
+	case int16:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint:
+		return float64(n)
+	case uint8:
+		return float64(n)
+	case uint16:
+		return float64(n)
+	case uint32:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	}
+	return 0
+}
@@ -0,0 +1,233 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateJSON_Valid(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"age": {"type": "integer"},
+			"score": {"type": "number"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"address": {
+				"type": "object",
+				"properties": {"city": {"type": "string"}},
+				"required": ["city"]
+			}
+		},
+		"required": ["name", "age"]
+	}`)
+
+	data := json.RawMessage(`{"name": "Ada", "age": 36, "score": 9.5, "tags": ["math"], "address": {"city": "London"}}`)
+
+	if err := ValidateJSON(schema, data); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateJSON_Errors(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"age": {"type": "integer"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"address": {
+				"type": "object",
+				"properties": {"city": {"type": "string"}},
+				"required": ["city"]
+			}
+		},
+		"required": ["name", "age"]
+	}`)
+
+	data := json.RawMessage(`{"age": 36.5, "tags": ["ok", 3], "address": {}}`)
+
+	err := ValidateJSON(schema, data)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+
+	expected := []string{
+		`$: missing required field "name"`,
+		`$.address: missing required field "city"`,
+		`$.age: expected integer, got number`,
+		`$.tags[1]: expected string, got integer`,
+	}
+	if len(verr.Errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), verr.Errors)
+	}
+	for i, e := range expected {
+		if verr.Errors[i] != e {
+			t.Errorf("error %d: expected %q, got %q", i, e, verr.Errors[i])
+		}
+	}
+}
+
+func TestValidateJSON_InvalidJSON(t *testing.T) {
+	err := ValidateJSON(json.RawMessage(`{"type": "object"}`), json.RawMessage(`{not json`))
+	if err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Errorf("expected invalid JSON error, got %v", err)
+	}
+}
+
+func TestValidateJSON_TypeUnion(t *testing.T) {
+	schema := json.RawMessage(`{"type": ["string", "null"]}`)
+
+	if err := ValidateJSON(schema, json.RawMessage(`null`)); err != nil {
+		t.Errorf("expected null to be valid: %v", err)
+	}
+	if err := ValidateJSON(schema, json.RawMessage(`"x"`)); err != nil {
+		t.Errorf("expected string to be valid: %v", err)
+	}
+	if err := ValidateJSON(schema, json.RawMessage(`1`)); err == nil {
+		t.Error("expected number to be invalid")
+	}
+}
+
+func TestValidateValue_DecodedMap(t *testing.T) {
+	schema := json.RawMessage(`{"type": "object", "properties": {"count": {"type": "integer"}}}`)
+
+	// Values decoded without UseNumber are float64
+	if err := ValidateValue(schema, map[string]any{"count": float64(3)}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ValidateValue(schema, map[string]any{"count": "3"}); err == nil {
+		t.Error("expected error for string count")
+	}
+}
+
+func TestValidateJSON_Constraints(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"method": {"type": "string", "enum": ["GET", "POST"]},
+			"count": {"type": "integer", "minimum": 1, "maximum": 10},
+			"ratio": {"type": "number", "exclusiveMinimum": 0, "exclusiveMaximum": 1},
+			"step": {"type": "integer", "multipleOf": 5},
+			"code": {"type": "string", "pattern": "^[A-Z]{3}$", "minLength": 3, "maxLength": 3},
+			"tags": {"type": "array", "items": {"type": "string"}, "minItems": 1, "maxItems": 2, "uniqueItems": true},
+			"kind": {"const": "fixed"},
+			"headers": {"type": "object", "additionalProperties": {"type": "string"}}
+		},
+		"additionalProperties": false
+	}`)
+
+	valid := json.RawMessage(`{
+		"method": "GET", "count": 10, "ratio": 0.5, "step": 15, "code": "ABC",
+		"tags": ["a", "b"], "kind": "fixed", "headers": {"Accept": "text/html"}
+	}`)
+	if err := ValidateJSON(schema, valid); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := json.RawMessage(`{
+		"method": "DELETE", "count": 0, "ratio": 1, "step": 7, "code": "abcd",
+		"tags": ["a", "a", "b"], "kind": "other", "headers": {"X-Num": 1}, "extra": true
+	}`)
+
+	err := ValidateJSON(schema, invalid)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+
+	expected := []string{
+		`$.code: must be at most 3 characters`,
+		`$.code: must match pattern "^[A-Z]{3}$"`,
+		`$.count: must be >= 1`,
+		`$: unexpected property "extra"`,
+		`$.headers.X-Num: expected string, got integer`,
+		`$.kind: must be "fixed"`,
+		`$.method: must be one of ["GET", "POST"]`,
+		`$.ratio: must be < 1`,
+		`$.step: must be a multiple of 5`,
+		`$.tags: must have at most 2 items`,
+		`$.tags[1]: duplicate item`,
+	}
+	if len(verr.Errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(verr.Errors), verr.Errors)
+	}
+	for i, e := range expected {
+		if verr.Errors[i] != e {
+			t.Errorf("error %d: expected %q, got %q", i, e, verr.Errors[i])
+		}
+	}
+}
+
+func TestValidateJSON_EnumNumbers(t *testing.T) {
+	schema := json.RawMessage(`{"enum": [1, 2, 3]}`)
+
+	if err := ValidateJSON(schema, json.RawMessage(`2`)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ValidateJSON(schema, json.RawMessage(`2.0`)); err != nil {
+		t.Errorf("expected 2.0 to equal 2: %v", err)
+	}
+	if err := ValidateJSON(schema, json.RawMessage(`4`)); err == nil {
+		t.Error("expected error for 4")
+	}
+}
+
+func TestValidateJSON_Ref(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"properties": {"item": {"$ref": "#/$defs/item"}},
+		"$defs": {"item": {"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}}}}
+	}`)
+
+	if err := ValidateJSON(schema, json.RawMessage(`{"item":{"id":1}}`)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err := ValidateJSON(schema, json.RawMessage(`{"item":{}}`))
+	if err == nil || !strings.Contains(err.Error(), `$.item: missing required field "id"`) {
+		t.Errorf("expected missing field error, got %v", err)
+	}
+
+	broken := json.RawMessage(`{"properties": {"a": {"$ref": "#/$defs/missing"}}}`)
+	err = ValidateJSON(broken, json.RawMessage(`{"a":1}`))
+	if err == nil || !strings.Contains(err.Error(), "unresolvable $ref") {
+		t.Errorf("expected unresolvable ref error, got %v", err)
+	}
+
+	loop := json.RawMessage(`{"$ref": "#"}`)
+	if err := ValidateJSON(loop, json.RawMessage(`1`)); err == nil {
+		t.Error("expected self-referencing schema to fail")
+	}
+}
+
+func TestValidateJSON_DeepRecursiveRef(t *testing.T) {
+	schema := json.RawMessage(`{
+		"$ref": "#/$defs/node",
+		"$defs": {"node": {
+			"type": "object",
+			"required": ["name"],
+			"properties": {
+				"name": {"type": "string"},
+				"children": {"type": "array", "items": {"$ref": "#/$defs/node"}}
+			}
+		}}
+	}`)
+
+	// A tree 200 levels deep, well past maxRefDepth
+	value := `{"name":"leaf"}`
+	for range 200 {
+		value = `{"name":"n","children":[` + value + `]}`
+	}
+	if err := ValidateJSON(schema, json.RawMessage(value)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := strings.Replace(value, `"leaf"`, `1`, 1)
+	if err := ValidateJSON(schema, json.RawMessage(invalid)); err == nil || !strings.Contains(err.Error(), "expected string") {
+		t.Errorf("expected a type error deep in the tree, got %v", err)
+	}
+}
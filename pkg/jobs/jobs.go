@@ -0,0 +1,405 @@
+// Package jobs runs agent tasks asynchronously. Jobs are kept in a
+// storage.AtomicStore, so they survive restarts and can be picked up by any
+// replica sharing the store.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/storage"
+	"github.com/storo/lattice/pkg/tool/builtin"
+)
+
+// Job errors
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job already finished")
+	ErrCancelled   = errors.New("job cancelled")
+
+	errLeaseLost = errors.New("job lease held by another worker")
+)
+
+// Status is the state of a job.
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Finished reports whether the status is final.
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCancelled
+}
+
+// Job is an asynchronous agent run.
+type Job struct {
+	ID string `json:"id"`
+
+	// AgentID is the agent to run. Empty lets the mesh choose.
+	AgentID string `json:"agent_id,omitempty"`
+
+	// Input is the task for the agent.
+	Input string `json:"input"`
+
+	// UserID is the end user the job runs for (see core.WithUserID).
+	UserID string `json:"user_id,omitempty"`
+
+	// Owner is the caller that submitted the job, such as the API key
+	// of an authenticated HTTP request.
+	Owner string `json:"owner,omitempty"`
+
+	// Webhook is called with the job when it finishes.
+	Webhook string `json:"webhook,omitempty"`
+
+	Status          Status `json:"status"`
+	CancelRequested bool   `json:"cancel_requested,omitempty"`
+	Attempts        int    `json:"attempts,omitempty"`
+
+	Output    string `json:"output,omitempty"`
+	Error     string `json:"error,omitempty"`
+	TokensIn  int    `json:"tokens_in,omitempty"`
+	TokensOut int    `json:"tokens_out,omitempty"`
+	TraceID   string `json:"trace_id,omitempty"`
+
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+// Runner executes a job.
+type Runner func(ctx context.Context, job *Job) (*core.Result, error)
+
+// Key prefixes
+const (
+	jobKeyPrefix     = "jobs:job:"
+	leaseKeyPrefix   = "jobs:lease:"
+	cancelKeyPrefix  = "jobs:cancel:"
+	pendingKeyPrefix = "jobs:pending:"
+)
+
+// pendingKey is the key indexing an unfinished job. Keys sort by
+// submission time, so workers take the oldest jobs first.
+func pendingKey(job *Job) string {
+	return fmt.Sprintf("%s%020d:%s", pendingKeyPrefix, job.CreatedAt.UnixNano(), job.ID)
+}
+
+// Defaults
+const (
+	DefaultWorkers      = 4
+	DefaultPollInterval = time.Second
+	DefaultLeaseTTL     = 30 * time.Second
+	DefaultMaxAttempts  = 3
+	DefaultJobTTL       = 24 * time.Hour
+)
+
+// Queue stores jobs and runs them on a pool of workers.
+type Queue struct {
+	store  storage.AtomicStore
+	runner Runner
+
+	workerID      string
+	workers       int
+	pollInterval  time.Duration
+	leaseTTL      time.Duration
+	maxAttempts   int
+	jobTTL        time.Duration
+	webhookPolicy *builtin.EgressPolicy
+	webhookClient *http.Client
+	webhookSecret string
+
+	wake    chan struct{}
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+	wg      sync.WaitGroup
+	stop    context.CancelFunc
+}
+
+// Option configures a Queue.
+type Option func(*Queue)
+
+// NewQueue creates a job queue. Call Start to run workers. Workers claim
+// jobs with the store's atomic operations, so that a job runs on one
+// worker at a time.
+func NewQueue(store storage.AtomicStore, runner Runner, opts ...Option) *Queue {
+	q := &Queue{
+		store:         store,
+		runner:        runner,
+		workerID:      uuid.New().String(),
+		workers:       DefaultWorkers,
+		pollInterval:  DefaultPollInterval,
+		leaseTTL:      DefaultLeaseTTL,
+		maxAttempts:   DefaultMaxAttempts,
+		jobTTL:        DefaultJobTTL,
+		webhookPolicy: builtin.NewEgressPolicy(builtin.WithAllowedMethods(http.MethodPost)),
+		wake:          make(chan struct{}, 1),
+		running:       make(map[string]context.CancelFunc),
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	if q.webhookClient == nil {
+		q.webhookClient = q.webhookPolicy.Client(10 * time.Second)
+	}
+
+	return q
+}
+
+// WithWorkers sets the number of concurrent jobs per process.
+func WithWorkers(n int) Option {
+	return func(q *Queue) {
+		q.workers = n
+	}
+}
+
+// WithPollInterval sets how often workers look for jobs submitted by
+// other replicas and for cancellations.
+func WithPollInterval(d time.Duration) Option {
+	return func(q *Queue) {
+		q.pollInterval = d
+	}
+}
+
+// WithLeaseTTL sets how long a worker's claim on a job lasts without a
+// heartbeat. Jobs of workers that die are picked up after it expires.
+func WithLeaseTTL(d time.Duration) Option {
+	return func(q *Queue) {
+		q.leaseTTL = d
+	}
+}
+
+// WithMaxAttempts sets how many times a job is started before it is
+// failed, when its workers keep disappearing.
+func WithMaxAttempts(n int) Option {
+	return func(q *Queue) {
+		q.maxAttempts = n
+	}
+}
+
+// WithJobTTL sets how long finished jobs are kept (0 keeps them forever).
+func WithJobTTL(d time.Duration) Option {
+	return func(q *Queue) {
+		q.jobTTL = d
+	}
+}
+
+// WithWebhookPolicy sets the egress policy webhooks must pass, both when a
+// job is submitted and when its webhook is called. By default webhooks may
+// only reach public addresses.
+func WithWebhookPolicy(p *builtin.EgressPolicy) Option {
+	return func(q *Queue) {
+		q.webhookPolicy = p
+	}
+}
+
+// WithWebhookClient sets the HTTP client used for webhooks, in place of
+// one enforcing the webhook policy on every connection.
+func WithWebhookClient(c *http.Client) Option {
+	return func(q *Queue) {
+		q.webhookClient = c
+	}
+}
+
+// WithWebhookSecret signs webhook bodies with HMAC-SHA256 in the
+// X-Lattice-Signature header.
+func WithWebhookSecret(secret string) Option {
+	return func(q *Queue) {
+		q.webhookSecret = secret
+	}
+}
+
+// Submit queues a job and returns it with its ID and status set.
+func (q *Queue) Submit(ctx context.Context, job *Job) (*Job, error) {
+	if job.Webhook != "" {
+		if err := q.validateWebhook(job.Webhook); err != nil {
+			return nil, err
+		}
+	}
+
+	submitted := &Job{
+		ID:        uuid.New().String(),
+		AgentID:   job.AgentID,
+		Input:     job.Input,
+		UserID:    job.UserID,
+		Owner:     job.Owner,
+		Webhook:   job.Webhook,
+		Status:    StatusQueued,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	data, err := json.Marshal(submitted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job: %w", err)
+	}
+	if err := q.store.MSet(ctx, map[string][]byte{
+		jobKeyPrefix + submitted.ID: data,
+		pendingKey(submitted):       []byte(submitted.ID),
+	}, 0); err != nil {
+		return nil, err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return submitted, nil
+}
+
+// Get returns a job by ID.
+func (q *Queue) Get(ctx context.Context, id string) (*Job, error) {
+	data, err := q.store.Get(ctx, jobKeyPrefix+id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+		}
+		return nil, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// List returns all jobs, oldest first.
+func (q *Queue) List(ctx context.Context) ([]*Job, error) {
+	keys, err := q.store.Keys(ctx, jobKeyPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(keys))
+	for _, key := range keys {
+		job, err := q.Get(ctx, strings.TrimPrefix(key, jobKeyPrefix))
+		if err != nil {
+			// Expired between Keys and Get
+			if errors.Is(err, ErrJobNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// Cancel stops a job. A queued job is cancelled at once; a running job
+// stops within the poll interval, on whichever replica runs it.
+func (q *Queue) Cancel(ctx context.Context, id string) (*Job, error) {
+	jobKey, leaseKey, cancelKey := jobKeyPrefix+id, leaseKeyPrefix+id, cancelKeyPrefix+id
+
+	// The update is dropped and retried if a worker claims or finishes the
+	// job meanwhile, so a finished job is never rewritten
+	var job Job
+	err := q.store.Txn(ctx, []string{jobKey, leaseKey}, func(tx *storage.Tx) error {
+		data, err := tx.Get(jobKey)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return fmt.Errorf("%w: %s", ErrJobNotFound, id)
+			}
+			return err
+		}
+		job = Job{}
+		if err := json.Unmarshal(data, &job); err != nil {
+			return fmt.Errorf("failed to decode job %s: %w", id, err)
+		}
+		if job.Status.Finished() {
+			return fmt.Errorf("%w: %s", ErrJobFinished, id)
+		}
+
+		// Nobody has claimed a queued job: finish it here
+		if _, err := tx.Get(leaseKey); job.Status == StatusQueued && errors.Is(err, storage.ErrNotFound) {
+			job.Status = StatusCancelled
+			job.FinishedAt = time.Now().UTC()
+			data, err := json.Marshal(&job)
+			if err != nil {
+				return fmt.Errorf("failed to encode job: %w", err)
+			}
+			tx.Set(jobKey, data, q.jobTTL)
+			tx.Delete(pendingKey(&job))
+			return nil
+		}
+
+		job.CancelRequested = true
+		data, err = json.Marshal(&job)
+		if err != nil {
+			return fmt.Errorf("failed to encode job: %w", err)
+		}
+		tx.Set(jobKey, data, 0)
+		tx.Set(cancelKey, []byte("1"), q.jobTTL)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrJobFinished) {
+			return &job, err
+		}
+		return nil, err
+	}
+
+	// Stop it right away if it runs here
+	q.mu.Lock()
+	cancel := q.running[id]
+	q.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+
+	return &job, nil
+}
+
+// save stores a job without expiry.
+func (q *Queue) save(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	return q.store.Set(ctx, jobKeyPrefix+job.ID, data, 0)
+}
+
+// saveFinished stores a finished job with the retention TTL and removes
+// its index, lease and cancellation keys, all at once. Nothing is written,
+// and errLeaseLost returned, if another worker holds the job's lease.
+func (q *Queue) saveFinished(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	leaseKey := leaseKeyPrefix + job.ID
+	return q.store.Txn(ctx, []string{leaseKey}, func(tx *storage.Tx) error {
+		owner, err := tx.Get(leaseKey)
+		switch {
+		case err == nil && string(owner) != q.workerID:
+			return errLeaseLost
+		case err != nil && !errors.Is(err, storage.ErrNotFound):
+			return err
+		}
+
+		tx.Set(jobKeyPrefix+job.ID, data, q.jobTTL)
+		tx.Delete(pendingKey(job))
+		tx.Delete(cancelKeyPrefix + job.ID)
+		tx.Delete(leaseKey)
+		return nil
+	})
+}
@@ -0,0 +1,450 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/storage"
+	"github.com/storo/lattice/pkg/tool/builtin"
+)
+
+// echoRunner returns the job's input in upper case.
+func echoRunner(ctx context.Context, job *Job) (*core.Result, error) {
+	return &core.Result{Output: strings.ToUpper(job.Input), TokensIn: 3, TokensOut: 5}, nil
+}
+
+// blockingRunner runs until its context is cancelled.
+func blockingRunner(started chan<- string) Runner {
+	return func(ctx context.Context, job *Job) (*core.Result, error) {
+		started <- job.ID
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+}
+
+// waitFor polls a job until its status is final or the timeout expires.
+func waitFor(t *testing.T, q *Queue, id string) *Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("failed to get job: %v", err)
+		}
+		if job.Status.Finished() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+func TestQueue_Submit(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueue(storage.NewMemoryStore(), echoRunner, WithPollInterval(10*time.Millisecond))
+	q.Start(ctx)
+	defer q.Stop()
+
+	job, err := q.Submit(ctx, &Job{Input: "hello"})
+	if err != nil {
+		t.Fatalf("failed to submit: %v", err)
+	}
+	if job.ID == "" || job.Status != StatusQueued {
+		t.Fatalf("unexpected submitted job %+v", job)
+	}
+
+	job = waitFor(t, q, job.ID)
+	if job.Status != StatusSucceeded || job.Output != "HELLO" || job.Attempts != 1 {
+		t.Errorf("unexpected job %+v", job)
+	}
+	if job.TokensIn != 3 || job.TokensOut != 5 || job.FinishedAt.IsZero() {
+		t.Errorf("unexpected job result %+v", job)
+	}
+}
+
+func TestQueue_RunnerError(t *testing.T) {
+	ctx := context.Background()
+	runner := func(ctx context.Context, job *Job) (*core.Result, error) {
+		return nil, errors.New("boom")
+	}
+	q := NewQueue(storage.NewMemoryStore(), runner, WithPollInterval(10*time.Millisecond))
+	q.Start(ctx)
+	defer q.Stop()
+
+	job, _ := q.Submit(ctx, &Job{Input: "x"})
+	job = waitFor(t, q, job.ID)
+	if job.Status != StatusFailed || job.Error != "boom" {
+		t.Errorf("unexpected job %+v", job)
+	}
+}
+
+func TestQueue_Webhook(t *testing.T) {
+	ctx := context.Background()
+
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer hook.Close()
+
+	q := NewQueue(storage.NewMemoryStore(), echoRunner,
+		WithPollInterval(10*time.Millisecond),
+		WithWebhookSecret("s3cret"),
+		WithWebhookPolicy(builtin.NewEgressPolicy(builtin.WithPrivateNetworks())),
+	)
+	q.Start(ctx)
+	defer q.Stop()
+
+	job, err := q.Submit(ctx, &Job{Input: "hi", Webhook: hook.URL})
+	if err != nil {
+		t.Fatalf("failed to submit: %v", err)
+	}
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		if r.Header.Get("X-Lattice-Job-ID") != job.ID {
+			t.Errorf("unexpected job ID header %q", r.Header.Get("X-Lattice-Job-ID"))
+		}
+		if r.Header.Get("X-Lattice-Signature") != "sha256="+Sign("s3cret", body) {
+			t.Errorf("invalid signature %q", r.Header.Get("X-Lattice-Signature"))
+		}
+		if !strings.Contains(string(body), `"status":"succeeded"`) {
+			t.Errorf("unexpected body %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+}
+
+func TestQueue_InvalidWebhook(t *testing.T) {
+	q := NewQueue(storage.NewMemoryStore(), echoRunner)
+
+	for _, webhook := range []string{
+		"ftp://example.com", "not a url", "/relative",
+		"http://169.254.169.254/latest/meta-data", "http://127.0.0.1:8080/hook", "http://[::1]/hook",
+	} {
+		if _, err := q.Submit(context.Background(), &Job{Input: "x", Webhook: webhook}); err == nil {
+			t.Errorf("expected error for webhook %q", webhook)
+		}
+	}
+}
+
+func TestQueue_WebhookPrivateAddress(t *testing.T) {
+	called := make(chan struct{}, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called <- struct{}{}
+	}))
+	defer hook.Close()
+
+	// The host passes the URL check but resolves to a loopback address
+	webhook := strings.Replace(hook.URL, "127.0.0.1", "localhost", 1)
+	q := NewQueue(storage.NewMemoryStore(), echoRunner)
+	if err := q.validateWebhook(webhook); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	q.notify(ctx, &Job{ID: "1", Status: StatusSucceeded, Webhook: webhook})
+
+	select {
+	case <-called:
+		t.Error("expected the webhook to be blocked")
+	default:
+	}
+}
+
+func TestQueue_CancelQueued(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueue(storage.NewMemoryStore(), echoRunner)
+
+	// Not started, so the job stays queued
+	job, _ := q.Submit(ctx, &Job{Input: "x"})
+
+	cancelled, err := q.Cancel(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+	if cancelled.Status != StatusCancelled {
+		t.Errorf("expected cancelled, got %s", cancelled.Status)
+	}
+
+	if _, err := q.Cancel(ctx, job.ID); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("expected ErrJobFinished, got %v", err)
+	}
+	if _, err := q.Cancel(ctx, "missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestQueue_CancelClaimed(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	q := NewQueue(store, echoRunner)
+
+	// A worker has claimed the job but not started it yet
+	job, _ := q.Submit(ctx, &Job{Input: "x"})
+	store.Set(ctx, leaseKeyPrefix+job.ID, []byte("worker"), time.Minute)
+
+	cancelled, err := q.Cancel(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+	if cancelled.Status != StatusQueued || !cancelled.CancelRequested {
+		t.Errorf("expected the cancellation to be left to the worker, got %+v", cancelled)
+	}
+	if !store.Exists(ctx, cancelKeyPrefix+job.ID) {
+		t.Error("expected a cancellation key")
+	}
+}
+
+func TestQueue_CancelRunning(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	started := make(chan string, 1)
+
+	q := NewQueue(store, blockingRunner(started), WithPollInterval(10*time.Millisecond))
+	q.Start(ctx)
+	defer q.Stop()
+
+	job, _ := q.Submit(ctx, &Job{Input: "x"})
+	<-started
+
+	// Cancel from another replica sharing the store
+	other := NewQueue(store, echoRunner)
+	if _, err := other.Cancel(ctx, job.ID); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+
+	job = waitFor(t, q, job.ID)
+	if job.Status != StatusCancelled {
+		t.Errorf("expected cancelled, got %+v", job)
+	}
+}
+
+func TestQueue_Restart(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	started := make(chan string, 1)
+
+	first := NewQueue(store, blockingRunner(started), WithPollInterval(10*time.Millisecond))
+	first.Start(ctx)
+
+	job, _ := first.Submit(ctx, &Job{Input: "resume me"})
+	<-started
+	first.Stop()
+
+	if j, _ := first.Get(ctx, job.ID); j.Status != StatusRunning {
+		t.Fatalf("expected the stopped job to stay running, got %s", j.Status)
+	}
+
+	second := NewQueue(store, echoRunner, WithPollInterval(10*time.Millisecond))
+	second.Start(ctx)
+	defer second.Stop()
+
+	job = waitFor(t, second, job.ID)
+	if job.Status != StatusSucceeded || job.Output != "RESUME ME" || job.Attempts != 2 {
+		t.Errorf("unexpected job %+v", job)
+	}
+}
+
+func TestQueue_RunsOnce(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+
+	var mu sync.Mutex
+	runs := make(map[string]int)
+	runner := func(ctx context.Context, job *Job) (*core.Result, error) {
+		mu.Lock()
+		runs[job.ID]++
+		mu.Unlock()
+		return &core.Result{}, nil
+	}
+
+	// Replicas sharing the store race for every job
+	for range 3 {
+		q := NewQueue(store, runner, WithPollInterval(time.Millisecond))
+		q.Start(ctx)
+		defer q.Stop()
+	}
+
+	q := NewQueue(store, runner)
+	var ids []string
+	for range 20 {
+		job, _ := q.Submit(ctx, &Job{Input: "x"})
+		ids = append(ids, job.ID)
+	}
+	for _, id := range ids {
+		waitFor(t, q, id)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range ids {
+		if runs[id] != 1 {
+			t.Errorf("job %s ran %d times", id, runs[id])
+		}
+	}
+}
+
+func TestQueue_LostLease(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	started := make(chan string, 1)
+	stopped := make(chan struct{})
+
+	runner := func(ctx context.Context, job *Job) (*core.Result, error) {
+		started <- job.ID
+		<-ctx.Done()
+		close(stopped)
+		return nil, ctx.Err()
+	}
+	q := NewQueue(store, runner, WithPollInterval(10*time.Millisecond))
+	q.Start(ctx)
+	defer q.Stop()
+
+	job, _ := q.Submit(ctx, &Job{Input: "x"})
+	<-started
+
+	// Another worker took the job over after the lease expired
+	store.Set(ctx, leaseKeyPrefix+job.ID, []byte("other"), time.Minute)
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job kept running without its lease")
+	}
+
+	// The outcome is left to the new owner
+	time.Sleep(50 * time.Millisecond)
+	if j, _ := q.Get(ctx, job.ID); j.Status != StatusRunning {
+		t.Errorf("expected the job to stay running, got %s", j.Status)
+	}
+	if owner, _ := store.Get(ctx, leaseKeyPrefix+job.ID); string(owner) != "other" {
+		t.Errorf("expected the lease to stay with the new owner, got %q", owner)
+	}
+}
+
+func TestQueue_LostLeaseBeforeFinish(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+
+	called := make(chan struct{}, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called <- struct{}{}
+	}))
+	defer hook.Close()
+
+	done := make(chan struct{})
+	runner := func(ctx context.Context, job *Job) (*core.Result, error) {
+		// The lease expired and another worker took the job over before
+		// the heartbeat noticed
+		store.Set(ctx, leaseKeyPrefix+job.ID, []byte("other"), time.Minute)
+		close(done)
+		return &core.Result{Output: "stale"}, nil
+	}
+	q := NewQueue(store, runner,
+		WithPollInterval(time.Minute),
+		WithWebhookPolicy(builtin.NewEgressPolicy(builtin.WithPrivateNetworks())),
+	)
+	q.Start(ctx)
+	defer q.Stop()
+
+	job, _ := q.Submit(ctx, &Job{Input: "x", Webhook: hook.URL})
+	<-done
+
+	time.Sleep(50 * time.Millisecond)
+	if j, _ := q.Get(ctx, job.ID); j.Status != StatusRunning || j.Output != "" {
+		t.Errorf("expected the new owner's job to be left alone, got %+v", j)
+	}
+	if owner, _ := store.Get(ctx, leaseKeyPrefix+job.ID); string(owner) != "other" {
+		t.Errorf("expected the lease to stay with the new owner, got %q", owner)
+	}
+	select {
+	case <-called:
+		t.Error("expected no webhook for an outcome that was not recorded")
+	default:
+	}
+}
+
+func TestQueue_MaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+
+	q := NewQueue(store, echoRunner, WithMaxAttempts(1), WithPollInterval(10*time.Millisecond))
+	job, _ := q.Submit(ctx, &Job{Input: "x"})
+
+	// Simulate a worker that died after starting the job
+	stale, _ := q.Get(ctx, job.ID)
+	stale.Status = StatusRunning
+	stale.Attempts = 1
+	q.save(ctx, stale)
+
+	q.Start(ctx)
+	defer q.Stop()
+
+	job = waitFor(t, q, job.ID)
+	if job.Status != StatusFailed || !strings.Contains(job.Error, "1 attempts") {
+		t.Errorf("unexpected job %+v", job)
+	}
+}
+
+func TestQueue_PendingIndex(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	q := NewQueue(store, echoRunner, WithPollInterval(10*time.Millisecond))
+
+	pending := func() []string {
+		keys, _ := store.Keys(ctx, pendingKeyPrefix+"*")
+		return keys
+	}
+
+	cancelled, _ := q.Submit(ctx, &Job{Input: "a"})
+	run, _ := q.Submit(ctx, &Job{Input: "b"})
+	if keys := pending(); len(keys) != 2 {
+		t.Fatalf("expected 2 pending jobs, got %v", keys)
+	}
+
+	q.Cancel(ctx, cancelled.ID)
+	if keys := pending(); len(keys) != 1 {
+		t.Fatalf("expected the cancelled job to leave the index, got %v", keys)
+	}
+
+	q.Start(ctx)
+	defer q.Stop()
+	waitFor(t, q, run.ID)
+	if keys := pending(); len(keys) != 0 {
+		t.Errorf("expected an empty index, got %v", keys)
+	}
+}
+
+func TestQueue_List(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueue(storage.NewMemoryStore(), echoRunner)
+
+	first, _ := q.Submit(ctx, &Job{Input: "a"})
+	time.Sleep(time.Millisecond)
+	second, _ := q.Submit(ctx, &Job{Input: "b"})
+
+	jobs, err := q.List(ctx)
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != first.ID || jobs[1].ID != second.ID {
+		t.Errorf("unexpected jobs %v", jobs)
+	}
+}
@@ -0,0 +1,346 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/storage"
+)
+
+// webhookAttempts is how many times a webhook is tried.
+const webhookAttempts = 3
+
+// Start runs the queue's workers until ctx is done or Stop is called.
+func (q *Queue) Start(ctx context.Context) {
+	ctx, q.stop = context.WithCancel(ctx)
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			q.work(ctx)
+		}()
+	}
+}
+
+// Stop stops the workers and waits for them. Running jobs are
+// interrupted and left for another replica, or a restart, to pick up.
+func (q *Queue) Stop() {
+	if q.stop != nil {
+		q.stop()
+	}
+	q.wg.Wait()
+}
+
+// work claims and runs jobs until ctx is done.
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			job, err := q.claim(ctx)
+			if err != nil || job == nil {
+				break
+			}
+			q.execute(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim finds a runnable job and takes a lease on it. Only the index of
+// unfinished jobs is read. Queued jobs are taken oldest first; running
+// jobs whose lease expired belong to a worker that died and are taken over.
+func (q *Queue) claim(ctx context.Context) (*Job, error) {
+	keys, err := q.pendingKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		id := key[strings.LastIndex(key, ":")+1:]
+		if q.store.Exists(ctx, leaseKeyPrefix+id) {
+			continue
+		}
+		ok, err := q.store.SetNX(ctx, leaseKeyPrefix+id, []byte(q.workerID), q.leaseTTL)
+		if err != nil || !ok {
+			continue
+		}
+
+		// Re-read now that we hold the lease
+		job, err := q.Get(ctx, id)
+		if err == nil && !job.Status.Finished() {
+			return job, nil
+		}
+		if errors.Is(err, ErrJobNotFound) || (err == nil && job.Status.Finished()) {
+			// A stale index entry
+			q.store.Delete(ctx, key)
+		}
+		q.release(ctx, id)
+	}
+
+	return nil, nil
+}
+
+// pendingKeys returns the index keys of the unfinished jobs, paging
+// through them when the store supports it.
+func (q *Queue) pendingKeys(ctx context.Context) ([]string, error) {
+	scanner, ok := q.store.(storage.ScanStore)
+	if !ok {
+		return q.store.Keys(ctx, pendingKeyPrefix+"*")
+	}
+
+	var keys []string
+	for key, err := range storage.ScanKeys(ctx, scanner, pendingKeyPrefix+"*", 0) {
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// renew extends the worker's lease on a job. It reports false when the
+// lease was lost to another worker.
+func (q *Queue) renew(ctx context.Context, id string) bool {
+	key := leaseKeyPrefix + id
+	owner, version, err := q.store.GetVersion(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		// Expired, but nobody took it over yet
+		ok, err := q.store.SetNX(ctx, key, []byte(q.workerID), q.leaseTTL)
+		return ok || err != nil
+	}
+	if err != nil {
+		// Keep running through store hiccups; the lease may still be ours
+		return true
+	}
+	if string(owner) != q.workerID {
+		return false
+	}
+	_, err = q.store.CompareAndSwap(ctx, key, []byte(q.workerID), version, q.leaseTTL)
+	return !errors.Is(err, storage.ErrConflict)
+}
+
+// release gives up the worker's lease on a job, unless another worker
+// holds it by now.
+func (q *Queue) release(ctx context.Context, id string) {
+	key := leaseKeyPrefix + id
+	q.store.Txn(ctx, []string{key}, func(tx *storage.Tx) error {
+		if owner, err := tx.Get(key); err == nil && string(owner) == q.workerID {
+			tx.Delete(key)
+		}
+		return nil
+	})
+}
+
+// execute runs a claimed job and records its outcome.
+func (q *Queue) execute(ctx context.Context, job *Job) {
+	// Keep the job's record even if the worker is stopped mid-write
+	storeCtx := context.WithoutCancel(ctx)
+
+	if q.store.Exists(ctx, cancelKeyPrefix+job.ID) {
+		q.finish(storeCtx, job, nil, ErrCancelled)
+		return
+	}
+
+	if job.Attempts >= q.maxAttempts {
+		q.finish(storeCtx, job, nil, fmt.Errorf("gave up after %d attempts", job.Attempts))
+		return
+	}
+
+	job.Status = StatusRunning
+	job.Attempts++
+	job.StartedAt = time.Now().UTC()
+	if err := q.save(storeCtx, job); err != nil {
+		q.release(storeCtx, job.ID)
+		return
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	q.mu.Lock()
+	q.running[job.ID] = cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, job.ID)
+		q.mu.Unlock()
+	}()
+
+	var stopped heartbeatStop
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		stopped = q.heartbeat(runCtx, job.ID, cancel)
+	}()
+
+	result, err := q.runner(runCtx, job)
+	cancel()
+	<-heartbeatDone
+
+	cancelled := stopped == heartbeatCancelled || q.store.Exists(storeCtx, cancelKeyPrefix+job.ID)
+	switch {
+	case stopped == heartbeatLost:
+		// Another worker took the job over and records its outcome
+		return
+	case ctx.Err() != nil && !cancelled:
+		// The worker is stopping: release the job for another worker
+		q.release(storeCtx, job.ID)
+		return
+	case cancelled:
+		err = ErrCancelled
+	}
+
+	q.finish(storeCtx, job, result, err)
+}
+
+// heartbeatStop is why a heartbeat stopped a job.
+type heartbeatStop int
+
+const (
+	heartbeatEnded heartbeatStop = iota
+	heartbeatCancelled
+	heartbeatLost
+)
+
+// heartbeat renews the job's lease and watches for cancellation until ctx
+// is done. It stops the job when it is cancelled through the store or
+// when its lease is lost, and reports which happened.
+func (q *Queue) heartbeat(ctx context.Context, id string, cancel context.CancelFunc) heartbeatStop {
+	interval := min(q.pollInterval, q.leaseTTL/3)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return heartbeatEnded
+		case <-ticker.C:
+			if q.store.Exists(ctx, cancelKeyPrefix+id) {
+				cancel()
+				return heartbeatCancelled
+			}
+			if !q.renew(ctx, id) {
+				cancel()
+				return heartbeatLost
+			}
+		}
+	}
+}
+
+// finish records a job's outcome and calls its webhook, unless the job
+// could not be recorded.
+func (q *Queue) finish(ctx context.Context, job *Job, result *core.Result, err error) {
+	job.FinishedAt = time.Now().UTC()
+	job.CancelRequested = false
+
+	switch {
+	case errors.Is(err, ErrCancelled):
+		job.Status = StatusCancelled
+	case err != nil:
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	default:
+		job.Status = StatusSucceeded
+		job.Error = ""
+	}
+
+	if result != nil {
+		job.Output = result.Output
+		job.TokensIn = result.TokensIn
+		job.TokensOut = result.TokensOut
+		job.TraceID = result.TraceID
+	}
+
+	// A worker that took the job over records its outcome instead
+	if err := q.saveFinished(ctx, job); err != nil {
+		return
+	}
+
+	if job.Webhook != "" {
+		q.notify(ctx, job)
+	}
+}
+
+// notify posts the finished job to its webhook, retrying failures.
+func (q *Queue) notify(ctx context.Context, job *Job) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return
+	}
+
+	for attempt := 0; attempt < webhookAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.Webhook, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Lattice-Job-ID", job.ID)
+		if q.webhookSecret != "" {
+			req.Header.Set("X-Lattice-Signature", "sha256="+Sign(q.webhookSecret, body))
+		}
+
+		resp, err := q.webhookClient.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 300 {
+			return
+		}
+		// Client errors will not succeed on retry
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return
+		}
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 of body, as sent in the
+// X-Lattice-Signature header.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateWebhook checks that a webhook is an absolute http(s) URL the
+// webhook policy allows. Hosts are checked again when connecting.
+func (q *Queue) validateWebhook(webhook string) error {
+	u, err := url.Parse(webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q", webhook)
+	}
+	if err := q.webhookPolicy.CheckURL(u); err != nil {
+		return fmt.Errorf("invalid webhook URL %q: %w", webhook, err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package knowledge
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// SplitText splits text into chunks of at most size characters. Chunks
+// break between paragraphs where possible, then between words. Each chunk
+// after the first starts with about overlap characters from the end of the
+// one before.
+func SplitText(text string, size, overlap int) []string {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	if text == "" {
+		return nil
+	}
+	if size <= 0 {
+		return []string{text}
+	}
+	overlap = min(max(overlap, 0), size/2)
+
+	// Pieces are paragraphs, or parts of paragraphs too long for a chunk,
+	// each with the separator that precedes it in the text
+	type piece struct{ sep, text string }
+	var pieces []piece
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		if runeLen(para) <= size {
+			pieces = append(pieces, piece{"\n\n", para})
+			continue
+		}
+		for i, part := range splitWords(para, size-overlap) {
+			sep := " "
+			if i == 0 {
+				sep = "\n\n"
+			}
+			pieces = append(pieces, piece{sep, part})
+		}
+	}
+
+	var chunks []string
+	var cur strings.Builder
+	curLen := 0
+	for _, p := range pieces {
+		if curLen > 0 && curLen+len(p.sep)+runeLen(p.text) > size {
+			chunk := cur.String()
+			chunks = append(chunks, chunk)
+
+			cur.Reset()
+			curLen = 0
+			if tail := overlapTail(chunk, overlap); tail != "" && runeLen(tail)+len(p.sep)+runeLen(p.text) <= size {
+				cur.WriteString(tail)
+				curLen = runeLen(tail)
+			}
+		}
+		if curLen > 0 {
+			cur.WriteString(p.sep)
+			curLen += len(p.sep)
+		}
+		cur.WriteString(p.text)
+		curLen += runeLen(p.text)
+	}
+	if curLen > 0 {
+		chunks = append(chunks, cur.String())
+	}
+	return chunks
+}
+
+// splitWords splits text into parts of at most size characters at spaces,
+// cutting words longer than size.
+func splitWords(text string, size int) []string {
+	var parts []string
+	var cur strings.Builder
+	curLen := 0
+	for _, word := range strings.Fields(text) {
+		for runeLen(word) > size {
+			if curLen > 0 {
+				parts = append(parts, cur.String())
+				cur.Reset()
+				curLen = 0
+			}
+			r := []rune(word)
+			parts = append(parts, string(r[:size]))
+			word = string(r[size:])
+		}
+
+		n := runeLen(word)
+		if curLen > 0 && curLen+1+n > size {
+			parts = append(parts, cur.String())
+			cur.Reset()
+			curLen = 0
+		}
+		if curLen > 0 {
+			cur.WriteByte(' ')
+			curLen++
+		}
+		cur.WriteString(word)
+		curLen += n
+	}
+	if curLen > 0 {
+		parts = append(parts, cur.String())
+	}
+	return parts
+}
+
+// overlapTail returns up to n characters from the end of text, starting at
+// a word.
+func overlapTail(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	r := []rune(text)
+	if len(r) <= n {
+		return text
+	}
+	tail := string(r[len(r)-n:])
+	if i := strings.IndexAny(tail, " \n"); i >= 0 {
+		tail = tail[i+1:]
+	}
+	return strings.TrimSpace(tail)
+}
+
+func runeLen(s string) int {
+	return utf8.RuneCountInString(s)
+}
@@ -0,0 +1,241 @@
+package knowledge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Embedder turns texts into vectors whose cosine similarity reflects how
+// close the texts are in meaning.
+type Embedder interface {
+	// Embed returns one vector per text, in order.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// Embedder defaults
+const (
+	DefaultOllamaEmbedModel = "nomic-embed-text"
+	DefaultOpenAIEmbedModel = "text-embedding-3-small"
+	DefaultHashDimensions   = 256
+)
+
+// EmbedderOption configures the HTTP embedders.
+type EmbedderOption func(*httpEmbedder)
+
+// WithEmbedBaseURL sets the API base URL.
+func WithEmbedBaseURL(url string) EmbedderOption {
+	return func(e *httpEmbedder) {
+		e.baseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithEmbedModel sets the embedding model.
+func WithEmbedModel(model string) EmbedderOption {
+	return func(e *httpEmbedder) {
+		e.model = model
+	}
+}
+
+// WithEmbedAPIKey sets the API key, sent as a bearer token.
+func WithEmbedAPIKey(key string) EmbedderOption {
+	return func(e *httpEmbedder) {
+		e.apiKey = key
+	}
+}
+
+// WithEmbedHTTPClient sets a custom HTTP client.
+func WithEmbedHTTPClient(client *http.Client) EmbedderOption {
+	return func(e *httpEmbedder) {
+		e.httpClient = client
+	}
+}
+
+// httpEmbedder holds the settings shared by the HTTP embedders.
+type httpEmbedder struct {
+	baseURL    string
+	model      string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newHTTPEmbedder(baseURL, model string, opts []EmbedderOption) httpEmbedder {
+	e := httpEmbedder{
+		baseURL:    baseURL,
+		model:      model,
+		httpClient: &http.Client{Timeout: 2 * time.Minute},
+	}
+	for _, opt := range opts {
+		opt(&e)
+	}
+	return e
+}
+
+// post sends a JSON request and decodes the JSON response into out.
+func (e *httpEmbedder) post(ctx context.Context, path string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("embedding error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// OllamaEmbedder embeds texts with Ollama's /api/embed endpoint.
+type OllamaEmbedder struct {
+	httpEmbedder
+}
+
+// NewOllamaEmbedder creates an Ollama embedder. By default it connects to
+// localhost:11434 and uses nomic-embed-text.
+func NewOllamaEmbedder(opts ...EmbedderOption) *OllamaEmbedder {
+	return &OllamaEmbedder{newHTTPEmbedder("http://localhost:11434", DefaultOllamaEmbedModel, opts)}
+}
+
+// Embed returns one vector per text.
+func (e *OllamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	err := e.post(ctx, "/api/embed", map[string]any{"model": e.model, "input": texts}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Embeddings, nil
+}
+
+// OpenAIEmbedder embeds texts with an OpenAI-compatible /embeddings
+// endpoint.
+type OpenAIEmbedder struct {
+	httpEmbedder
+}
+
+// NewOpenAIEmbedder creates an OpenAI-compatible embedder. By default it
+// uses api.openai.com with text-embedding-3-small.
+func NewOpenAIEmbedder(opts ...EmbedderOption) *OpenAIEmbedder {
+	return &OpenAIEmbedder{newHTTPEmbedder("https://api.openai.com/v1", DefaultOpenAIEmbedModel, opts)}
+}
+
+// Embed returns one vector per text.
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	err := e.post(ctx, "/embeddings", map[string]any{"model": e.model, "input": texts}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("no embedding for text %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// HashEmbedder is a deterministic embedder that hashes words into a fixed
+// number of dimensions. Texts sharing words score as similar. It needs no
+// model, which makes it useful for tests and for keyword-like search.
+type HashEmbedder struct {
+	dims int
+}
+
+// NewHashEmbedder creates a hashing embedder (default 256 dimensions).
+func NewHashEmbedder(dims int) *HashEmbedder {
+	if dims <= 0 {
+		dims = DefaultHashDimensions
+	}
+	return &HashEmbedder{dims: dims}
+}
+
+// Embed returns one unit vector per text.
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, e.dims)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		for _, w := range words {
+			h := fnv.New64a()
+			h.Write([]byte(w))
+			sum := h.Sum64()
+
+			// The top bit picks the sign so that collisions tend to cancel
+			if sum>>63 == 0 {
+				v[sum%uint64(e.dims)]++
+			} else {
+				v[sum%uint64(e.dims)]--
+			}
+		}
+		normalize(v)
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+// normalize scales v to unit length.
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+}
+
+// Compile-time checks
+var (
+	_ Embedder = (*OllamaEmbedder)(nil)
+	_ Embedder = (*OpenAIEmbedder)(nil)
+	_ Embedder = (*HashEmbedder)(nil)
+)
@@ -0,0 +1,362 @@
+// Package knowledge provides retrieval over a corpus of documents.
+// Documents are split into chunks, embedded by an Embedder and kept in a
+// vector Index; a Base searches them by meaning for a query.
+package knowledge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Knowledge errors
+var (
+	ErrEmptyQuery         = errors.New("query is empty")
+	ErrDimensionMismatch  = errors.New("vector dimensions do not match")
+	ErrEmbeddingCount     = errors.New("embedder returned the wrong number of vectors")
+	ErrDocumentIDRequired = errors.New("document id is required")
+)
+
+// Defaults
+const (
+	DefaultChunkSize    = 1000
+	DefaultChunkOverlap = 100
+	DefaultBatchSize    = 32
+)
+
+// Document is a text to be indexed.
+type Document struct {
+	ID       string
+	Text     string
+	Metadata map[string]string
+}
+
+// Chunk is an indexed piece of a document.
+type Chunk struct {
+	ID         string            `json:"id"`
+	DocumentID string            `json:"document_id"`
+	Text       string            `json:"text"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Vector     []float32         `json:"-"`
+}
+
+// Result is a chunk found by a search, with its cosine similarity to the
+// query.
+type Result struct {
+	Chunk
+	Score float64 `json:"score"`
+}
+
+// Filter restricts a search to chunks whose metadata has all of its
+// key-value pairs.
+type Filter map[string]string
+
+// Match reports whether metadata satisfies the filter.
+func (f Filter) Match(metadata map[string]string) bool {
+	for k, v := range f {
+		if got, ok := metadata[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Index stores chunk vectors and finds the nearest ones.
+type Index interface {
+	// Upsert adds chunks, replacing chunks with the same ID.
+	Upsert(ctx context.Context, chunks ...Chunk) error
+
+	// ReplaceDocument replaces all chunks of a document with chunks, and
+	// records hash as its content hash, in one step.
+	ReplaceDocument(ctx context.Context, documentID, hash string, chunks []Chunk) error
+
+	// Documents returns the content hash of every indexed document, by ID.
+	// Documents indexed without ReplaceDocument have an empty hash.
+	Documents(ctx context.Context) (map[string]string, error)
+
+	// Search returns the k chunks most similar to vector that match
+	// filter, best first.
+	Search(ctx context.Context, vector []float32, k int, filter Filter) ([]Result, error)
+
+	// DeleteDocument removes all chunks of a document, and its hash.
+	DeleteDocument(ctx context.Context, documentID string) error
+
+	// Count returns the number of chunks.
+	Count(ctx context.Context) (int, error)
+
+	// Close releases the index.
+	Close() error
+}
+
+// Base is a searchable collection of documents.
+type Base struct {
+	index        Index
+	embedder     Embedder
+	chunkSize    int
+	chunkOverlap int
+	batchSize    int
+	fingerprint  string
+}
+
+// Option configures a Base.
+type Option func(*Base)
+
+// WithChunkSize sets the most characters per chunk.
+func WithChunkSize(n int) Option {
+	return func(b *Base) {
+		b.chunkSize = n
+	}
+}
+
+// WithChunkOverlap sets how many characters of a chunk are repeated at the
+// start of the next, so that text cut at a boundary is found from both.
+func WithChunkOverlap(n int) Option {
+	return func(b *Base) {
+		b.chunkOverlap = n
+	}
+}
+
+// WithBatchSize sets how many chunks are embedded per request.
+func WithBatchSize(n int) Option {
+	return func(b *Base) {
+		b.batchSize = n
+	}
+}
+
+// WithFingerprint identifies the embedder, such as its type and model.
+// Documents indexed under another fingerprint are embedded again.
+func WithFingerprint(fingerprint string) Option {
+	return func(b *Base) {
+		b.fingerprint = fingerprint
+	}
+}
+
+// New creates a knowledge base on an index and embedder.
+func New(index Index, embedder Embedder, opts ...Option) *Base {
+	b := &Base{
+		index:        index,
+		embedder:     embedder,
+		chunkSize:    DefaultChunkSize,
+		chunkOverlap: DefaultChunkOverlap,
+		batchSize:    DefaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Index returns the underlying index.
+func (b *Base) Index() Index {
+	return b.index
+}
+
+// Add chunks, embeds and indexes documents. A document that was added
+// before is replaced, unless its text and metadata are unchanged. All of
+// a document's chunks are embedded before its old chunks are replaced, so
+// a failure leaves the previous version searchable.
+func (b *Base) Add(ctx context.Context, docs ...Document) error {
+	known, err := b.index.Documents(ctx)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if _, err := b.add(ctx, known, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add indexes a document unless known holds its content hash, and reports
+// whether it did.
+func (b *Base) add(ctx context.Context, known map[string]string, doc Document) (bool, error) {
+	if doc.ID == "" {
+		return false, ErrDocumentIDRequired
+	}
+
+	hash := b.contentHash(doc)
+	if known[doc.ID] == hash {
+		return false, nil
+	}
+
+	var chunks []Chunk
+	for i, text := range SplitText(doc.Text, b.chunkSize, b.chunkOverlap) {
+		chunks = append(chunks, Chunk{
+			ID:         fmt.Sprintf("%s#%d", doc.ID, i),
+			DocumentID: doc.ID,
+			Text:       text,
+			Metadata:   maps.Clone(doc.Metadata),
+		})
+	}
+
+	for start := 0; start < len(chunks); start += b.batchSize {
+		batch := chunks[start:min(start+b.batchSize, len(chunks))]
+		texts := make([]string, len(batch))
+		for i, c := range batch {
+			texts[i] = c.Text
+		}
+
+		vectors, err := b.embedder.Embed(ctx, texts)
+		if err != nil {
+			return false, fmt.Errorf("failed to embed %s: %w", doc.ID, err)
+		}
+		if len(vectors) != len(batch) {
+			return false, fmt.Errorf("%w: %d for %d texts", ErrEmbeddingCount, len(vectors), len(batch))
+		}
+		for i := range batch {
+			batch[i].Vector = vectors[i]
+		}
+	}
+
+	if err := b.index.ReplaceDocument(ctx, doc.ID, hash, chunks); err != nil {
+		return false, fmt.Errorf("failed to index %s: %w", doc.ID, err)
+	}
+	known[doc.ID] = hash
+	return true, nil
+}
+
+// contentHash identifies what a document's chunks are built from: its text
+// and metadata, the chunking settings and the embedder's fingerprint.
+func (b *Base) contentHash(doc Document) string {
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(strconv.Itoa(len(s))))
+		h.Write([]byte{':'})
+		h.Write([]byte(s))
+	}
+
+	write(b.fingerprint)
+	write(strconv.Itoa(b.chunkSize))
+	write(strconv.Itoa(b.chunkOverlap))
+	write(doc.Text)
+	for _, k := range slices.Sorted(maps.Keys(doc.Metadata)) {
+		write(k)
+		write(doc.Metadata[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AddDir adds the files under dir with one of the given extensions
+// (default .md and .txt). Each file becomes a document whose ID and
+// "source" metadata are its slash-separated path relative to dir. Files
+// that did not change since they were added are skipped; the number of
+// files indexed is returned.
+func (b *Base) AddDir(ctx context.Context, dir string, exts ...string) (int, error) {
+	known, err := b.index.Documents(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return b.addDir(ctx, dir, exts, known, make(map[string]bool))
+}
+
+// Sync makes the index hold the files under dirs, as added by AddDir:
+// changed files are indexed, and documents whose files are gone are
+// deleted. It returns how many documents were indexed and deleted.
+func (b *Base) Sync(ctx context.Context, dirs []string, exts ...string) (indexed, deleted int, err error) {
+	known, err := b.index.Documents(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		n, err := b.addDir(ctx, dir, exts, known, seen)
+		indexed += n
+		if err != nil {
+			return indexed, 0, fmt.Errorf("failed to index %s: %w", dir, err)
+		}
+	}
+
+	for id := range known {
+		if seen[id] {
+			continue
+		}
+		if err := b.index.DeleteDocument(ctx, id); err != nil {
+			return indexed, deleted, fmt.Errorf("failed to delete %s: %w", id, err)
+		}
+		deleted++
+	}
+	return indexed, deleted, nil
+}
+
+// addDir indexes the changed files under dir and records every file's
+// document ID in seen.
+func (b *Base) addDir(ctx context.Context, dir string, exts []string, known map[string]string, seen map[string]bool) (int, error) {
+	if len(exts) == 0 {
+		exts = []string{".md", ".txt"}
+	}
+
+	indexed := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !slices.Contains(exts, strings.ToLower(filepath.Ext(path))) {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+
+		added, err := b.add(ctx, known, Document{ID: rel, Text: string(data), Metadata: map[string]string{"source": rel}})
+		if err != nil {
+			return err
+		}
+		if added {
+			indexed++
+		}
+		return nil
+	})
+	return indexed, err
+}
+
+// Search returns the k chunks most relevant to a query.
+func (b *Base) Search(ctx context.Context, query string, k int, filter Filter) ([]Result, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, ErrEmptyQuery
+	}
+
+	vectors, err := b.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("%w: %d for 1 text", ErrEmbeddingCount, len(vectors))
+	}
+
+	return b.index.Search(ctx, vectors[0], k, filter)
+}
+
+// Delete removes a document.
+func (b *Base) Delete(ctx context.Context, documentID string) error {
+	return b.index.DeleteDocument(ctx, documentID)
+}
+
+// Close closes the index.
+func (b *Base) Close() error {
+	return b.index.Close()
+}
@@ -0,0 +1,357 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var testDocs = []Document{
+	{ID: "vacation", Text: "Employees get 25 vacation days per year. Unused vacation days carry over until March.", Metadata: map[string]string{"team": "hr"}},
+	{ID: "deploy", Text: "To deploy the service, merge to main. The pipeline builds the image and rolls it out to staging, then production.", Metadata: map[string]string{"team": "eng"}},
+	{ID: "oncall", Text: "The on-call engineer answers pages within 15 minutes and escalates production incidents.", Metadata: map[string]string{"team": "eng"}},
+}
+
+func testIndexes(t *testing.T) map[string]func() Index {
+	return map[string]func() Index{
+		"memory": func() Index { return NewMemoryIndex() },
+		"sqlite": func() Index {
+			x, err := NewSQLiteIndex(filepath.Join(t.TempDir(), "index.db"))
+			if err != nil {
+				t.Fatalf("failed to open index: %v", err)
+			}
+			return x
+		},
+	}
+}
+
+func TestBase_Search(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newIndex := range testIndexes(t) {
+		t.Run(name, func(t *testing.T) {
+			kb := New(newIndex(), NewHashEmbedder(0))
+			defer kb.Close()
+
+			if err := kb.Add(ctx, testDocs...); err != nil {
+				t.Fatalf("failed to add: %v", err)
+			}
+
+			results, err := kb.Search(ctx, "how many vacation days do I get", 2, nil)
+			if err != nil {
+				t.Fatalf("search failed: %v", err)
+			}
+			if len(results) != 2 || results[0].DocumentID != "vacation" {
+				t.Fatalf("expected vacation first, got %+v", results)
+			}
+			if results[0].Score <= results[1].Score {
+				t.Errorf("results not sorted by score: %v, %v", results[0].Score, results[1].Score)
+			}
+			if results[0].Metadata["team"] != "hr" {
+				t.Errorf("expected metadata, got %v", results[0].Metadata)
+			}
+
+			// Filters restrict the candidates
+			results, err = kb.Search(ctx, "vacation days", 5, Filter{"team": "eng"})
+			if err != nil {
+				t.Fatalf("search failed: %v", err)
+			}
+			if len(results) != 2 {
+				t.Fatalf("expected 2 eng results, got %d", len(results))
+			}
+			for _, r := range results {
+				if r.Metadata["team"] != "eng" {
+					t.Errorf("filter not applied: %+v", r)
+				}
+			}
+
+			// Re-adding replaces, deleting removes
+			if err := kb.Add(ctx, Document{ID: "vacation", Text: "Vacation policy moved to the wiki."}); err != nil {
+				t.Fatalf("failed to replace: %v", err)
+			}
+			if n, _ := kb.Index().Count(ctx); n != 3 {
+				t.Errorf("expected 3 chunks, got %d", n)
+			}
+			if err := kb.Delete(ctx, "vacation"); err != nil {
+				t.Fatalf("failed to delete: %v", err)
+			}
+			results, _ = kb.Search(ctx, "vacation", 5, nil)
+			for _, r := range results {
+				if r.DocumentID == "vacation" {
+					t.Error("deleted document still found")
+				}
+			}
+
+			if _, err := kb.Search(ctx, "  ", 5, nil); err != ErrEmptyQuery {
+				t.Errorf("expected ErrEmptyQuery, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSQLiteIndex_Persists(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "index.db")
+
+	x, err := NewSQLiteIndex(path)
+	if err != nil {
+		t.Fatalf("failed to open index: %v", err)
+	}
+	if err := New(x, NewHashEmbedder(64)).Add(ctx, testDocs...); err != nil {
+		t.Fatalf("failed to add: %v", err)
+	}
+	x.Close()
+
+	x, err = NewSQLiteIndex(path)
+	if err != nil {
+		t.Fatalf("failed to reopen index: %v", err)
+	}
+	kb := New(x, NewHashEmbedder(64))
+	defer kb.Close()
+
+	results, err := kb.Search(ctx, "deploy to production", 1, nil)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].DocumentID != "deploy" {
+		t.Errorf("expected deploy, got %+v", results)
+	}
+
+	// An embedder with other dimensions cannot search this index
+	kb = New(x, NewHashEmbedder(32))
+	if _, err := kb.Search(ctx, "deploy", 1, nil); err == nil || !strings.Contains(err.Error(), ErrDimensionMismatch.Error()) {
+		t.Errorf("expected ErrDimensionMismatch, got %v", err)
+	}
+}
+
+func TestBase_AddDir(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "guides"), 0o755)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0o755)
+	os.WriteFile(filepath.Join(dir, "guides", "deploy.md"), []byte("# Deploying\n\nMerge to main."), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("Team notes."), 0o644)
+	os.WriteFile(filepath.Join(dir, "image.png"), []byte{0x89}, 0o644)
+	os.WriteFile(filepath.Join(dir, ".git", "HEAD.md"), []byte("ref"), 0o644)
+
+	kb := New(NewMemoryIndex(), NewHashEmbedder(0))
+	n, err := kb.AddDir(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("failed to add dir: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 documents, got %d", n)
+	}
+
+	results, _ := kb.Search(context.Background(), "deploying merge", 1, Filter{"source": "guides/deploy.md"})
+	if len(results) != 1 || results[0].DocumentID != "guides/deploy.md" {
+		t.Errorf("unexpected results: %+v", results)
+	}
+}
+
+// countingEmbedder counts the texts it embeds, and fails when err is set.
+type countingEmbedder struct {
+	Embedder
+	texts int
+	err   error
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	e.texts += len(texts)
+	return e.Embedder.Embed(ctx, texts)
+}
+
+func TestBase_Sync(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newIndex := range testIndexes(t) {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, "deploy.md"), []byte("Merge to main to deploy."), 0o644)
+			os.WriteFile(filepath.Join(dir, "oncall.md"), []byte("Answer pages within 15 minutes."), 0o644)
+
+			embedder := &countingEmbedder{Embedder: NewHashEmbedder(0)}
+			kb := New(newIndex(), embedder)
+			defer kb.Close()
+
+			if indexed, deleted, err := kb.Sync(ctx, []string{dir}); err != nil || indexed != 2 || deleted != 0 {
+				t.Fatalf("expected 2 indexed, got %d, %d, %v", indexed, deleted, err)
+			}
+
+			// Unchanged files are not embedded again
+			embedder.texts = 0
+			if indexed, _, err := kb.Sync(ctx, []string{dir}); err != nil || indexed != 0 || embedder.texts != 0 {
+				t.Errorf("expected nothing to index, got %d (%d texts), %v", indexed, embedder.texts, err)
+			}
+
+			os.WriteFile(filepath.Join(dir, "deploy.md"), []byte("Deploys go through the release train."), 0o644)
+			os.Remove(filepath.Join(dir, "oncall.md"))
+			indexed, deleted, err := kb.Sync(ctx, []string{dir})
+			if err != nil || indexed != 1 || deleted != 1 {
+				t.Fatalf("expected 1 indexed and 1 deleted, got %d, %d, %v", indexed, deleted, err)
+			}
+
+			results, _ := kb.Search(ctx, "release train", 5, nil)
+			if len(results) != 1 || results[0].DocumentID != "deploy.md" || !strings.Contains(results[0].Text, "release train") {
+				t.Errorf("unexpected results: %+v", results)
+			}
+		})
+	}
+}
+
+func TestBase_AddKeepsOldVersionOnError(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newIndex := range testIndexes(t) {
+		t.Run(name, func(t *testing.T) {
+			embedder := &countingEmbedder{Embedder: NewHashEmbedder(0)}
+			kb := New(newIndex(), embedder)
+			defer kb.Close()
+
+			if err := kb.Add(ctx, testDocs[0]); err != nil {
+				t.Fatalf("failed to add: %v", err)
+			}
+
+			embedder.err = errors.New("embedder down")
+			if err := kb.Add(ctx, Document{ID: testDocs[0].ID, Text: "Vacation policy moved to the wiki."}); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			results, _ := kb.Index().Documents(ctx)
+			if len(results) != 1 {
+				t.Fatalf("unexpected documents: %v", results)
+			}
+			embedder.err = nil
+			found, _ := kb.Search(ctx, "vacation days", 1, nil)
+			if len(found) != 1 || !strings.Contains(found[0].Text, "25 vacation days") {
+				t.Errorf("expected the previous version, got %+v", found)
+			}
+		})
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	if chunks := SplitText("  \n ", 100, 10); chunks != nil {
+		t.Errorf("expected no chunks, got %q", chunks)
+	}
+	if chunks := SplitText("Short text.", 100, 10); len(chunks) != 1 || chunks[0] != "Short text." {
+		t.Errorf("unexpected chunks: %q", chunks)
+	}
+
+	// Paragraphs are packed together up to the size
+	text := "First paragraph here.\n\nSecond paragraph here.\n\nThird paragraph is a bit longer than the others."
+	chunks := SplitText(text, 50, 0)
+	if len(chunks) != 2 || chunks[0] != "First paragraph here.\n\nSecond paragraph here." {
+		t.Errorf("unexpected chunks: %q", chunks)
+	}
+
+	// Long paragraphs split at words, with overlap and within the size
+	long := strings.Repeat("lorem ipsum dolor sit amet ", 40)
+	chunks = SplitText(long, 100, 20)
+	if len(chunks) < 10 {
+		t.Fatalf("expected many chunks, got %d", len(chunks))
+	}
+	for i, c := range chunks {
+		if n := utf8.RuneCountInString(c); n > 100 {
+			t.Errorf("chunk %d has %d characters", i, n)
+		}
+		if i > 0 {
+			prev := chunks[i-1]
+			if !strings.Contains(prev[len(prev)-20:], strings.Fields(c)[0]) {
+				t.Errorf("chunk %d does not overlap the previous one: %q", i, c)
+			}
+		}
+	}
+
+	// Words longer than a chunk are cut
+	chunks = SplitText(strings.Repeat("x", 250), 100, 0)
+	if len(chunks) != 3 {
+		t.Errorf("expected 3 chunks, got %d", len(chunks))
+	}
+}
+
+func TestHashEmbedder(t *testing.T) {
+	e := NewHashEmbedder(128)
+	vectors, err := e.Embed(context.Background(), []string{"Deploy the service", "deploy THE service!", "vacation days", ""})
+	if err != nil {
+		t.Fatalf("embed failed: %v", err)
+	}
+
+	same, _ := cosine(vectors[0], vectors[1])
+	other, _ := cosine(vectors[0], vectors[2])
+	if same < 0.999 {
+		t.Errorf("expected identical words to match, got %v", same)
+	}
+	if other >= same {
+		t.Errorf("expected unrelated text to score lower: %v >= %v", other, same)
+	}
+	if empty, _ := cosine(vectors[0], vectors[3]); empty != 0 {
+		t.Errorf("expected 0 for empty text, got %v", empty)
+	}
+}
+
+func TestHTTPEmbedders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		switch r.URL.Path {
+		case "/api/embed":
+			if req.Model != "nomic-embed-text" {
+				t.Errorf("unexpected model %q", req.Model)
+			}
+			vectors := make([][]float32, len(req.Input))
+			for i := range req.Input {
+				vectors[i] = []float32{float32(i), 1}
+			}
+			json.NewEncoder(w).Encode(map[string]any{"embeddings": vectors})
+
+		case "/v1/embeddings":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			// Out of order, as the API allows
+			json.NewEncoder(w).Encode(map[string]any{"data": []map[string]any{
+				{"index": 1, "embedding": []float32{1, 1}},
+				{"index": 0, "embedding": []float32{0, 1}},
+			}})
+		}
+	}))
+	defer server.Close()
+
+	texts := []string{"a", "b"}
+
+	vectors, err := NewOllamaEmbedder(WithEmbedBaseURL(server.URL)).Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("ollama embed failed: %v", err)
+	}
+	if len(vectors) != 2 || vectors[1][0] != 1 {
+		t.Errorf("unexpected ollama vectors: %v", vectors)
+	}
+
+	openai := NewOpenAIEmbedder(WithEmbedBaseURL(server.URL+"/v1"), WithEmbedAPIKey("secret"))
+	vectors, err = openai.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("openai embed failed: %v", err)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 0 || vectors[1][0] != 1 {
+		t.Errorf("unexpected openai vectors: %v", vectors)
+	}
+
+	if _, err := NewOpenAIEmbedder(WithEmbedBaseURL(server.URL+"/v1")).Embed(context.Background(), texts); err == nil {
+		t.Error("expected error without api key")
+	}
+}
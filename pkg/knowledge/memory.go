@@ -0,0 +1,166 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+)
+
+// MemoryIndex is an in-memory Index that compares the query with every
+// chunk. It suits corpora of up to some tens of thousands of chunks.
+type MemoryIndex struct {
+	mu     sync.RWMutex
+	chunks map[string]Chunk
+	hashes map[string]string
+}
+
+// NewMemoryIndex creates an empty in-memory index.
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{chunks: make(map[string]Chunk), hashes: make(map[string]string)}
+}
+
+// Upsert adds chunks, replacing chunks with the same ID.
+func (x *MemoryIndex) Upsert(ctx context.Context, chunks ...Chunk) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, c := range chunks {
+		x.chunks[c.ID] = c
+	}
+	return nil
+}
+
+// ReplaceDocument replaces all chunks of a document and records its hash.
+func (x *MemoryIndex) ReplaceDocument(ctx context.Context, documentID, hash string, chunks []Chunk) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.deleteDocument(documentID)
+	for _, c := range chunks {
+		x.chunks[c.ID] = c
+	}
+	x.hashes[documentID] = hash
+	return nil
+}
+
+// Documents returns the content hash of every document, by ID.
+func (x *MemoryIndex) Documents(ctx context.Context) (map[string]string, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	docs := maps.Clone(x.hashes)
+	for _, c := range x.chunks {
+		if _, ok := docs[c.DocumentID]; !ok {
+			docs[c.DocumentID] = ""
+		}
+	}
+	return docs, nil
+}
+
+// Search returns the k chunks most similar to vector that match filter.
+func (x *MemoryIndex) Search(ctx context.Context, vector []float32, k int, filter Filter) ([]Result, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	top := newTopK(k)
+	for _, c := range x.chunks {
+		if !filter.Match(c.Metadata) {
+			continue
+		}
+		score, err := cosine(vector, c.Vector)
+		if err != nil {
+			return nil, err
+		}
+		top.add(Result{Chunk: c, Score: score})
+	}
+	return top.results(), nil
+}
+
+// DeleteDocument removes all chunks of a document, and its hash.
+func (x *MemoryIndex) DeleteDocument(ctx context.Context, documentID string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.deleteDocument(documentID)
+	return nil
+}
+
+// deleteDocument removes a document. The caller holds the lock.
+func (x *MemoryIndex) deleteDocument(documentID string) {
+	for id, c := range x.chunks {
+		if c.DocumentID == documentID {
+			delete(x.chunks, id)
+		}
+	}
+	delete(x.hashes, documentID)
+}
+
+// Count returns the number of chunks.
+func (x *MemoryIndex) Count(ctx context.Context) (int, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.chunks), nil
+}
+
+// Close does nothing.
+func (x *MemoryIndex) Close() error {
+	return nil
+}
+
+// topK keeps the k best results seen.
+type topK struct {
+	k    int
+	best []Result // sorted, best first
+}
+
+func newTopK(k int) *topK {
+	return &topK{k: max(k, 1)}
+}
+
+func (t *topK) add(r Result) {
+	if len(t.best) == t.k && r.Score <= t.best[len(t.best)-1].Score {
+		return
+	}
+	i, _ := slices.BinarySearchFunc(t.best, r.Score, func(e Result, score float64) int {
+		// Descending by score
+		switch {
+		case e.Score > score:
+			return -1
+		case e.Score < score:
+			return 1
+		}
+		return 0
+	})
+	t.best = slices.Insert(t.best, i, r)
+	if len(t.best) > t.k {
+		t.best = t.best[:t.k]
+	}
+}
+
+func (t *topK) results() []Result {
+	return t.best
+}
+
+// cosine returns the cosine similarity of two vectors.
+func cosine(a, b []float32) (float64, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("%w: query has %d, chunk has %d", ErrDimensionMismatch, len(a), len(b))
+	}
+
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0, nil
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb)), nil
+}
+
+// Compile-time check that MemoryIndex implements Index.
+var _ Index = (*MemoryIndex)(nil)
@@ -0,0 +1,241 @@
+package knowledge
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	_ "modernc.org/sqlite" // Pure Go SQLite driver
+)
+
+// SQLiteIndex is an Index persisted in SQLite. Metadata filters run in
+// SQL; similarity is computed over the remaining chunks, like MemoryIndex.
+type SQLiteIndex struct {
+	db *sql.DB
+}
+
+// NewSQLiteIndex opens or creates an index. Path can be a file path or
+// ":memory:".
+func NewSQLiteIndex(dbPath string) (*SQLiteIndex, error) {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if dbPath == ":memory:" {
+		// Each connection would get its own database
+		db.SetMaxOpenConns(1)
+	}
+
+	for _, pragma := range []string{"journal_mode = WAL", "synchronous = NORMAL", "busy_timeout = 5000"} {
+		if _, err := db.Exec("PRAGMA " + pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to set pragma %s: %w", pragma, err)
+		}
+	}
+
+	schema := `
+		CREATE TABLE IF NOT EXISTS chunks (
+			id TEXT PRIMARY KEY,
+			document_id TEXT NOT NULL,
+			text TEXT NOT NULL,
+			metadata TEXT NOT NULL,
+			vector BLOB NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_chunks_document_id ON chunks(document_id);
+		CREATE TABLE IF NOT EXISTS documents (
+			id TEXT PRIMARY KEY,
+			hash TEXT NOT NULL
+		);
+	`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	return &SQLiteIndex{db: db}, nil
+}
+
+// Upsert adds chunks, replacing chunks with the same ID.
+func (x *SQLiteIndex) Upsert(ctx context.Context, chunks ...Chunk) error {
+	tx, err := x.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertChunks(ctx, tx, chunks); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceDocument replaces all chunks of a document and records its hash,
+// in one transaction.
+func (x *SQLiteIndex) ReplaceDocument(ctx context.Context, documentID, hash string, chunks []Chunk) error {
+	tx, err := x.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM chunks WHERE document_id = ?", documentID); err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	if err := insertChunks(ctx, tx, chunks); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO documents (id, hash) VALUES (?, ?)", documentID, hash); err != nil {
+		return fmt.Errorf("failed to record document: %w", err)
+	}
+	return tx.Commit()
+}
+
+// insertChunks writes chunks in a transaction.
+func insertChunks(ctx context.Context, tx *sql.Tx, chunks []Chunk) error {
+	stmt, err := tx.PrepareContext(ctx,
+		"INSERT OR REPLACE INTO chunks (id, document_id, text, metadata, vector) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, c := range chunks {
+		metadata := c.Metadata
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		meta, err := json.Marshal(metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+		if _, err := stmt.ExecContext(ctx, c.ID, c.DocumentID, c.Text, string(meta), encodeVector(c.Vector)); err != nil {
+			return fmt.Errorf("failed to insert chunk: %w", err)
+		}
+	}
+	return nil
+}
+
+// Documents returns the content hash of every document, by ID.
+func (x *SQLiteIndex) Documents(ctx context.Context) (map[string]string, error) {
+	rows, err := x.db.QueryContext(ctx, `
+		SELECT id, hash FROM documents
+		UNION
+		SELECT DISTINCT document_id, '' FROM chunks WHERE document_id NOT IN (SELECT id FROM documents)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query documents: %w", err)
+	}
+	defer rows.Close()
+
+	docs := make(map[string]string)
+	for rows.Next() {
+		var id, hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		docs[id] = hash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return docs, nil
+}
+
+// Search returns the k chunks most similar to vector that match filter.
+func (x *SQLiteIndex) Search(ctx context.Context, vector []float32, k int, filter Filter) ([]Result, error) {
+	query := "SELECT id, document_id, text, metadata, vector FROM chunks"
+	var where []string
+	var args []any
+	for key, value := range filter {
+		where = append(where, "json_extract(metadata, ?) = ?")
+		args = append(args, `$."`+strings.ReplaceAll(key, `"`, `\"`)+`"`, value)
+	}
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	rows, err := x.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunks: %w", err)
+	}
+	defer rows.Close()
+
+	top := newTopK(k)
+	for rows.Next() {
+		var c Chunk
+		var meta string
+		var vec []byte
+		if err := rows.Scan(&c.ID, &c.DocumentID, &c.Text, &meta, &vec); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		c.Vector = decodeVector(vec)
+
+		score, err := cosine(vector, c.Vector)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(meta), &c.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to parse metadata: %w", err)
+		}
+		top.add(Result{Chunk: c, Score: score})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return top.results(), nil
+}
+
+// DeleteDocument removes all chunks of a document, and its hash.
+func (x *SQLiteIndex) DeleteDocument(ctx context.Context, documentID string) error {
+	tx, err := x.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM chunks WHERE document_id = ?", documentID); err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM documents WHERE id = ?", documentID); err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Count returns the number of chunks.
+func (x *SQLiteIndex) Count(ctx context.Context) (int, error) {
+	var n int
+	if err := x.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM chunks").Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count chunks: %w", err)
+	}
+	return n, nil
+}
+
+// Close closes the database.
+func (x *SQLiteIndex) Close() error {
+	return x.db.Close()
+}
+
+// encodeVector packs a vector as little-endian float32s.
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
+
+// Compile-time check that SQLiteIndex implements Index.
+var _ Index = (*SQLiteIndex)(nil)
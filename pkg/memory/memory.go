@@ -0,0 +1,609 @@
+// Package memory gives agents long-term memory across sessions. Facts are
+// kept in a storage.Store, per agent and optionally per user, and are
+// recalled by relevance to a query, weighted by how recently they were
+// used.
+package memory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/storo/lattice/pkg/knowledge"
+	"github.com/storo/lattice/pkg/storage"
+)
+
+// Memory errors
+var (
+	ErrNotFound      = errors.New("memory not found")
+	ErrContentEmpty  = errors.New("memory content is empty")
+	ErrAgentRequired = errors.New("agent is required")
+	ErrUserRequired  = errors.New("user is required")
+)
+
+// Defaults
+const (
+	DefaultHalfLife    = 30 * 24 * time.Hour
+	DefaultInjectLimit = 10
+	DefaultMaxPerScope = 1000
+)
+
+// keyPrefix is the storage key prefix of memories.
+const keyPrefix = "memory:"
+
+// Memory is a remembered fact.
+type Memory struct {
+	ID string `json:"id"`
+
+	// Agent is the agent that remembers the fact.
+	Agent string `json:"agent"`
+
+	// User is the user the fact is about; empty for facts the agent keeps
+	// for every user.
+	User string `json:"user,omitempty"`
+
+	Content string   `json:"content"`
+	Tags    []string `json:"tags,omitempty"`
+
+	// Uses counts how often the memory was recalled.
+	Uses int `json:"uses,omitempty"`
+
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	LastUsedAt time.Time `json:"last_used_at,omitzero"`
+	ExpiresAt  time.Time `json:"expires_at,omitzero"`
+
+	// Vector is the content's embedding, when the store has an embedder.
+	Vector []float32 `json:"vector,omitempty"`
+}
+
+// Recalled is a memory found by Recall.
+type Recalled struct {
+	*Memory
+
+	// Relevance is how well the memory matches the query, from 0 to 1.
+	Relevance float64 `json:"relevance"`
+
+	// Score ranks results: relevance weighted by recency.
+	Score float64 `json:"score"`
+}
+
+// Store keeps memories in a storage.Store.
+type Store struct {
+	store       storage.Store
+	embedder    knowledge.Embedder
+	ttl         time.Duration
+	halfLife    time.Duration
+	minWeight   float64
+	injectLimit int
+	maxPerScope int
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithTTL expires memories that were not updated for d (default: never).
+func WithTTL(d time.Duration) Option {
+	return func(s *Store) {
+		s.ttl = d
+	}
+}
+
+// WithHalfLife sets how fast unused memories lose weight in recall: a
+// memory last used one half-life ago counts half as much (default 30 days).
+func WithHalfLife(d time.Duration) Option {
+	return func(s *Store) {
+		s.halfLife = d
+	}
+}
+
+// WithMinWeight forgets memories whose recency weight decayed below w,
+// between 0 and 1 (default 0: never).
+func WithMinWeight(w float64) Option {
+	return func(s *Store) {
+		s.minWeight = w
+	}
+}
+
+// WithEmbedder recalls memories by embedding similarity instead of shared
+// words.
+func WithEmbedder(e knowledge.Embedder) Option {
+	return func(s *Store) {
+		s.embedder = e
+	}
+}
+
+// WithInjectLimit sets how many memories are added to an agent's system
+// prompt at the start of a run (default 10; 0 disables injection).
+func WithInjectLimit(n int) Option {
+	return func(s *Store) {
+		s.injectLimit = n
+	}
+}
+
+// WithMaxPerScope caps the memories per agent and user. Remembering more
+// forgets the least weighted ones (default 1000).
+func WithMaxPerScope(n int) Option {
+	return func(s *Store) {
+		s.maxPerScope = n
+	}
+}
+
+// New creates a memory store.
+func New(store storage.Store, opts ...Option) *Store {
+	s := &Store{
+		store:       store,
+		halfLife:    DefaultHalfLife,
+		injectLimit: DefaultInjectLimit,
+		maxPerScope: DefaultMaxPerScope,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Remember stores a fact for an agent and user (empty for all users). If
+// the scope already holds the same content, that memory is refreshed
+// instead. A memory's ID derives from its scope and content, so that
+// concurrent calls with the same fact store it once.
+func (s *Store) Remember(ctx context.Context, agent, user, content string, tags ...string) (*Memory, error) {
+	if agent == "" {
+		return nil, ErrAgentRequired
+	}
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, ErrContentEmpty
+	}
+
+	existing, err := s.scope(ctx, agent, user)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	for _, m := range existing {
+		if strings.EqualFold(m.Content, content) {
+			return s.refresh(ctx, m, tags, now)
+		}
+	}
+
+	m := &Memory{
+		ID:        contentID(agent, user, content),
+		Agent:     agent,
+		User:      user,
+		Content:   content,
+		Tags:      mergeTags(nil, tags),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if s.embedder != nil {
+		vectors, err := s.embedder.Embed(ctx, []string{content})
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed memory: %w", err)
+		}
+		if len(vectors) == 1 {
+			m.Vector = vectors[0]
+		}
+	}
+	created, err := s.create(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		// Remembered concurrently since the scope was read
+		current, err := s.load(ctx, key(agent, user, m.ID))
+		if err != nil {
+			return nil, err
+		}
+		return s.refresh(ctx, current, tags, now)
+	}
+
+	// Make room by forgetting the least weighted memories
+	if scope := append([]*Memory{m}, existing...); s.maxPerScope > 0 && len(scope) > s.maxPerScope {
+		sort.SliceStable(scope, func(i, j int) bool {
+			return s.weight(scope[i], now) > s.weight(scope[j], now)
+		})
+		if err := s.delete(ctx, scope[s.maxPerScope:]); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// refresh adds tags to a remembered memory and marks it updated.
+func (s *Store) refresh(ctx context.Context, m *Memory, tags []string, now time.Time) (*Memory, error) {
+	m.Tags = mergeTags(m.Tags, tags)
+	m.UpdatedAt = now
+	if err := s.save(ctx, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// contentID is the ID of a memory: a hash of its scope and content,
+// ignoring case like the duplicate check in Remember.
+func contentID(agent, user, content string) string {
+	sum := sha256.Sum256([]byte(agent + "\x00" + user + "\x00" + strings.ToLower(content)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Recall returns up to limit of the agent's memories about the user and
+// for all users, best first. With a query, only memories relevant to it
+// are returned; without one, the most recently used are. Returned
+// memories count as used, which keeps them from decaying.
+func (s *Store) Recall(ctx context.Context, agent, user, query string, limit int) ([]*Recalled, error) {
+	results, err := s.rank(ctx, agent, user, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(query) != "" {
+		results = slices.DeleteFunc(results, func(r *Recalled) bool { return r.Relevance <= 0 })
+	}
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	if err := s.touch(ctx, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Relevant returns up to limit memories for the start of a run: those
+// relevant to input first, then the most recently used.
+func (s *Store) Relevant(ctx context.Context, agent, user, input string, limit int) ([]*Recalled, error) {
+	results, err := s.rank(ctx, agent, user, input)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	if err := s.touch(ctx, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// rank scores the agent's memories about the user, and for all users,
+// against a query. Memories that decayed below the minimum weight are
+// left out, and forgotten once ranking is done.
+func (s *Store) rank(ctx context.Context, agent, user, query string) ([]*Recalled, error) {
+	memories, err := s.scope(ctx, agent, "")
+	if err != nil {
+		return nil, err
+	}
+	if user != "" {
+		userMemories, err := s.scope(ctx, agent, user)
+		if err != nil {
+			return nil, err
+		}
+		memories = append(memories, userMemories...)
+	}
+
+	var queryVector []float32
+	queryWords := words(query)
+	if s.embedder != nil && len(queryWords) > 0 {
+		vectors, err := s.embedder.Embed(ctx, []string{query})
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed query: %w", err)
+		}
+		if len(vectors) == 1 {
+			queryVector = vectors[0]
+		}
+	}
+
+	now := time.Now()
+	results := make([]*Recalled, 0, len(memories))
+	var decayed []*Memory
+	for _, m := range memories {
+		w := s.weight(m, now)
+		if s.minWeight > 0 && w < s.minWeight {
+			decayed = append(decayed, m)
+			continue
+		}
+
+		var relevance float64
+		if queryVector != nil && len(m.Vector) == len(queryVector) {
+			relevance = max(cosine(queryVector, m.Vector), 0)
+		} else {
+			relevance = overlap(queryWords, words(m.Content+" "+strings.Join(m.Tags, " ")))
+		}
+
+		// Relevance dominates; recency breaks ties and orders the rest
+		results = append(results, &Recalled{Memory: m, Relevance: relevance, Score: (relevance + 0.1) * w})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if err := s.delete(ctx, decayed); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// touch marks memories as used.
+func (s *Store) touch(ctx context.Context, results []*Recalled) error {
+	now := time.Now().UTC()
+	for _, r := range results {
+		r.LastUsedAt = now
+		r.Uses++
+		if err := s.save(ctx, r.Memory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delete forgets memories.
+func (s *Store) delete(ctx context.Context, memories []*Memory) error {
+	for _, m := range memories {
+		if err := s.store.Delete(ctx, key(m.Agent, m.User, m.ID)); err != nil {
+			return fmt.Errorf("failed to delete memory: %w", err)
+		}
+	}
+	return nil
+}
+
+// weight is a memory's recency weight: 1 when just used, halving every
+// half-life since.
+func (s *Store) weight(m *Memory, now time.Time) float64 {
+	if s.halfLife <= 0 {
+		return 1
+	}
+	last := m.UpdatedAt
+	if m.LastUsedAt.After(last) {
+		last = m.LastUsedAt
+	}
+	age := now.Sub(last)
+	if age <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, float64(age)/float64(s.halfLife))
+}
+
+// Get returns a memory by ID.
+func (s *Store) Get(ctx context.Context, id string) (*Memory, error) {
+	keys, err := s.store.Keys(ctx, keyPrefix+"*:*:"+escape(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find memory: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, ErrNotFound
+	}
+	return s.load(ctx, keys[0])
+}
+
+// List returns the memories of an agent about a user, oldest first. An
+// empty agent lists them across all agents and an empty user lists the
+// memories about every user, including those for all users.
+func (s *Store) List(ctx context.Context, agent, user string) ([]*Memory, error) {
+	a, u := "*", "*"
+	if agent != "" {
+		a = escape(agent)
+	}
+	if user != "" {
+		u = escape(user)
+	}
+	return s.list(ctx, keyPrefix+a+":"+u+":*")
+}
+
+// scope returns the memories of an agent about exactly one user, or those
+// for all users when user is empty.
+func (s *Store) scope(ctx context.Context, agent, user string) ([]*Memory, error) {
+	return s.list(ctx, keyPrefix+escape(agent)+":"+escape(user)+":*")
+}
+
+// list loads the memories whose keys match pattern, oldest first.
+func (s *Store) list(ctx context.Context, pattern string) ([]*Memory, error) {
+	keys, err := s.store.Keys(ctx, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memories: %w", err)
+	}
+
+	memories := make([]*Memory, 0, len(keys))
+	for _, k := range keys {
+		m, err := s.load(ctx, k)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		memories = append(memories, m)
+	}
+
+	sort.Slice(memories, func(i, j int) bool {
+		return memories[i].CreatedAt.Before(memories[j].CreatedAt)
+	})
+	return memories, nil
+}
+
+// Forget deletes a memory. When agent is set, the memory must be the
+// agent's, shared or about user; an empty agent deletes any memory.
+func (s *Store) Forget(ctx context.Context, agent, user, id string) error {
+	m, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if agent != "" && (m.Agent != agent || m.User != "" && m.User != user) {
+		return ErrNotFound
+	}
+	return s.store.Delete(ctx, key(m.Agent, m.User, m.ID))
+}
+
+// ForgetUser deletes everything remembered about a user, across agents
+// when agent is empty, and returns how many memories were deleted. Use it
+// for privacy requests.
+func (s *Store) ForgetUser(ctx context.Context, agent, user string) (int, error) {
+	if user == "" {
+		return 0, ErrUserRequired
+	}
+
+	memories, err := s.List(ctx, agent, user)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.delete(ctx, memories); err != nil {
+		return 0, err
+	}
+	return len(memories), nil
+}
+
+// save writes a memory, keeping its expiry.
+func (s *Store) save(ctx context.Context, m *Memory) error {
+	data, ttl, err := s.encode(m)
+	if err != nil {
+		return err
+	}
+	if ttl < 0 {
+		return s.store.Delete(ctx, key(m.Agent, m.User, m.ID))
+	}
+	if err := s.store.Set(ctx, key(m.Agent, m.User, m.ID), data, ttl); err != nil {
+		return fmt.Errorf("failed to save memory: %w", err)
+	}
+	return nil
+}
+
+// create writes a new memory and reports whether it did. With an
+// atomic store it does not overwrite a memory with the same ID.
+func (s *Store) create(ctx context.Context, m *Memory) (bool, error) {
+	atomic, ok := s.store.(storage.AtomicStore)
+	if !ok {
+		return true, s.save(ctx, m)
+	}
+
+	data, ttl, err := s.encode(m)
+	if err != nil {
+		return false, err
+	}
+	created, err := atomic.SetNX(ctx, key(m.Agent, m.User, m.ID), data, max(ttl, 0))
+	if err != nil {
+		return false, fmt.Errorf("failed to save memory: %w", err)
+	}
+	return created, nil
+}
+
+// encode marshals a memory and returns the TTL to store it with, which
+// is negative when it has already expired.
+func (s *Store) encode(m *Memory) ([]byte, time.Duration, error) {
+	var ttl time.Duration
+	if s.ttl > 0 {
+		m.ExpiresAt = m.UpdatedAt.Add(s.ttl)
+		ttl = time.Until(m.ExpiresAt)
+		if ttl <= 0 {
+			return nil, -1, nil
+		}
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to marshal memory: %w", err)
+	}
+	return data, ttl, nil
+}
+
+func (s *Store) load(ctx context.Context, k string) (*Memory, error) {
+	data, err := s.store.Get(ctx, k)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get memory: %w", err)
+	}
+
+	var m Memory
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal memory: %w", err)
+	}
+	return &m, nil
+}
+
+// key is the storage key of a memory. The parts are escaped so that
+// separators and glob characters in names cannot widen a pattern.
+func key(agent, user, id string) string {
+	return keyPrefix + escape(agent) + ":" + escape(user) + ":" + escape(id)
+}
+
+// escape escapes a key part. "-" stands for an empty part, such as the
+// user of a shared memory, so a literal "-" is escaped too.
+func escape(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(url.QueryEscape(s), "-", "%2D")
+}
+
+// stopWords are ignored when matching a query to memories.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "do": true, "does": true, "for": true, "from": true,
+	"has": true, "have": true, "i": true, "in": true, "is": true, "it": true,
+	"me": true, "my": true, "of": true, "on": true, "or": true, "that": true,
+	"the": true, "this": true, "to": true, "was": true, "what": true, "with": true,
+	"you": true, "your": true,
+}
+
+// words returns the distinct lowercased words of s, without stop words.
+func words(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if !stopWords[w] {
+			set[w] = true
+		}
+	}
+	return set
+}
+
+// overlap returns the fraction of query words found in text.
+func overlap(query, text map[string]bool) float64 {
+	if len(query) == 0 {
+		return 0
+	}
+	n := 0
+	for w := range query {
+		if text[w] || text[strings.TrimSuffix(w, "s")] || text[w+"s"] {
+			n++
+		}
+	}
+	return float64(n) / float64(len(query))
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+func mergeTags(tags, more []string) []string {
+	for _, t := range more {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,394 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/knowledge"
+	"github.com/storo/lattice/pkg/storage"
+)
+
+func TestStore_Remember(t *testing.T) {
+	ctx := context.Background()
+	s := New(storage.NewMemoryStore())
+
+	first, err := s.Remember(ctx, "assistant", "alice", "Alice prefers dark mode", "ui")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	again, err := s.Remember(ctx, "assistant", "alice", "alice prefers dark mode ", "Settings")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again.ID != first.ID || strings.Join(again.Tags, ",") != "ui,settings" {
+		t.Errorf("expected the same memory with merged tags, got %+v", again)
+	}
+
+	s.Remember(ctx, "assistant", "bob", "Bob prefers dark mode")
+	s.Remember(ctx, "assistant", "", "The office closes at 6pm")
+	s.Remember(ctx, "coder", "alice", "Alice writes Go")
+
+	tests := []struct {
+		agent, user string
+		want        int
+	}{
+		{"assistant", "alice", 1},
+		{"assistant", "", 3},
+		{"", "alice", 2},
+		{"", "", 4},
+	}
+	for _, tt := range tests {
+		list, err := s.List(ctx, tt.agent, tt.user)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(list) != tt.want {
+			t.Errorf("List(%q, %q): expected %d memories, got %d", tt.agent, tt.user, tt.want, len(list))
+		}
+	}
+
+	if _, err := s.Remember(ctx, "", "alice", "x"); !errors.Is(err, ErrAgentRequired) {
+		t.Errorf("expected ErrAgentRequired, got %v", err)
+	}
+	if _, err := s.Remember(ctx, "assistant", "alice", "  "); !errors.Is(err, ErrContentEmpty) {
+		t.Errorf("expected ErrContentEmpty, got %v", err)
+	}
+}
+
+func TestStore_RememberConcurrently(t *testing.T) {
+	ctx := context.Background()
+	s := New(storage.NewMemoryStore())
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Remember(ctx, "assistant", "alice", "Alice prefers dark mode", fmt.Sprint("tag", i)); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if list, _ := s.List(ctx, "assistant", "alice"); len(list) != 1 {
+		t.Errorf("expected one memory, got %d", len(list))
+	}
+}
+
+// failingDeletes is a store whose deletes fail.
+type failingDeletes struct {
+	*storage.MemoryStore
+}
+
+func (s failingDeletes) Delete(ctx context.Context, key string) error {
+	return errors.New("store unavailable")
+}
+
+func TestStore_DeleteErrors(t *testing.T) {
+	ctx := context.Background()
+	s := New(failingDeletes{storage.NewMemoryStore()}, WithMaxPerScope(1), WithHalfLife(time.Hour), WithMinWeight(0.5))
+
+	old, _ := s.Remember(ctx, "assistant", "alice", "one")
+	if _, err := s.Remember(ctx, "assistant", "alice", "two"); err == nil {
+		t.Error("expected the failed cap delete to be returned")
+	}
+
+	old.UpdatedAt = old.UpdatedAt.Add(-24 * time.Hour)
+	s.save(ctx, old)
+	if _, err := s.Recall(ctx, "assistant", "alice", "one", 10); err == nil {
+		t.Error("expected the failed decay delete to be returned")
+	}
+}
+
+func TestStore_Recall(t *testing.T) {
+	ctx := context.Background()
+	s := New(storage.NewMemoryStore())
+
+	s.Remember(ctx, "assistant", "alice", "Alice's favourite editor is Vim")
+	s.Remember(ctx, "assistant", "alice", "Alice is allergic to peanuts", "food")
+	s.Remember(ctx, "assistant", "", "Lunch is served at noon", "food")
+	s.Remember(ctx, "assistant", "bob", "Bob is vegetarian", "food")
+
+	results, err := s.Recall(ctx, "assistant", "alice", "what food should I order", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected alice's and the shared food memories, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.User == "bob" || !strings.Contains(strings.Join(r.Tags, " "), "food") {
+			t.Errorf("unexpected memory %+v", r.Memory)
+		}
+		if r.Uses != 1 {
+			t.Errorf("expected recalled memory to be used once, got %d", r.Uses)
+		}
+	}
+
+	results, _ = s.Recall(ctx, "assistant", "alice", "which editor", 10)
+	if len(results) != 1 || !strings.Contains(results[0].Content, "Vim") {
+		t.Errorf("unexpected editor results %+v", results)
+	}
+
+	results, _ = s.Recall(ctx, "assistant", "alice", "", 2)
+	if len(results) != 2 {
+		t.Errorf("expected the limit without a query, got %d", len(results))
+	}
+
+	results, _ = s.Recall(ctx, "other", "alice", "food", 10)
+	if len(results) != 0 {
+		t.Errorf("expected no memories for another agent, got %d", len(results))
+	}
+}
+
+func TestStore_RecallDecay(t *testing.T) {
+	ctx := context.Background()
+	s := New(storage.NewMemoryStore(), WithHalfLife(24*time.Hour), WithMinWeight(0.1))
+
+	stale, _ := s.Remember(ctx, "assistant", "alice", "Alice uses the staging cluster")
+	old, _ := s.Remember(ctx, "assistant", "alice", "Alice deploys to the production cluster")
+	recent, _ := s.Remember(ctx, "assistant", "alice", "Alice maintains the cluster dashboards")
+
+	// Age the memories: the stale one decays below the minimum weight
+	for m, age := range map[*Memory]time.Duration{stale: 5 * 24 * time.Hour, old: 2 * 24 * time.Hour} {
+		m.UpdatedAt = m.UpdatedAt.Add(-age)
+		s.save(ctx, m)
+	}
+
+	results, err := s.Recall(ctx, "assistant", "alice", "cluster", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != recent.ID || results[1].ID != old.ID {
+		t.Fatalf("expected recent before old, got %+v", results)
+	}
+	if _, err := s.Get(ctx, stale.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the decayed memory to be forgotten, got %v", err)
+	}
+
+	// Recalling refreshes a memory's weight
+	results, _ = s.Recall(ctx, "assistant", "alice", "production", 10)
+	if len(results) != 1 || s.weight(results[0].Memory, time.Now()) < 0.99 {
+		t.Errorf("expected the recalled memory to be refreshed, got %+v", results)
+	}
+}
+
+func TestStore_MaxPerScope(t *testing.T) {
+	ctx := context.Background()
+	s := New(storage.NewMemoryStore(), WithMaxPerScope(2))
+
+	first, _ := s.Remember(ctx, "assistant", "alice", "one")
+	first.UpdatedAt = first.UpdatedAt.Add(-time.Hour)
+	s.save(ctx, first)
+	s.Remember(ctx, "assistant", "alice", "two")
+	s.Remember(ctx, "assistant", "alice", "three")
+	s.Remember(ctx, "assistant", "bob", "four")
+
+	list, _ := s.List(ctx, "assistant", "alice")
+	if len(list) != 2 {
+		t.Fatalf("expected 2 memories, got %d", len(list))
+	}
+	for _, m := range list {
+		if m.ID == first.ID {
+			t.Error("expected the least recent memory to be forgotten")
+		}
+	}
+}
+
+func TestStore_TTL(t *testing.T) {
+	ctx := context.Background()
+	s := New(storage.NewMemoryStore(), WithTTL(50*time.Millisecond))
+
+	m, _ := s.Remember(ctx, "assistant", "alice", "Alice is on call this week")
+	if m.ExpiresAt.IsZero() {
+		t.Error("expected an expiry")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := s.Get(ctx, m.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the memory to expire, got %v", err)
+	}
+}
+
+func TestStore_Forget(t *testing.T) {
+	ctx := context.Background()
+	s := New(storage.NewMemoryStore())
+
+	alice, _ := s.Remember(ctx, "assistant", "alice", "Alice lives in Lisbon")
+	shared, _ := s.Remember(ctx, "assistant", "", "The wiki moved")
+	other, _ := s.Remember(ctx, "coder", "alice", "Alice writes Go")
+	s.Remember(ctx, "coder", "bob", "Bob writes Rust")
+
+	if err := s.Forget(ctx, "assistant", "bob", alice.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected another user's memory to be hidden, got %v", err)
+	}
+	if err := s.Forget(ctx, "assistant", "alice", other.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected another agent's memory to be hidden, got %v", err)
+	}
+	if err := s.Forget(ctx, "assistant", "bob", shared.ID); err != nil {
+		t.Errorf("unexpected error forgetting a shared memory: %v", err)
+	}
+	if err := s.Forget(ctx, "", "", alice.ID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	s.Remember(ctx, "assistant", "alice", "Alice likes tea")
+	n, err := s.ForgetUser(ctx, "", "alice")
+	if err != nil || n != 2 {
+		t.Errorf("expected 2 memories forgotten, got %d (%v)", n, err)
+	}
+	if list, _ := s.List(ctx, "", ""); len(list) != 1 || list[0].User != "bob" {
+		t.Errorf("expected only bob's memory to remain, got %+v", list)
+	}
+	if _, err := s.ForgetUser(ctx, "", ""); !errors.Is(err, ErrUserRequired) {
+		t.Errorf("expected ErrUserRequired, got %v", err)
+	}
+}
+
+func TestStore_DashUser(t *testing.T) {
+	ctx := context.Background()
+	s := New(storage.NewMemoryStore())
+
+	// "-" also stands for the empty user of shared memories in keys
+	m, _ := s.Remember(ctx, "assistant", "-", "Dash likes tea")
+	if m.User != "-" {
+		t.Fatalf("unexpected user %q", m.User)
+	}
+	if shared, _ := s.Recall(ctx, "assistant", "bob", "tea", 5); len(shared) != 0 {
+		t.Errorf("expected the memory not to be shared, got %+v", shared)
+	}
+	if list, _ := s.List(ctx, "assistant", "-"); len(list) != 1 {
+		t.Errorf("expected the memory under its user, got %+v", list)
+	}
+}
+
+func TestStore_Embedder(t *testing.T) {
+	ctx := context.Background()
+	s := New(storage.NewMemoryStore(), WithEmbedder(knowledge.NewHashEmbedder(256)))
+
+	s.Remember(ctx, "assistant", "alice", "Alice's favourite colour is green")
+	s.Remember(ctx, "assistant", "alice", "Alice runs marathons")
+
+	results, err := s.Recall(ctx, "assistant", "alice", "favourite colour", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Content, "green") || len(results[0].Vector) != 256 {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
+
+func TestTools(t *testing.T) {
+	s := New(storage.NewMemoryStore())
+	run := toolRunner(t, Tools(s, "assistant", WithSharedWrites()))
+
+	alice := core.WithUserID(context.Background(), "alice")
+	bob := core.WithUserID(context.Background(), "bob")
+
+	out, err := run(alice, "remember", `{"content": "Alice's cat is called Miso", "tags": ["pets"]}`)
+	if err != nil || !strings.HasPrefix(out, "Remembered") {
+		t.Fatalf("unexpected remember result %q (%v)", out, err)
+	}
+	run(alice, "remember", `{"content": "Deploys happen on Tuesdays", "scope": "shared"}`)
+
+	out, _ = run(alice, "recall", `{"query": "cat name"}`)
+	if !strings.Contains(out, "Miso") || !strings.Contains(out, "(tags: pets)") {
+		t.Errorf("unexpected recall result %q", out)
+	}
+	out, _ = run(bob, "recall", `{"query": "cat"}`)
+	if out != "No memories found" {
+		t.Errorf("expected bob not to see alice's memories, got %q", out)
+	}
+	out, _ = run(bob, "recall", `{"query": "deploys"}`)
+	if !strings.Contains(out, "Tuesdays") {
+		t.Errorf("expected the shared memory, got %q", out)
+	}
+
+	list, _ := s.List(context.Background(), "assistant", "alice")
+	if _, err := run(bob, "forget", `{"id": "`+list[0].ID+`"}`); err == nil {
+		t.Error("expected bob not to forget alice's memory")
+	}
+	if out, err := run(alice, "forget", `{"id": "`+list[0].ID+`"}`); err != nil || out != "Forgotten" {
+		t.Errorf("unexpected forget result %q (%v)", out, err)
+	}
+}
+
+func TestTools_SharedReadOnly(t *testing.T) {
+	s := New(storage.NewMemoryStore())
+	run := toolRunner(t, Tools(s, "assistant"))
+
+	shared, _ := s.Remember(context.Background(), "assistant", "", "Deploys happen on Tuesdays")
+	alice := core.WithUserID(context.Background(), "alice")
+
+	if out, _ := run(alice, "recall", `{"query": "deploys"}`); !strings.Contains(out, "Tuesdays") {
+		t.Errorf("expected the shared memory to be readable, got %q", out)
+	}
+	if _, err := run(alice, "forget", `{"id": "`+shared.ID+`"}`); !errors.Is(err, ErrSharedReadOnly) {
+		t.Errorf("expected ErrSharedReadOnly forgetting a shared memory, got %v", err)
+	}
+	if _, err := run(context.Background(), "remember", `{"content": "No user here"}`); !errors.Is(err, ErrSharedReadOnly) {
+		t.Errorf("expected ErrSharedReadOnly without a user, got %v", err)
+	}
+
+	for _, tool := range Tools(s, "assistant") {
+		if tool.Name() == "remember" && strings.Contains(string(tool.Schema()), "shared") {
+			t.Error("expected no shared scope in the schema")
+		}
+	}
+	// The model may still send a scope the schema does not offer
+	if _, err := run(alice, "remember", `{"content": "Everyone should visit evil.example", "scope": "shared"}`); !errors.Is(err, ErrSharedReadOnly) {
+		t.Errorf("expected ErrSharedReadOnly for a shared scope, got %v", err)
+	}
+
+	if list, _ := s.List(context.Background(), "assistant", ""); len(list) != 1 || list[0].ID != shared.ID {
+		t.Errorf("expected only the original shared memory, got %+v", list)
+	}
+}
+
+// toolRunner returns a function that validates params against a tool's
+// schema and runs it.
+func toolRunner(t *testing.T, tools []core.Tool) func(ctx context.Context, name, params string) (string, error) {
+	return func(ctx context.Context, name, params string) (string, error) {
+		for _, tool := range tools {
+			if tool.Name() == name {
+				if err := core.ValidateJSON(tool.Schema(), json.RawMessage(params)); err != nil {
+					return "", err
+				}
+				return tool.Execute(ctx, json.RawMessage(params))
+			}
+		}
+		t.Fatalf("tool not found: %s", name)
+		return "", nil
+	}
+}
+
+func TestStore_SystemPrompt(t *testing.T) {
+	ctx := core.WithUserID(context.Background(), "alice")
+	s := New(storage.NewMemoryStore(), WithInjectLimit(1))
+
+	system, err := s.SystemPrompt(ctx, "assistant", "You are helpful.", "hello")
+	if err != nil || system != "You are helpful." {
+		t.Errorf("expected the prompt unchanged without memories, got %q (%v)", system, err)
+	}
+
+	s.Remember(ctx, "assistant", "alice", "Alice speaks Portuguese")
+	s.Remember(ctx, "assistant", "alice", "Alice works on billing")
+
+	system, _ = s.SystemPrompt(ctx, "assistant", "You are helpful.", "reply in the language Alice speaks")
+	if !strings.HasPrefix(system, "You are helpful.\n\n") || !strings.Contains(system, "Portuguese") || strings.Contains(system, "billing") {
+		t.Errorf("unexpected system prompt %q", system)
+	}
+
+	s = New(s.store, WithInjectLimit(0))
+	if system, _ := s.SystemPrompt(ctx, "assistant", "", "billing"); system != "" {
+		t.Errorf("expected no injection, got %q", system)
+	}
+}
@@ -0,0 +1,278 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/storo/lattice/pkg/core"
+)
+
+// maxRecallLimit caps the limit the model may ask recall for.
+const maxRecallLimit = 20
+
+// ErrSharedReadOnly is returned when the model tries to save or forget a
+// shared memory without WithSharedWrites.
+var ErrSharedReadOnly = errors.New("shared memories are read-only for this agent")
+
+// ToolsOption configures the memory tools.
+type ToolsOption func(*toolsConfig)
+
+type toolsConfig struct {
+	shared bool
+}
+
+// WithSharedWrites lets the model save and forget shared memories, seen by
+// every user. Off by default, since what one user tells the agent would
+// otherwise reach the others.
+func WithSharedWrites() ToolsOption {
+	return func(c *toolsConfig) {
+		c.shared = true
+	}
+}
+
+// Tools returns the remember, recall and forget tools for an agent. They
+// act on the memories about the run's user, set with core.WithUserID, and
+// read the shared ones. Without WithSharedWrites, a run needs a user to
+// remember or forget anything.
+func Tools(s *Store, agent string, opts ...ToolsOption) []core.Tool {
+	var c toolsConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return []core.Tool{
+		&rememberTool{store: s, agent: agent, shared: c.shared},
+		&recallTool{store: s, agent: agent},
+		&forgetTool{store: s, agent: agent, shared: c.shared},
+	}
+}
+
+// writeUser returns the user whose memories a run may change.
+func writeUser(ctx context.Context, shared bool) (string, error) {
+	user := core.UserID(ctx)
+	if user == "" && !shared {
+		return "", fmt.Errorf("%w: the run has no user", ErrSharedReadOnly)
+	}
+	return user, nil
+}
+
+// rememberTool stores a fact.
+type rememberTool struct {
+	store  *Store
+	agent  string
+	shared bool
+}
+
+func (t *rememberTool) Name() string {
+	return "remember"
+}
+
+func (t *rememberTool) Description() string {
+	return "Save a lasting fact for future conversations, such as a user's preferences, " +
+		"details about their projects, or decisions made. Write one self-contained fact per call. " +
+		"Do not save secrets or passwords."
+}
+
+func (t *rememberTool) Schema() json.RawMessage {
+	scope := ""
+	if t.shared {
+		scope = `,
+			"scope": {
+				"type": "string",
+				"enum": ["user", "shared"],
+				"description": "user: about the current user (default); shared: useful for every user"
+			}`
+	}
+	return json.RawMessage(fmt.Sprintf(`{
+		"type": "object",
+		"properties": {
+			"content": {
+				"type": "string",
+				"description": "The fact to remember, as a complete sentence"
+			},
+			"tags": {
+				"type": "array",
+				"items": {"type": "string"},
+				"description": "Optional keywords to find the fact by"
+			}%s
+		},
+		"required": ["content"]
+	}`, scope))
+}
+
+func (t *rememberTool) Execute(ctx context.Context, params json.RawMessage) (string, error) {
+	var p struct {
+		Content string   `json:"content"`
+		Tags    []string `json:"tags"`
+		Scope   string   `json:"scope"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return "", fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	user, err := writeUser(ctx, t.shared)
+	if err != nil {
+		return "", err
+	}
+	if p.Scope == "shared" {
+		if !t.shared {
+			return "", ErrSharedReadOnly
+		}
+		user = ""
+	}
+
+	m, err := t.store.Remember(ctx, t.agent, user, p.Content, p.Tags...)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Remembered (id %s)", m.ID), nil
+}
+
+// recallTool searches memories.
+type recallTool struct {
+	store *Store
+	agent string
+}
+
+func (t *recallTool) Name() string {
+	return "recall"
+}
+
+func (t *recallTool) Description() string {
+	return "Search facts saved in earlier conversations with the remember tool."
+}
+
+func (t *recallTool) Schema() json.RawMessage {
+	return json.RawMessage(fmt.Sprintf(`{
+		"type": "object",
+		"properties": {
+			"query": {
+				"type": "string",
+				"description": "What to look for; empty lists the most recently used facts"
+			},
+			"limit": {
+				"type": "integer",
+				"description": "Most facts to return (default 5, max %d)"
+			}
+		}
+	}`, maxRecallLimit))
+}
+
+func (t *recallTool) Execute(ctx context.Context, params json.RawMessage) (string, error) {
+	var p struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return "", fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	limit := 5
+	if p.Limit > 0 {
+		limit = min(p.Limit, maxRecallLimit)
+	}
+
+	results, err := t.store.Recall(ctx, t.agent, core.UserID(ctx), p.Query, limit)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "No memories found", nil
+	}
+	return formatMemories(results), nil
+}
+
+// forgetTool deletes a memory.
+type forgetTool struct {
+	store  *Store
+	agent  string
+	shared bool
+}
+
+func (t *forgetTool) Name() string {
+	return "forget"
+}
+
+func (t *forgetTool) Description() string {
+	return "Delete a saved fact that is wrong, outdated, or that the user asked you to forget."
+}
+
+func (t *forgetTool) Schema() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"id": {
+				"type": "string",
+				"description": "The ID of the memory, as shown by recall"
+			}
+		},
+		"required": ["id"]
+	}`)
+}
+
+func (t *forgetTool) Execute(ctx context.Context, params json.RawMessage) (string, error) {
+	var p struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return "", fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	user, err := writeUser(ctx, t.shared)
+	if err != nil {
+		return "", err
+	}
+	if !t.shared {
+		if m, err := t.store.Get(ctx, p.ID); err == nil && m.Agent == t.agent && m.User == "" {
+			return "", ErrSharedReadOnly
+		}
+	}
+
+	err = t.store.Forget(ctx, t.agent, user, p.ID)
+	if errors.Is(err, ErrNotFound) {
+		return "", fmt.Errorf("no memory with id %s", p.ID)
+	}
+	if err != nil {
+		return "", err
+	}
+	return "Forgotten", nil
+}
+
+// formatMemories lists memories one per line with their IDs.
+func formatMemories(results []*Recalled) string {
+	var sb strings.Builder
+	for _, r := range results {
+		fmt.Fprintf(&sb, "- [%s] %s", r.ID, r.Content)
+		if len(r.Tags) > 0 {
+			fmt.Fprintf(&sb, " (tags: %s)", strings.Join(r.Tags, ", "))
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// SystemPrompt returns system with the memories relevant to input added,
+// for an agent's run for the user in ctx. It returns system unchanged
+// when there are none or injection is disabled.
+func (s *Store) SystemPrompt(ctx context.Context, agent, system, input string) (string, error) {
+	if s.injectLimit <= 0 {
+		return system, nil
+	}
+
+	results, err := s.Relevant(ctx, agent, core.UserID(ctx), input, s.injectLimit)
+	if err != nil {
+		return system, err
+	}
+	if len(results) == 0 {
+		return system, nil
+	}
+
+	prompt := "Facts you remember from earlier conversations (use the forget tool with the ID to delete one that is wrong):\n" +
+		formatMemories(results)
+	if system == "" {
+		return prompt, nil
+	}
+	return system + "\n\n" + prompt, nil
+}
@@ -62,6 +62,14 @@ type AgentToolInput struct {
 	Context string `json:"context,omitempty" schema:"Additional context that might help the agent understand the task better"`
 }
 
+// prompt builds the delegated agent's input.
+func (in AgentToolInput) prompt() string {
+	if in.Context != "" {
+		return fmt.Sprintf("Context: %s\n\nTask: %s", in.Context, in.Task)
+	}
+	return in.Task
+}
+
 // AgentTool wraps an agent as a tool for delegation.
 type AgentTool struct {
 	capability    core.Capability
@@ -111,14 +119,8 @@ func (t *AgentTool) Execute(ctx context.Context, params json.RawMessage) (string
 	// Prepare context for the delegated agent
 	ctx = t.cycleDetector.PrepareContext(ctx, provider.ID())
 
-	// Build the full input
-	fullInput := input.Task
-	if input.Context != "" {
-		fullInput = fmt.Sprintf("Context: %s\n\nTask: %s", input.Context, input.Task)
-	}
-
 	// Execute the delegated agent
-	result, err := provider.Run(ctx, fullInput)
+	result, err := provider.Run(ctx, input.prompt())
 	if err != nil {
 		return "", fmt.Errorf("agent %s failed: %w", provider.Name(), err)
 	}
@@ -2,6 +2,7 @@ package mesh
 
 import (
 	"context"
+	"fmt"
 	"sync"
 
 	"github.com/google/uuid"
@@ -144,6 +145,32 @@ func (m *Mesh) RunAgent(ctx context.Context, agentID string, input string) (*cor
 	return a.Run(ctx, input)
 }
 
+// Delegate executes a task on an agent that provides a capability,
+// chosen by the mesh's balancer.
+func (m *Mesh) Delegate(ctx context.Context, cap core.Capability, input string) (*core.Result, error) {
+	// Ensure we have a trace ID
+	if core.TraceID(ctx) == "" {
+		ctx = core.WithTraceID(ctx, uuid.New().String())
+	}
+
+	providers, err := m.FindProviders(ctx, cap)
+	if err != nil {
+		return nil, err
+	}
+
+	a := m.balancer.Select(providers)
+	if a == nil {
+		return nil, fmt.Errorf("%w: %s", registry.ErrAgentNotFound, cap)
+	}
+
+	// Prepare and run
+	if err := m.PrepareAgent(ctx, a); err != nil {
+		return nil, err
+	}
+
+	return a.Run(ctx, input)
+}
+
 // Run executes a task on the mesh by finding an appropriate agent.
 // This is a simplified entry point that delegates to the first capable agent.
 func (m *Mesh) Run(ctx context.Context, task string) (*core.Result, error) {
@@ -183,3 +183,28 @@ func TestMesh_TraceID(t *testing.T) {
 		t.Error("expected trace ID to be set")
 	}
 }
+
+func TestMesh_Delegate(t *testing.T) {
+	ctx := context.Background()
+
+	m := New()
+
+	researcher := agent.New("researcher").
+		Model(provider.NewMockWithResponse("Research result")).
+		Provides(core.CapResearch).
+		Build()
+
+	m.Register(researcher)
+
+	result, err := m.Delegate(ctx, core.CapResearch, "Find information")
+	if err != nil {
+		t.Fatalf("failed to delegate: %v", err)
+	}
+	if result.Output != "Research result" {
+		t.Errorf("expected 'Research result', got '%s'", result.Output)
+	}
+
+	if _, err := m.Delegate(ctx, core.CapCoding, "Write code"); err == nil {
+		t.Error("expected error for capability with no providers")
+	}
+}
@@ -0,0 +1,100 @@
+package mesh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/storo/lattice/pkg/core"
+)
+
+// Tools returns tools that run the mesh's agents: one "ask_<agent>" tool
+// per agent and one "delegate_to_<capability>" tool per provided
+// capability. They let external callers, such as MCP clients, use the mesh.
+func (m *Mesh) Tools(ctx context.Context) ([]core.Tool, error) {
+	agents, err := m.ListAgents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tools []core.Tool
+	providers := make(map[core.Capability][]core.Agent)
+
+	for _, a := range agents {
+		tools = append(tools, &RunAgentTool{mesh: m, agent: a})
+		for _, cap := range a.Provides() {
+			providers[cap] = append(providers[cap], a)
+		}
+	}
+
+	for cap, agents := range providers {
+		tools = append(tools, &AgentTool{
+			capability:    cap,
+			providers:     agents,
+			balancer:      m.balancer,
+			cycleDetector: m.cycleDetector,
+		})
+	}
+
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Name() < tools[j].Name()
+	})
+
+	return tools, nil
+}
+
+// RunAgentTool runs a specific mesh agent as a tool.
+type RunAgentTool struct {
+	mesh  *Mesh
+	agent core.Agent
+}
+
+// Name returns the tool name.
+func (t *RunAgentTool) Name() string {
+	return "ask_" + toolName(t.agent.Name())
+}
+
+// Description returns the tool description.
+func (t *RunAgentTool) Description() string {
+	if desc := t.agent.Description(); desc != "" {
+		return fmt.Sprintf("Ask the '%s' agent: %s", t.agent.Name(), desc)
+	}
+	return fmt.Sprintf("Ask the '%s' agent to handle a task and return its answer.", t.agent.Name())
+}
+
+// Schema returns the JSON Schema for the tool's parameters.
+func (t *RunAgentTool) Schema() json.RawMessage {
+	return core.SchemaFromStruct(AgentToolInput{})
+}
+
+// Execute runs the agent through the mesh.
+func (t *RunAgentTool) Execute(ctx context.Context, params json.RawMessage) (string, error) {
+	var input AgentToolInput
+	if err := json.Unmarshal(params, &input); err != nil {
+		return "", fmt.Errorf("invalid input: %w", err)
+	}
+
+	result, err := t.mesh.RunAgent(ctx, t.agent.ID(), input.prompt())
+	if err != nil {
+		return "", fmt.Errorf("agent %s failed: %w", t.agent.Name(), err)
+	}
+
+	return result.Output, nil
+}
+
+// toolName converts an agent name to a valid tool name, replacing
+// characters other than letters, digits, '_' and '-' with '_'.
+func toolName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// Verify RunAgentTool implements core.Tool
+var _ core.Tool = (*RunAgentTool)(nil)
@@ -0,0 +1,64 @@
+package mesh
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/storo/lattice/pkg/agent"
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/provider"
+)
+
+func TestMesh_Tools(t *testing.T) {
+	m := New()
+
+	researcher := agent.New("research agent").
+		Model(provider.NewMockWithResponse("research result")).
+		Description("Finds information").
+		Provides(core.CapResearch).
+		Build()
+	writer := agent.New("writer").
+		Model(provider.NewMockWithResponse("written text")).
+		Provides(core.CapWriting, core.CapResearch).
+		Build()
+
+	if err := m.Register(researcher, writer); err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+
+	tools, err := m.Tools(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var names []string
+	byName := make(map[string]core.Tool)
+	for _, tool := range tools {
+		names = append(names, tool.Name())
+		byName[tool.Name()] = tool
+	}
+
+	expected := []string{"ask_research_agent", "ask_writer", "delegate_to_research", "delegate_to_writing"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected tools %v, got %v", expected, names)
+	}
+	for i, name := range expected {
+		if names[i] != name {
+			t.Errorf("expected tool %d to be %s, got %s", i, name, names[i])
+		}
+	}
+
+	out, err := byName["ask_writer"].Execute(context.Background(), json.RawMessage(`{"task": "write"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "written text" {
+		t.Errorf("expected 'written text', got '%s'", out)
+	}
+
+	out, err = byName["delegate_to_writing"].Execute(context.Background(), json.RawMessage(`{"task": "write"}`))
+	if err != nil || out != "written text" {
+		t.Errorf("expected 'written text', got %q (%v)", out, err)
+	}
+}
@@ -0,0 +1,215 @@
+package patterns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/storo/lattice/pkg/core"
+)
+
+// CriticRefine errors
+var (
+	ErrInvalidCritique = errors.New("invalid critique")
+)
+
+const (
+	// DefaultScoreThreshold is the default score, from 0 to 10, at which a
+	// draft is accepted.
+	DefaultScoreThreshold = 8.0
+
+	// DefaultMaxRefinements is the default number of drafts written.
+	DefaultMaxRefinements = 3
+)
+
+// Refinement is one draft and the critic's review of it.
+type Refinement struct {
+	Iteration int     `json:"iteration"`
+	Draft     string  `json:"draft"`
+	Score     float64 `json:"score"`
+	Feedback  string  `json:"feedback"`
+}
+
+// critique is the critic's reply.
+type critique struct {
+	Score    float64 `json:"score" schema:"How well the draft meets the criteria, from 0 (not at all) to 10 (perfectly)" minimum:"0" maximum:"10"`
+	Feedback string  `json:"feedback" schema:"Concrete changes that would improve the draft"`
+}
+
+// critiqueSchema is the JSON Schema of the critic's reply.
+var critiqueSchema = core.SchemaFromStruct(critique{})
+
+// CriticRefine has a generator agent write a draft, a critic agent score
+// it against criteria, and the generator revise it with the critic's
+// feedback until the score reaches a threshold or the iteration limit.
+type CriticRefine struct {
+	generator     core.Agent
+	critic        core.Agent
+	criteria      []string
+	threshold     float64
+	maxIterations int
+}
+
+// CriticRefineOption configures the CriticRefine pattern.
+type CriticRefineOption func(*CriticRefine)
+
+// NewCriticRefine creates a Critic/Refine loop.
+func NewCriticRefine(generator, critic core.Agent, opts ...CriticRefineOption) *CriticRefine {
+	c := &CriticRefine{
+		generator:     generator,
+		critic:        critic,
+		threshold:     DefaultScoreThreshold,
+		maxIterations: DefaultMaxRefinements,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// WithCriteria adds criteria the critic scores drafts against.
+func WithCriteria(criteria ...string) CriticRefineOption {
+	return func(c *CriticRefine) {
+		c.criteria = append(c.criteria, criteria...)
+	}
+}
+
+// WithScoreThreshold sets the score, from 0 to 10, at which a draft is
+// accepted.
+func WithScoreThreshold(score float64) CriticRefineOption {
+	return func(c *CriticRefine) {
+		c.threshold = score
+	}
+}
+
+// WithMaxRefinements sets the maximum number of drafts, including the
+// first one.
+func WithMaxRefinements(n int) CriticRefineOption {
+	return func(c *CriticRefine) {
+		c.maxIterations = n
+	}
+}
+
+// Run writes and refines an answer to a task. The result's output is the
+// first draft that reaches the threshold or, failing that, the highest
+// scored one. Metadata holds the "transcript" ([]Refinement), "score",
+// "accepted" (whether the threshold was reached), "iterations",
+// "tokens_in" and "tokens_out".
+func (c *CriticRefine) Run(ctx context.Context, task string) (*core.Result, error) {
+	start := time.Now()
+	var transcript []Refinement
+	var tokensIn, tokensOut int
+
+	prompt := task
+	best := -1
+	accepted := false
+
+	for i := 1; i <= max(c.maxIterations, 1); i++ {
+		draft, err := c.generator.Run(ctx, prompt)
+		if err != nil {
+			return nil, fmt.Errorf("generator failed: %w", err)
+		}
+		tokensIn += draft.TokensIn
+		tokensOut += draft.TokensOut
+
+		review, err := c.critic.Run(ctx, c.critiquePrompt(task, draft.Output))
+		if err != nil {
+			return nil, fmt.Errorf("critic failed: %w", err)
+		}
+		tokensIn += review.TokensIn
+		tokensOut += review.TokensOut
+
+		crit, err := parseCritique(review.Output)
+		if err != nil {
+			return nil, err
+		}
+
+		transcript = append(transcript, Refinement{
+			Iteration: i,
+			Draft:     draft.Output,
+			Score:     crit.Score,
+			Feedback:  crit.Feedback,
+		})
+		if best < 0 || crit.Score > transcript[best].Score {
+			best = len(transcript) - 1
+		}
+
+		if crit.Score >= c.threshold {
+			best = len(transcript) - 1
+			accepted = true
+			break
+		}
+
+		prompt = c.revisePrompt(task, draft.Output, crit.Feedback)
+	}
+
+	return &core.Result{
+		Output:    transcript[best].Draft,
+		TokensIn:  tokensIn,
+		TokensOut: tokensOut,
+		Duration:  time.Since(start),
+		TraceID:   core.TraceID(ctx),
+		CallChain: core.CallChain(ctx),
+		Metadata: map[string]any{
+			"transcript": transcript,
+			"score":      transcript[best].Score,
+			"accepted":   accepted,
+			"iterations": len(transcript),
+			"tokens_in":  tokensIn,
+			"tokens_out": tokensOut,
+		},
+	}, nil
+}
+
+// parseCritique extracts and validates the critic's JSON reply.
+func parseCritique(output string) (*critique, error) {
+	raw := core.ExtractJSON(output)
+	if raw == nil {
+		return nil, fmt.Errorf("%w: critic reply is not JSON", ErrInvalidCritique)
+	}
+	if err := core.ValidateJSON(critiqueSchema, raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCritique, err)
+	}
+
+	var crit critique
+	if err := json.Unmarshal(raw, &crit); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCritique, err)
+	}
+	return &crit, nil
+}
+
+// critiquePrompt asks the critic to score a draft.
+func (c *CriticRefine) critiquePrompt(task, draft string) string {
+	var sb strings.Builder
+	sb.WriteString("Review the draft below, written for the task that follows it.\n")
+	if len(c.criteria) > 0 {
+		sb.WriteString("Score it against these criteria:\n")
+		for _, criterion := range c.criteria {
+			fmt.Fprintf(&sb, "- %s\n", criterion)
+		}
+	}
+	fmt.Fprintf(&sb, "Respond only with JSON matching this schema:\n%s\n", critiqueSchema)
+	sb.WriteString("\nTask: ")
+	sb.WriteString(task)
+	sb.WriteString("\n\nDraft:\n")
+	sb.WriteString(draft)
+	return sb.String()
+}
+
+// revisePrompt asks the generator to revise a draft with feedback.
+func (c *CriticRefine) revisePrompt(task, draft, feedback string) string {
+	var sb strings.Builder
+	sb.WriteString("Task: ")
+	sb.WriteString(task)
+	sb.WriteString("\n\nYour previous draft:\n")
+	sb.WriteString(draft)
+	sb.WriteString("\n\nA reviewer gave this feedback:\n")
+	sb.WriteString(feedback)
+	sb.WriteString("\n\nWrite an improved version that addresses the feedback. Reply with the new version only.")
+	return sb.String()
+}
@@ -0,0 +1,90 @@
+package patterns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCriticRefine_Run(t *testing.T) {
+	ctx := context.Background()
+
+	drafts := 0
+	generator, generatorPrompts := recordingAgent("writer", func(string) (string, error) {
+		drafts++
+		return fmt.Sprintf("draft %d", drafts), nil
+	})
+	critic, criticPrompts := recordingAgent("critic", func(prompt string) (string, error) {
+		if strings.Contains(prompt, "draft 2") {
+			return `{"score": 9, "feedback": "Good."}`, nil
+		}
+		return "```json\n{\"score\": 4, \"feedback\": \"Add an example.\"}\n```", nil
+	})
+
+	c := NewCriticRefine(generator, critic, WithCriteria("Is accurate", "Has an example"))
+	result, err := c.Run(ctx, "Explain channels")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Output != "draft 2" || result.Metadata["accepted"] != true || result.Metadata["score"] != 9.0 {
+		t.Errorf("unexpected result %q %v", result.Output, result.Metadata)
+	}
+
+	transcript := result.Metadata["transcript"].([]Refinement)
+	if len(transcript) != 2 || transcript[0].Feedback != "Add an example." || transcript[1].Score != 9 {
+		t.Errorf("unexpected transcript %+v", transcript)
+	}
+
+	if p := generatorPrompts(); len(p) != 2 || !strings.Contains(p[1], "draft 1") || !strings.Contains(p[1], "Add an example.") {
+		t.Errorf("unexpected revision prompt %q", p)
+	}
+	if p := criticPrompts(); !strings.Contains(p[0], "- Has an example") {
+		t.Errorf("criteria missing from critic prompt %q", p[0])
+	}
+}
+
+func TestCriticRefine_IterationLimit(t *testing.T) {
+	ctx := context.Background()
+
+	drafts := 0
+	generator, _ := recordingAgent("writer", func(string) (string, error) {
+		drafts++
+		return fmt.Sprintf("draft %d", drafts), nil
+	})
+	scores := map[string]int{"draft 1": 5, "draft 2": 7, "draft 3": 6}
+	critic, _ := recordingAgent("critic", func(prompt string) (string, error) {
+		for draft, score := range scores {
+			if strings.HasSuffix(prompt, draft) {
+				return fmt.Sprintf(`{"score": %d, "feedback": "More."}`, score), nil
+			}
+		}
+		return "", errors.New("unexpected draft")
+	})
+
+	result, err := NewCriticRefine(generator, critic, WithMaxRefinements(3), WithScoreThreshold(9)).Run(ctx, "Write")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The best draft is kept when none reaches the threshold
+	if result.Output != "draft 2" || result.Metadata["accepted"] != false || result.Metadata["iterations"] != 3 {
+		t.Errorf("unexpected result %q %v", result.Output, result.Metadata)
+	}
+}
+
+func TestCriticRefine_InvalidCritique(t *testing.T) {
+	ctx := context.Background()
+
+	generator, _ := recordingAgent("writer", func(string) (string, error) { return "draft", nil })
+
+	for _, reply := range []string{"Looks fine to me", `{"score": 12, "feedback": "x"}`, `{"feedback": "x"}`} {
+		critic, _ := recordingAgent("critic", func(string) (string, error) { return reply, nil })
+		_, err := NewCriticRefine(generator, critic).Run(ctx, "Write")
+		if !errors.Is(err, ErrInvalidCritique) {
+			t.Errorf("%q: expected ErrInvalidCritique, got %v", reply, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package patterns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/storo/lattice/pkg/core"
+)
+
+// Debate errors
+var (
+	ErrNoDebaters = errors.New("debate needs at least one debater")
+)
+
+// DefaultDebateRounds is the default number of rounds in which debaters
+// revise their answers after seeing each other's.
+const DefaultDebateRounds = 2
+
+// DebateTurn is one debater's answer in one round. Round 0 holds the
+// initial answers.
+type DebateTurn struct {
+	Round  int    `json:"round"`
+	Agent  string `json:"agent"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Debate has several agents answer the same question, shows each of them
+// the others' answers for a number of rounds so they can revise theirs,
+// and lets a judge agent decide the final answer.
+type Debate struct {
+	debaters []core.Agent
+	judge    core.Agent
+	rounds   int
+}
+
+// DebateOption configures the Debate pattern.
+type DebateOption func(*Debate)
+
+// NewDebate creates a debate between debaters, decided by judge.
+func NewDebate(debaters []core.Agent, judge core.Agent, opts ...DebateOption) *Debate {
+	d := &Debate{
+		debaters: debaters,
+		judge:    judge,
+		rounds:   DefaultDebateRounds,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// WithDebateRounds sets the number of revision rounds after the initial
+// answers. Zero sends the initial answers straight to the judge.
+func WithDebateRounds(n int) DebateOption {
+	return func(d *Debate) {
+		d.rounds = n
+	}
+}
+
+// Run debates a question. The result's output is the judge's decision.
+// Metadata holds the "transcript" ([]DebateTurn, in round order), the
+// number of "rounds", "tokens_in" and "tokens_out". A debater that fails
+// is recorded in the transcript and drops out of the later rounds.
+func (d *Debate) Run(ctx context.Context, question string) (*core.Result, error) {
+	if len(d.debaters) == 0 {
+		return nil, ErrNoDebaters
+	}
+
+	start := time.Now()
+	var transcript []DebateTurn
+	var tokensIn, tokensOut int
+
+	// answers holds each debater's latest answer; failed debaters are removed
+	answers := make(map[int]string, len(d.debaters))
+	active := make([]int, len(d.debaters))
+	for i := range d.debaters {
+		active[i] = i
+	}
+
+	for round := 0; round <= d.rounds && len(active) > 0; round++ {
+		prompts := make([]string, len(active))
+		for j, i := range active {
+			prompts[j] = question
+			if round > 0 {
+				prompts[j] = d.rebuttalPrompt(question, i, active, answers)
+			}
+		}
+
+		results, errs := d.runRound(ctx, active, prompts)
+
+		var next []int
+		for j, i := range active {
+			turn := DebateTurn{Round: round, Agent: d.debaters[i].Name()}
+			if errs[j] != nil {
+				turn.Error = errs[j].Error()
+				delete(answers, i)
+			} else {
+				turn.Output = results[j].Output
+				tokensIn += results[j].TokensIn
+				tokensOut += results[j].TokensOut
+				answers[i] = results[j].Output
+				next = append(next, i)
+			}
+			transcript = append(transcript, turn)
+		}
+		active = next
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(active) == 0 {
+		return nil, fmt.Errorf("debate: %w", ErrAllAgentsFailed)
+	}
+
+	verdict, err := d.judge.Run(ctx, d.judgePrompt(question, transcript))
+	if err != nil {
+		return nil, fmt.Errorf("judge failed: %w", err)
+	}
+	tokensIn += verdict.TokensIn
+	tokensOut += verdict.TokensOut
+
+	return &core.Result{
+		Output:    verdict.Output,
+		TokensIn:  tokensIn,
+		TokensOut: tokensOut,
+		Duration:  time.Since(start),
+		TraceID:   core.TraceID(ctx),
+		CallChain: core.CallChain(ctx),
+		Metadata: map[string]any{
+			"transcript": transcript,
+			"rounds":     d.rounds,
+			"tokens_in":  tokensIn,
+			"tokens_out": tokensOut,
+		},
+	}, nil
+}
+
+// runRound runs the active debaters concurrently, each with its prompt.
+func (d *Debate) runRound(ctx context.Context, active []int, prompts []string) ([]*core.Result, []error) {
+	results := make([]*core.Result, len(active))
+	errs := make([]error, len(active))
+
+	var wg sync.WaitGroup
+	for j, i := range active {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[j], errs[j] = d.debaters[i].Run(ctx, prompts[j])
+		}()
+	}
+	wg.Wait()
+
+	return results, errs
+}
+
+// rebuttalPrompt shows debater i the other debaters' latest answers.
+func (d *Debate) rebuttalPrompt(question string, i int, active []int, answers map[int]string) string {
+	var sb strings.Builder
+	sb.WriteString("Question: ")
+	sb.WriteString(question)
+	sb.WriteString("\n\nYour previous answer:\n")
+	sb.WriteString(answers[i])
+	sb.WriteString("\n\nAnswers from the other participants:\n")
+	for _, other := range active {
+		if other == i {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%s:\n%s\n", d.debaters[other].Name(), answers[other])
+	}
+	sb.WriteString("\nConsider their arguments. Point out any mistakes, then give your updated answer to the question.")
+	return sb.String()
+}
+
+// judgePrompt asks the judge to decide from the whole debate.
+func (d *Debate) judgePrompt(question string, transcript []DebateTurn) string {
+	var sb strings.Builder
+	sb.WriteString("Several participants debated the question below. Read the debate and give the best final answer, explaining briefly which arguments convinced you.\n\nQuestion: ")
+	sb.WriteString(question)
+	sb.WriteString("\n")
+
+	round := -1
+	for _, turn := range transcript {
+		if turn.Error != "" {
+			continue
+		}
+		if turn.Round != round {
+			round = turn.Round
+			if round == 0 {
+				sb.WriteString("\nInitial answers:\n")
+			} else {
+				fmt.Fprintf(&sb, "\nRound %d:\n", round)
+			}
+		}
+		fmt.Fprintf(&sb, "\n%s:\n%s\n", turn.Agent, turn.Output)
+	}
+	return sb.String()
+}
@@ -0,0 +1,124 @@
+package patterns
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/storo/lattice/pkg/agent"
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/provider"
+)
+
+// recordingAgent returns an agent that records its prompts and replies
+// with reply(prompt).
+func recordingAgent(name string, reply func(prompt string) (string, error)) (*agent.Agent, func() []string) {
+	var mu sync.Mutex
+	var prompts []string
+	mock := &provider.MockProvider{
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			prompt := req.Messages[len(req.Messages)-1].Content
+			mu.Lock()
+			prompts = append(prompts, prompt)
+			mu.Unlock()
+
+			content, err := reply(prompt)
+			if err != nil {
+				return nil, err
+			}
+			return &provider.ChatResponse{
+				Content:    content,
+				StopReason: provider.StopReasonEndTurn,
+				Usage:      provider.Usage{InputTokens: 2, OutputTokens: 1},
+			}, nil
+		},
+	}
+	return agent.New(name).Model(mock).Build(), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), prompts...)
+	}
+}
+
+func TestDebate_Run(t *testing.T) {
+	ctx := context.Background()
+
+	alice, _ := recordingAgent("alice", func(prompt string) (string, error) {
+		if strings.Contains(prompt, "other participants") {
+			return "4, agreeing with bob", nil
+		}
+		return "4", nil
+	})
+	bob, bobPrompts := recordingAgent("bob", func(prompt string) (string, error) {
+		if strings.Contains(prompt, "other participants") {
+			return "4, I was wrong", nil
+		}
+		return "5", nil
+	})
+	judge, judgePrompts := recordingAgent("judge", func(prompt string) (string, error) {
+		return "The answer is 4.", nil
+	})
+
+	d := NewDebate([]core.Agent{alice, bob}, judge, WithDebateRounds(1))
+	result, err := d.Run(ctx, "What is 2+2?")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Output != "The answer is 4." {
+		t.Errorf("unexpected output %q", result.Output)
+	}
+
+	transcript, ok := result.Metadata["transcript"].([]DebateTurn)
+	if !ok || len(transcript) != 4 {
+		t.Fatalf("expected 4 turns, got %v", result.Metadata["transcript"])
+	}
+	if transcript[0].Round != 0 || transcript[2].Round != 1 || transcript[3].Output != "4, I was wrong" {
+		t.Errorf("unexpected transcript %+v", transcript)
+	}
+
+	// Bob sees Alice's answer, not his own under her name
+	if p := bobPrompts(); len(p) != 2 || !strings.Contains(p[1], "alice:\n4") || !strings.Contains(p[1], "Your previous answer:\n5") {
+		t.Errorf("unexpected rebuttal prompt %q", p)
+	}
+	if p := judgePrompts(); len(p) != 1 || !strings.Contains(p[0], "Round 1:") || !strings.Contains(p[0], "4, I was wrong") {
+		t.Errorf("unexpected judge prompt %q", p)
+	}
+
+	// 4 debater turns and 1 judge call, 2 tokens in each
+	if result.TokensIn != 10 || result.Metadata["tokens_in"] != 10 {
+		t.Errorf("expected 10 tokens in, got %d", result.TokensIn)
+	}
+}
+
+func TestDebate_FailedDebater(t *testing.T) {
+	ctx := context.Background()
+
+	good, _ := recordingAgent("good", func(string) (string, error) { return "yes", nil })
+	bad, badPrompts := recordingAgent("bad", func(string) (string, error) { return "", errors.New("offline") })
+	judge, _ := recordingAgent("judge", func(string) (string, error) { return "yes", nil })
+
+	result, err := NewDebate([]core.Agent{good, bad}, judge).Run(ctx, "ok?")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	transcript := result.Metadata["transcript"].([]DebateTurn)
+	if len(transcript) != 4 || transcript[1].Error == "" {
+		t.Errorf("unexpected transcript %+v", transcript)
+	}
+	if n := len(badPrompts()); n != 1 {
+		t.Errorf("failed debater should drop out, got %d prompts", n)
+	}
+
+	_, err = NewDebate([]core.Agent{bad}, judge).Run(ctx, "ok?")
+	if !errors.Is(err, ErrAllAgentsFailed) {
+		t.Errorf("expected ErrAllAgentsFailed, got %v", err)
+	}
+
+	if _, err := NewDebate(nil, judge).Run(ctx, "ok?"); !errors.Is(err, ErrNoDebaters) {
+		t.Errorf("expected ErrNoDebaters, got %v", err)
+	}
+}
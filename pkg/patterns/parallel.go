@@ -166,6 +166,15 @@ func (p *Parallel) Aggregate(ctx context.Context, input string, aggregator func(
 	return aggregator(agentResults)
 }
 
+// Vote executes all agents and combines their answers with an aggregator,
+// such as MajorityVote, WeightedVote, Quorum or JudgeMerge (nil means
+// MajorityVote). Metadata holds the "agreement" ratio, the "votes" per
+// normalized answer, the "answers" by agent index, the number of "failed"
+// agents, "tokens_in" and "tokens_out".
+func (p *Parallel) Vote(ctx context.Context, input string, agg Aggregator) (*core.Result, error) {
+	return vote(ctx, p.agents, input, agg)
+}
+
 // Agents returns the agents in the parallel executor.
 func (p *Parallel) Agents() []core.Agent {
 	return p.agents
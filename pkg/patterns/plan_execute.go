@@ -0,0 +1,352 @@
+package patterns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/storo/lattice/pkg/core"
+)
+
+// PlanExecute errors
+var (
+	ErrInvalidPlan      = errors.New("invalid plan")
+	ErrStepLimitReached = errors.New("plan step limit reached")
+)
+
+const (
+	// DefaultMaxPlanSteps is the default maximum number of steps executed.
+	DefaultMaxPlanSteps = 10
+
+	// DefaultMaxReplans is the default number of times a plan may be
+	// revised after a failed step.
+	DefaultMaxReplans = 3
+)
+
+// Delegator runs a task on an agent that provides a capability.
+// Both *Supervisor and *mesh.Mesh implement it.
+type Delegator interface {
+	Delegate(ctx context.Context, cap core.Capability, input string) (*core.Result, error)
+}
+
+// StepStatus is the state of a plan step.
+type StepStatus string
+
+const (
+	StepPending StepStatus = "pending"
+	StepDone    StepStatus = "done"
+	StepFailed  StepStatus = "failed"
+)
+
+// PlanStep is one step of a plan.
+type PlanStep struct {
+	ID         int             `json:"id"`
+	Capability core.Capability `json:"capability"`
+	Task       string          `json:"task"`
+	Status     StepStatus      `json:"status"`
+	Output     string          `json:"output,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// plannedStep is a step as written by the planner.
+type plannedStep struct {
+	Capability string `json:"capability" schema:"Capability of the agent that should perform the step"`
+	Task       string `json:"task" schema:"Self-contained instructions for the step"`
+}
+
+// plannerOutput is the planner's reply.
+type plannerOutput struct {
+	Steps []plannedStep `json:"steps" schema:"Remaining steps in execution order"`
+}
+
+// PlanExecute asks a planner agent for a list of steps, each tagged with a
+// capability, and runs them in order through a Delegator. Each step sees
+// the results of the steps before it. When a step fails, the planner
+// revises the rest of the plan.
+type PlanExecute struct {
+	planner        core.Agent
+	executor       Delegator
+	capabilities   []core.Capability
+	maxSteps       int
+	maxReplans     int
+	replanEachStep bool
+}
+
+// PlanExecuteOption configures the PlanExecute pattern.
+type PlanExecuteOption func(*PlanExecute)
+
+// NewPlanExecute creates a Plan-and-Execute pattern.
+func NewPlanExecute(planner core.Agent, executor Delegator, opts ...PlanExecuteOption) *PlanExecute {
+	p := &PlanExecute{
+		planner:    planner,
+		executor:   executor,
+		maxSteps:   DefaultMaxPlanSteps,
+		maxReplans: DefaultMaxReplans,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// WithPlanCapabilities tells the planner which capabilities it can use.
+func WithPlanCapabilities(caps ...core.Capability) PlanExecuteOption {
+	return func(p *PlanExecute) {
+		p.capabilities = append(p.capabilities, caps...)
+	}
+}
+
+// WithMaxPlanSteps sets the maximum number of steps executed, including
+// failed ones.
+func WithMaxPlanSteps(n int) PlanExecuteOption {
+	return func(p *PlanExecute) {
+		p.maxSteps = n
+	}
+}
+
+// WithMaxReplans sets how many times the plan may be revised after a
+// failed step. Revisions made by WithReplanEachStep do not count.
+func WithMaxReplans(n int) PlanExecuteOption {
+	return func(p *PlanExecute) {
+		p.maxReplans = n
+	}
+}
+
+// WithReplanEachStep makes the planner revise the remaining steps after
+// every completed step, not only after failures.
+func WithReplanEachStep() PlanExecuteOption {
+	return func(p *PlanExecute) {
+		p.replanEachStep = true
+	}
+}
+
+// Run plans and executes a task. The result's output is the last step's
+// output. Metadata holds the final "plan" ([]PlanStep), "step_outputs"
+// (map of step ID to output), "replans", "tokens_in" and "tokens_out".
+// When the step limit is reached, or a step or the planner fails, the
+// partial result is returned with the error.
+func (p *PlanExecute) Run(ctx context.Context, task string) (*core.Result, error) {
+	run := &planRun{
+		task:    task,
+		start:   time.Now(),
+		outputs: make(map[int]string),
+	}
+
+	steps, err := p.makePlan(ctx, run, p.planPrompt(task))
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("%w: planner returned no steps", ErrInvalidPlan)
+	}
+	run.addSteps(steps)
+
+	executed := 0
+	for i := 0; i < len(run.plan); i++ {
+		if executed >= p.maxSteps {
+			return run.result(ctx), ErrStepLimitReached
+		}
+		executed++
+
+		step := &run.plan[i]
+		result, err := p.executor.Delegate(ctx, step.Capability, p.stepPrompt(run, i))
+		if err != nil {
+			step.Status = StepFailed
+			step.Error = err.Error()
+
+			if run.recoveries >= p.maxReplans {
+				return run.result(ctx), fmt.Errorf("step %d failed: %w", step.ID, err)
+			}
+			run.recoveries++
+			if err := p.replan(ctx, run, i); err != nil {
+				return run.result(ctx), err
+			}
+			continue
+		}
+
+		run.tokensIn += result.TokensIn
+		run.tokensOut += result.TokensOut
+		step.Status = StepDone
+		step.Output = result.Output
+		run.outputs[step.ID] = result.Output
+		run.last = result.Output
+
+		if p.replanEachStep && i < len(run.plan)-1 {
+			if err := p.replan(ctx, run, i); err != nil {
+				return run.result(ctx), err
+			}
+		}
+	}
+
+	return run.result(ctx), nil
+}
+
+// planRun is the state of one Run.
+type planRun struct {
+	task      string
+	start     time.Time
+	plan      []PlanStep
+	nextID    int
+	outputs   map[int]string
+	last      string
+	tokensIn  int
+	tokensOut int
+
+	// replans counts every revision, recoveries those after a failure
+	replans    int
+	recoveries int
+}
+
+// addSteps appends planner steps to the plan.
+func (r *planRun) addSteps(steps []plannedStep) {
+	for _, s := range steps {
+		r.nextID++
+		r.plan = append(r.plan, PlanStep{
+			ID:         r.nextID,
+			Capability: core.Capability(s.Capability),
+			Task:       s.Task,
+			Status:     StepPending,
+		})
+	}
+}
+
+// result builds the Run result from the current state.
+func (r *planRun) result(ctx context.Context) *core.Result {
+	return &core.Result{
+		Output:    r.last,
+		TokensIn:  r.tokensIn,
+		TokensOut: r.tokensOut,
+		Duration:  time.Since(r.start),
+		TraceID:   core.TraceID(ctx),
+		CallChain: core.CallChain(ctx),
+		Metadata: map[string]any{
+			"plan":         r.plan,
+			"step_outputs": r.outputs,
+			"replans":      r.replans,
+			"tokens_in":    r.tokensIn,
+			"tokens_out":   r.tokensOut,
+		},
+	}
+}
+
+// replan replaces the steps after index i with a revised plan.
+func (p *PlanExecute) replan(ctx context.Context, run *planRun, i int) error {
+	run.replans++
+
+	steps, err := p.makePlan(ctx, run, p.replanPrompt(run, i))
+	if err != nil {
+		return err
+	}
+
+	run.plan = run.plan[:i+1]
+	run.addSteps(steps)
+	return nil
+}
+
+// makePlan runs the planner and parses its steps.
+func (p *PlanExecute) makePlan(ctx context.Context, run *planRun, prompt string) ([]plannedStep, error) {
+	result, err := p.planner.Run(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("planner failed: %w", err)
+	}
+	run.tokensIn += result.TokensIn
+	run.tokensOut += result.TokensOut
+
+	raw := core.ExtractJSON(result.Output)
+	if raw == nil {
+		return nil, fmt.Errorf("%w: planner reply is not JSON", ErrInvalidPlan)
+	}
+	if err := core.ValidateJSON(planSchema, raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlan, err)
+	}
+
+	var out plannerOutput
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlan, err)
+	}
+
+	for i, s := range out.Steps {
+		if strings.TrimSpace(s.Capability) == "" || strings.TrimSpace(s.Task) == "" {
+			return nil, fmt.Errorf("%w: step %d needs a capability and a task", ErrInvalidPlan, i+1)
+		}
+	}
+
+	return out.Steps, nil
+}
+
+// planSchema is the JSON Schema of the planner's reply.
+var planSchema = core.SchemaFromStruct(plannerOutput{})
+
+// planPrompt asks for the initial plan.
+func (p *PlanExecute) planPrompt(task string) string {
+	var sb strings.Builder
+	sb.WriteString("Break the task below into steps. Each step is performed by an agent with the given capability and sees the results of earlier steps.\n")
+	p.writeInstructions(&sb)
+	sb.WriteString("\nTask: ")
+	sb.WriteString(task)
+	return sb.String()
+}
+
+// replanPrompt asks for the steps remaining after step i.
+func (p *PlanExecute) replanPrompt(run *planRun, i int) string {
+	var sb strings.Builder
+	sb.WriteString("Revise the plan for the task below. Return only the steps still needed after the progress so far, or an empty list if the task is complete.\n")
+	p.writeInstructions(&sb)
+	sb.WriteString("\nTask: ")
+	sb.WriteString(run.task)
+	sb.WriteString("\n\nProgress so far:\n")
+	for _, step := range run.plan[:i+1] {
+		fmt.Fprintf(&sb, "\nStep %d (%s): %s\n", step.ID, step.Capability, step.Task)
+		switch step.Status {
+		case StepDone:
+			fmt.Fprintf(&sb, "Result: %s\n", step.Output)
+		case StepFailed:
+			fmt.Fprintf(&sb, "Failed: %s\n", step.Error)
+		}
+	}
+	return sb.String()
+}
+
+// writeInstructions adds the capabilities and reply format to a prompt.
+func (p *PlanExecute) writeInstructions(sb *strings.Builder) {
+	if len(p.capabilities) > 0 {
+		names := make([]string, len(p.capabilities))
+		for i, c := range p.capabilities {
+			names[i] = string(c)
+		}
+		fmt.Fprintf(sb, "Available capabilities: %s.\n", strings.Join(names, ", "))
+	}
+	fmt.Fprintf(sb, "Use at most %d steps. Respond only with JSON matching this schema:\n%s\n", p.maxSteps, planSchema)
+}
+
+// stepPrompt builds the input for step i, including earlier results.
+func (p *PlanExecute) stepPrompt(run *planRun, i int) string {
+	var sb strings.Builder
+	sb.WriteString("Overall task: ")
+	sb.WriteString(run.task)
+	sb.WriteString("\n")
+
+	wroteHeader := false
+	for _, step := range run.plan[:i] {
+		if step.Status != StepDone {
+			continue
+		}
+		if !wroteHeader {
+			sb.WriteString("\nResults of previous steps:\n")
+			wroteHeader = true
+		}
+		fmt.Fprintf(&sb, "\nStep %d (%s): %s\n%s\n", step.ID, step.Capability, step.Task, step.Output)
+	}
+
+	sb.WriteString("\nYour step: ")
+	sb.WriteString(run.plan[i].Task)
+	return sb.String()
+}
+
+// Verify Supervisor implements Delegator
+var _ Delegator = (*Supervisor)(nil)
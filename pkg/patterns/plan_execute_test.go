@@ -0,0 +1,275 @@
+package patterns
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/storo/lattice/pkg/agent"
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/provider"
+)
+
+// scriptedPlanner returns a planner agent that replies with each plan in turn.
+func scriptedPlanner(plans ...string) (*agent.Agent, *[]string) {
+	var prompts []string
+	mock := &provider.MockProvider{
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			prompts = append(prompts, req.Messages[len(req.Messages)-1].Content)
+			reply := `{"steps":[]}`
+			if len(prompts) <= len(plans) {
+				reply = plans[len(prompts)-1]
+			}
+			return &provider.ChatResponse{
+				Content:    reply,
+				StopReason: provider.StopReasonEndTurn,
+				Usage:      provider.Usage{InputTokens: 10, OutputTokens: 5},
+			}, nil
+		},
+	}
+	return agent.New("planner").Model(mock).Build(), &prompts
+}
+
+func TestPlanExecute_Run(t *testing.T) {
+	ctx := context.Background()
+
+	planner, prompts := scriptedPlanner(`{"steps":[
+		{"capability":"research","task":"Find facts about Go"},
+		{"capability":"writing","task":"Write a summary"}
+	]}`)
+
+	var writerInput string
+	writer := agent.New("writer").
+		Model(&provider.MockProvider{
+			ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+				writerInput = req.Messages[len(req.Messages)-1].Content
+				return &provider.ChatResponse{
+					Content:    "Go is great.",
+					StopReason: provider.StopReasonEndTurn,
+					Usage:      provider.Usage{InputTokens: 3, OutputTokens: 2},
+				}, nil
+			},
+		}).
+		Provides(core.CapWriting).
+		Build()
+
+	researcher := agent.New("researcher").
+		Model(provider.NewMockWithResponse("Go was released in 2009.")).
+		Provides(core.CapResearch).
+		Build()
+
+	pe := NewPlanExecute(planner, NewSupervisor(WithWorkers(researcher, writer)),
+		WithPlanCapabilities(core.CapResearch, core.CapWriting))
+
+	result, err := pe.Run(ctx, "Write about Go")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Output != "Go is great." {
+		t.Errorf("expected final step output, got '%s'", result.Output)
+	}
+	if !strings.Contains(writerInput, "Go was released in 2009.") {
+		t.Errorf("expected previous step result in writer input, got %q", writerInput)
+	}
+	if !strings.Contains((*prompts)[0], "research, writing") {
+		t.Errorf("expected capabilities in planner prompt, got %q", (*prompts)[0])
+	}
+
+	plan := result.Metadata["plan"].([]PlanStep)
+	if len(plan) != 2 || plan[0].Status != StepDone || plan[1].Status != StepDone {
+		t.Errorf("expected 2 completed steps, got %+v", plan)
+	}
+	outputs := result.Metadata["step_outputs"].(map[int]string)
+	if outputs[1] != "Go was released in 2009." {
+		t.Errorf("expected step 1 output, got %q", outputs[1])
+	}
+	if result.TokensIn != 13 || result.Metadata["tokens_in"] != 13 {
+		t.Errorf("expected 13 tokens in, got %d", result.TokensIn)
+	}
+}
+
+func TestPlanExecute_ReplanAfterFailure(t *testing.T) {
+	ctx := context.Background()
+
+	planner, prompts := scriptedPlanner(
+		`{"steps":[{"capability":"coding","task":"Write code"}]}`,
+		`{"steps":[{"capability":"research","task":"Look it up instead"}]}`,
+	)
+
+	researcher := agent.New("researcher").
+		Model(provider.NewMockWithResponse("Found it")).
+		Provides(core.CapResearch).
+		Build()
+
+	pe := NewPlanExecute(planner, NewSupervisor(WithWorkers(researcher)))
+
+	result, err := pe.Run(ctx, "Solve the problem")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Output != "Found it" {
+		t.Errorf("expected 'Found it', got '%s'", result.Output)
+	}
+	if result.Metadata["replans"] != 1 {
+		t.Errorf("expected 1 replan, got %v", result.Metadata["replans"])
+	}
+	if !strings.Contains((*prompts)[1], "Failed: "+ErrNoWorkerAvailable.Error()) {
+		t.Errorf("expected failure in replan prompt, got %q", (*prompts)[1])
+	}
+
+	plan := result.Metadata["plan"].([]PlanStep)
+	if len(plan) != 2 || plan[0].Status != StepFailed || plan[1].ID != 2 {
+		t.Errorf("unexpected plan: %+v", plan)
+	}
+}
+
+func TestPlanExecute_MaxReplans(t *testing.T) {
+	ctx := context.Background()
+
+	planner, _ := scriptedPlanner(
+		`{"steps":[{"capability":"coding","task":"Write code"}]}`,
+		`{"steps":[{"capability":"coding","task":"Write code again"}]}`,
+	)
+
+	pe := NewPlanExecute(planner, NewSupervisor(), WithMaxReplans(1))
+
+	result, err := pe.Run(ctx, "Solve the problem")
+	if !errors.Is(err, ErrNoWorkerAvailable) {
+		t.Fatalf("expected ErrNoWorkerAvailable, got %v", err)
+	}
+	if result == nil || result.Metadata["replans"] != 1 {
+		t.Errorf("expected partial result after 1 replan, got %+v", result)
+	}
+}
+
+func TestPlanExecute_StepLimit(t *testing.T) {
+	ctx := context.Background()
+
+	planner, _ := scriptedPlanner(`{"steps":[
+		{"capability":"research","task":"Step one"},
+		{"capability":"research","task":"Step two"},
+		{"capability":"research","task":"Step three"}
+	]}`)
+
+	researcher := agent.New("researcher").
+		Model(provider.NewMockWithResponse("ok")).
+		Provides(core.CapResearch).
+		Build()
+
+	pe := NewPlanExecute(planner, NewSupervisor(WithWorkers(researcher)), WithMaxPlanSteps(2))
+
+	result, err := pe.Run(ctx, "Do three things")
+	if err != ErrStepLimitReached {
+		t.Fatalf("expected ErrStepLimitReached, got %v", err)
+	}
+	if len(result.Metadata["step_outputs"].(map[int]string)) != 2 {
+		t.Errorf("expected 2 step outputs, got %v", result.Metadata["step_outputs"])
+	}
+}
+
+func TestPlanExecute_ReplanEachStep(t *testing.T) {
+	ctx := context.Background()
+
+	planner, prompts := scriptedPlanner(
+		`{"steps":[
+			{"capability":"research","task":"Step one"},
+			{"capability":"research","task":"Step two"}
+		]}`,
+		`{"steps":[]}`,
+	)
+
+	researcher := agent.New("researcher").
+		Model(provider.NewMockWithResponse("done")).
+		Provides(core.CapResearch).
+		Build()
+
+	pe := NewPlanExecute(planner, NewSupervisor(WithWorkers(researcher)), WithReplanEachStep())
+
+	result, err := pe.Run(ctx, "Do things")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(*prompts) != 2 {
+		t.Errorf("expected 2 planner calls, got %d", len(*prompts))
+	}
+	if plan := result.Metadata["plan"].([]PlanStep); len(plan) != 1 {
+		t.Errorf("expected plan to end after step one, got %+v", plan)
+	}
+}
+
+func TestPlanExecute_ReplanEachStepKeepsRecoveries(t *testing.T) {
+	ctx := context.Background()
+
+	planner, _ := scriptedPlanner(
+		`{"steps":[{"capability":"research","task":"One"},{"capability":"research","task":"Two"}]}`,
+		`{"steps":[{"capability":"research","task":"Two"},{"capability":"coding","task":"Three"}]}`,
+		`{"steps":[{"capability":"coding","task":"Three"}]}`,
+		`{"steps":[{"capability":"research","task":"Four"}]}`,
+	)
+
+	researcher := agent.New("researcher").
+		Model(provider.NewMockWithResponse("done")).
+		Provides(core.CapResearch).
+		Build()
+
+	// Revisions after successful steps leave the failure's replan
+	pe := NewPlanExecute(planner, NewSupervisor(WithWorkers(researcher)), WithReplanEachStep(), WithMaxReplans(1))
+
+	result, err := pe.Run(ctx, "Do things")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Metadata["replans"] != 3 {
+		t.Errorf("expected 3 replans, got %v", result.Metadata["replans"])
+	}
+	if plan := result.Metadata["plan"].([]PlanStep); len(plan) != 4 || plan[2].Status != StepFailed || plan[3].Status != StepDone {
+		t.Errorf("unexpected plan: %+v", plan)
+	}
+}
+
+func TestPlanExecute_ReplanErrorKeepsProgress(t *testing.T) {
+	ctx := context.Background()
+
+	planner, _ := scriptedPlanner(
+		`{"steps":[{"capability":"research","task":"One"},{"capability":"coding","task":"Two"}]}`,
+		"I give up",
+	)
+
+	researcher := agent.New("researcher").
+		Model(provider.NewMockWithResponse("found")).
+		Provides(core.CapResearch).
+		Build()
+
+	pe := NewPlanExecute(planner, NewSupervisor(WithWorkers(researcher)))
+
+	result, err := pe.Run(ctx, "Do things")
+	if !errors.Is(err, ErrInvalidPlan) {
+		t.Fatalf("expected ErrInvalidPlan, got %v", err)
+	}
+	if result == nil || result.Output != "found" || result.Metadata["step_outputs"].(map[int]string)[1] != "found" {
+		t.Errorf("expected the partial result, got %+v", result)
+	}
+}
+
+func TestPlanExecute_InvalidPlan(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []string{
+		"I cannot plan this",
+		`{"steps":[{"capability":"research"}]}`,
+		`{"steps":[]}`,
+	}
+
+	for _, reply := range tests {
+		planner, _ := scriptedPlanner(reply)
+		pe := NewPlanExecute(planner, NewSupervisor())
+
+		if _, err := pe.Run(ctx, "task"); !errors.Is(err, ErrInvalidPlan) {
+			t.Errorf("reply %q: expected ErrInvalidPlan, got %v", reply, err)
+		}
+	}
+}
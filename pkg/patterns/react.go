@@ -1,10 +1,14 @@
 package patterns
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/storo/lattice/pkg/core"
 )
@@ -18,13 +22,31 @@ var (
 const DefaultMaxIterations = 10
 
 // ReActAgent wraps an agent with the ReAct (Reasoning + Acting) pattern.
-// The agent alternates between thinking (reasoning) and acting (tool use)
-// until it reaches a final answer or exceeds max iterations.
+// Each iteration the agent writes a Thought and either an Action with its
+// JSON input or a final Answer. Actions run the matching tool from the
+// agent's Tools() and the result is fed back as an Observation. Because
+// tool use is plain text, this works with models that have no native tool
+// calling: agents that can run without sending their tools to the model,
+// like *agent.Agent, are run that way, and run the actions themselves, so
+// that their approval gate applies.
 type ReActAgent struct {
 	agent         core.Agent
+	model         core.Agent
 	maxIterations int
 }
 
+// toollessRunner is implemented by agents that can run without offering
+// their tools to the model natively.
+type toollessRunner interface {
+	WithoutTools() core.Agent
+}
+
+// toolExecutor is implemented by agents, such as *agent.Agent, that run
+// tool calls themselves, applying their approval gate.
+type toolExecutor interface {
+	ExecuteTool(ctx context.Context, call core.ToolCall) (string, error)
+}
+
 // ReActOption configures the ReAct agent.
 type ReActOption func(*ReActAgent)
 
@@ -32,8 +54,12 @@ type ReActOption func(*ReActAgent)
 func NewReActAgent(agent core.Agent, opts ...ReActOption) *ReActAgent {
 	r := &ReActAgent{
 		agent:         agent,
+		model:         agent,
 		maxIterations: DefaultMaxIterations,
 	}
+	if t, ok := agent.(toollessRunner); ok {
+		r.model = t.WithoutTools()
+	}
 
 	for _, opt := range opts {
 		opt(r)
@@ -49,45 +75,193 @@ func WithMaxIterations(n int) ReActOption {
 	}
 }
 
-// Run executes the ReAct agent with reasoning iterations.
+// ReActStep is one parsed Thought/Action/Observation iteration.
+type ReActStep struct {
+	Thought     string          `json:"thought,omitempty"`
+	Action      string          `json:"action,omitempty"`
+	ActionInput json.RawMessage `json:"action_input,omitempty"`
+	Observation string          `json:"observation,omitempty"`
+	Answer      string          `json:"answer,omitempty"`
+}
+
+// generateFunc runs the wrapped agent once on a prompt.
+type generateFunc func(ctx context.Context, prompt string) (*core.Result, error)
+
+// Run executes the ReAct loop. The result's output is the final answer.
+// Metadata holds the parsed "steps" ([]ReActStep), the "scratchpad" and
+// the number of "iterations". When the iteration limit is reached, the
+// last result is returned with ErrMaxIterationsReached.
 func (r *ReActAgent) Run(ctx context.Context, input string) (*core.Result, error) {
-	// The underlying agent handles the tool loop.
-	// ReAct adds iteration limiting on top for multi-step reasoning.
-	iterations := 0
-	currentInput := input
-	var lastResult *core.Result
+	return r.loop(ctx, input, r.model.Run, nil)
+}
+
+// loop runs Thought/Action/Observation iterations until an answer is
+// given. observe, if set, is called with each observation line.
+func (r *ReActAgent) loop(ctx context.Context, input string, generate generateFunc, observe func(string)) (*core.Result, error) {
+	start := time.Now()
+	tools := r.agent.Tools()
+	instructions := reactInstructions(tools)
+
+	var (
+		scratchpad strings.Builder
+		steps      []ReActStep
+		tokensIn   int
+		tokensOut  int
+		lastResult *core.Result
+	)
+
+	finish := func(result *core.Result, output string) *core.Result {
+		return &core.Result{
+			Output:    output,
+			TokensIn:  tokensIn,
+			TokensOut: tokensOut,
+			Duration:  time.Since(start),
+			TraceID:   result.TraceID,
+			CallChain: result.CallChain,
+			Metadata: map[string]any{
+				"steps":      steps,
+				"scratchpad": scratchpad.String(),
+				"iterations": len(steps),
+			},
+		}
+	}
 
-	for iterations < r.maxIterations {
-		iterations++
+	for len(steps) < r.maxIterations {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
-		result, err := r.agent.Run(ctx, currentInput)
+		result, err := generate(ctx, reactPrompt(instructions, input, scratchpad.String()))
 		if err != nil {
 			return nil, err
 		}
 		lastResult = result
-
-		// Check if the output contains an Action (meaning more reasoning needed)
-		_, action := ParseThoughtAction(result.Output)
-		if action == "" {
-			// No action specified, this is the final answer
-			return result, nil
+		tokensIn += result.TokensIn
+		tokensOut += result.TokensOut
+
+		text := truncateObservation(result.Output)
+		step := ParseReActStep(text)
+
+		if step.Action == "" {
+			// A reply without an action is the final answer
+			if step.Answer == "" {
+				step.Answer = strings.TrimSpace(text)
+			}
+			steps = append(steps, step)
+			return finish(result, step.Answer), nil
 		}
 
-		// Continue with the result as additional context
-		currentInput = result.Output
+		step.Observation = r.act(ctx, tools, step)
+		steps = append(steps, step)
+
+		scratchpad.WriteString(strings.TrimSpace(text))
+		scratchpad.WriteString("\nObservation: ")
+		scratchpad.WriteString(step.Observation)
+		scratchpad.WriteString("\n")
+
+		if observe != nil {
+			observe("\nObservation: " + step.Observation + "\n")
+		}
 	}
 
-	// If we have a result from the last iteration, return it with the error
 	if lastResult != nil {
-		return lastResult, ErrMaxIterationsReached
+		return finish(lastResult, lastResult.Output), ErrMaxIterationsReached
 	}
 
 	return nil, ErrMaxIterationsReached
 }
 
-// RunStream executes the ReAct agent with streaming output.
+// act executes the step's action and returns the observation.
+func (r *ReActAgent) act(ctx context.Context, tools []core.Tool, step ReActStep) string {
+	var tool core.Tool
+	for _, t := range tools {
+		if t.Name() == step.Action {
+			tool = t
+			break
+		}
+	}
+	if tool == nil {
+		names := make([]string, len(tools))
+		for i, t := range tools {
+			names[i] = t.Name()
+		}
+		if len(names) == 0 {
+			return fmt.Sprintf("Error: unknown tool %q. No tools are available; give your Answer.", step.Action)
+		}
+		return fmt.Sprintf("Error: unknown tool %q. Available tools: %s", step.Action, strings.Join(names, ", "))
+	}
+
+	params := step.ActionInput
+	if params == nil {
+		params = json.RawMessage(`{}`)
+	}
+	if err := core.ValidateJSON(tool.Schema(), params); err != nil {
+		return "Error: " + err.Error()
+	}
+
+	// Calls go through the agent when it can run them, so that they wait
+	// for the same approvals as its native tool calls
+	var (
+		output string
+		err    error
+	)
+	if e, ok := r.agent.(toolExecutor); ok {
+		output, err = e.ExecuteTool(ctx, core.ToolCall{Name: tool.Name(), Params: params})
+	} else {
+		output, err = tool.Execute(ctx, params)
+	}
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+	return output
+}
+
+// RunStream executes the ReAct loop, streaming the model's reasoning and
+// each observation. Only the final chunk has Done set.
 func (r *ReActAgent) RunStream(ctx context.Context, input string) (<-chan core.StreamChunk, error) {
-	return r.agent.RunStream(ctx, input)
+	ch := make(chan core.StreamChunk)
+
+	send := func(chunk core.StreamChunk) {
+		select {
+		case ch <- chunk:
+		case <-ctx.Done():
+		}
+	}
+
+	// Stream each model call, collecting its text for parsing
+	generate := func(ctx context.Context, prompt string) (*core.Result, error) {
+		chunks, err := r.model.RunStream(ctx, prompt)
+		if err != nil {
+			return nil, err
+		}
+
+		var sb strings.Builder
+		for chunk := range chunks {
+			if chunk.Error != nil {
+				return nil, chunk.Error
+			}
+			if chunk.Content != "" {
+				sb.WriteString(chunk.Content)
+				send(core.StreamChunk{Content: chunk.Content})
+			}
+		}
+		return &core.Result{Output: sb.String()}, nil
+	}
+
+	go func() {
+		defer close(ch)
+
+		_, err := r.loop(ctx, input, generate, func(observation string) {
+			send(core.StreamChunk{Content: observation})
+		})
+		if err != nil {
+			send(core.StreamChunk{Error: err})
+			return
+		}
+		send(core.StreamChunk{Done: true})
+	}()
+
+	return ch, nil
 }
 
 // ID returns the underlying agent's ID.
@@ -152,16 +326,109 @@ func ParseThoughtAction(response string) (thought, action string) {
 	return thought, action
 }
 
+// reactLinePattern matches the start of a ReAct section.
+var reactLinePattern = regexp.MustCompile(`(?i)^(thought|action input|action|final answer|answer)\s*:\s*(.*)$`)
+
+// ParseReActStep parses a ReAct-formatted response. Sections may span
+// several lines; the action input is the JSON value after "Action Input:"
+// or after the tool name on the Action line.
+func ParseReActStep(response string) ReActStep {
+	var (
+		step     ReActStep
+		section  string
+		sections = make(map[string]*strings.Builder)
+	)
+
+	for _, line := range strings.Split(response, "\n") {
+		if matches := reactLinePattern.FindStringSubmatch(strings.TrimSpace(line)); matches != nil {
+			section = strings.ToLower(matches[1])
+			if section == "final answer" {
+				section = "answer"
+			}
+			// A repeated section replaces the earlier one
+			sections[section] = &strings.Builder{}
+			sections[section].WriteString(matches[2])
+			continue
+		}
+		if sb, ok := sections[section]; ok {
+			sb.WriteString("\n")
+			sb.WriteString(line)
+		}
+	}
+
+	text := func(name string) string {
+		if sb, ok := sections[name]; ok {
+			return strings.TrimSpace(sb.String())
+		}
+		return ""
+	}
+
+	step.Thought = text("thought")
+	step.Answer = text("answer")
+
+	action := strings.Trim(text("action"), "`\"' ")
+	input := text("action input")
+	if i := strings.IndexAny(action, " ({["); i > 0 {
+		if input == "" {
+			input = strings.TrimSpace(action[i:])
+		}
+		action = action[:i]
+	}
+	step.Action = action
+
+	if input != "" {
+		if raw := core.ExtractJSON(input); raw != nil {
+			step.ActionInput = raw
+		} else {
+			// Not JSON: pass it as a string so schema validation can
+			// explain what was expected
+			step.ActionInput, _ = json.Marshal(strings.Trim(input, "`"))
+		}
+	}
+
+	return step
+}
+
+// truncateObservation drops anything from the first Observation line on,
+// in case the model invents its own observations.
+func truncateObservation(response string) string {
+	lines := strings.Split(response, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), "observation:") {
+			return strings.Join(lines[:i], "\n")
+		}
+	}
+	return response
+}
+
+// reactPrompt builds the input for one iteration.
+func reactPrompt(instructions, question, scratchpad string) string {
+	var sb strings.Builder
+	sb.WriteString(instructions)
+	sb.WriteString("\nQuestion: ")
+	sb.WriteString(question)
+	sb.WriteString("\n")
+	if scratchpad != "" {
+		sb.WriteString("\n")
+		sb.WriteString(scratchpad)
+	}
+	return sb.String()
+}
+
 // FormatReActPrompt creates a ReAct-style system prompt.
 func FormatReActPrompt(basePrompt string, tools []core.Tool) string {
+	return basePrompt + "\n\n" + reactInstructions(tools)
+}
+
+// reactInstructions describes the ReAct format and the available tools.
+func reactInstructions(tools []core.Tool) string {
 	var sb strings.Builder
-	sb.WriteString(basePrompt)
-	sb.WriteString("\n\n")
 	sb.WriteString("You are a ReAct agent. For each step:\n")
 	sb.WriteString("1. Think about what you need to do (Thought: ...)\n")
 	sb.WriteString("2. Choose an action to take (Action: tool_name)\n")
-	sb.WriteString("3. Observe the result (Observation: ...)\n")
-	sb.WriteString("4. Repeat until you have an answer (Answer: ...)\n\n")
+	sb.WriteString("3. Give the tool input as JSON (Action Input: {...})\n")
+	sb.WriteString("4. Stop and wait for the result (Observation: ...)\n")
+	sb.WriteString("5. Repeat until you have an answer (Answer: ...)\n\n")
 
 	if len(tools) > 0 {
 		sb.WriteString("Available tools:\n")
@@ -170,6 +437,8 @@ func FormatReActPrompt(basePrompt string, tools []core.Tool) string {
 			sb.WriteString(tool.Name())
 			sb.WriteString(": ")
 			sb.WriteString(tool.Description())
+			sb.WriteString("\n  Input schema: ")
+			sb.WriteString(compactJSON(tool.Schema()))
 			sb.WriteString("\n")
 		}
 	}
@@ -177,5 +446,14 @@ func FormatReActPrompt(basePrompt string, tools []core.Tool) string {
 	return sb.String()
 }
 
+// compactJSON renders a JSON document on one line.
+func compactJSON(data json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return string(data)
+	}
+	return buf.String()
+}
+
 // Verify ReActAgent implements core.Agent
 var _ core.Agent = (*ReActAgent)(nil)
@@ -3,11 +3,16 @@ package patterns
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/storo/lattice/pkg/agent"
+	"github.com/storo/lattice/pkg/approval"
 	"github.com/storo/lattice/pkg/core"
 	"github.com/storo/lattice/pkg/provider"
+	"github.com/storo/lattice/pkg/storage"
 )
 
 func TestReActAgent_BasicReasoning(t *testing.T) {
@@ -214,6 +219,257 @@ func TestReActAgent_ParseThoughtAction(t *testing.T) {
 	}
 }
 
+func TestReActAgent_TextActions(t *testing.T) {
+	ctx := context.Background()
+
+	var toolParams string
+	calculator := &mockTool{
+		name:        "calculator",
+		description: "Performs calculations",
+		executeFunc: func(ctx context.Context, params json.RawMessage) (string, error) {
+			toolParams = string(params)
+			return "42", nil
+		},
+	}
+
+	var prompts []string
+	nativeTools := 0
+	mockProvider := &provider.MockProvider{
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			prompts = append(prompts, req.Messages[0].Content)
+			nativeTools += len(req.Tools)
+			content := "Thought: I need to calculate.\nAction: calculator\nAction Input: {\"expression\": \"6 * 7\"}\nObservation: 41"
+			if len(prompts) > 1 {
+				content = "Thought: I know the result.\nAnswer: The result is 42."
+			}
+			return &provider.ChatResponse{
+				Content:    content,
+				StopReason: provider.StopReasonEndTurn,
+				Usage:      provider.Usage{InputTokens: 10, OutputTokens: 5},
+			}, nil
+		},
+	}
+
+	a := agent.New("react-agent").
+		Model(mockProvider).
+		Tools(calculator).
+		Build()
+
+	result, err := NewReActAgent(a).Run(ctx, "What is 6 * 7?")
+	if err != nil {
+		t.Fatalf("failed to run: %v", err)
+	}
+
+	if toolParams != `{"expression": "6 * 7"}` {
+		t.Errorf("expected action input passed to tool, got %q", toolParams)
+	}
+	if result.Output != "The result is 42." {
+		t.Errorf("expected final answer, got %q", result.Output)
+	}
+	if !strings.Contains(prompts[0], "calculator: Performs calculations") {
+		t.Errorf("expected tool list in prompt, got %q", prompts[0])
+	}
+
+	// Models without tool support reject native tool definitions
+	if nativeTools != 0 {
+		t.Errorf("expected no native tool definitions, got %d", nativeTools)
+	}
+	if !strings.Contains(prompts[1], "Observation: 42") || strings.Contains(prompts[1], "Observation: 41") {
+		t.Errorf("expected only the real observation in scratchpad, got %q", prompts[1])
+	}
+	if result.TokensIn != 20 || result.TokensOut != 10 {
+		t.Errorf("expected accumulated tokens, got %d/%d", result.TokensIn, result.TokensOut)
+	}
+	if result.Metadata["iterations"] != 2 {
+		t.Errorf("expected 2 iterations, got %v", result.Metadata["iterations"])
+	}
+}
+
+func TestReActAgent_ActionErrors(t *testing.T) {
+	ctx := context.Background()
+
+	strict := &strictTool{mockTool{
+		name:        "lookup",
+		description: "Looks things up",
+		executeFunc: func(ctx context.Context, params json.RawMessage) (string, error) {
+			return "", errors.New("not found")
+		},
+	}}
+
+	replies := []string{
+		"Action: search\nAction Input: {}",
+		"Action: lookup\nAction Input: {}",
+		"Action: lookup\nAction Input: {\"key\": \"x\"}",
+		"Answer: I give up.",
+	}
+	var prompts []string
+	mockProvider := &provider.MockProvider{
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			prompts = append(prompts, req.Messages[0].Content)
+			return &provider.ChatResponse{Content: replies[len(prompts)-1], StopReason: provider.StopReasonEndTurn}, nil
+		},
+	}
+
+	a := agent.New("react-agent").Model(mockProvider).Tools(strict).Build()
+
+	if _, err := NewReActAgent(a).Run(ctx, "Find x"); err != nil {
+		t.Fatalf("failed to run: %v", err)
+	}
+
+	last := prompts[len(prompts)-1]
+	for _, want := range []string{
+		`Observation: Error: unknown tool "search". Available tools: lookup`,
+		`Observation: Error: schema validation failed: $: missing required field "key"`,
+		"Observation: Error: not found",
+	} {
+		if !strings.Contains(last, want) {
+			t.Errorf("expected %q in scratchpad, got %q", want, last)
+		}
+	}
+}
+
+func TestReActAgent_Approvals(t *testing.T) {
+	ctx := context.Background()
+
+	deleted := false
+	remove := &mockTool{
+		name:        "delete",
+		description: "Deletes a file",
+		executeFunc: func(ctx context.Context, params json.RawMessage) (string, error) {
+			deleted = true
+			return "deleted", nil
+		},
+	}
+
+	var q *approval.Queue
+	q = approval.NewQueue(storage.NewMemoryStore(), approval.WithPollInterval(time.Millisecond), approval.WithNotify(func(a *approval.Approval) {
+		go q.Deny(context.Background(), a.ID, "ops", "not today")
+	}))
+	policy, _ := approval.NewPolicy(approval.Rule{Tool: "delete"})
+
+	replies := []string{"Action: delete\nAction Input: {\"path\": \"a\"}", "Answer: I could not."}
+	var prompts []string
+	mockProvider := &provider.MockProvider{
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			prompts = append(prompts, req.Messages[0].Content)
+			return &provider.ChatResponse{Content: replies[len(prompts)-1], StopReason: provider.StopReasonEndTurn}, nil
+		},
+	}
+
+	a := agent.New("react-agent").Model(mockProvider).Tools(remove).Approvals(approval.NewGate(policy, q)).Build()
+
+	if _, err := NewReActAgent(a).Run(ctx, "Delete a"); err != nil {
+		t.Fatalf("failed to run: %v", err)
+	}
+	if deleted {
+		t.Error("expected the denied action not to run")
+	}
+	if last := prompts[len(prompts)-1]; !strings.Contains(last, "Observation: Error: tool call not approved") || !strings.Contains(last, "not today") {
+		t.Errorf("expected the denial in the scratchpad, got %q", last)
+	}
+}
+
+func TestReActAgent_StreamingLoop(t *testing.T) {
+	ctx := context.Background()
+
+	calculator := &mockTool{
+		name: "calculator",
+		executeFunc: func(ctx context.Context, params json.RawMessage) (string, error) {
+			return "42", nil
+		},
+	}
+
+	calls := 0
+	mockProvider := &provider.MockProvider{
+		ChatStreamFunc: func(ctx context.Context, req *provider.ChatRequest) (<-chan provider.StreamEvent, error) {
+			if len(req.Tools) > 0 {
+				return nil, errors.New("model does not support tools")
+			}
+			calls++
+			content := "Action: calculator"
+			if calls > 1 {
+				content = "Answer: 42"
+			}
+			ch := make(chan provider.StreamEvent, 2)
+			ch <- provider.StreamEvent{Type: provider.EventTypeDelta, Delta: content}
+			ch <- provider.StreamEvent{Type: provider.EventTypeStop}
+			close(ch)
+			return ch, nil
+		},
+	}
+
+	a := agent.New("react-agent").Model(mockProvider).Tools(calculator).Build()
+
+	chunks, err := NewReActAgent(a).RunStream(ctx, "What is 6 * 7?")
+	if err != nil {
+		t.Fatalf("failed to run stream: %v", err)
+	}
+
+	var sb strings.Builder
+	done := 0
+	for chunk := range chunks {
+		if chunk.Error != nil {
+			t.Fatalf("unexpected error: %v", chunk.Error)
+		}
+		if chunk.Done {
+			done++
+		}
+		sb.WriteString(chunk.Content)
+	}
+
+	if done != 1 {
+		t.Errorf("expected exactly one done chunk, got %d", done)
+	}
+	if got := sb.String(); got != "Action: calculator\nObservation: 42\nAnswer: 42" {
+		t.Errorf("unexpected stream content %q", got)
+	}
+}
+
+func TestParseReActStep(t *testing.T) {
+	tests := []struct {
+		input string
+		want  ReActStep
+	}{
+		{
+			input: "Thought: Search first.\nAction: search\nAction Input: {\"query\": \"go\"}",
+			want:  ReActStep{Thought: "Search first.", Action: "search", ActionInput: json.RawMessage(`{"query": "go"}`)},
+		},
+		{
+			input: "Action: `search`\nAction Input:\n```json\n{\"query\": \"go\"}\n```",
+			want:  ReActStep{Action: "search", ActionInput: json.RawMessage(`{"query": "go"}`)},
+		},
+		{
+			input: `Action: search {"query": "go"}`,
+			want:  ReActStep{Action: "search", ActionInput: json.RawMessage(`{"query": "go"}`)},
+		},
+		{
+			input: "Action: search\nAction Input: golang",
+			want:  ReActStep{Action: "search", ActionInput: json.RawMessage(`"golang"`)},
+		},
+		{
+			input: "Thought: Done.\nFinal Answer: Line one.\nLine two.",
+			want:  ReActStep{Thought: "Done.", Answer: "Line one.\nLine two."},
+		},
+	}
+
+	for _, tt := range tests {
+		got := ParseReActStep(tt.input)
+		if got.Thought != tt.want.Thought || got.Action != tt.want.Action ||
+			string(got.ActionInput) != string(tt.want.ActionInput) || got.Answer != tt.want.Answer {
+			t.Errorf("ParseReActStep(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+// strictTool is a mockTool with a required "key" parameter.
+type strictTool struct {
+	mockTool
+}
+
+func (t *strictTool) Schema() json.RawMessage {
+	return []byte(`{"type":"object","properties":{"key":{"type":"string"}},"required":["key"]}`)
+}
+
 // mockTool implements core.Tool for testing
 type mockTool struct {
 	name        string
@@ -5,17 +5,32 @@ import (
 	"errors"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/storo/lattice/pkg/core"
 )
 
 // Pipeline errors
 var (
-	ErrEmptyPipeline = errors.New("pipeline has no agents")
+	ErrEmptyPipeline  = errors.New("pipeline has no agents")
+	ErrNoCheckpointer = errors.New("pipeline has no checkpointer")
 )
 
+// Checkpointer runs a pipeline with a checkpoint after every agent, so
+// that a run interrupted by a crash resumes from its last completed step.
+// workflow.Checkpoints.Pipeline returns one.
+type Checkpointer interface {
+	// Run runs the agents in order as the run runID.
+	Run(ctx context.Context, runID, input string, agents []core.Agent) (*core.Result, error)
+
+	// Resume continues the run runID; agents that completed are not run
+	// again.
+	Resume(ctx context.Context, runID string, agents []core.Agent) (*core.Result, error)
+}
+
 // Sequential executes agents in sequence, passing output to the next input.
 type Sequential struct {
-	agents []core.Agent
+	agents       []core.Agent
+	checkpointer Checkpointer
 }
 
 // NewSequential creates a new sequential pipeline.
@@ -25,12 +40,28 @@ func NewSequential(agents ...core.Agent) *Sequential {
 	}
 }
 
+// WithCheckpoints makes runs durable: c saves a checkpoint after every
+// agent, and interrupted runs continue with Resume.
+func (s *Sequential) WithCheckpoints(c Checkpointer) *Sequential {
+	s.checkpointer = c
+	return s
+}
+
 // Run executes the pipeline sequentially.
 // Each agent receives the previous agent's output as input.
 func (s *Sequential) Run(ctx context.Context, input string) (*core.Result, error) {
+	return s.RunWithID(ctx, uuid.New().String(), input)
+}
+
+// RunWithID is Run with a caller-chosen run ID, used as the checkpoint
+// key. With checkpoints, Metadata is that of the checkpointer's run.
+func (s *Sequential) RunWithID(ctx context.Context, runID, input string) (*core.Result, error) {
 	if len(s.agents) == 0 {
 		return nil, ErrEmptyPipeline
 	}
+	if s.checkpointer != nil {
+		return s.checkpointer.Run(ctx, runID, input, s.agents)
+	}
 
 	start := time.Now()
 	currentInput := input
@@ -62,6 +93,14 @@ func (s *Sequential) Run(ctx context.Context, input string) (*core.Result, error
 	}, nil
 }
 
+// Resume continues a checkpointed run from its last completed agent.
+func (s *Sequential) Resume(ctx context.Context, runID string) (*core.Result, error) {
+	if s.checkpointer == nil {
+		return nil, ErrNoCheckpointer
+	}
+	return s.checkpointer.Resume(ctx, runID, s.agents)
+}
+
 // Agents returns the agents in the pipeline.
 func (s *Sequential) Agents() []core.Agent {
 	return s.agents
@@ -3,6 +3,7 @@ package patterns
 import (
 	"context"
 	"errors"
+	"sort"
 	"sync"
 
 	"github.com/storo/lattice/pkg/core"
@@ -26,7 +27,8 @@ const (
 	// StrategyRaceFirst sends to all workers and returns the first result.
 	StrategyRaceFirst Strategy = "race_first"
 
-	// StrategyAll sends to all workers and aggregates results.
+	// StrategyAll sends to all workers and aggregates their answers with
+	// the supervisor's aggregator (default: MajorityVote).
 	StrategyAll Strategy = "all"
 )
 
@@ -35,6 +37,7 @@ type Supervisor struct {
 	mu       sync.RWMutex
 	workers  map[string]core.Agent
 	strategy Strategy
+	agg      Aggregator
 	rrIndex  map[core.Capability]int // round-robin indices
 	healthy  map[string]bool
 }
@@ -75,6 +78,13 @@ func WithStrategy(strategy Strategy) SupervisorOption {
 	}
 }
 
+// WithAggregator sets how StrategyAll combines the workers' answers.
+func WithAggregator(agg Aggregator) SupervisorOption {
+	return func(s *Supervisor) {
+		s.agg = agg
+	}
+}
+
 // AddWorker adds a worker to the supervisor.
 func (s *Supervisor) AddWorker(worker core.Agent) {
 	s.mu.Lock()
@@ -122,6 +132,10 @@ func (s *Supervisor) Delegate(ctx context.Context, cap core.Capability, input st
 		return s.raceFirst(ctx, workers, input)
 	case StrategyRoundRobin:
 		return s.roundRobin(ctx, cap, workers, input)
+	case StrategyAll:
+		// Sort so that ties are broken the same way every time
+		sort.Slice(workers, func(i, j int) bool { return workers[i].ID() < workers[j].ID() })
+		return vote(ctx, workers, input, s.agg)
 	default:
 		// Default to first worker
 		return workers[0].Run(ctx, input)
@@ -0,0 +1,364 @@
+package patterns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/storo/lattice/pkg/core"
+)
+
+// Voting errors
+var (
+	ErrNoQuorum = errors.New("quorum not reached")
+)
+
+// Consensus is the outcome of aggregating several agents' answers.
+type Consensus struct {
+	// Output is the agreed answer.
+	Output string
+
+	// Agreement is the share of the vote, from 0 to 1, behind Output.
+	Agreement float64
+
+	// Votes maps each normalized answer to its vote weight.
+	Votes map[string]float64
+
+	// TokensIn and TokensOut count tokens spent by the aggregator itself.
+	TokensIn  int
+	TokensOut int
+}
+
+// Aggregator combines the successful results of agents that were given the
+// same input. Results are in the order the agents were given.
+type Aggregator interface {
+	Aggregate(ctx context.Context, input string, results []*AgentResult) (*Consensus, error)
+}
+
+// EarlyAggregator is an Aggregator that can decide before every agent has
+// answered. The agents still running are then cancelled.
+type EarlyAggregator interface {
+	Aggregator
+
+	// Decided reports whether the results so far settle the outcome.
+	Decided(results []*AgentResult) bool
+}
+
+// VoteOption configures the built-in aggregators.
+type VoteOption func(*voteConfig)
+
+// voteConfig is shared by the built-in aggregators.
+type voteConfig struct {
+	normalize  func(string) string
+	confidence func(*AgentResult) (string, float64)
+}
+
+func newVoteConfig(opts []VoteOption) voteConfig {
+	c := voteConfig{
+		normalize:  NormalizeAnswer,
+		confidence: Confidence,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithNormalizer sets how answers are normalized before they are compared
+// (default: NormalizeAnswer).
+func WithNormalizer(normalize func(string) string) VoteOption {
+	return func(c *voteConfig) {
+		c.normalize = normalize
+	}
+}
+
+// WithConfidence sets how WeightedVote reads an answer and its confidence
+// from a result (default: Confidence).
+func WithConfidence(confidence func(*AgentResult) (string, float64)) VoteOption {
+	return func(c *voteConfig) {
+		c.confidence = confidence
+	}
+}
+
+// MajorityVote picks the most common normalized answer. Ties go to the
+// answer of the earliest agent.
+func MajorityVote(opts ...VoteOption) Aggregator {
+	return &majorityVote{config: newVoteConfig(opts)}
+}
+
+type majorityVote struct {
+	config voteConfig
+}
+
+func (v *majorityVote) Aggregate(ctx context.Context, input string, results []*AgentResult) (*Consensus, error) {
+	return v.config.tally(results, false).Consensus, nil
+}
+
+// WeightedVote picks the normalized answer with the highest total
+// confidence. Confidence is read from each result with the function set by
+// WithConfidence. When every confidence is 0, it falls back to a majority
+// vote.
+func WeightedVote(opts ...VoteOption) Aggregator {
+	return &weightedVote{config: newVoteConfig(opts)}
+}
+
+type weightedVote struct {
+	config voteConfig
+}
+
+func (v *weightedVote) Aggregate(ctx context.Context, input string, results []*AgentResult) (*Consensus, error) {
+	return v.config.tally(results, true).Consensus, nil
+}
+
+// Quorum succeeds as soon as n agents give the same normalized answer, and
+// cancels the agents still running. It fails with ErrNoQuorum if no answer
+// gets n votes.
+func Quorum(n int, opts ...VoteOption) EarlyAggregator {
+	return &quorum{n: n, config: newVoteConfig(opts)}
+}
+
+type quorum struct {
+	n      int
+	config voteConfig
+}
+
+func (q *quorum) Decided(results []*AgentResult) bool {
+	return q.config.tally(results, false).leading >= float64(q.n)
+}
+
+func (q *quorum) Aggregate(ctx context.Context, input string, results []*AgentResult) (*Consensus, error) {
+	t := q.config.tally(results, false)
+	if t.leading < float64(q.n) {
+		return nil, fmt.Errorf("%w: best answer has %d of %d votes needed", ErrNoQuorum, int(t.leading), q.n)
+	}
+	return t.Consensus, nil
+}
+
+// JudgeMerge has a judge agent read every answer and write the final one.
+// Agreement is still measured by majority over normalized answers.
+func JudgeMerge(judge core.Agent, opts ...VoteOption) Aggregator {
+	return &judgeMerge{judge: judge, config: newVoteConfig(opts)}
+}
+
+type judgeMerge struct {
+	judge  core.Agent
+	config voteConfig
+}
+
+func (j *judgeMerge) Aggregate(ctx context.Context, input string, results []*AgentResult) (*Consensus, error) {
+	var sb strings.Builder
+	sb.WriteString("Several agents answered the task below. Compare their answers and reply with the single best answer, merging their strengths and correcting mistakes.\n\nTask: ")
+	sb.WriteString(input)
+	sb.WriteString("\n")
+	for i, r := range results {
+		fmt.Fprintf(&sb, "\nAnswer %d:\n%s\n", i+1, r.Output)
+	}
+
+	verdict, err := j.judge.Run(ctx, sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("judge failed: %w", err)
+	}
+
+	consensus := j.config.tally(results, false).Consensus
+	consensus.Output = verdict.Output
+	consensus.TokensIn = verdict.TokensIn
+	consensus.TokensOut = verdict.TokensOut
+	return consensus, nil
+}
+
+// tally is a vote count.
+type tally struct {
+	*Consensus
+	leading float64
+}
+
+// tally counts the results' normalized answers, weighted by confidence if
+// weighted is set and any result has some.
+func (c voteConfig) tally(results []*AgentResult, weighted bool) tally {
+	answers := make([]string, len(results))
+	weights := make([]float64, len(results))
+	var total float64
+	for i, r := range results {
+		answers[i], weights[i] = r.Output, 1
+		if weighted {
+			answers[i], weights[i] = c.confidence(r)
+		}
+		total += weights[i]
+	}
+
+	// Nobody is confident: count every answer once
+	if total == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+		total = float64(len(weights))
+	}
+
+	votes := make(map[string]float64)
+	first := make(map[string]string)
+	var order []string
+	for i, answer := range answers {
+		key := c.normalize(answer)
+		if _, seen := votes[key]; !seen {
+			order = append(order, key)
+			first[key] = strings.TrimSpace(answer)
+		}
+		votes[key] += weights[i]
+	}
+
+	t := tally{Consensus: &Consensus{Votes: votes}}
+	for _, key := range order {
+		if votes[key] > t.leading {
+			t.leading = votes[key]
+			t.Output = first[key]
+		}
+	}
+	if total > 0 {
+		t.Agreement = t.leading / total
+	}
+	return t
+}
+
+// NormalizeAnswer lowercases an answer, collapses whitespace and trims
+// surrounding punctuation, quotes and markdown emphasis, so that "Positive."
+// and "**positive**" count as the same vote.
+func NormalizeAnswer(s string) string {
+	s = strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	return strings.Trim(s, " .,;:!?\"'`*_")
+}
+
+// confidencePattern matches a "Confidence: 0.8" or "confidence: 80%" line.
+var confidencePattern = regexp.MustCompile(`(?im)^\s*confidence\s*[:=]\s*([0-9]*\.?[0-9]+)\s*(%?)\s*$`)
+
+// Confidence reads an agent's confidence, from 0 to 1, from its result's
+// "confidence" metadata or from a "Confidence: 0.8" (or "80%") line in its
+// output, which is removed from the answer. Answers without a confidence
+// count as 1.
+func Confidence(r *AgentResult) (string, float64) {
+	if r.Result != nil {
+		if c, ok := r.Result.Metadata["confidence"].(float64); ok {
+			return r.Output, c
+		}
+	}
+
+	m := confidencePattern.FindStringSubmatchIndex(r.Output)
+	if m == nil {
+		return r.Output, 1
+	}
+
+	c, err := strconv.ParseFloat(r.Output[m[2]:m[3]], 64)
+	if err != nil {
+		return r.Output, 1
+	}
+	if m[5] > m[4] || c > 1 {
+		c /= 100
+	}
+
+	answer := r.Output[:m[0]] + r.Output[m[1]:]
+	return strings.TrimSpace(answer), min(max(c, 0), 1)
+}
+
+// vote runs the agents concurrently on input and aggregates their answers.
+func vote(ctx context.Context, agents []core.Agent, input string, agg Aggregator) (*core.Result, error) {
+	if len(agents) == 0 {
+		return nil, ErrEmptyPipeline
+	}
+	if agg == nil {
+		agg = MajorityVote()
+	}
+
+	start := time.Now()
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type indexed struct {
+		index int
+		AgentResult
+	}
+	resultsCh := make(chan indexed, len(agents))
+	for i, a := range agents {
+		go func() {
+			result, err := a.Run(runCtx, input)
+			ar := indexed{index: i, AgentResult: AgentResult{AgentID: a.ID(), Result: result, Error: err}}
+			if result != nil {
+				ar.Output = result.Output
+			}
+			resultsCh <- ar
+		}()
+	}
+
+	// Collect in agent order, so that ties are broken the same way every run
+	byIndex := make([]*AgentResult, len(agents))
+	var lastErr error
+	failed := 0
+	early, _ := agg.(EarlyAggregator)
+
+	for received := 0; received < len(agents); received++ {
+		ar := <-resultsCh
+		if ar.Error != nil {
+			lastErr = ar.Error
+			failed++
+		} else {
+			byIndex[ar.index] = &ar.AgentResult
+		}
+
+		if early != nil && early.Decided(compact(byIndex)) {
+			cancel()
+			break
+		}
+	}
+
+	results := compact(byIndex)
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrAllAgentsFailed, lastErr)
+	}
+
+	consensus, err := agg.Aggregate(ctx, input, results)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keyed by position, as the same agent may vote more than once
+	tokensIn, tokensOut := consensus.TokensIn, consensus.TokensOut
+	answers := make(map[int]string, len(results))
+	for i, r := range byIndex {
+		if r == nil {
+			continue
+		}
+		tokensIn += r.Result.TokensIn
+		tokensOut += r.Result.TokensOut
+		answers[i] = r.Output
+	}
+
+	return &core.Result{
+		Output:    consensus.Output,
+		TokensIn:  tokensIn,
+		TokensOut: tokensOut,
+		Duration:  time.Since(start),
+		TraceID:   core.TraceID(ctx),
+		CallChain: core.CallChain(ctx),
+		Metadata: map[string]any{
+			"agreement":  consensus.Agreement,
+			"votes":      consensus.Votes,
+			"answers":    answers,
+			"failed":     failed,
+			"tokens_in":  tokensIn,
+			"tokens_out": tokensOut,
+		},
+	}, nil
+}
+
+// compact returns the non-nil results in order.
+func compact(results []*AgentResult) []*AgentResult {
+	var out []*AgentResult
+	for _, r := range results {
+		if r != nil {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,245 @@
+package patterns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/storo/lattice/pkg/agent"
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/provider"
+)
+
+// classifier returns an agent that always answers label.
+func classifier(name, label string) *agent.Agent {
+	return agent.New(name).
+		Model(provider.NewMockWithResponse(label)).
+		Provides(core.CapAnalysis).
+		Build()
+}
+
+func TestParallel_VoteMajority(t *testing.T) {
+	ctx := context.Background()
+
+	p := NewParallel(
+		classifier("a", "Positive."),
+		classifier("b", "negative"),
+		classifier("c", "**positive**"),
+	)
+
+	result, err := p.Vote(ctx, "Classify: I love it", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Output != "Positive." {
+		t.Errorf("expected the first positive answer, got %q", result.Output)
+	}
+	if agreement := result.Metadata["agreement"].(float64); agreement < 0.66 || agreement > 0.67 {
+		t.Errorf("expected agreement 2/3, got %v", agreement)
+	}
+	votes := result.Metadata["votes"].(map[string]float64)
+	if votes["positive"] != 2 || votes["negative"] != 1 {
+		t.Errorf("unexpected votes %v", votes)
+	}
+	if len(result.Metadata["answers"].(map[int]string)) != 3 {
+		t.Errorf("unexpected answers %v", result.Metadata["answers"])
+	}
+}
+
+func TestParallel_VoteSameAgentTwice(t *testing.T) {
+	ctx := context.Background()
+
+	// One agent asked twice still casts two votes, and both answers are kept
+	calls := 0
+	var mu sync.Mutex
+	a := agent.New("sampler").Model(&provider.MockProvider{
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			return &provider.ChatResponse{Content: fmt.Sprintf("answer %d", calls), StopReason: provider.StopReasonEndTurn}, nil
+		},
+	}).Build()
+
+	result, err := NewParallel(a, a).Vote(ctx, "Pick", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	answers := result.Metadata["answers"].(map[int]string)
+	if len(answers) != 2 || answers[0] == answers[1] {
+		t.Errorf("expected both answers, got %v", answers)
+	}
+}
+
+func TestParallel_VoteWeighted(t *testing.T) {
+	ctx := context.Background()
+
+	p := NewParallel(
+		classifier("a", "spam\nConfidence: 0.3"),
+		classifier("b", "Spam\nconfidence: 20%"),
+		classifier("c", "ham\nConfidence: 0.9"),
+	)
+
+	result, err := p.Vote(ctx, "Classify", WeightedVote())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Output != "ham" {
+		t.Errorf("expected the confident answer to win, got %q", result.Output)
+	}
+	if agreement := result.Metadata["agreement"].(float64); agreement < 0.64 || agreement > 0.65 {
+		t.Errorf("expected agreement 0.9/1.4, got %v", agreement)
+	}
+}
+
+func TestParallel_VoteWeightedNoConfidence(t *testing.T) {
+	ctx := context.Background()
+
+	p := NewParallel(
+		classifier("a", "spam\nConfidence: 0"),
+		classifier("b", "ham\nConfidence: 0%"),
+		classifier("c", "Ham\nconfidence: 0.0"),
+	)
+
+	result, err := p.Vote(ctx, "Classify", WeightedVote())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Nobody is confident, so the majority wins
+	if result.Output != "ham" {
+		t.Errorf("expected the majority answer, got %q", result.Output)
+	}
+	if agreement := result.Metadata["agreement"].(float64); agreement < 0.66 || agreement > 0.67 {
+		t.Errorf("expected agreement 2/3, got %v", agreement)
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	tests := []struct {
+		output     string
+		metadata   map[string]any
+		answer     string
+		confidence float64
+	}{
+		{"yes", nil, "yes", 1},
+		{"yes\nConfidence: 0.75", nil, "yes", 0.75},
+		{"Confidence: 85%\nno", nil, "no", 0.85},
+		{"maybe\nconfidence = 7", nil, "maybe", 0.07},
+		{"yes", map[string]any{"confidence": 0.4}, "yes", 0.4},
+	}
+
+	for _, tt := range tests {
+		answer, confidence := Confidence(&AgentResult{
+			Output: tt.output,
+			Result: &core.Result{Output: tt.output, Metadata: tt.metadata},
+		})
+		if answer != tt.answer || confidence != tt.confidence {
+			t.Errorf("%q: got %q, %v", tt.output, answer, confidence)
+		}
+	}
+}
+
+func TestParallel_VoteQuorum(t *testing.T) {
+	ctx := context.Background()
+
+	slowCancelled := make(chan bool, 1)
+	slow := agent.New("slow").
+		Model(&provider.MockProvider{
+			ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+				select {
+				case <-ctx.Done():
+					slowCancelled <- true
+					return nil, ctx.Err()
+				case <-time.After(5 * time.Second):
+					slowCancelled <- false
+					return &provider.ChatResponse{Content: "no", StopReason: provider.StopReasonEndTurn}, nil
+				}
+			},
+		}).
+		Build()
+
+	p := NewParallel(classifier("a", "yes"), slow, classifier("b", "Yes"))
+
+	result, err := p.Vote(ctx, "Agree?", Quorum(2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Output != "yes" || result.Metadata["agreement"] != 1.0 {
+		t.Errorf("unexpected result %q %v", result.Output, result.Metadata)
+	}
+	if !<-slowCancelled {
+		t.Error("expected the slow agent to be cancelled")
+	}
+
+	_, err = NewParallel(classifier("a", "yes"), classifier("b", "no")).Vote(ctx, "Agree?", Quorum(2))
+	if !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("expected ErrNoQuorum, got %v", err)
+	}
+}
+
+func TestParallel_VoteJudge(t *testing.T) {
+	ctx := context.Background()
+
+	judge, prompts := recordingAgent("judge", func(string) (string, error) {
+		return "merged", nil
+	})
+
+	result, err := NewParallel(classifier("a", "one"), classifier("b", "two")).Vote(ctx, "Count", JudgeMerge(judge))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Output != "merged" || result.Metadata["agreement"] != 0.5 {
+		t.Errorf("unexpected result %q %v", result.Output, result.Metadata)
+	}
+	if p := prompts(); len(p) != 1 || !strings.Contains(p[0], "Answer 1:\none") || !strings.Contains(p[0], "Answer 2:\ntwo") {
+		t.Errorf("unexpected judge prompt %q", p)
+	}
+}
+
+func TestParallel_VoteAllFailed(t *testing.T) {
+	ctx := context.Background()
+
+	failing, _ := recordingAgent("failing", func(string) (string, error) {
+		return "", errors.New("down")
+	})
+
+	_, err := NewParallel(failing).Vote(ctx, "x", nil)
+	if !errors.Is(err, ErrAllAgentsFailed) {
+		t.Errorf("expected ErrAllAgentsFailed, got %v", err)
+	}
+}
+
+func TestSupervisor_StrategyAll(t *testing.T) {
+	ctx := context.Background()
+
+	supervisor := NewSupervisor(
+		WithWorkers(classifier("a", "cat"), classifier("b", "dog"), classifier("c", "Cat")),
+		WithStrategy(StrategyAll),
+	)
+
+	result, err := supervisor.Delegate(ctx, core.CapAnalysis, "Which animal?")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if NormalizeAnswer(result.Output) != "cat" {
+		t.Errorf("expected cat, got %q", result.Output)
+	}
+
+	supervisor = NewSupervisor(
+		WithWorkers(classifier("a", "cat"), classifier("b", "dog")),
+		WithStrategy(StrategyAll),
+		WithAggregator(Quorum(2)),
+	)
+	if _, err := supervisor.Delegate(ctx, core.CapAnalysis, "Which animal?"); !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("expected ErrNoQuorum, got %v", err)
+	}
+}
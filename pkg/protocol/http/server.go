@@ -3,21 +3,29 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/storo/lattice/pkg/approval"
 	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/jobs"
+	"github.com/storo/lattice/pkg/memory"
 	"github.com/storo/lattice/pkg/mesh"
 	"github.com/storo/lattice/pkg/security"
 )
 
 // Server provides an HTTP API for the mesh.
 type Server struct {
-	mesh   *mesh.Mesh
-	auth   *security.Auth
-	mux    *http.ServeMux
-	server *http.Server
+	mesh      *mesh.Mesh
+	auth      *security.Auth
+	jobs      *jobs.Queue
+	approvals *approval.Queue
+	memory    *memory.Store
+	mux       *http.ServeMux
+	server    *http.Server
 }
 
 // ServerOption configures the server.
@@ -46,12 +54,55 @@ func WithAuth(auth *security.Auth) ServerOption {
 	}
 }
 
+// WithJobs enables the asynchronous job API, backed by q. Runs submitted
+// through it should use JobRunner with the server's mesh.
+func WithJobs(q *jobs.Queue) ServerOption {
+	return func(s *Server) {
+		s.jobs = q
+	}
+}
+
+// WithApprovals enables the approval endpoints, so that pending tool
+// calls and workflow steps can be approved or denied over HTTP.
+func WithApprovals(q *approval.Queue) ServerOption {
+	return func(s *Server) {
+		s.approvals = q
+	}
+}
+
+// WithMemory enables the memory endpoints, so that what agents remember
+// about users can be inspected and deleted.
+func WithMemory(m *memory.Store) ServerOption {
+	return func(s *Server) {
+		s.memory = m
+	}
+}
+
+// JobRunner returns a jobs.Runner that runs jobs on the mesh.
+func JobRunner(m *mesh.Mesh) jobs.Runner {
+	return func(ctx context.Context, job *jobs.Job) (*core.Result, error) {
+		if job.UserID != "" {
+			ctx = core.WithUserID(ctx, job.UserID)
+		}
+		if job.AgentID != "" {
+			return m.RunAgent(ctx, job.AgentID, job.Input)
+		}
+		return m.Run(ctx, job.Input)
+	}
+}
+
 // registerRoutes sets up the HTTP routes.
 func (s *Server) registerRoutes() {
 	s.mux.HandleFunc("/health", s.handleHealth)
 	s.mux.HandleFunc("/agents", s.handleAgents)
 	s.mux.HandleFunc("/agents/", s.handleAgent)
 	s.mux.HandleFunc("/mesh/run", s.handleMeshRun)
+	s.mux.HandleFunc("/jobs", s.handleJobs)
+	s.mux.HandleFunc("/jobs/", s.handleJob)
+	s.mux.HandleFunc("/approvals", s.handleApprovals)
+	s.mux.HandleFunc("/approvals/", s.handleApproval)
+	s.mux.HandleFunc("/memories", s.handleMemories)
+	s.mux.HandleFunc("/memories/", s.handleMemory)
 }
 
 // ServeHTTP implements http.Handler.
@@ -185,7 +236,24 @@ func (s *Server) handleRunAgent(w http.ResponseWriter, r *http.Request, agentID
 		return
 	}
 
+	if !s.canActAs(r, req.UserID) {
+		s.writeError(w, http.StatusForbidden, "user_id requires the "+PermActAsUser+" permission")
+		return
+	}
+
 	ctx := r.Context()
+	if req.UserID != "" {
+		ctx = core.WithUserID(ctx, req.UserID)
+	}
+	if req.Async {
+		if _, err := s.mesh.GetAgent(ctx, agentID); err != nil {
+			s.writeError(w, http.StatusNotFound, "agent not found")
+			return
+		}
+		s.submitJob(w, r, &jobs.Job{AgentID: agentID, Input: req.Input, UserID: req.UserID, Webhook: req.Webhook})
+		return
+	}
+
 	result, err := s.mesh.RunAgent(ctx, agentID, req.Input)
 	if err != nil {
 		s.writeError(w, http.StatusInternalServerError, err.Error())
@@ -208,7 +276,20 @@ func (s *Server) handleMeshRun(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.canActAs(r, req.UserID) {
+		s.writeError(w, http.StatusForbidden, "user_id requires the "+PermActAsUser+" permission")
+		return
+	}
+
+	if req.Async {
+		s.submitJob(w, r, &jobs.Job{Input: req.Input, UserID: req.UserID, Webhook: req.Webhook})
+		return
+	}
+
 	ctx := r.Context()
+	if req.UserID != "" {
+		ctx = core.WithUserID(ctx, req.UserID)
+	}
 	result, err := s.mesh.Run(ctx, req.Input)
 	if err != nil {
 		s.writeError(w, http.StatusInternalServerError, err.Error())
@@ -218,6 +299,289 @@ func (s *Server) handleMeshRun(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, resultToResponse(result))
 }
 
+// handleJobs submits and lists jobs. Callers see their own jobs, or every
+// job with PermJobsAdmin.
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if s.jobs == nil {
+		s.writeError(w, http.StatusNotImplemented, "jobs are not enabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var req SubmitJobRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if !s.canActAs(r, req.UserID) {
+			s.writeError(w, http.StatusForbidden, "user_id requires the "+PermActAsUser+" permission")
+			return
+		}
+		if req.AgentID != "" {
+			if _, err := s.mesh.GetAgent(r.Context(), req.AgentID); err != nil {
+				s.writeError(w, http.StatusNotFound, "agent not found")
+				return
+			}
+		}
+		s.submitJob(w, r, &jobs.Job{AgentID: req.AgentID, Input: req.Input, UserID: req.UserID, Webhook: req.Webhook})
+
+	case http.MethodGet:
+		list, err := s.jobs.List(r.Context())
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		list = slices.DeleteFunc(list, func(job *jobs.Job) bool {
+			return !s.ownsJob(r, job)
+		})
+		s.writeJSON(w, http.StatusOK, ListJobsResponse{Jobs: list})
+
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleJob returns or cancels a job. Other callers' jobs are not found,
+// unless the caller has PermJobsAdmin.
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if s.jobs == nil {
+		s.writeError(w, http.StatusNotImplemented, "jobs are not enabled")
+		return
+	}
+
+	// Extract job ID from path: /jobs/{id}
+	jobID := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	if jobID == "" || strings.Contains(jobID, "/") {
+		s.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	var (
+		job *jobs.Job
+		err error
+	)
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	job, err = s.jobs.Get(r.Context(), jobID)
+	if err == nil && !s.ownsJob(r, job) {
+		err = jobs.ErrJobNotFound
+	}
+	if err == nil && r.Method == http.MethodDelete {
+		job, err = s.jobs.Cancel(r.Context(), jobID)
+	}
+
+	switch {
+	case errors.Is(err, jobs.ErrJobNotFound):
+		s.writeError(w, http.StatusNotFound, "job not found")
+	case errors.Is(err, jobs.ErrJobFinished):
+		s.writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		s.writeJSON(w, http.StatusOK, job)
+	}
+}
+
+// handleApprovals lists approvals, pending ones unless ?status= is given
+// ("all" lists every approval).
+func (s *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	if s.approvals == nil {
+		s.writeError(w, http.StatusNotImplemented, "approvals are not enabled")
+		return
+	}
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	status := approval.Status(r.URL.Query().Get("status"))
+	switch status {
+	case "":
+		status = approval.StatusPending
+	case "all":
+		status = ""
+	}
+
+	list, err := s.approvals.List(r.Context(), status)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, ListApprovalsResponse{Approvals: list})
+}
+
+// handleApproval returns or decides an approval.
+func (s *Server) handleApproval(w http.ResponseWriter, r *http.Request) {
+	if s.approvals == nil {
+		s.writeError(w, http.StatusNotImplemented, "approvals are not enabled")
+		return
+	}
+
+	// Extract approval ID from path: /approvals/{id} or /approvals/{id}/{approve|deny}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/approvals/"), "/")
+	if parts[0] == "" || len(parts) > 2 {
+		s.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	id := parts[0]
+
+	var (
+		a   *approval.Approval
+		err error
+	)
+	switch {
+	case len(parts) == 1:
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		a, err = s.approvals.Get(r.Context(), id)
+
+	case parts[1] == "approve" || parts[1] == "deny":
+		if r.Method != http.MethodPost {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		if !s.permitted(r, PermApprovalsDecide) {
+			s.writeError(w, http.StatusForbidden, "deciding approvals requires the "+PermApprovalsDecide+" permission")
+			return
+		}
+
+		var req DecisionRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				s.writeError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+		}
+
+		if parts[1] == "approve" {
+			a, err = s.approvals.Approve(r.Context(), id, callerID(r), req.Comment)
+		} else {
+			a, err = s.approvals.Deny(r.Context(), id, callerID(r), req.Comment)
+		}
+
+	default:
+		s.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch {
+	case errors.Is(err, approval.ErrNotFound):
+		s.writeError(w, http.StatusNotFound, "approval not found")
+	case errors.Is(err, approval.ErrAlreadyDecided):
+		s.writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		s.writeJSON(w, http.StatusOK, a)
+	}
+}
+
+// handleMemories lists memories, or deletes everything remembered about a
+// user. Both accept ?agent= and ?user= filters. Callers without
+// PermMemoriesAdmin must pass their own ID as user.
+func (s *Server) handleMemories(w http.ResponseWriter, r *http.Request) {
+	if s.memory == nil {
+		s.writeError(w, http.StatusNotImplemented, "memory is not enabled")
+		return
+	}
+
+	agent := r.URL.Query().Get("agent")
+	user := r.URL.Query().Get("user")
+	if !s.ownsMemories(r, user) {
+		s.writeError(w, http.StatusForbidden, "other users' memories require the "+PermMemoriesAdmin+" permission")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := s.memory.List(r.Context(), agent, user)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, ListMemoriesResponse{Memories: list})
+
+	case http.MethodDelete:
+		n, err := s.memory.ForgetUser(r.Context(), agent, user)
+		if errors.Is(err, memory.ErrUserRequired) {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, ForgetMemoriesResponse{Deleted: n})
+
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleMemory returns or deletes a memory. Callers without
+// PermMemoriesAdmin only find the memories about themselves.
+func (s *Server) handleMemory(w http.ResponseWriter, r *http.Request) {
+	if s.memory == nil {
+		s.writeError(w, http.StatusNotImplemented, "memory is not enabled")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/memories/")
+	if id == "" || strings.Contains(id, "/") {
+		s.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	m, err := s.memory.Get(r.Context(), id)
+	if err == nil && !s.ownsMemories(r, m.User) {
+		err = memory.ErrNotFound
+	}
+	if err == nil && r.Method == http.MethodDelete {
+		err = s.memory.Forget(r.Context(), "", "", id)
+	}
+
+	switch {
+	case errors.Is(err, memory.ErrNotFound):
+		s.writeError(w, http.StatusNotFound, "memory not found")
+	case err != nil:
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+	case r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.writeJSON(w, http.StatusOK, m)
+	}
+}
+
+// submitJob queues a job and responds with it.
+func (s *Server) submitJob(w http.ResponseWriter, r *http.Request, job *jobs.Job) {
+	if s.jobs == nil {
+		s.writeError(w, http.StatusNotImplemented, "jobs are not enabled")
+		return
+	}
+
+	job.Owner = callerID(r)
+	submitted, err := s.jobs.Submit(r.Context(), job)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+submitted.ID)
+	s.writeJSON(w, http.StatusAccepted, submitted)
+}
+
 // writeJSON writes a JSON response.
 func (s *Server) writeJSON(w http.ResponseWriter, status int, data any) {
 	w.Header().Set("Content-Type", "application/json")
@@ -266,3 +630,60 @@ func resultToResponse(r *core.Result) RunResponse {
 type contextKey string
 
 const claimsKey contextKey = "claims"
+
+// Permissions checked when authentication is enabled.
+const (
+	// PermJobsAdmin lets a caller list and cancel every caller's jobs.
+	PermJobsAdmin = "jobs:admin"
+
+	// PermActAsUser lets a caller run agents and jobs for any user_id.
+	// Without it, a caller may only pass its own ID.
+	PermActAsUser = "users:act_as"
+
+	// PermApprovalsDecide lets a caller approve and deny tool calls.
+	PermApprovalsDecide = "approvals:decide"
+
+	// PermMemoriesAdmin lets a caller list and delete every user's
+	// memories. Without it, a caller only reaches those about its own ID.
+	PermMemoriesAdmin = "memories:admin"
+)
+
+// callerClaims returns the caller's claims, or nil without authentication.
+func callerClaims(r *http.Request) *security.AuthClaims {
+	claims, _ := r.Context().Value(claimsKey).(*security.AuthClaims)
+	return claims
+}
+
+// callerID returns the authenticated caller's ID, or "".
+func callerID(r *http.Request) string {
+	if claims := callerClaims(r); claims != nil {
+		return claims.AgentID
+	}
+	return ""
+}
+
+// permitted reports whether the caller has perm. Every caller has every
+// permission when the server has no authentication.
+func (s *Server) permitted(r *http.Request, perm string) bool {
+	if s.auth == nil {
+		return true
+	}
+	claims := callerClaims(r)
+	return claims != nil && claims.HasPermission(perm)
+}
+
+// canActAs reports whether the caller may run as the end user userID.
+func (s *Server) canActAs(r *http.Request, userID string) bool {
+	return userID == "" || userID == callerID(r) || s.permitted(r, PermActAsUser)
+}
+
+// ownsMemories reports whether the caller may see and delete the memories
+// about user, where "" stands for every user or the shared memories.
+func (s *Server) ownsMemories(r *http.Request, user string) bool {
+	return user != "" && user == callerID(r) || s.permitted(r, PermMemoriesAdmin)
+}
+
+// ownsJob reports whether the caller may see and cancel job.
+func (s *Server) ownsJob(r *http.Request, job *jobs.Job) bool {
+	return job.Owner == callerID(r) || s.permitted(r, PermJobsAdmin)
+}
@@ -6,13 +6,19 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/storo/lattice/pkg/agent"
+	"github.com/storo/lattice/pkg/approval"
 	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/jobs"
+	"github.com/storo/lattice/pkg/memory"
 	"github.com/storo/lattice/pkg/mesh"
 	"github.com/storo/lattice/pkg/provider"
 	"github.com/storo/lattice/pkg/security"
+	"github.com/storo/lattice/pkg/storage"
 )
 
 func setupTestMesh() *mesh.Mesh {
@@ -243,3 +249,403 @@ func TestServer_MethodNotAllowed(t *testing.T) {
 		t.Errorf("expected status 405, got %d", w.Code)
 	}
 }
+
+func setupTestJobs(t *testing.T, m *mesh.Mesh) *jobs.Queue {
+	q := jobs.NewQueue(storage.NewMemoryStore(), JobRunner(m), jobs.WithPollInterval(10*time.Millisecond))
+	q.Start(context.Background())
+	t.Cleanup(q.Stop)
+	return q
+}
+
+func TestServer_AsyncRun(t *testing.T) {
+	m := setupTestMesh()
+	server := NewServer(m, WithJobs(setupTestJobs(t, m)))
+
+	agents, _ := m.ListAgents(context.Background())
+	agentID := agents[0].ID()
+
+	jsonBody, _ := json.Marshal(RunRequest{Input: "Test input", Async: true})
+	req := httptest.NewRequest("POST", "/agents/"+agentID+"/run", bytes.NewReader(jsonBody))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", w.Code)
+	}
+
+	var job jobs.Job
+	json.Unmarshal(w.Body.Bytes(), &job)
+	if job.ID == "" || job.AgentID != agentID || w.Header().Get("Location") != "/jobs/"+job.ID {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !job.Status.Finished() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/jobs/"+job.ID, nil))
+		json.Unmarshal(w.Body.Bytes(), &job)
+	}
+
+	if job.Status != jobs.StatusSucceeded || job.Output != "Test response from agent" {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	// A finished job cannot be cancelled
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("DELETE", "/jobs/"+job.ID, nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status 409, got %d", w.Code)
+	}
+}
+
+func TestServer_Jobs(t *testing.T) {
+	m := setupTestMesh()
+	q := jobs.NewQueue(storage.NewMemoryStore(), JobRunner(m))
+	server := NewServer(m, WithJobs(q))
+
+	// The queue is not started, so the job stays queued until cancelled
+	jsonBody, _ := json.Marshal(SubmitJobRequest{Input: "Test input"})
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", "/jobs", bytes.NewReader(jsonBody)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", w.Code)
+	}
+
+	var job jobs.Job
+	json.Unmarshal(w.Body.Bytes(), &job)
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/jobs", nil))
+	var list ListJobsResponse
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Jobs) != 1 || list.Jobs[0].ID != job.ID {
+		t.Errorf("unexpected jobs %+v", list.Jobs)
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("DELETE", "/jobs/"+job.ID, nil))
+	json.Unmarshal(w.Body.Bytes(), &job)
+	if w.Code != http.StatusOK || job.Status != jobs.StatusCancelled {
+		t.Errorf("unexpected cancel response %d %+v", w.Code, job)
+	}
+
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"GET", "/jobs/missing", "", http.StatusNotFound},
+		{"POST", "/jobs", `{"agent_id":"missing","input":"x"}`, http.StatusNotFound},
+		{"POST", "/jobs", `{"input":"x","webhook":"ftp://example.com"}`, http.StatusBadRequest},
+		{"PUT", "/jobs", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, w.Code)
+		}
+	}
+}
+
+// newAuthServer returns a server whose API keys are named after their
+// callers: "<caller>-key".
+func newAuthServer(m *mesh.Mesh, permissions map[string][]string, opts ...ServerOption) *Server {
+	apiKeyAuth := security.NewAPIKeyAuth()
+	for caller, perms := range permissions {
+		apiKeyAuth.RegisterKey(caller+"-key", &security.KeyEntry{AgentID: caller, Permissions: perms})
+	}
+	auth := security.NewAuth(security.WithAPIKeyAuth(apiKeyAuth))
+	return NewServer(m, append([]ServerOption{WithAuth(auth)}, opts...)...)
+}
+
+// call sends an authenticated request as caller.
+func call(server *Server, caller, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-API-Key", caller+"-key")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestServer_JobsPermissions(t *testing.T) {
+	m := setupTestMesh()
+	q := jobs.NewQueue(storage.NewMemoryStore(), JobRunner(m))
+	server := newAuthServer(m, map[string][]string{
+		"alice": nil,
+		"bob":   nil,
+		"ops":   {PermJobsAdmin, PermActAsUser},
+	}, WithJobs(q))
+
+	w := call(server, "alice", "POST", "/jobs", `{"input":"x","user_id":"alice"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", w.Code)
+	}
+	var job jobs.Job
+	json.Unmarshal(w.Body.Bytes(), &job)
+	if job.Owner != "alice" {
+		t.Errorf("expected the job to be owned by its caller, got %q", job.Owner)
+	}
+
+	// Other callers neither see nor cancel it
+	var list ListJobsResponse
+	json.Unmarshal(call(server, "bob", "GET", "/jobs", "").Body.Bytes(), &list)
+	if len(list.Jobs) != 0 {
+		t.Errorf("expected no jobs for another caller, got %+v", list.Jobs)
+	}
+	for _, method := range []string{"GET", "DELETE"} {
+		if w := call(server, "bob", method, "/jobs/"+job.ID, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s by another caller: expected status 404, got %d", method, w.Code)
+		}
+	}
+
+	json.Unmarshal(call(server, "alice", "GET", "/jobs", "").Body.Bytes(), &list)
+	if len(list.Jobs) != 1 {
+		t.Errorf("expected the owner to see the job, got %+v", list.Jobs)
+	}
+	json.Unmarshal(call(server, "ops", "GET", "/jobs", "").Body.Bytes(), &list)
+	if len(list.Jobs) != 1 {
+		t.Errorf("expected an admin to see every job, got %+v", list.Jobs)
+	}
+
+	// Only callers with PermActAsUser run for other users
+	tests := []struct {
+		caller, path, body string
+		status             int
+	}{
+		{"alice", "/jobs", `{"input":"x","user_id":"bob"}`, http.StatusForbidden},
+		{"alice", "/mesh/run", `{"input":"x","user_id":"bob","async":true}`, http.StatusForbidden},
+		{"alice", "/agents/test-agent/run", `{"input":"x","user_id":"bob"}`, http.StatusForbidden},
+		{"ops", "/jobs", `{"input":"x","user_id":"bob"}`, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		if w := call(server, tt.caller, "POST", tt.path, tt.body); w.Code != tt.status {
+			t.Errorf("%s POST %s: expected status %d, got %d", tt.caller, tt.path, tt.status, w.Code)
+		}
+	}
+}
+
+func TestServer_JobsDisabled(t *testing.T) {
+	server := NewServer(setupTestMesh())
+
+	jsonBody, _ := json.Marshal(RunRequest{Input: "Test input", Async: true})
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", "/mesh/run", bytes.NewReader(jsonBody)))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expected status 501, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/jobs", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expected status 501, got %d", w.Code)
+	}
+}
+
+func TestServer_Approvals(t *testing.T) {
+	ctx := context.Background()
+	q := approval.NewQueue(storage.NewMemoryStore())
+	server := NewServer(setupTestMesh(), WithApprovals(q))
+
+	first, _ := q.Request(ctx, &approval.Approval{Tool: "shell", Params: json.RawMessage(`{"command":"rm -rf /tmp/x"}`)})
+	second, _ := q.Request(ctx, &approval.Approval{Tool: "fs"})
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/approvals", nil))
+	var list ListApprovalsResponse
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || len(list.Approvals) != 2 {
+		t.Fatalf("unexpected pending approvals %d %+v", w.Code, list.Approvals)
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", "/approvals/"+first.ID+"/approve", nil))
+	var a approval.Approval
+	json.Unmarshal(w.Body.Bytes(), &a)
+	if w.Code != http.StatusOK || a.Status != approval.StatusApproved {
+		t.Errorf("unexpected approve response %d %+v", w.Code, a)
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", "/approvals/"+second.ID+"/deny", strings.NewReader(`{"comment":"too risky"}`)))
+	json.Unmarshal(w.Body.Bytes(), &a)
+	if w.Code != http.StatusOK || a.Status != approval.StatusDenied || a.Comment != "too risky" {
+		t.Errorf("unexpected deny response %d %+v", w.Code, a)
+	}
+
+	tests := []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/approvals/" + first.ID, http.StatusOK},
+		{"POST", "/approvals/" + first.ID + "/deny", http.StatusConflict},
+		{"POST", "/approvals/missing/approve", http.StatusNotFound},
+		{"GET", "/approvals/" + first.ID + "/approve", http.StatusMethodNotAllowed},
+		{"POST", "/approvals/" + first.ID + "/maybe", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/approvals?status=all", nil))
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Approvals) != 2 {
+		t.Errorf("expected 2 approvals, got %d", len(list.Approvals))
+	}
+}
+
+func TestServer_ApprovalsPermissions(t *testing.T) {
+	ctx := context.Background()
+	q := approval.NewQueue(storage.NewMemoryStore())
+	server := newAuthServer(setupTestMesh(), map[string][]string{
+		"alice":    nil,
+		"reviewer": {PermApprovalsDecide},
+	}, WithApprovals(q))
+
+	a, _ := q.Request(ctx, &approval.Approval{Tool: "shell"})
+
+	for _, action := range []string{"approve", "deny"} {
+		if w := call(server, "alice", "POST", "/approvals/"+a.ID+"/"+action, ""); w.Code != http.StatusForbidden {
+			t.Errorf("%s without the permission: expected status 403, got %d", action, w.Code)
+		}
+	}
+	if got, _ := q.Get(ctx, a.ID); got.Status != approval.StatusPending {
+		t.Fatalf("expected the approval to stay pending, got %s", got.Status)
+	}
+
+	w := call(server, "reviewer", "POST", "/approvals/"+a.ID+"/approve", "")
+	var decided approval.Approval
+	json.Unmarshal(w.Body.Bytes(), &decided)
+	if w.Code != http.StatusOK || decided.DecidedBy != "reviewer" {
+		t.Errorf("unexpected approve response %d %+v", w.Code, decided)
+	}
+}
+
+func TestServer_Memories(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New(storage.NewMemoryStore())
+	server := NewServer(setupTestMesh(), WithMemory(mem))
+
+	first, _ := mem.Remember(ctx, "test-agent", "alice", "Alice likes tea")
+	mem.Remember(ctx, "test-agent", "alice", "Alice lives in Porto")
+	mem.Remember(ctx, "other-agent", "alice", "Alice writes Go")
+	mem.Remember(ctx, "test-agent", "bob", "Bob likes coffee")
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/memories?user=alice&agent=test-agent", nil))
+	var list ListMemoriesResponse
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || len(list.Memories) != 2 {
+		t.Fatalf("unexpected memories %d %+v", w.Code, list.Memories)
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/memories/"+first.ID, nil))
+	var m memory.Memory
+	json.Unmarshal(w.Body.Bytes(), &m)
+	if w.Code != http.StatusOK || m.Content != "Alice likes tea" {
+		t.Errorf("unexpected memory %d %+v", w.Code, m)
+	}
+
+	tests := []struct {
+		method, path string
+		status       int
+	}{
+		{"DELETE", "/memories/" + first.ID, http.StatusNoContent},
+		{"GET", "/memories/" + first.ID, http.StatusNotFound},
+		{"DELETE", "/memories/missing", http.StatusNotFound},
+		{"POST", "/memories", http.StatusMethodNotAllowed},
+		{"DELETE", "/memories", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("DELETE", "/memories?user=alice", nil))
+	var forgot ForgetMemoriesResponse
+	json.Unmarshal(w.Body.Bytes(), &forgot)
+	if w.Code != http.StatusOK || forgot.Deleted != 2 {
+		t.Errorf("unexpected forget response %d %+v", w.Code, forgot)
+	}
+
+	if remaining, _ := mem.List(ctx, "", ""); len(remaining) != 1 || remaining[0].User != "bob" {
+		t.Errorf("expected only bob's memory to remain, got %+v", remaining)
+	}
+}
+
+func TestServer_MemoriesPermissions(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New(storage.NewMemoryStore())
+	server := newAuthServer(setupTestMesh(), map[string][]string{
+		"alice": nil,
+		"dpo":   {PermMemoriesAdmin},
+	}, WithMemory(mem))
+
+	own, _ := mem.Remember(ctx, "test-agent", "alice", "Alice likes tea")
+	bobs, _ := mem.Remember(ctx, "test-agent", "bob", "Bob likes coffee")
+	shared, _ := mem.Remember(ctx, "test-agent", "", "The office closes at 6pm")
+
+	tests := []struct {
+		caller, method, path string
+		status               int
+	}{
+		{"alice", "GET", "/memories", http.StatusForbidden},
+		{"alice", "GET", "/memories?user=bob", http.StatusForbidden},
+		{"alice", "DELETE", "/memories?user=bob", http.StatusForbidden},
+		{"alice", "GET", "/memories/" + bobs.ID, http.StatusNotFound},
+		{"alice", "DELETE", "/memories/" + bobs.ID, http.StatusNotFound},
+		{"alice", "DELETE", "/memories/" + shared.ID, http.StatusNotFound},
+		{"alice", "GET", "/memories?user=alice", http.StatusOK},
+		{"alice", "GET", "/memories/" + own.ID, http.StatusOK},
+		{"dpo", "GET", "/memories", http.StatusOK},
+		{"dpo", "GET", "/memories/" + bobs.ID, http.StatusOK},
+		{"dpo", "DELETE", "/memories?user=bob", http.StatusOK},
+		{"alice", "DELETE", "/memories/" + own.ID, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if w := call(server, tt.caller, tt.method, tt.path, ""); w.Code != tt.status {
+			t.Errorf("%s %s %s: expected status %d, got %d", tt.caller, tt.method, tt.path, tt.status, w.Code)
+		}
+	}
+
+	if list, _ := mem.List(ctx, "", ""); len(list) != 1 || list[0].ID != shared.ID {
+		t.Errorf("expected only the shared memory to remain, got %+v", list)
+	}
+}
+
+func TestServer_RunWithUserID(t *testing.T) {
+	mem := memory.New(storage.NewMemoryStore())
+	mem.Remember(context.Background(), "test-agent", "alice", "Alice prefers metric units")
+
+	var system string
+	a := agent.New("test-agent").
+		Model(&provider.MockProvider{
+			ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+				system = req.System
+				return &provider.ChatResponse{Content: "ok", StopReason: provider.StopReasonEndTurn}, nil
+			},
+		}).
+		Memory(mem).
+		Build()
+	m := mesh.New()
+	m.Register(a)
+	server := NewServer(m)
+
+	req := httptest.NewRequest("POST", "/agents/"+a.ID()+"/run", strings.NewReader(`{"input": "units?", "user_id": "alice"}`))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(system, "metric units") {
+		t.Errorf("expected alice's memories in the system prompt, got %d %q", w.Code, system)
+	}
+}
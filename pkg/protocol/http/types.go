@@ -1,5 +1,11 @@
 package http
 
+import (
+	"github.com/storo/lattice/pkg/approval"
+	"github.com/storo/lattice/pkg/jobs"
+	"github.com/storo/lattice/pkg/memory"
+)
+
 // RunRequest is the request body for running an agent.
 type RunRequest struct {
 	// Input is the task or prompt to send to the agent.
@@ -7,6 +13,37 @@ type RunRequest struct {
 
 	// Context is optional additional context.
 	Context string `json:"context,omitempty"`
+
+	// UserID identifies the end user, for agents that remember facts
+	// per user.
+	UserID string `json:"user_id,omitempty"`
+
+	// Async queues the run as a job and responds at once with the job.
+	Async bool `json:"async,omitempty"`
+
+	// Webhook is called with the finished job of an async run.
+	Webhook string `json:"webhook,omitempty"`
+}
+
+// SubmitJobRequest is the request body for submitting a job.
+type SubmitJobRequest struct {
+	// AgentID is the agent to run. Empty lets the mesh choose.
+	AgentID string `json:"agent_id,omitempty"`
+
+	// Input is the task or prompt to send to the agent.
+	Input string `json:"input"`
+
+	// UserID identifies the end user.
+	UserID string `json:"user_id,omitempty"`
+
+	// Webhook is called with the job when it finishes.
+	Webhook string `json:"webhook,omitempty"`
+}
+
+// ListJobsResponse is the response for listing jobs.
+type ListJobsResponse struct {
+	// Jobs is the list of jobs, oldest first.
+	Jobs []*jobs.Job `json:"jobs"`
 }
 
 // RunResponse is the response from running an agent.
@@ -51,6 +88,31 @@ type ListAgentsResponse struct {
 	Agents []AgentInfo `json:"agents"`
 }
 
+// ListApprovalsResponse is the response for listing approvals.
+type ListApprovalsResponse struct {
+	// Approvals is the list of approvals, oldest first.
+	Approvals []*approval.Approval `json:"approvals"`
+}
+
+// ListMemoriesResponse is the response for listing memories.
+type ListMemoriesResponse struct {
+	// Memories is the list of memories, oldest first.
+	Memories []*memory.Memory `json:"memories"`
+}
+
+// ForgetMemoriesResponse is the response for deleting a user's memories.
+type ForgetMemoriesResponse struct {
+	// Deleted is how many memories were deleted.
+	Deleted int `json:"deleted"`
+}
+
+// DecisionRequest is the optional request body for approving or denying.
+type DecisionRequest struct {
+	// Comment is recorded with the decision. A denial's comment is
+	// returned to the agent as the tool result.
+	Comment string `json:"comment,omitempty"`
+}
+
 // ErrorResponse is an error response.
 type ErrorResponse struct {
 	// Error is the error message.
@@ -0,0 +1,580 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/storo/lattice/pkg/core"
+)
+
+// Client errors
+var (
+	ErrConnectionClosed = errors.New("mcp: connection closed")
+	ErrClientClosed     = errors.New("mcp: client closed")
+
+	errSessionExpired = errors.New("mcp: session expired")
+)
+
+// DefaultRequestTimeout bounds a single request to the server.
+const DefaultRequestTimeout = 60 * time.Second
+
+// Client connects to an external MCP server and exposes its tools as
+// core.Tool values. It reconnects on the next request after the server
+// exits or its session expires.
+type Client struct {
+	dial           func() transport
+	info           Implementation
+	prefix         string
+	timeout        time.Duration
+	onToolsChanged func(tools []core.Tool)
+
+	// Transport settings
+	env        []string
+	stderr     io.Writer
+	headers    map[string]string
+	httpClient *http.Client
+
+	nextID atomic.Int64
+
+	mu          sync.Mutex
+	transport   transport
+	serverInfo  Implementation
+	tools       []core.Tool
+	connections int
+	closed      bool
+
+	pendingMu sync.Mutex
+	pending   map[string]*pendingCall
+}
+
+// pendingCall waits for the response to a request.
+type pendingCall struct {
+	transport transport
+	ch        chan *message
+}
+
+// ClientOption configures the client.
+type ClientOption func(*Client)
+
+// NewStdioClient creates a client that starts the server as a subprocess
+// and talks to it over stdin/stdout.
+func NewStdioClient(command string, args []string, opts ...ClientOption) *Client {
+	c := newClient(opts...)
+	c.dial = func() transport {
+		return &stdioTransport{command: command, args: args, env: c.env, stderr: c.stderr}
+	}
+	return c
+}
+
+// NewHTTPClient creates a client for a server using the streamable HTTP
+// transport at url.
+func NewHTTPClient(url string, opts ...ClientOption) *Client {
+	c := newClient(opts...)
+	c.dial = func() transport {
+		return &httpTransport{url: url, headers: c.headers, client: c.httpClient}
+	}
+	return c
+}
+
+func newClient(opts ...ClientOption) *Client {
+	c := &Client{
+		info:       Implementation{Name: "lattice", Version: "dev"},
+		timeout:    DefaultRequestTimeout,
+		stderr:     os.Stderr,
+		headers:    make(map[string]string),
+		httpClient: &http.Client{},
+		pending:    make(map[string]*pendingCall),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// WithClientInfo sets the name and version reported to the server.
+func WithClientInfo(name, version string) ClientOption {
+	return func(c *Client) {
+		c.info = Implementation{Name: name, Version: version}
+	}
+}
+
+// WithToolPrefix prefixes the names of the server's tools, to avoid
+// collisions between servers.
+func WithToolPrefix(prefix string) ClientOption {
+	return func(c *Client) {
+		c.prefix = prefix
+	}
+}
+
+// WithRequestTimeout sets the timeout for each request.
+// Zero disables the timeout.
+func WithRequestTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithToolsChanged sets a function called with the new tool list when the
+// server reports that its tools changed, or after a reconnect.
+func WithToolsChanged(fn func(tools []core.Tool)) ClientOption {
+	return func(c *Client) {
+		c.onToolsChanged = fn
+	}
+}
+
+// WithEnv adds "KEY=value" environment variables for a stdio server.
+func WithEnv(env ...string) ClientOption {
+	return func(c *Client) {
+		c.env = append(c.env, env...)
+	}
+}
+
+// WithStderr sets where a stdio server's stderr goes (default os.Stderr).
+func WithStderr(w io.Writer) ClientOption {
+	return func(c *Client) {
+		c.stderr = w
+	}
+}
+
+// WithHeader sets an HTTP header sent with every request, such as
+// Authorization.
+func WithHeader(key, value string) ClientOption {
+	return func(c *Client) {
+		c.headers[key] = value
+	}
+}
+
+// WithClientHTTPClient sets the HTTP client used by the HTTP transport.
+func WithClientHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = client
+	}
+}
+
+// Connect starts the server if needed, runs the initialize handshake and
+// loads the tool list.
+func (c *Client) Connect(ctx context.Context) error {
+	_, err := c.conn(ctx)
+	return err
+}
+
+// Tools returns the server's tools as core.Tool values.
+func (c *Client) Tools() []core.Tool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.tools)
+}
+
+// ServerInfo returns the name and version the server reported.
+func (c *Client) ServerInfo() Implementation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.serverInfo
+}
+
+// ListTools fetches the server's tool definitions.
+func (c *Client) ListTools(ctx context.Context) ([]ToolDefinition, error) {
+	t, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.listTools(ctx, t)
+}
+
+// CallTool runs a tool on the server. Tool failures are reported in the
+// result with IsError set; protocol failures are returned as errors.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (*ToolResult, error) {
+	var result callToolResult
+	if err := c.request(ctx, MethodToolsCall, callToolParams{Name: name, Arguments: args}, &result); err != nil {
+		return nil, err
+	}
+
+	parts := make([]string, 0, len(result.Content))
+	for _, content := range result.Content {
+		if content.Type == "text" {
+			parts = append(parts, content.Text)
+		} else {
+			parts = append(parts, fmt.Sprintf("[%s content]", content.Type))
+		}
+	}
+
+	return &ToolResult{
+		Content: strings.Join(parts, "\n"),
+		IsError: result.IsError,
+	}, nil
+}
+
+// Close disconnects from the server, stopping a stdio subprocess.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	t := c.transport
+	c.transport = nil
+	c.mu.Unlock()
+
+	if t != nil {
+		return t.close()
+	}
+	return nil
+}
+
+// request sends a request, reconnecting first if needed. A request whose
+// session expired is retried once on a new session.
+func (c *Client) request(ctx context.Context, method string, params, result any) error {
+	t, err := c.conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = c.roundTrip(ctx, t, method, params, result)
+	if !errors.Is(err, errSessionExpired) {
+		return err
+	}
+
+	c.disconnect(t)
+	if t, err = c.conn(ctx); err != nil {
+		return err
+	}
+	return c.roundTrip(ctx, t, method, params, result)
+}
+
+// conn returns the current transport, connecting if there is none.
+func (c *Client) conn(ctx context.Context) (transport, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+	if c.transport != nil {
+		return c.transport, nil
+	}
+
+	t := c.dial()
+	if err := t.start(c.handleMessage, c.transportClosed); err != nil {
+		return nil, fmt.Errorf("mcp: failed to connect: %w", err)
+	}
+
+	info, err := c.initialize(ctx, t)
+	if err != nil {
+		t.close()
+		return nil, err
+	}
+
+	defs, err := c.listTools(ctx, t)
+	if err != nil {
+		t.close()
+		return nil, err
+	}
+
+	c.transport = t
+	c.serverInfo = info
+	c.tools = c.wrapTools(defs)
+	c.connections++
+
+	// A reconnect may bring a different tool list
+	if c.connections > 1 && c.onToolsChanged != nil {
+		go c.onToolsChanged(slices.Clone(c.tools))
+	}
+
+	return t, nil
+}
+
+// initialize runs the handshake on a new transport.
+func (c *Client) initialize(ctx context.Context, t transport) (Implementation, error) {
+	var result InitializeResult
+	err := c.roundTrip(ctx, t, MethodInitialize, InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    json.RawMessage(`{}`),
+		ClientInfo:      c.info,
+	}, &result)
+	if err != nil {
+		return Implementation{}, fmt.Errorf("mcp: initialize failed: %w", err)
+	}
+
+	if !slices.Contains(supportedVersions, result.ProtocolVersion) {
+		return Implementation{}, fmt.Errorf("mcp: unsupported protocol version %q", result.ProtocolVersion)
+	}
+	t.setProtocolVersion(result.ProtocolVersion)
+
+	if err := c.notify(ctx, t, MethodInitialized, nil); err != nil {
+		return Implementation{}, fmt.Errorf("mcp: initialize failed: %w", err)
+	}
+	t.listen()
+
+	return result.ServerInfo, nil
+}
+
+// listTools fetches every page of the tool list.
+func (c *Client) listTools(ctx context.Context, t transport) ([]ToolDefinition, error) {
+	var defs []ToolDefinition
+	cursor := ""
+
+	for {
+		var result listToolsResult
+		if err := c.roundTrip(ctx, t, MethodToolsList, listToolsParams{Cursor: cursor}, &result); err != nil {
+			return nil, fmt.Errorf("mcp: failed to list tools: %w", err)
+		}
+
+		for _, tool := range result.Tools {
+			defs = append(defs, ToolDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				InputSchema: tool.InputSchema,
+			})
+		}
+
+		if result.NextCursor == "" {
+			return defs, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// refreshTools reloads the tool list after a change notification.
+func (c *Client) refreshTools() {
+	c.mu.Lock()
+	t := c.transport
+	c.mu.Unlock()
+	if t == nil {
+		return
+	}
+
+	ctx, cancel := c.withTimeout(context.Background())
+	defer cancel()
+
+	defs, err := c.listTools(ctx, t)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	if c.transport != t {
+		c.mu.Unlock()
+		return
+	}
+	c.tools = c.wrapTools(defs)
+	tools := slices.Clone(c.tools)
+	handler := c.onToolsChanged
+	c.mu.Unlock()
+
+	if handler != nil {
+		handler(tools)
+	}
+}
+
+// wrapTools wraps tool definitions as core.Tool values.
+func (c *Client) wrapTools(defs []ToolDefinition) []core.Tool {
+	tools := make([]core.Tool, 0, len(defs))
+	for _, def := range defs {
+		tools = append(tools, &remoteTool{client: c, def: def, name: c.prefix + def.Name})
+	}
+	return tools
+}
+
+// roundTrip sends a request on t and waits for its response.
+func (c *Client) roundTrip(ctx context.Context, t transport, method string, params, result any) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	id := json.RawMessage(strconv.FormatInt(c.nextID.Add(1), 10))
+	req := Request{JSONRPC: JSONRPCVersion, ID: id, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = data
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan *message, 1)
+	c.pendingMu.Lock()
+	c.pending[string(id)] = &pendingCall{transport: t, ch: ch}
+	c.pendingMu.Unlock()
+
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, string(id))
+		c.pendingMu.Unlock()
+	}()
+
+	if err := t.send(ctx, data); err != nil {
+		return err
+	}
+
+	select {
+	case msg := <-ch:
+		if msg == nil {
+			return ErrConnectionClosed
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				return fmt.Errorf("mcp: invalid %s result: %w", method, err)
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		// Tell the server to stop working on it
+		notifyCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c.notify(notifyCtx, t, MethodCancelled, cancelledParams{RequestID: id, Reason: ctx.Err().Error()})
+		return ctx.Err()
+	}
+}
+
+// notify sends a notification on t.
+func (c *Client) notify(ctx context.Context, t transport, method string, params any) error {
+	req := Request{JSONRPC: JSONRPCVersion, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = data
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return t.send(ctx, data)
+}
+
+// handleMessage processes a message from the server.
+func (c *Client) handleMessage(t transport, data []byte) {
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+
+	switch {
+	case msg.isResponse():
+		c.pendingMu.Lock()
+		call, ok := c.pending[string(msg.ID)]
+		c.pendingMu.Unlock()
+		if ok {
+			select {
+			case call.ch <- &msg:
+			default:
+			}
+		}
+	case msg.Method == MethodToolsListChanged:
+		go c.refreshTools()
+	case len(msg.ID) > 0:
+		// Requests from the server: only ping is supported
+		resp := newError(msg.ID, CodeMethodNotFound, "method not found: "+msg.Method)
+		if msg.Method == MethodPing {
+			resp = newResult(msg.ID, struct{}{})
+		}
+		if data, err := json.Marshal(resp); err == nil {
+			go t.send(context.Background(), data)
+		}
+	}
+}
+
+// transportClosed fails the requests waiting on t and forgets it, so the
+// next request reconnects.
+func (c *Client) transportClosed(t transport) {
+	c.pendingMu.Lock()
+	for id, call := range c.pending {
+		if call.transport == t {
+			select {
+			case call.ch <- nil:
+			default:
+			}
+			delete(c.pending, id)
+		}
+	}
+	c.pendingMu.Unlock()
+
+	c.mu.Lock()
+	if c.transport == t {
+		c.transport = nil
+	}
+	c.mu.Unlock()
+}
+
+// disconnect closes t if it is still the current transport.
+func (c *Client) disconnect(t transport) {
+	c.mu.Lock()
+	if c.transport == t {
+		c.transport = nil
+	}
+	c.mu.Unlock()
+	t.close()
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(ctx, c.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// remoteTool is a tool on an MCP server, exposed as a core.Tool.
+type remoteTool struct {
+	client *Client
+	def    ToolDefinition
+	name   string
+}
+
+// Name returns the tool name, including the client's prefix.
+func (t *remoteTool) Name() string {
+	return t.name
+}
+
+// Description returns the tool description.
+func (t *remoteTool) Description() string {
+	return t.def.Description
+}
+
+// Schema returns the tool's input schema.
+func (t *remoteTool) Schema() json.RawMessage {
+	if len(t.def.InputSchema) == 0 {
+		return json.RawMessage(`{"type": "object"}`)
+	}
+	return t.def.InputSchema
+}
+
+// Execute calls the tool on the server.
+func (t *remoteTool) Execute(ctx context.Context, params json.RawMessage) (string, error) {
+	args := map[string]any{}
+	if len(params) > 0 && string(params) != "null" {
+		if err := json.Unmarshal(params, &args); err != nil {
+			return "", fmt.Errorf("invalid parameters: %w", err)
+		}
+	}
+
+	result, err := t.client.CallTool(ctx, t.def.Name, args)
+	if err != nil {
+		return "", err
+	}
+	if result.IsError {
+		return "", errors.New(result.Content)
+	}
+	return result.Content, nil
+}
+
+// Verify remoteTool implements core.Tool
+var _ core.Tool = (*remoteTool)(nil)
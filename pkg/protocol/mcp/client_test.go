@@ -0,0 +1,357 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/storo/lattice/pkg/core"
+)
+
+// When MCP_TEST_SERVER is set, the test binary acts as a tiny stdio MCP
+// server for the client tests.
+func TestMain(m *testing.M) {
+	if os.Getenv("MCP_TEST_SERVER") == "1" {
+		runTestStdioServer(os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runTestStdioServer serves echo, add_tool, crash and pid tools.
+func runTestStdioServer(in io.Reader, out io.Writer) {
+	tools := []wireTool{
+		{Name: "echo", Description: "Echo the message", InputSchema: json.RawMessage(`{"type":"object","properties":{"message":{"type":"string"}}}`)},
+		{Name: "add_tool", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		{Name: "crash", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		{Name: "pid", InputSchema: json.RawMessage(`{"type":"object"}`)},
+	}
+
+	enc := json.NewEncoder(out)
+	reply := func(id json.RawMessage, result any) {
+		data, _ := json.Marshal(result)
+		enc.Encode(Response{JSONRPC: JSONRPCVersion, ID: id, Result: data})
+	}
+	text := func(id json.RawMessage, s string, isError bool) {
+		reply(id, callToolResult{Content: []Content{{Type: "text", Text: s}}, IsError: isError})
+	}
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		var req Request
+		if json.Unmarshal(scanner.Bytes(), &req) != nil || req.IsNotification() {
+			continue
+		}
+
+		switch req.Method {
+		case MethodInitialize:
+			reply(req.ID, InitializeResult{
+				ProtocolVersion: ProtocolVersion,
+				Capabilities:    ServerCapabilities{Tools: &ToolsCapability{ListChanged: true}},
+				ServerInfo:      Implementation{Name: "tiny", Version: "0.1"},
+			})
+		case MethodToolsList:
+			reply(req.ID, listToolsResult{Tools: tools})
+		case MethodToolsCall:
+			var p callToolParams
+			json.Unmarshal(req.Params, &p)
+			switch p.Name {
+			case "echo":
+				msg, _ := p.Arguments["message"].(string)
+				if msg == "" {
+					text(req.ID, "message is empty", true)
+				} else {
+					text(req.ID, msg, false)
+				}
+			case "add_tool":
+				tools = append(tools, wireTool{Name: "extra", InputSchema: json.RawMessage(`{"type":"object"}`)})
+				text(req.ID, "added", false)
+				enc.Encode(Request{JSONRPC: JSONRPCVersion, Method: MethodToolsListChanged})
+			case "crash":
+				os.Exit(1)
+			case "pid":
+				text(req.ID, strconv.Itoa(os.Getpid()), false)
+			default:
+				data, _ := json.Marshal(newError(req.ID, CodeInvalidParams, "unknown tool"))
+				out.Write(append(data, '\n'))
+			}
+		default:
+			data, _ := json.Marshal(newError(req.ID, CodeMethodNotFound, "method not found"))
+			out.Write(append(data, '\n'))
+		}
+	}
+}
+
+func newTestStdioClient(opts ...ClientOption) *Client {
+	opts = append([]ClientOption{WithEnv("MCP_TEST_SERVER=1"), WithRequestTimeout(5 * time.Second)}, opts...)
+	return NewStdioClient(os.Args[0], nil, opts...)
+}
+
+func toolNames(tools []core.Tool) []string {
+	names := make([]string, 0, len(tools))
+	for _, t := range tools {
+		names = append(names, t.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestClient_Stdio(t *testing.T) {
+	ctx := context.Background()
+	client := newTestStdioClient(WithToolPrefix("tiny_"))
+	defer client.Close()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+
+	if info := client.ServerInfo(); info.Name != "tiny" {
+		t.Errorf("expected server name 'tiny', got %q", info.Name)
+	}
+
+	tools := client.Tools()
+	if got := strings.Join(toolNames(tools), ","); got != "tiny_add_tool,tiny_crash,tiny_echo,tiny_pid" {
+		t.Fatalf("unexpected tools: %s", got)
+	}
+
+	var echo core.Tool
+	for _, tool := range tools {
+		if tool.Name() == "tiny_echo" {
+			echo = tool
+		}
+	}
+	if echo.Description() != "Echo the message" || !strings.Contains(string(echo.Schema()), "message") {
+		t.Errorf("unexpected echo tool: %s %s", echo.Description(), echo.Schema())
+	}
+
+	out, err := echo.Execute(ctx, json.RawMessage(`{"message": "hello"}`))
+	if err != nil || out != "hello" {
+		t.Errorf("expected 'hello', got %q (%v)", out, err)
+	}
+
+	if _, err := echo.Execute(ctx, json.RawMessage(`{}`)); err == nil || err.Error() != "message is empty" {
+		t.Errorf("expected tool error, got %v", err)
+	}
+
+	if _, err := client.CallTool(ctx, "missing", nil); err == nil {
+		t.Error("expected error for unknown tool")
+	}
+}
+
+func TestClient_ToolsChanged(t *testing.T) {
+	ctx := context.Background()
+	changed := make(chan []core.Tool, 1)
+	client := newTestStdioClient(WithToolsChanged(func(tools []core.Tool) {
+		changed <- tools
+	}))
+	defer client.Close()
+
+	if _, err := client.CallTool(ctx, "add_tool", nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	select {
+	case tools := <-changed:
+		if got := strings.Join(toolNames(tools), ","); !strings.Contains(got, "extra") {
+			t.Errorf("expected extra tool, got %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tools changed handler was not called")
+	}
+
+	if got := toolNames(client.Tools()); len(got) != 5 {
+		t.Errorf("expected 5 tools, got %v", got)
+	}
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	ctx := context.Background()
+	client := newTestStdioClient()
+	defer client.Close()
+
+	first, err := client.CallTool(ctx, "pid", nil)
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	if _, err := client.CallTool(ctx, "crash", nil); err == nil {
+		t.Fatal("expected error when the server exits")
+	}
+
+	second, err := client.CallTool(ctx, "pid", nil)
+	if err != nil {
+		t.Fatalf("call after crash failed: %v", err)
+	}
+	if first.Content == second.Content {
+		t.Errorf("expected a new server process, got pid %s twice", first.Content)
+	}
+
+	client.Close()
+	if _, err := client.CallTool(ctx, "pid", nil); err != ErrClientClosed {
+		t.Errorf("expected ErrClientClosed, got %v", err)
+	}
+}
+
+func TestClient_HTTP(t *testing.T) {
+	ts := httptest.NewServer(newTestServer())
+	defer ts.Close()
+
+	client := NewHTTPClient(ts.URL)
+	defer client.Close()
+
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+
+	if got := strings.Join(toolNames(client.Tools()), ","); got != "echo,fail,wait" {
+		t.Fatalf("unexpected tools: %s", got)
+	}
+
+	result, err := client.CallTool(context.Background(), "echo", map[string]any{"message": "over http"})
+	if err != nil || result.IsError || result.Content != "over http" {
+		t.Errorf("unexpected result: %+v (%v)", result, err)
+	}
+
+	result, err = client.CallTool(context.Background(), "fail", nil)
+	if err != nil || !result.IsError || result.Content != "boom" {
+		t.Errorf("expected error result, got %+v (%v)", result, err)
+	}
+}
+
+// sessionServer wraps a Server with sessions and event-stream replies.
+// The first session expires on its first tool call.
+type sessionServer struct {
+	server *Server
+
+	mu       sync.Mutex
+	sessions int
+	expired  bool
+	headers  []string
+}
+
+func (s *sessionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		http.Error(w, "no event stream", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	var req Request
+	json.Unmarshal(body, &req)
+
+	s.mu.Lock()
+	session := r.Header.Get("Mcp-Session-Id")
+	s.headers = append(s.headers, req.Method+":"+session+":"+r.Header.Get("MCP-Protocol-Version"))
+	if req.Method == MethodInitialize {
+		s.sessions++
+		w.Header().Set("Mcp-Session-Id", fmt.Sprintf("s%d", s.sessions))
+	} else if req.Method == MethodToolsCall && session == "s1" && !s.expired {
+		s.expired = true
+		s.mu.Unlock()
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	s.mu.Unlock()
+
+	rec := httptest.NewRecorder()
+	r.Body = io.NopCloser(strings.NewReader(string(body)))
+	s.server.ServeHTTP(rec, r)
+
+	if rec.Code != http.StatusOK {
+		w.WriteHeader(rec.Code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprintf(w, ": comment\nevent: message\ndata: %s\n\n", strings.TrimSpace(rec.Body.String()))
+}
+
+func TestClient_HTTPSessionExpired(t *testing.T) {
+	handler := &sessionServer{server: newTestServer()}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	client := NewHTTPClient(ts.URL, WithHeader("Authorization", "Bearer token"))
+	defer client.Close()
+
+	result, err := client.CallTool(context.Background(), "echo", map[string]any{"message": "retried"})
+	if err != nil || result.Content != "retried" {
+		t.Fatalf("expected retried call to succeed, got %+v (%v)", result, err)
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	if handler.sessions != 2 {
+		t.Errorf("expected a new session after expiry, got %d sessions", handler.sessions)
+	}
+	last := handler.headers[len(handler.headers)-1]
+	if last != MethodToolsCall+":s2:"+ProtocolVersion {
+		t.Errorf("expected call on session s2 with protocol version, got %s", last)
+	}
+}
+
+func TestClient_HTTPToolsChanged(t *testing.T) {
+	server := newTestServer()
+	notify := make(chan struct{})
+
+	// The server announces tool changes on its GET event stream
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			server.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-notify:
+				fmt.Fprintf(w, "data: {\"jsonrpc\":\"2.0\",\"method\":%q}\n\n", MethodToolsListChanged)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	changed := make(chan []core.Tool, 1)
+	client := NewHTTPClient(ts.URL, WithToolsChanged(func(tools []core.Tool) {
+		changed <- tools
+	}))
+	defer client.Close()
+
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+
+	server.executor.Register(NewFunctionTool("extra", "Added later", nil,
+		func(ctx context.Context, args map[string]any) (string, error) {
+			return "", nil
+		}))
+	select {
+	case notify <- struct{}{}:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not open the event stream")
+	}
+
+	select {
+	case tools := <-changed:
+		if got := strings.Join(toolNames(tools), ","); got != "echo,extra,fail,wait" {
+			t.Errorf("unexpected tools: %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tools changed handler was not called")
+	}
+}
@@ -0,0 +1,379 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxMessageSize bounds the size of a single HTTP request body.
+const maxMessageSize = 10 << 20
+
+// Server exposes the tools of a ToolExecutor to MCP clients over stdio
+// or streamable HTTP.
+type Server struct {
+	executor       *ToolExecutor
+	info           Implementation
+	instructions   string
+	allowedOrigins []string
+	allowedHosts   []string
+}
+
+// ServerOption configures the server.
+type ServerOption func(*Server)
+
+// NewServer creates an MCP server for the executor's tools.
+func NewServer(executor *ToolExecutor, opts ...ServerOption) *Server {
+	s := &Server{
+		executor: executor,
+		info:     Implementation{Name: "lattice", Version: "dev"},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithServerInfo sets the name and version reported to clients.
+func WithServerInfo(name, version string) ServerOption {
+	return func(s *Server) {
+		s.info = Implementation{Name: name, Version: version}
+	}
+}
+
+// WithInstructions sets usage instructions sent to clients on initialize.
+func WithInstructions(instructions string) ServerOption {
+	return func(s *Server) {
+		s.instructions = instructions
+	}
+}
+
+// WithAllowedOrigins allows browser requests from these origins over HTTP.
+// Requests from localhost are always allowed.
+func WithAllowedOrigins(origins ...string) ServerOption {
+	return func(s *Server) {
+		s.allowedOrigins = append(s.allowedOrigins, origins...)
+	}
+}
+
+// WithAllowedHosts accepts HTTP requests addressed to these hosts, such as
+// the server's listen address or public name, besides localhost. A host
+// without a port matches any port.
+func WithAllowedHosts(hosts ...string) ServerOption {
+	return func(s *Server) {
+		s.allowedHosts = append(s.allowedHosts, hosts...)
+	}
+}
+
+// ServeStdio reads newline-delimited JSON-RPC messages from in and writes
+// responses to out until in is closed. Requests are handled concurrently.
+func (s *Server) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		writeMu  sync.Mutex
+		mu       sync.Mutex
+		inflight = make(map[string]context.CancelFunc)
+	)
+
+	write := func(resp *Response) {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		out.Write(append(data, '\n'))
+	}
+
+	reader := bufio.NewReader(in)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			req, errResp := parseRequest(line)
+			switch {
+			case errResp != nil:
+				write(errResp)
+			case req == nil:
+				// Responses are not expected; ignore them
+			case req.Method == MethodCancelled:
+				var p cancelledParams
+				if json.Unmarshal(req.Params, &p) == nil {
+					mu.Lock()
+					if cancelReq, ok := inflight[string(p.RequestID)]; ok {
+						cancelReq()
+					}
+					mu.Unlock()
+				}
+			case req.IsNotification():
+				s.handle(ctx, req)
+			default:
+				reqCtx, cancelReq := context.WithCancel(ctx)
+				id := string(req.ID)
+				mu.Lock()
+				inflight[id] = cancelReq
+				mu.Unlock()
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					resp := s.handle(reqCtx, req)
+					cancelled := reqCtx.Err() != nil
+
+					mu.Lock()
+					delete(inflight, id)
+					mu.Unlock()
+					cancelReq()
+
+					// Cancelled requests get no response
+					if !cancelled {
+						write(resp)
+					}
+				}()
+			}
+		}
+
+		if readErr != nil {
+			wg.Wait()
+			if errors.Is(readErr, io.EOF) {
+				return nil
+			}
+			return readErr
+		}
+	}
+}
+
+// ServeHTTP implements the streamable HTTP transport. Each POST carries one
+// JSON-RPC message; requests are answered with a JSON response body.
+// The server is stateless and does not offer a server-initiated stream.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.hostAllowed(r.Host) {
+		http.Error(w, "host not allowed", http.StatusForbidden)
+		return
+	}
+	if !s.originAllowed(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxMessageSize {
+		http.Error(w, "message too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	req, resp := parseRequest(body)
+	if req != nil {
+		if req.IsNotification() {
+			s.handle(r.Context(), req)
+		} else {
+			resp = s.handle(r.Context(), req)
+		}
+	}
+
+	if resp == nil {
+		// Notifications and responses are acknowledged without a body
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	status := http.StatusOK
+	if resp.Error != nil && resp.Error.Code == CodeParseError {
+		status = http.StatusBadRequest
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// hostAllowed guards against DNS rebinding. A page on a domain that was
+// rebound to this server sends that domain in both Host and Origin, so the
+// request must be addressed to localhost or an allowed host.
+func (s *Server) hostAllowed(host string) bool {
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+	name = strings.Trim(name, "[]")
+	if isLoopback(name) {
+		return true
+	}
+	for _, allowed := range s.allowedHosts {
+		if allowed == host || allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// originAllowed reports whether a browser request comes from localhost or
+// an allowed origin. Requests without an Origin are not from browsers.
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || slices.Contains(s.allowedOrigins, origin) {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return isLoopback(u.Hostname())
+}
+
+// isLoopback reports whether host names this machine's loopback interface.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// parseRequest decodes a JSON-RPC message. It returns nil, nil for
+// responses, and an error response for malformed messages.
+func parseRequest(data []byte) (*Request, *Response) {
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, newError(nil, CodeParseError, "parse error: "+err.Error())
+	}
+
+	if msg.isResponse() {
+		return nil, nil
+	}
+
+	if msg.JSONRPC != JSONRPCVersion || msg.Method == "" {
+		return nil, newError(msg.ID, CodeInvalidRequest, "invalid request")
+	}
+
+	return &Request{JSONRPC: msg.JSONRPC, ID: msg.ID, Method: msg.Method, Params: msg.Params}, nil
+}
+
+// handle dispatches a request. Returns nil for notifications.
+func (s *Server) handle(ctx context.Context, req *Request) (resp *Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = newError(req.ID, CodeInternalError, fmt.Sprintf("internal error: %v", r))
+		}
+		if req.IsNotification() {
+			resp = nil
+		}
+	}()
+
+	switch req.Method {
+	case MethodInitialize:
+		return s.handleInitialize(req)
+	case MethodPing:
+		return newResult(req.ID, struct{}{})
+	case MethodToolsList:
+		return s.handleToolsList(req)
+	case MethodToolsCall:
+		return s.handleToolsCall(ctx, req)
+	case MethodInitialized:
+		return nil
+	default:
+		return newError(req.ID, CodeMethodNotFound, "method not found: "+req.Method)
+	}
+}
+
+// handleInitialize negotiates the protocol version.
+func (s *Server) handleInitialize(req *Request) *Response {
+	var params InitializeParams
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return newError(req.ID, CodeInvalidParams, "invalid params: "+err.Error())
+		}
+	}
+
+	// Answer with the client's version if we support it, else our latest
+	version := ProtocolVersion
+	if slices.Contains(supportedVersions, params.ProtocolVersion) {
+		version = params.ProtocolVersion
+	}
+
+	return newResult(req.ID, InitializeResult{
+		ProtocolVersion: version,
+		Capabilities:    ServerCapabilities{Tools: &ToolsCapability{}},
+		ServerInfo:      s.info,
+		Instructions:    s.instructions,
+	})
+}
+
+// handleToolsList lists the executor's tools sorted by name.
+func (s *Server) handleToolsList(req *Request) *Response {
+	defs := s.executor.List()
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Name < defs[j].Name
+	})
+
+	result := listToolsResult{Tools: make([]wireTool, 0, len(defs))}
+	for _, def := range defs {
+		schema := def.InputSchema
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		result.Tools = append(result.Tools, wireTool{
+			Name:        def.Name,
+			Description: def.Description,
+			InputSchema: schema,
+		})
+	}
+
+	return newResult(req.ID, result)
+}
+
+// handleToolsCall runs a tool. Tool failures are reported in the result
+// with isError set, so the calling model can see them.
+func (s *Server) handleToolsCall(ctx context.Context, req *Request) *Response {
+	var params callToolParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return newError(req.ID, CodeInvalidParams, "invalid params: "+err.Error())
+	}
+
+	result, err := s.executor.Execute(ctx, ToolCall{
+		ID:        string(req.ID),
+		Name:      params.Name,
+		Arguments: params.Arguments,
+	})
+	if errors.Is(err, ErrToolNotFound) {
+		return newError(req.ID, CodeInvalidParams, "unknown tool: "+params.Name)
+	}
+	if err != nil {
+		return newError(req.ID, CodeInternalError, err.Error())
+	}
+
+	return newResult(req.ID, callToolResult{
+		Content: []Content{{Type: "text", Text: result.Content}},
+		IsError: result.IsError,
+	})
+}
+
+// Verify Server implements http.Handler
+var _ http.Handler = (*Server)(nil)
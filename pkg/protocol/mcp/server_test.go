@@ -0,0 +1,240 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer() *Server {
+	executor := NewToolExecutor()
+	executor.Register(NewFunctionTool("echo", "Echo the message",
+		json.RawMessage(`{"type":"object","properties":{"message":{"type":"string"}},"required":["message"]}`),
+		func(ctx context.Context, args map[string]any) (string, error) {
+			return args["message"].(string), nil
+		}))
+	executor.Register(NewFunctionTool("fail", "Always fails", nil,
+		func(ctx context.Context, args map[string]any) (string, error) {
+			return "", errors.New("boom")
+		}))
+	executor.Register(NewFunctionTool("wait", "Waits until cancelled", nil,
+		func(ctx context.Context, args map[string]any) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}))
+	return NewServer(executor, WithServerInfo("test", "1.0"))
+}
+
+// serveLines runs the stdio transport over the given input lines and
+// returns the responses keyed by request ID.
+func serveLines(t *testing.T, s *Server, lines ...string) map[string]Response {
+	t.Helper()
+
+	var out bytes.Buffer
+	in := strings.NewReader(strings.Join(lines, "\n") + "\n")
+	if err := s.ServeStdio(context.Background(), in, &out); err != nil {
+		t.Fatalf("serve failed: %v", err)
+	}
+
+	responses := make(map[string]Response)
+	dec := json.NewDecoder(&out)
+	for {
+		var resp Response
+		if err := dec.Decode(&resp); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		responses[string(resp.ID)] = resp
+	}
+	return responses
+}
+
+func TestServer_Stdio(t *testing.T) {
+	responses := serveLines(t, newTestServer(),
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"c","version":"1"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{"message":"hi"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"fail"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"missing"}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"unknown"}`,
+		`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"echo","arguments":{}}}`,
+		`not json`,
+	)
+
+	if len(responses) != 8 {
+		t.Fatalf("expected 8 responses, got %d: %v", len(responses), responses)
+	}
+
+	var init InitializeResult
+	json.Unmarshal(responses["1"].Result, &init)
+	if init.ProtocolVersion != "2025-03-26" || init.ServerInfo.Name != "test" || init.Capabilities.Tools == nil {
+		t.Errorf("unexpected initialize result: %s", responses["1"].Result)
+	}
+
+	var list listToolsResult
+	json.Unmarshal(responses["2"].Result, &list)
+	if len(list.Tools) != 3 || list.Tools[0].Name != "echo" || list.Tools[1].Name != "fail" {
+		t.Errorf("unexpected tools: %s", responses["2"].Result)
+	}
+	if string(list.Tools[1].InputSchema) != `{"type":"object"}` {
+		t.Errorf("expected default input schema, got %s", list.Tools[1].InputSchema)
+	}
+
+	var call callToolResult
+	json.Unmarshal(responses["3"].Result, &call)
+	if call.IsError || len(call.Content) != 1 || call.Content[0].Text != "hi" {
+		t.Errorf("unexpected call result: %s", responses["3"].Result)
+	}
+
+	json.Unmarshal(responses["4"].Result, &call)
+	if !call.IsError || call.Content[0].Text != "boom" {
+		t.Errorf("expected tool error result, got %s", responses["4"].Result)
+	}
+
+	if e := responses["5"].Error; e == nil || e.Code != CodeInvalidParams {
+		t.Errorf("expected invalid params error, got %+v", responses["5"])
+	}
+	if e := responses["6"].Error; e == nil || e.Code != CodeMethodNotFound {
+		t.Errorf("expected method not found, got %+v", responses["6"])
+	}
+
+	json.Unmarshal(responses["7"].Result, &call)
+	if !call.IsError || !strings.Contains(call.Content[0].Text, `missing required field "message"`) {
+		t.Errorf("expected validation error result, got %s", responses["7"].Result)
+	}
+
+	if e := responses["null"].Error; e == nil || e.Code != CodeParseError {
+		t.Errorf("expected parse error, got %+v", responses["null"])
+	}
+}
+
+func TestServer_StdioCancel(t *testing.T) {
+	in, writer := io.Pipe()
+	var out bytes.Buffer
+
+	done := make(chan error, 1)
+	go func() {
+		done <- newTestServer().ServeStdio(context.Background(), in, &out)
+	}()
+
+	io.WriteString(writer, `{"jsonrpc":"2.0","id":"w","method":"tools/call","params":{"name":"wait"}}`+"\n")
+	time.Sleep(50 * time.Millisecond)
+	io.WriteString(writer, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"w"}}`+"\n")
+	writer.Close()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("serve failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("cancelled request did not finish")
+	}
+
+	if out.Len() != 0 {
+		t.Errorf("expected no response for a cancelled request, got %s", out.String())
+	}
+}
+
+func TestServer_HTTP(t *testing.T) {
+	ts := httptest.NewServer(newTestServer())
+	defer ts.Close()
+
+	post := func(body string, origin string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := post(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{"message":"over http"}}}`, "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	var rpc Response
+	json.NewDecoder(resp.Body).Decode(&rpc)
+	var call callToolResult
+	json.Unmarshal(rpc.Result, &call)
+	if len(call.Content) != 1 || call.Content[0].Text != "over http" {
+		t.Errorf("unexpected result: %s", rpc.Result)
+	}
+
+	notify := post(`{"jsonrpc":"2.0","method":"notifications/initialized"}`, "")
+	notify.Body.Close()
+	if notify.StatusCode != http.StatusAccepted {
+		t.Errorf("expected 202 for notification, got %d", notify.StatusCode)
+	}
+
+	evil := post(`{"jsonrpc":"2.0","id":1,"method":"ping"}`, "https://evil.example.com")
+	evil.Body.Close()
+	if evil.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for foreign origin, got %d", evil.StatusCode)
+	}
+
+	get, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	get.Body.Close()
+	if get.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %d", get.StatusCode)
+	}
+}
+
+func TestServer_HTTP_DNSRebinding(t *testing.T) {
+	server := newTestServer()
+	WithAllowedHosts("lattice.internal")(server)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	post := func(host, origin string) int {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Host = host
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	tests := []struct {
+		host, origin string
+		want         int
+	}{
+		// A rebound domain sends itself in both headers
+		{"evil.example:8081", "http://evil.example:8081", http.StatusForbidden},
+		{"evil.example:8081", "", http.StatusForbidden},
+		{"localhost:8081", "http://localhost:3000", http.StatusOK},
+		{"[::1]:8081", "", http.StatusOK},
+		{"lattice.internal:8081", "", http.StatusOK},
+		{"lattice.internal:8081", "http://lattice.internal:8081", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := post(tt.host, tt.origin); got != tt.want {
+			t.Errorf("host %q, origin %q: expected %d, got %d", tt.host, tt.origin, tt.want, got)
+		}
+	}
+}
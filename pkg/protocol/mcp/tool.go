@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"sync"
+
+	"github.com/storo/lattice/pkg/core"
 )
 
 // MCP errors
@@ -114,6 +116,17 @@ func (e *ToolExecutor) Execute(ctx context.Context, call ToolCall) (*ToolResult,
 		return nil, ErrToolNotFound
 	}
 
+	// Reject invalid arguments before they reach the tool
+	if schema := tool.Definition().InputSchema; len(schema) > 0 {
+		if err := ValidateArguments(schema, call.Arguments); err != nil {
+			return &ToolResult{
+				CallID:  call.ID,
+				Content: err.Error(),
+				IsError: true,
+			}, nil
+		}
+	}
+
 	content, err := tool.Execute(ctx, call.Arguments)
 	result := &ToolResult{
 		CallID:  call.ID,
@@ -129,26 +142,12 @@ func (e *ToolExecutor) Execute(ctx context.Context, call ToolCall) (*ToolResult,
 }
 
 // ValidateArguments validates arguments against a JSON Schema.
-// This is a simplified validation - a full implementation would use a JSON Schema library.
+// Returns a *core.ValidationError describing every mismatch.
 func ValidateArguments(schema json.RawMessage, args map[string]any) error {
-	// Parse schema
-	var schemaObj map[string]any
-	if err := json.Unmarshal(schema, &schemaObj); err != nil {
-		return err
+	if args == nil {
+		args = map[string]any{}
 	}
-
-	// Check required fields
-	if required, ok := schemaObj["required"].([]any); ok {
-		for _, req := range required {
-			if reqStr, ok := req.(string); ok {
-				if _, exists := args[reqStr]; !exists {
-					return errors.New("missing required field: " + reqStr)
-				}
-			}
-		}
-	}
-
-	return nil
+	return core.ValidateValue(schema, args)
 }
 
 // FunctionTool wraps a simple function as a Tool.
@@ -3,6 +3,7 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -149,6 +150,63 @@ func TestValidateArguments(t *testing.T) {
 	}
 }
 
+func TestValidateArguments_Invalid(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"age": {"type": "number", "minimum": 0}
+		},
+		"required": ["name"],
+		"additionalProperties": false
+	}`)
+
+	err := ValidateArguments(schema, map[string]any{"age": -1, "extra": true})
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{`missing required field "name"`, "must be >= 0", `unexpected property "extra"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in error, got: %v", want, err)
+		}
+	}
+}
+
+func TestToolExecutor_InvalidArguments(t *testing.T) {
+	executor := NewToolExecutor()
+
+	executed := false
+	executor.Register(&mockMCPTool{
+		def: ToolDefinition{
+			Name:        "echo",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{"message":{"type":"string"}},"required":["message"]}`),
+		},
+		exec: func(ctx context.Context, args map[string]any) (string, error) {
+			executed = true
+			return "", nil
+		},
+	})
+
+	result, err := executor.Execute(context.Background(), ToolCall{
+		ID:        "call-1",
+		Name:      "echo",
+		Arguments: map[string]any{"message": 42},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if executed {
+		t.Error("tool should not run with invalid arguments")
+	}
+	if !result.IsError {
+		t.Error("expected error result")
+	}
+	if !strings.Contains(result.Content, "$.message: expected string") {
+		t.Errorf("expected schema error in result, got %q", result.Content)
+	}
+}
+
 // mockMCPTool implements Tool for testing
 type mockMCPTool struct {
 	def  ToolDefinition
@@ -0,0 +1,328 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transport carries JSON-RPC messages between a client and a server.
+type transport interface {
+	// start connects. Incoming messages are passed to handle; closed is
+	// called once if the connection is lost.
+	start(handle func(t transport, data []byte), closed func(t transport)) error
+
+	// send delivers one message.
+	send(ctx context.Context, data []byte) error
+
+	// setProtocolVersion records the version agreed on initialize.
+	setProtocolVersion(version string)
+
+	// listen starts receiving the messages the server sends unprompted,
+	// such as tool list changes, once the session is initialized.
+	listen()
+
+	// close disconnects.
+	close() error
+}
+
+// stdioTransport runs the server as a subprocess and exchanges
+// newline-delimited messages over its stdin and stdout.
+type stdioTransport struct {
+	command string
+	args    []string
+	env     []string
+	stderr  io.Writer
+
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+	done    chan struct{}
+}
+
+func (t *stdioTransport) start(handle func(transport, []byte), closed func(transport)) error {
+	cmd := exec.Command(t.command, t.args...)
+	cmd.Env = append(os.Environ(), t.env...)
+	cmd.Stderr = t.stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	t.cmd = cmd
+	t.stdin = stdin
+	t.done = make(chan struct{})
+
+	go func() {
+		reader := bufio.NewReader(stdout)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				handle(t, line)
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		cmd.Wait()
+		close(t.done)
+		closed(t)
+	}()
+
+	return nil
+}
+
+func (t *stdioTransport) send(ctx context.Context, data []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	if _, err := t.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("%w: %v", ErrConnectionClosed, err)
+	}
+	return nil
+}
+
+func (t *stdioTransport) setProtocolVersion(version string) {}
+
+// listen does nothing: the server's messages all arrive on its stdout.
+func (t *stdioTransport) listen() {}
+
+// close closes the server's stdin and kills it if it does not exit.
+func (t *stdioTransport) close() error {
+	t.stdin.Close()
+
+	select {
+	case <-t.done:
+	case <-time.After(2 * time.Second):
+		t.cmd.Process.Kill()
+		<-t.done
+	}
+	return nil
+}
+
+// httpTransport implements the client side of the streamable HTTP
+// transport. Each message is POSTed; responses arrive as JSON or as a
+// server-sent event stream in the reply. Messages the server sends
+// unprompted arrive on a GET event stream, if it offers one.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	handle     func(transport, []byte)
+	stopStream context.CancelFunc
+
+	mu              sync.Mutex
+	sessionID       string
+	protocolVersion string
+}
+
+func (t *httpTransport) start(handle func(transport, []byte), closed func(transport)) error {
+	t.handle = handle
+	return nil
+}
+
+func (t *httpTransport) send(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.setHeaders(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConnectionClosed, err)
+	}
+	defer resp.Body.Close()
+
+	t.mu.Lock()
+	hadSession := t.sessionID != ""
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.sessionID = id
+	}
+	t.mu.Unlock()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && hadSession:
+		return errSessionExpired
+	case resp.StatusCode == http.StatusAccepted:
+		return nil
+	case resp.StatusCode >= 300:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("mcp: server returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return readEvents(resp.Body, func(data []byte) { t.handle(t, data) })
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+	if err != nil {
+		return err
+	}
+	body = bytes.TrimSpace(body)
+
+	// Older servers may answer with a batch
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return err
+		}
+		for _, msg := range batch {
+			t.handle(t, msg)
+		}
+		return nil
+	}
+
+	if len(body) > 0 {
+		t.handle(t, body)
+	}
+	return nil
+}
+
+func (t *httpTransport) setHeaders(req *http.Request) {
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		req.Header.Set("MCP-Protocol-Version", t.protocolVersion)
+	}
+}
+
+func (t *httpTransport) setProtocolVersion(version string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.protocolVersion = version
+}
+
+func (t *httpTransport) listen() {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.mu.Lock()
+	t.stopStream = cancel
+	t.mu.Unlock()
+
+	go t.stream(ctx)
+}
+
+// stream reads the server's GET event stream until ctx is done,
+// reconnecting when it drops. It stops if the server does not offer one.
+func (t *httpTransport) stream(ctx context.Context) {
+	const maxBackoff = 30 * time.Second
+	backoff := time.Second
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+		if err != nil {
+			return
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		t.setHeaders(req)
+
+		resp, err := t.client.Do(req)
+		if err == nil {
+			offered := resp.StatusCode == http.StatusOK &&
+				strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+			if offered {
+				backoff = time.Second
+				readEvents(resp.Body, func(data []byte) { t.handle(t, data) })
+			}
+			resp.Body.Close()
+			if !offered {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// close stops the event stream and ends the session, if the server
+// assigned one.
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	hasSession := t.sessionID != ""
+	if t.stopStream != nil {
+		t.stopStream()
+	}
+	t.mu.Unlock()
+	if !hasSession {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	t.setHeaders(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// readEvents reads a server-sent event stream, passing each event's data
+// to handle.
+func readEvents(r io.Reader, handle func(data []byte)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+
+	var data []string
+	flush := func() {
+		if len(data) > 0 {
+			handle([]byte(strings.Join(data, "\n")))
+			data = data[:0]
+		}
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		// Other fields (event, id, retry) and comments are ignored
+	}
+	flush()
+
+	return scanner.Err()
+}
@@ -19,6 +19,13 @@ const (
 	defaultMaxTokens  = 4096
 	apiVersion        = "2023-06-01"
 	defaultMaxRetries = 3
+
+	// defaultContextWindow is the context window of current Claude models.
+	defaultContextWindow = 200000
+
+	// structuredOutputTool is the tool the model is asked to call when a
+	// request has a ResponseSchema.
+	structuredOutputTool = "structured_output"
 )
 
 // Client is the Anthropic API client.
@@ -29,6 +36,8 @@ type Client struct {
 	maxTokens  int
 	maxRetries int
 	httpClient *http.Client
+
+	contextWindow int
 }
 
 // Option configures the client.
@@ -89,11 +98,31 @@ func WithHTTPClient(client *http.Client) Option {
 	}
 }
 
+// WithContextWindow overrides the context window reported for the model.
+func WithContextWindow(n int) Option {
+	return func(c *Client) {
+		c.contextWindow = n
+	}
+}
+
 // Name returns the provider name.
 func (c *Client) Name() string {
 	return "anthropic"
 }
 
+// ContextWindow returns the model's context window in tokens.
+func (c *Client) ContextWindow() int {
+	if c.contextWindow > 0 {
+		return c.contextWindow
+	}
+	return defaultContextWindow
+}
+
+// CountTokens estimates the input tokens for a request.
+func (c *Client) CountTokens(req *provider.ChatRequest) int {
+	return provider.EstimateRequestTokens(req)
+}
+
 // Chat sends a chat request and returns the response.
 func (c *Client) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
 	// Build request body
@@ -111,6 +140,10 @@ func (c *Client) Chat(ctx context.Context, req *provider.ChatRequest) (*provider
 		body.Tools = convertTools(req.Tools)
 	}
 
+	if len(req.ResponseSchema) > 0 {
+		addStructuredOutput(&body, req.ResponseSchema)
+	}
+
 	if req.MaxTokens > 0 {
 		body.MaxTokens = req.MaxTokens
 	}
@@ -356,6 +389,26 @@ func convertTools(tools []provider.ToolDefinition) []tool {
 	return result
 }
 
+// addStructuredOutput asks the model for JSON matching schema by forcing a
+// call to a tool whose input schema is the requested schema. The model may
+// still call other tools first; the structured_output call ends the turn.
+func addStructuredOutput(body *messagesRequest, schema json.RawMessage) {
+	var s struct {
+		Type string `json:"type"`
+	}
+	// Tool inputs must be objects; other schemas rely on the prompt alone.
+	if json.Unmarshal(schema, &s) != nil || s.Type != "object" {
+		return
+	}
+
+	body.Tools = append(body.Tools, tool{
+		Name:        structuredOutputTool,
+		Description: "Return the final answer. The input must match the required output schema.",
+		InputSchema: schema,
+	})
+	body.ToolChoice = &toolChoice{Type: "any"}
+}
+
 // convertResponse converts API response to provider.ChatResponse.
 func convertResponse(resp *messagesResponse) *provider.ChatResponse {
 	result := &provider.ChatResponse{
@@ -378,12 +431,17 @@ func convertResponse(resp *messagesResponse) *provider.ChatResponse {
 	}
 
 	// Extract content and tool calls
+	var structured json.RawMessage
 	for _, block := range resp.Content {
 		switch block.Type {
 		case "text":
 			result.Content = block.Text
 		case "tool_use":
 			params, _ := json.Marshal(block.Input)
+			if block.Name == structuredOutputTool {
+				structured = params
+				continue
+			}
 			result.ToolCalls = append(result.ToolCalls, core.ToolCall{
 				ID:     block.ID,
 				Name:   block.Name,
@@ -392,6 +450,13 @@ func convertResponse(resp *messagesResponse) *provider.ChatResponse {
 		}
 	}
 
+	// A structured_output call is the final answer
+	if structured != nil {
+		result.Content = string(structured)
+		result.ToolCalls = nil
+		result.StopReason = provider.StopReasonEndTurn
+	}
+
 	return result
 }
 
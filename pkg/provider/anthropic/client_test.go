@@ -134,6 +134,55 @@ func TestClient_ChatWithTools(t *testing.T) {
 	}
 }
 
+func TestClient_ChatWithResponseSchema(t *testing.T) {
+	var got messagesRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+
+		resp := messagesResponse{
+			Content: []contentBlock{
+				{
+					Type:  "tool_use",
+					ID:    "tool_123",
+					Name:  structuredOutputTool,
+					Input: map[string]any{"answer": "4"},
+				},
+			},
+			StopReason: "tool_use",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient("test-key", WithBaseURL(server.URL))
+
+	resp, err := client.Chat(context.Background(), &provider.ChatRequest{
+		Messages:       []core.Message{{Role: core.RoleUser, Content: "What is 2 + 2?"}},
+		ResponseSchema: json.RawMessage(`{"type":"object","properties":{"answer":{"type":"string"}}}`),
+	})
+	if err != nil {
+		t.Fatalf("failed to chat: %v", err)
+	}
+
+	if got.ToolChoice == nil || got.ToolChoice.Type != "any" {
+		t.Errorf("expected tool_choice any, got %+v", got.ToolChoice)
+	}
+	if len(got.Tools) != 1 || got.Tools[0].Name != structuredOutputTool {
+		t.Errorf("expected structured output tool, got %+v", got.Tools)
+	}
+
+	if resp.StopReason != provider.StopReasonEndTurn {
+		t.Errorf("expected end_turn, got %s", resp.StopReason)
+	}
+	if len(resp.ToolCalls) != 0 {
+		t.Errorf("expected no tool calls, got %d", len(resp.ToolCalls))
+	}
+	if resp.Content != `{"answer":"4"}` {
+		t.Errorf("expected structured content, got %s", resp.Content)
+	}
+}
+
 func TestClient_ChatError(t *testing.T) {
 	// Mock server that returns an error
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -178,6 +227,18 @@ func TestClient_WithMaxRetries(t *testing.T) {
 	}
 }
 
+func TestClient_ContextWindow(t *testing.T) {
+	client := NewClient("test-key")
+	if client.ContextWindow() != defaultContextWindow {
+		t.Errorf("expected %d, got %d", defaultContextWindow, client.ContextWindow())
+	}
+
+	client = NewClient("test-key", WithContextWindow(100000))
+	if client.ContextWindow() != 100000 {
+		t.Errorf("expected 100000, got %d", client.ContextWindow())
+	}
+}
+
 func TestConvertMessages(t *testing.T) {
 	messages := []core.Message{
 		{Role: core.RoleUser, Content: "Hello"},
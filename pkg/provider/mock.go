@@ -6,11 +6,20 @@ import (
 
 // MockProvider implements Provider for testing.
 type MockProvider struct {
-	ChatFunc       func(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
-	ChatStreamFunc func(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error)
-	ProviderName   string
+	ChatFunc        func(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
+	ChatStreamFunc  func(ctx context.Context, req *ChatRequest) (<-chan StreamEvent, error)
+	CountTokensFunc func(req *ChatRequest) int
+	ProviderName    string
+
+	// ContextWindowSize is the value reported by ContextWindow.
+	// Zero means DefaultMockContextWindow.
+	ContextWindowSize int
 }
 
+// DefaultMockContextWindow is the context window reported by MockProvider
+// when ContextWindowSize is not set.
+const DefaultMockContextWindow = 200000
+
 // Chat implements Provider.
 func (m *MockProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
 	if m.ChatFunc != nil {
@@ -45,6 +54,22 @@ func (m *MockProvider) Name() string {
 	return "mock"
 }
 
+// ContextWindow implements Provider.
+func (m *MockProvider) ContextWindow() int {
+	if m.ContextWindowSize > 0 {
+		return m.ContextWindowSize
+	}
+	return DefaultMockContextWindow
+}
+
+// CountTokens implements Provider.
+func (m *MockProvider) CountTokens(req *ChatRequest) int {
+	if m.CountTokensFunc != nil {
+		return m.CountTokensFunc(req)
+	}
+	return EstimateRequestTokens(req)
+}
+
 // NewMock creates a new mock provider with default behavior.
 func NewMock() *MockProvider {
 	return &MockProvider{}
@@ -21,6 +21,9 @@ const (
 	defaultBaseURL   = "http://localhost:11434"
 	defaultModel     = "llama3.2"
 	defaultMaxTokens = 4096
+
+	// defaultContextWindow matches Ollama's default num_ctx.
+	defaultContextWindow = 4096
 )
 
 // Client is an Ollama API client implementing provider.Provider.
@@ -29,6 +32,9 @@ type Client struct {
 	model      string
 	maxTokens  int
 	httpClient *http.Client
+
+	// contextWindow is sent as num_ctx when set.
+	contextWindow int
 }
 
 // Option configures the Ollama client.
@@ -81,11 +87,31 @@ func WithHTTPClient(client *http.Client) Option {
 	}
 }
 
+// WithContextWindow sets the context window (num_ctx) used for the model.
+func WithContextWindow(n int) Option {
+	return func(c *Client) {
+		c.contextWindow = n
+	}
+}
+
 // Name returns the provider name.
 func (c *Client) Name() string {
 	return "ollama"
 }
 
+// ContextWindow returns the context window in tokens.
+func (c *Client) ContextWindow() int {
+	if c.contextWindow > 0 {
+		return c.contextWindow
+	}
+	return defaultContextWindow
+}
+
+// CountTokens estimates the input tokens for a request.
+func (c *Client) CountTokens(req *provider.ChatRequest) int {
+	return provider.EstimateRequestTokens(req)
+}
+
 // Chat sends a chat request and returns a response.
 func (c *Client) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
 	ollamaReq := c.buildRequest(req, false)
@@ -229,7 +255,7 @@ func (c *Client) buildRequest(req *provider.ChatRequest, stream bool) *chatReque
 	}
 
 	// Add options
-	if c.maxTokens > 0 || req.Temperature > 0 || len(req.StopSequences) > 0 {
+	if c.maxTokens > 0 || req.Temperature > 0 || len(req.StopSequences) > 0 || c.contextWindow > 0 {
 		ollamaReq.Options = &options{}
 		if c.maxTokens > 0 {
 			ollamaReq.Options.NumPredict = c.maxTokens
@@ -243,6 +269,9 @@ func (c *Client) buildRequest(req *provider.ChatRequest, stream bool) *chatReque
 		if len(req.StopSequences) > 0 {
 			ollamaReq.Options.Stop = req.StopSequences
 		}
+		if c.contextWindow > 0 {
+			ollamaReq.Options.NumCtx = c.contextWindow
+		}
 	}
 
 	// Add tools
@@ -250,6 +279,11 @@ func (c *Client) buildRequest(req *provider.ChatRequest, stream bool) *chatReque
 		ollamaReq.Tools = c.convertTools(req.Tools)
 	}
 
+	// Structured outputs are supported natively via the format field
+	if len(req.ResponseSchema) > 0 {
+		ollamaReq.Format = req.ResponseSchema
+	}
+
 	return ollamaReq
 }
 
@@ -327,3 +327,36 @@ func TestClient_DefaultOptions(t *testing.T) {
 		t.Errorf("expected %d, got %d", defaultMaxTokens, client.maxTokens)
 	}
 }
+
+func TestClient_ContextWindow(t *testing.T) {
+	client := NewClient()
+	if client.ContextWindow() != defaultContextWindow {
+		t.Errorf("expected %d, got %d", defaultContextWindow, client.ContextWindow())
+	}
+	if req := client.buildRequest(&provider.ChatRequest{}, false); req.Options.NumCtx != 0 {
+		t.Errorf("expected num_ctx to be unset by default, got %d", req.Options.NumCtx)
+	}
+
+	client = NewClient(WithContextWindow(32768))
+	if client.ContextWindow() != 32768 {
+		t.Errorf("expected 32768, got %d", client.ContextWindow())
+	}
+	if req := client.buildRequest(&provider.ChatRequest{}, false); req.Options.NumCtx != 32768 {
+		t.Errorf("expected num_ctx 32768, got %d", req.Options.NumCtx)
+	}
+}
+
+func TestClient_ResponseSchema(t *testing.T) {
+	client := NewClient()
+	schema := json.RawMessage(`{"type":"object","properties":{"answer":{"type":"string"}}}`)
+
+	req := client.buildRequest(&provider.ChatRequest{ResponseSchema: schema}, false)
+	if string(req.Format) != string(schema) {
+		t.Errorf("expected format to be the schema, got %s", string(req.Format))
+	}
+
+	req = client.buildRequest(&provider.ChatRequest{}, false)
+	if req.Format != nil {
+		t.Errorf("expected no format, got %s", string(req.Format))
+	}
+}
@@ -9,6 +9,9 @@ type chatRequest struct {
 	Stream   bool      `json:"stream"`
 	Tools    []tool    `json:"tools,omitempty"`
 	Options  *options  `json:"options,omitempty"`
+
+	// Format constrains the output to "json" or a JSON Schema.
+	Format json.RawMessage `json:"format,omitempty"`
 }
 
 // message represents a chat message in Ollama format.
@@ -37,6 +40,7 @@ type options struct {
 	Temperature float64 `json:"temperature,omitempty"`
 	TopP        float64 `json:"top_p,omitempty"`
 	Stop        []string `json:"stop,omitempty"`
+	NumCtx      int      `json:"num_ctx,omitempty"`
 }
 
 // chatResponse is the response from Ollama's chat API (non-streaming).
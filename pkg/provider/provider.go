@@ -17,6 +17,14 @@ type Provider interface {
 
 	// Name returns the provider name.
 	Name() string
+
+	// ContextWindow returns the maximum number of tokens the configured
+	// model accepts in a single request (prompt plus completion).
+	// Returns 0 if the limit is unknown.
+	ContextWindow() int
+
+	// CountTokens estimates the number of input tokens a request will use.
+	CountTokens(req *ChatRequest) int
 }
 
 // ChatRequest represents a request to the LLM.
@@ -42,6 +50,11 @@ type ChatRequest struct {
 	// StopSequences are strings that stop generation.
 	StopSequences []string
 
+	// ResponseSchema, when set, asks the model to reply with JSON matching
+	// this JSON Schema. Providers use native JSON mode or a forced tool
+	// call where supported; the reply is returned in ChatResponse.Content.
+	ResponseSchema json.RawMessage
+
 	// Metadata for the request.
 	Metadata map[string]string
 }
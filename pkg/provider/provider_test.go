@@ -145,3 +145,49 @@ func TestMockProvider_Chat(t *testing.T) {
 		t.Errorf("expected 'test response', got '%s'", resp.Content)
 	}
 }
+
+func TestEstimateTokens(t *testing.T) {
+	if n := EstimateTokens(""); n != 0 {
+		t.Errorf("expected 0 tokens for empty text, got %d", n)
+	}
+	if n := EstimateTokens("abcd"); n != 1 {
+		t.Errorf("expected 1 token, got %d", n)
+	}
+	if n := EstimateTokens("abcde"); n != 2 {
+		t.Errorf("expected 2 tokens, got %d", n)
+	}
+}
+
+func TestEstimateRequestTokens(t *testing.T) {
+	small := &ChatRequest{
+		Messages: []core.Message{{Role: core.RoleUser, Content: "hi"}},
+	}
+	large := &ChatRequest{
+		System: "You are a helpful assistant",
+		Messages: []core.Message{
+			{Role: core.RoleUser, Content: "hi"},
+			{Role: core.RoleAssistant, ToolCalls: []core.ToolCall{{Name: "search", Params: json.RawMessage(`{"query": "test"}`)}}},
+			{Role: core.RoleTool, ToolResult: &core.ToolResult{Content: "a long search result"}},
+		},
+		Tools: []ToolDefinition{{Name: "search", Description: "Search the web", InputSchema: json.RawMessage(`{"type": "object"}`)}},
+	}
+
+	if EstimateRequestTokens(nil) != 0 {
+		t.Error("expected 0 tokens for nil request")
+	}
+	if EstimateRequestTokens(large) <= EstimateRequestTokens(small) {
+		t.Error("expected larger request to use more tokens")
+	}
+}
+
+func TestMockProvider_ContextWindow(t *testing.T) {
+	p := NewMock()
+	if p.ContextWindow() != DefaultMockContextWindow {
+		t.Errorf("expected default context window, got %d", p.ContextWindow())
+	}
+
+	p.ContextWindowSize = 1000
+	if p.ContextWindow() != 1000 {
+		t.Errorf("expected 1000, got %d", p.ContextWindow())
+	}
+}
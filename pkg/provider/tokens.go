@@ -0,0 +1,45 @@
+package provider
+
+// charsPerToken is the average number of characters per token used for
+// estimates. It is deliberately conservative for English text and JSON.
+const charsPerToken = 4
+
+// messageOverhead approximates the tokens spent on role markers and
+// block framing for every message in a conversation.
+const messageOverhead = 4
+
+// EstimateTokens returns a rough token count for a piece of text.
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
+
+// EstimateRequestTokens returns a rough token count for everything a
+// request sends to the model: system prompt, messages, tool calls,
+// tool results and tool definitions.
+func EstimateRequestTokens(req *ChatRequest) int {
+	if req == nil {
+		return 0
+	}
+
+	total := EstimateTokens(req.System)
+
+	for _, m := range req.Messages {
+		total += messageOverhead
+		total += EstimateTokens(m.Content)
+		for _, tc := range m.ToolCalls {
+			total += EstimateTokens(tc.Name) + EstimateTokens(string(tc.Params))
+		}
+		if m.ToolResult != nil {
+			total += EstimateTokens(m.ToolResult.Content)
+		}
+	}
+
+	for _, t := range req.Tools {
+		total += EstimateTokens(t.Name) + EstimateTokens(t.Description) + EstimateTokens(string(t.InputSchema))
+	}
+
+	return total
+}
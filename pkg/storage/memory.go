@@ -3,26 +3,56 @@ package storage
 import (
 	"context"
 	"path"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 )
 
 // MemoryStore is an in-memory implementation of Store.
 type MemoryStore struct {
-	mu   sync.RWMutex
-	data map[string]entry
+	mu      sync.RWMutex
+	data    map[string]entry
+	version int64
+
+	feed          feed
+	seq           int64
+	sweepInterval time.Duration
+	sweeping      bool
+}
+
+// MemoryOption configures the in-memory store.
+type MemoryOption func(*MemoryStore)
+
+// WithSweepInterval sets how often a watched store looks for expired keys,
+// which is how late expire events may be. The default is one second.
+func WithSweepInterval(d time.Duration) MemoryOption {
+	return func(s *MemoryStore) {
+		s.sweepInterval = d
+	}
 }
 
 type entry struct {
 	value     []byte
 	expiresAt time.Time
+	version   int64
+}
+
+// expired reports whether the entry expired by now.
+func (e entry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
 }
 
 // NewMemoryStore creates a new in-memory store.
-func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{
-		data: make(map[string]entry),
+func NewMemoryStore(opts ...MemoryOption) *MemoryStore {
+	s := &MemoryStore{
+		data:          make(map[string]entry),
+		sweepInterval: time.Second,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // Get retrieves a value by key.
@@ -51,21 +81,60 @@ func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, ttl tim
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.put(key, value, ttl)
+	return nil
+}
+
+// put stores a copy of value with a new version and returns the version.
+// The caller must hold the write lock.
+func (s *MemoryStore) put(key string, value []byte, ttl time.Duration) int64 {
 	var expiresAt time.Time
 	if ttl > 0 {
 		expiresAt = time.Now().Add(ttl)
 	}
+	return s.putUntil(key, value, expiresAt)
+}
 
-	// Store a copy to prevent mutation
-	storedValue := make([]byte, len(value))
-	copy(storedValue, value)
-
+// putUntil is put with an absolute expiry.
+func (s *MemoryStore) putUntil(key string, value []byte, expiresAt time.Time) int64 {
+	s.version++
 	s.data[key] = entry{
-		value:     storedValue,
+		value:     cloneBytes(value),
 		expiresAt: expiresAt,
+		version:   s.version,
 	}
+	s.emit(EventSet, key)
+	return s.version
+}
 
-	return nil
+// remove deletes a key. The caller must hold the write lock.
+func (s *MemoryStore) remove(key string) {
+	e, ok := s.data[key]
+	if !ok {
+		return
+	}
+	delete(s.data, key)
+	if e.expired(time.Now()) {
+		s.emit(EventExpire, key)
+	} else {
+		s.emit(EventDelete, key)
+	}
+}
+
+// emit publishes a change to the watchers. The caller must hold the write
+// lock, so that events are published in the order of the changes.
+func (s *MemoryStore) emit(typ EventType, key string) {
+	s.seq++
+	s.feed.publish(Event{Type: typ, Key: key, seq: s.seq})
+}
+
+// live returns the unexpired entry for key. The caller must hold a lock.
+func (s *MemoryStore) live(key string) (entry, bool) {
+	e, ok := s.data[key]
+	if !ok || e.expired(time.Now()) {
+		return entry{}, false
+	}
+	return e, true
 }
 
 // Delete removes a key from the store.
@@ -73,7 +142,7 @@ func (s *MemoryStore) Delete(ctx context.Context, key string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	delete(s.data, key)
+	s.remove(key)
 	return nil
 }
 
@@ -117,6 +186,187 @@ func (s *MemoryStore) Keys(ctx context.Context, pattern string) ([]string, error
 	return result, nil
 }
 
+// Scan returns a page of the keys matching pattern, in key order. The
+// cursor is the last key of the previous page.
+func (s *MemoryStore) Scan(ctx context.Context, pattern, cursor string, limit int) ([]string, string, error) {
+	limit = scanLimit(limit)
+
+	s.mu.RLock()
+	var keys []string
+	now := time.Now()
+	for key, e := range s.data {
+		if (cursor == "" || key > cursor) && !e.expired(now) && matchPattern(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.RUnlock()
+
+	slices.Sort(keys)
+	if len(keys) > limit {
+		return keys[:limit], keys[limit-1], nil
+	}
+	return keys, "", nil
+}
+
+// Count returns how many keys match pattern.
+func (s *MemoryStore) Count(ctx context.Context, pattern string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var n int64
+	now := time.Now()
+	for key, e := range s.data {
+		if !e.expired(now) && matchPattern(pattern, key) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// GetVersion retrieves a value by key with its version.
+func (s *MemoryStore) GetVersion(ctx context.Context, key string) ([]byte, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.live(key)
+	if !ok {
+		return nil, 0, ErrNotFound
+	}
+	return cloneBytes(e.value), e.version, nil
+}
+
+// CompareAndSwap stores a value only if the key's version is still version.
+func (s *MemoryStore) CompareAndSwap(ctx context.Context, key string, value []byte, version int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, _ := s.live(key)
+	if e.version != version {
+		return 0, ErrConflict
+	}
+	return s.put(key, value, ttl), nil
+}
+
+// SetNX stores a value only if the key does not exist.
+func (s *MemoryStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.live(key); ok {
+		return false, nil
+	}
+	s.put(key, value, ttl)
+	return true, nil
+}
+
+// Incr adds delta to the integer at key and returns the result.
+func (s *MemoryStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.live(key)
+	if !ok {
+		s.put(key, strconv.AppendInt(nil, delta, 10), ttl)
+		return delta, nil
+	}
+
+	n, err := parseInt(e.value)
+	if err != nil {
+		return 0, err
+	}
+	n += delta
+	s.putUntil(key, strconv.AppendInt(nil, n, 10), e.expiresAt)
+	return n, nil
+}
+
+// MGet retrieves several keys.
+func (s *MemoryStore) MGet(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string][]byte, len(keys))
+	for _, k := range keys {
+		if e, ok := s.live(k); ok {
+			result[k] = cloneBytes(e.value)
+		}
+	}
+	return result, nil
+}
+
+// MSet stores several values at once.
+func (s *MemoryStore) MSet(ctx context.Context, values map[string][]byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, v := range values {
+		s.put(k, v, ttl)
+	}
+	return nil
+}
+
+// Txn runs fn while holding the store's lock, so it runs exactly once.
+func (s *MemoryStore) Txn(ctx context.Context, keys []string, fn func(tx *Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := make(map[string][]byte, len(keys))
+	for _, k := range keys {
+		if e, ok := s.live(k); ok {
+			values[k] = e.value
+		}
+	}
+
+	tx := newTx(keys, values)
+	if err := fn(tx); err != nil {
+		return err
+	}
+	for k, w := range tx.writes {
+		if w.value == nil {
+			s.remove(k)
+			continue
+		}
+		s.put(k, w.value, w.ttl)
+	}
+	return nil
+}
+
+// Watch streams the changes to keys starting with prefix, in the order they
+// happened, until ctx is done.
+func (s *MemoryStore) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.feed.watch(ctx, prefix, s.seq)
+	if !s.sweeping {
+		s.sweeping = true
+		go s.sweepLoop()
+	}
+	return w.ch, nil
+}
+
+// sweepLoop removes expired keys while the store is watched, so that their
+// expire events are published.
+func (s *MemoryStore) sweepLoop() {
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		if !s.feed.active() {
+			s.sweeping = false
+			s.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		for key, e := range s.data {
+			if e.expired(now) {
+				s.remove(key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
 // Ping checks if the store is available.
 func (s *MemoryStore) Ping(ctx context.Context) error {
 	return nil
@@ -128,6 +378,7 @@ func (s *MemoryStore) Close() error {
 	defer s.mu.Unlock()
 
 	s.data = make(map[string]entry)
+	s.feed.close()
 	return nil
 }
 
@@ -145,3 +396,10 @@ func matchPattern(pattern, key string) bool {
 	}
 	return matched
 }
+
+// Verify MemoryStore implements AtomicStore, ScanStore and WatchStore
+var (
+	_ AtomicStore = (*MemoryStore)(nil)
+	_ ScanStore   = (*MemoryStore)(nil)
+	_ WatchStore  = (*MemoryStore)(nil)
+)
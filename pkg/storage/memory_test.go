@@ -267,3 +267,23 @@ func TestMemoryStore_Keys_QuestionMark(t *testing.T) {
 		t.Errorf("expected 2 keys matching 'key?', got %d (%v)", len(keys), keys)
 	}
 }
+
+func TestMemoryStore_Atomic(t *testing.T) {
+	testAtomicStore(t, func(t *testing.T) AtomicStore {
+		return NewMemoryStore()
+	})
+}
+
+func TestMemoryStore_Scan(t *testing.T) {
+	testScanStore(t, func(t *testing.T) ScanStore {
+		return NewMemoryStore()
+	})
+}
+
+func TestMemoryStore_Watch(t *testing.T) {
+	testWatchStore(t, func(t *testing.T) WatchStore {
+		store := NewMemoryStore(WithSweepInterval(10 * time.Millisecond))
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
@@ -0,0 +1,891 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// PostgresStore is a PostgreSQL implementation of Store, for sharing state
+// between replicas that already have a database. It uses database/sql, so
+// the program must register a Postgres driver, such as
+// github.com/jackc/pgx/v5/stdlib. It needs PostgreSQL 13 or later.
+//
+// Expiry uses the database clock, so replicas need not agree on the time.
+// Writes lock their keys with advisory locks for the rest of their
+// transaction, which makes read-modify-write operations atomic.
+type PostgresStore struct {
+	db              *sql.DB
+	cleanupInterval time.Duration
+	stopCleanup     chan struct{}
+
+	feed            feed
+	pollInterval    time.Duration
+	changeRetention time.Duration
+	changed         chan struct{}
+	watchMu         sync.Mutex
+	logging         bool
+	snapshot        string
+	lastChange      int64
+	polling         bool
+}
+
+// PostgresOption configures the Postgres store.
+type PostgresOption func(*postgresConfig)
+
+type postgresConfig struct {
+	driver          string
+	cleanupInterval time.Duration
+	pollInterval    time.Duration
+	changeRetention time.Duration
+}
+
+// WithPostgresDriver sets the database/sql driver name (default "pgx").
+func WithPostgresDriver(name string) PostgresOption {
+	return func(c *postgresConfig) {
+		c.driver = name
+	}
+}
+
+// WithPostgresCleanupInterval sets how often expired entries are cleaned up.
+func WithPostgresCleanupInterval(d time.Duration) PostgresOption {
+	return func(c *postgresConfig) {
+		c.cleanupInterval = d
+	}
+}
+
+// WithPostgresPollInterval sets how often watchers check the change log
+// for writes from other replicas.
+func WithPostgresPollInterval(d time.Duration) PostgresOption {
+	return func(c *postgresConfig) {
+		c.pollInterval = d
+	}
+}
+
+// WithPostgresChangeRetention sets how long the change log keeps changes.
+func WithPostgresChangeRetention(d time.Duration) PostgresOption {
+	return func(c *postgresConfig) {
+		c.changeRetention = d
+	}
+}
+
+// NewPostgresStore connects to the database at dsn and migrates its schema.
+func NewPostgresStore(dsn string, opts ...PostgresOption) (*PostgresStore, error) {
+	cfg := &postgresConfig{
+		driver:          "pgx",
+		cleanupInterval: 5 * time.Minute,
+		pollInterval:    time.Second,
+		changeRetention: time.Hour,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if !slices.Contains(sql.Drivers(), cfg.driver) {
+		return nil, fmt.Errorf("postgres driver %q is not registered; import one, such as github.com/jackc/pgx/v5/stdlib", cfg.driver)
+	}
+
+	db, err := sql.Open(cfg.driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := migratePostgres(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &PostgresStore{
+		db:              db,
+		cleanupInterval: cfg.cleanupInterval,
+		stopCleanup:     make(chan struct{}),
+		pollInterval:    cfg.pollInterval,
+		changeRetention: cfg.changeRetention,
+		changed:         make(chan struct{}, 1),
+	}
+
+	// Start background cleanup goroutine
+	go s.cleanupLoop()
+
+	return s, nil
+}
+
+// postgresMigrations upgrade the schema, one list of statements per
+// version. kv_schema holds the number of migrations that ran.
+var postgresMigrations = [][]string{
+	// Keys sort by byte, like Go strings, so that prefixes are index ranges
+	// and scan cursors compare the same way everywhere. Versions come from
+	// a sequence, which never reuses a number
+	{
+		`CREATE TABLE kv (
+			key TEXT COLLATE "C" PRIMARY KEY,
+			value BYTEA NOT NULL,
+			version BIGINT NOT NULL,
+			expires_at TIMESTAMPTZ
+		)`,
+		`CREATE INDEX kv_expires_at ON kv (expires_at) WHERE expires_at IS NOT NULL`,
+		`CREATE SEQUENCE kv_version`,
+	},
+
+	// A trigger logs every change, whichever replica makes it, for Watch.
+	// It starts disabled and is enabled by the first Watch, so stores
+	// nobody watches pay nothing for it. Each change records its
+	// transaction, which tells pollers when it committed (see pollChanges).
+	// Deleting an expired row is an expiry
+	{
+		`CREATE TABLE kv_changes (
+			id BIGSERIAL PRIMARY KEY,
+			xid XID8 NOT NULL DEFAULT pg_current_xact_id(),
+			key TEXT NOT NULL,
+			type TEXT NOT NULL,
+			at TIMESTAMPTZ NOT NULL DEFAULT statement_timestamp()
+		)`,
+		`CREATE INDEX kv_changes_xid ON kv_changes (xid)`,
+		`CREATE INDEX kv_changes_at ON kv_changes (at)`,
+		`CREATE FUNCTION kv_changes_log() RETURNS trigger LANGUAGE plpgsql AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				INSERT INTO kv_changes (key, type)
+				VALUES (OLD.key, CASE WHEN OLD.expires_at <= statement_timestamp() THEN 'expire' ELSE 'delete' END);
+			ELSE
+				INSERT INTO kv_changes (key, type) VALUES (NEW.key, 'set');
+			END IF;
+			RETURN NULL;
+		END
+		$$`,
+		`CREATE TRIGGER kv_log AFTER INSERT OR UPDATE OR DELETE ON kv
+			FOR EACH ROW EXECUTE FUNCTION kv_changes_log()`,
+		`ALTER TABLE kv DISABLE TRIGGER kv_log`,
+	},
+}
+
+// postgresMigrationLock is the advisory lock that keeps replicas starting
+// together from migrating at once.
+const postgresMigrationLock = 0x6c617474696365
+
+// postgresLive is the condition for unexpired rows. Statements read the
+// clock, rather than transactions, which may have waited for a lock.
+const postgresLive = "(expires_at IS NULL OR expires_at > statement_timestamp())"
+
+// postgresUpsert writes $1 = $2 with a TTL of $3 ms (none when 0) and
+// returns the new version.
+const postgresUpsert = `INSERT INTO kv (key, value, version, expires_at)
+	VALUES ($1, $2, nextval('kv_version'), CASE WHEN $3::bigint > 0 THEN statement_timestamp() + $3::bigint * interval '1 millisecond' END)
+	ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, version = EXCLUDED.version, expires_at = EXCLUDED.expires_at
+	RETURNING version`
+
+// migratePostgres runs the migrations the database has not seen yet.
+func migratePostgres(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", int64(postgresMigrationLock)); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS kv_schema (version INTEGER NOT NULL)"); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	var version int
+	err = tx.QueryRowContext(ctx, "SELECT version FROM kv_schema").Scan(&version)
+	if err == sql.ErrNoRows {
+		_, err = tx.ExecContext(ctx, "INSERT INTO kv_schema (version) VALUES (0)")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	if version >= len(postgresMigrations) {
+		return nil
+	}
+
+	for i := version; i < len(postgresMigrations); i++ {
+		for _, stmt := range postgresMigrations[i] {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("failed to migrate schema to version %d: %w", i+1, err)
+			}
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE kv_schema SET version = $1", len(postgresMigrations)); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Get retrieves a value by key.
+func (s *PostgresStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.QueryRowContext(ctx,
+		"SELECT value FROM kv WHERE key = $1 AND "+postgresLive, key,
+	).Scan(&value)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key: %w", err)
+	}
+	return value, nil
+}
+
+// Set stores a value with an optional TTL.
+func (s *PostgresStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.inTx(ctx, []string{key}, func(tx *sql.Tx) error {
+		_, err := postgresPut(ctx, tx, key, value, ttl)
+		return err
+	})
+}
+
+// Delete removes a key from the store.
+func (s *PostgresStore) Delete(ctx context.Context, key string) error {
+	return s.inTx(ctx, []string{key}, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM kv WHERE key = $1", key); err != nil {
+			return fmt.Errorf("failed to delete key: %w", err)
+		}
+		return nil
+	})
+}
+
+// Exists checks if a key exists and is not expired.
+func (s *PostgresStore) Exists(ctx context.Context, key string) bool {
+	var exists bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM kv WHERE key = $1 AND "+postgresLive+")", key,
+	).Scan(&exists)
+	return err == nil && exists
+}
+
+// Keys returns all keys matching a pattern.
+func (s *PostgresStore) Keys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	_, _, err := s.eachKey(ctx, pattern, "", 0, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys, err
+}
+
+// Scan returns a page of the keys matching pattern, in key order. The
+// cursor is the last key of the previous page.
+func (s *PostgresStore) Scan(ctx context.Context, pattern, cursor string, limit int) ([]string, string, error) {
+	limit = scanLimit(limit)
+
+	var keys []string
+	for {
+		last, read, err := s.eachKey(ctx, pattern, cursor, limit, func(key string) bool {
+			keys = append(keys, key)
+			return len(keys) < limit
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		if len(keys) == limit {
+			return keys, keys[limit-1], nil
+		}
+		if read < limit {
+			return keys, "", nil
+		}
+		cursor = last
+	}
+}
+
+// Count returns how many keys match pattern.
+func (s *PostgresStore) Count(ctx context.Context, pattern string) (int64, error) {
+	// A literal prefix followed by * is counted in SQL
+	if prefix := literalPrefix(pattern); prefix+"*" == pattern {
+		where, args := postgresKeyFilter(pattern, "")
+		args = append(args, len(prefix)+1)
+		var n int64
+		err := s.db.QueryRowContext(ctx,
+			fmt.Sprintf("SELECT COUNT(*) FROM kv WHERE %s AND strpos(substr(key, $%d), '/') = 0", where, len(args)),
+			args...,
+		).Scan(&n)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count keys: %w", err)
+		}
+		return n, nil
+	}
+
+	var n int64
+	_, _, err := s.eachKey(ctx, pattern, "", 0, func(string) bool {
+		n++
+		return true
+	})
+	return n, err
+}
+
+// eachKey calls fn with the live keys matching pattern after cursor, in
+// key order, until it returns false. When limit is positive, at most limit
+// rows are read. Returns the last key read and how many rows were.
+func (s *PostgresStore) eachKey(ctx context.Context, pattern, cursor string, limit int, fn func(key string) bool) (string, int, error) {
+	where, args := postgresKeyFilter(pattern, cursor)
+	query := "SELECT key FROM kv WHERE " + where + " ORDER BY key"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to query keys: %w", err)
+	}
+	defer rows.Close()
+
+	var last string
+	var read int
+	for rows.Next() {
+		if err := rows.Scan(&last); err != nil {
+			return "", 0, fmt.Errorf("failed to scan key: %w", err)
+		}
+		read++
+
+		if matchPattern(pattern, last) && !fn(last) {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", 0, fmt.Errorf("rows error: %w", err)
+	}
+	return last, read, nil
+}
+
+// postgresKeyFilter returns a WHERE clause for the live keys after cursor
+// that may match pattern. The pattern's literal prefix becomes a range on
+// the primary key; the pattern itself is matched in Go.
+func postgresKeyFilter(pattern, cursor string) (string, []any) {
+	where := []string{postgresLive}
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if cursor != "" {
+		add("key > $%d", cursor)
+	}
+
+	if !validPattern(pattern) {
+		add("key = $%d", pattern)
+		return strings.Join(where, " AND "), args
+	}
+
+	if prefix := literalPrefix(pattern); prefix != "" {
+		add("key >= $%d", prefix)
+
+		// Text must be valid UTF-8, so some prefixes have no upper bound
+		if end, ok := prefixEnd(prefix); ok && utf8.ValidString(end) {
+			add("key < $%d", end)
+		}
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// GetVersion retrieves a value by key with its version.
+func (s *PostgresStore) GetVersion(ctx context.Context, key string) ([]byte, int64, error) {
+	var value []byte
+	var version int64
+	err := s.db.QueryRowContext(ctx,
+		"SELECT value, version FROM kv WHERE key = $1 AND "+postgresLive, key,
+	).Scan(&value, &version)
+
+	if err == sql.ErrNoRows {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get key: %w", err)
+	}
+	return value, version, nil
+}
+
+// CompareAndSwap stores a value only if the key's version is still version.
+func (s *PostgresStore) CompareAndSwap(ctx context.Context, key string, value []byte, version int64, ttl time.Duration) (int64, error) {
+	var newVersion int64
+	err := s.inTx(ctx, []string{key}, func(tx *sql.Tx) error {
+		_, current, err := postgresLiveKey(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if current != version {
+			return ErrConflict
+		}
+		newVersion, err = postgresPut(ctx, tx, key, value, ttl)
+		return err
+	})
+	return newVersion, err
+}
+
+// SetNX stores a value only if the key does not exist.
+func (s *PostgresStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	set := false
+	err := s.inTx(ctx, []string{key}, func(tx *sql.Tx) error {
+		_, current, err := postgresLiveKey(ctx, tx, key)
+		if err != nil || current != 0 {
+			return err
+		}
+		set = true
+		_, err = postgresPut(ctx, tx, key, value, ttl)
+		return err
+	})
+	return set, err
+}
+
+// Incr adds delta to the integer at key and returns the result.
+func (s *PostgresStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	var n int64
+	err := s.inTx(ctx, []string{key}, func(tx *sql.Tx) error {
+		value, current, err := postgresLiveKey(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			n = delta
+			_, err = postgresPut(ctx, tx, key, strconv.AppendInt(nil, n, 10), ttl)
+			return err
+		}
+
+		if n, err = parseInt(value); err != nil {
+			return err
+		}
+		n += delta
+
+		// An existing key keeps its expiry
+		_, err = tx.ExecContext(ctx,
+			"UPDATE kv SET value = $2, version = nextval('kv_version') WHERE key = $1",
+			key, strconv.AppendInt(nil, n, 10),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to set key: %w", err)
+		}
+		return nil
+	})
+	return n, err
+}
+
+// MGet retrieves several keys.
+func (s *PostgresStore) MGet(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(keys))
+
+	// Stay well below the limit on query parameters
+	for batch := range slices.Chunk(keys, 500) {
+		args := make([]any, len(batch))
+		params := make([]string, len(batch))
+		for i, k := range batch {
+			args[i] = k
+			params[i] = "$" + strconv.Itoa(i+1)
+		}
+
+		rows, err := s.db.QueryContext(ctx,
+			"SELECT key, value FROM kv WHERE "+postgresLive+" AND key IN ("+strings.Join(params, ", ")+")",
+			args...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get keys: %w", err)
+		}
+		for rows.Next() {
+			var key string
+			var value []byte
+			if err := rows.Scan(&key, &value); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan key: %w", err)
+			}
+			result[key] = value
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("rows error: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// MSet stores several values in one transaction.
+func (s *PostgresStore) MSet(ctx context.Context, values map[string][]byte, ttl time.Duration) error {
+	keys := slices.Collect(maps.Keys(values))
+	return s.inTx(ctx, keys, func(tx *sql.Tx) error {
+		for _, k := range keys {
+			if _, err := postgresPut(ctx, tx, k, values[k], ttl); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Txn runs fn in a transaction that holds the keys' locks, so it runs
+// exactly once. Keys fn writes without having been started with are
+// locked when it returns.
+func (s *PostgresStore) Txn(ctx context.Context, keys []string, fn func(tx *Tx) error) error {
+	return s.inTx(ctx, keys, func(sqlTx *sql.Tx) error {
+		values := make(map[string][]byte, len(keys))
+		for _, k := range keys {
+			value, version, err := postgresLiveKey(ctx, sqlTx, k)
+			if err != nil {
+				return err
+			}
+			if version != 0 {
+				values[k] = value
+			}
+		}
+
+		tx := newTx(keys, values)
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		var extra []string
+		for k := range tx.writes {
+			if !tx.keys[k] {
+				extra = append(extra, k)
+			}
+		}
+		if err := postgresLock(ctx, sqlTx, extra); err != nil {
+			return err
+		}
+
+		for k, w := range tx.writes {
+			if w.value == nil {
+				if _, err := sqlTx.ExecContext(ctx, "DELETE FROM kv WHERE key = $1", k); err != nil {
+					return fmt.Errorf("failed to delete key: %w", err)
+				}
+				continue
+			}
+			if _, err := postgresPut(ctx, sqlTx, k, w.value, w.ttl); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// inTx runs fn in a transaction that holds the locks of keys, committing
+// when it returns nil.
+func (s *PostgresStore) inTx(ctx context.Context, keys []string, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := postgresLock(ctx, tx, keys); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.notify()
+	return nil
+}
+
+// postgresLock takes the advisory locks of keys until the transaction
+// ends. Locks are taken in a fixed order, so transactions do not deadlock.
+func postgresLock(ctx context.Context, tx *sql.Tx, keys []string) error {
+	locks := make([]int64, len(keys))
+	for i, k := range keys {
+		h := fnv.New64a()
+		h.Write([]byte(k))
+		locks[i] = int64(h.Sum64())
+	}
+	slices.Sort(locks)
+
+	for _, l := range slices.Compact(locks) {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", l); err != nil {
+			return fmt.Errorf("failed to lock key: %w", err)
+		}
+	}
+	return nil
+}
+
+// postgresLiveKey reads a key in a transaction. The version is 0 when the
+// key does not exist or expired.
+func postgresLiveKey(ctx context.Context, tx *sql.Tx, key string) ([]byte, int64, error) {
+	var value []byte
+	var version int64
+	err := tx.QueryRowContext(ctx,
+		"SELECT value, version FROM kv WHERE key = $1 AND "+postgresLive, key,
+	).Scan(&value, &version)
+
+	if err == sql.ErrNoRows {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get key: %w", err)
+	}
+	return value, version, nil
+}
+
+// postgresPut writes a key in a transaction and returns its new version.
+func postgresPut(ctx context.Context, tx *sql.Tx, key string, value []byte, ttl time.Duration) (int64, error) {
+	if value == nil {
+		value = []byte{}
+	}
+
+	var ms int64
+	if ttl > 0 {
+		ms = max(ttl.Milliseconds(), 1)
+	}
+
+	var version int64
+	if err := tx.QueryRowContext(ctx, postgresUpsert, key, value, ms).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to set key: %w", err)
+	}
+	return version, nil
+}
+
+// Watch streams the changes to keys starting with prefix until ctx is
+// done. Changes to a key come in the order they were committed. Changes
+// made through this store are seen at once, and those of other replicas
+// within the poll interval. Expire events come when the cleanup loop or a
+// delete removes the key.
+//
+// The first Watch on a database turns on its change log, which needs the
+// store's role to own the kv table.
+func (s *PostgresStore) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	if err := s.enableChangeLog(ctx); err != nil {
+		return nil, fmt.Errorf("failed to watch keys: %w", err)
+	}
+
+	// Catch up, so the watcher only gets what commits from now on
+	var err error
+	if s.feed.active() {
+		err = s.pollChanges(ctx)
+	} else {
+		err = s.db.QueryRowContext(ctx, "SELECT pg_current_snapshot()::text").Scan(&s.snapshot)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch keys: %w", err)
+	}
+
+	w := s.feed.watch(ctx, prefix, s.lastChange)
+	if !s.polling {
+		s.polling = true
+		go s.pollLoop()
+	}
+	return w.ch, nil
+}
+
+// enableChangeLog turns on the change log trigger. Altering the table
+// waits for the writes in progress, which were not logged, to commit, so
+// a watcher reads them with the rest of the current state.
+func (s *PostgresStore) enableChangeLog(ctx context.Context) error {
+	if s.logging {
+		return nil
+	}
+
+	var enabled bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT tgenabled <> 'D' FROM pg_trigger WHERE tgrelid = 'kv'::regclass AND tgname = 'kv_log'",
+	).Scan(&enabled)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		if _, err := s.db.ExecContext(ctx, "ALTER TABLE kv ENABLE TRIGGER kv_log"); err != nil {
+			return err
+		}
+	}
+	s.logging = true
+	return nil
+}
+
+// notify wakes the change log poller after a write.
+func (s *PostgresStore) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// pollLoop publishes the change log to the watchers.
+func (s *PostgresStore) pollLoop() {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.changed:
+		case <-s.stopCleanup:
+			return
+		}
+		s.poll()
+	}
+}
+
+// poll publishes the changes committed since the last poll.
+func (s *PostgresStore) poll() {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	if !s.feed.active() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_ = s.pollChanges(ctx)
+}
+
+// pollChanges publishes the changes committed since the last snapshot was
+// taken, and takes a new one. Transactions get their IDs before they
+// commit, so IDs alone cannot tell which changes are new: a change is new
+// if its transaction had not committed in the last snapshot. Writers of a
+// key hold its lock, so its changes come in commit order.
+func (s *PostgresStore) pollChanges(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var snapshot string
+	if err := tx.QueryRowContext(ctx, "SELECT pg_current_snapshot()::text").Scan(&snapshot); err != nil {
+		return err
+	}
+	rows, err := tx.QueryContext(ctx,
+		`SELECT key, type FROM kv_changes
+		WHERE xid >= pg_snapshot_xmin($1::text::pg_snapshot) AND NOT pg_visible_in_snapshot(xid, $1::text::pg_snapshot)
+		ORDER BY xid, id`,
+		s.snapshot,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.Key, &e.Type); err != nil {
+			return err
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range events {
+		s.lastChange++
+		events[i].seq = s.lastChange
+	}
+	s.feed.publish(events...)
+	s.snapshot = snapshot
+	return nil
+}
+
+// Ping checks if the store is available.
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the store and stops the cleanup goroutine.
+func (s *PostgresStore) Close() error {
+	close(s.stopCleanup)
+	s.feed.close()
+	return s.db.Close()
+}
+
+// cleanupLoop periodically removes expired entries.
+func (s *PostgresStore) cleanupLoop() {
+	ticker := time.NewTicker(s.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.cleanup()
+		case <-s.stopCleanup:
+			return
+		}
+	}
+}
+
+// cleanup removes expired entries from the database. Keys are locked as
+// writes lock them, so the change log orders an expiry with the writes to
+// its key.
+func (s *PostgresStore) cleanup() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	const batch = 500
+	for {
+		keys, err := s.expiredKeys(ctx, batch)
+		if err != nil || len(keys) == 0 {
+			break
+		}
+
+		args := make([]any, len(keys))
+		params := make([]string, len(keys))
+		for i, k := range keys {
+			args[i] = k
+			params[i] = "$" + strconv.Itoa(i+1)
+		}
+		err = s.inTx(ctx, keys, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx,
+				"DELETE FROM kv WHERE expires_at <= statement_timestamp() AND key IN ("+strings.Join(params, ", ")+")",
+				args...,
+			)
+			return err
+		})
+		if err != nil || len(keys) < batch {
+			break
+		}
+	}
+
+	_, _ = s.db.ExecContext(ctx,
+		"DELETE FROM kv_changes WHERE at < statement_timestamp() - $1::bigint * interval '1 millisecond'",
+		s.changeRetention.Milliseconds(),
+	)
+	s.notify()
+}
+
+// expiredKeys returns up to limit expired keys.
+func (s *PostgresStore) expiredKeys(ctx context.Context, limit int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT key FROM kv WHERE expires_at <= statement_timestamp() LIMIT $1", limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Compile-time check that PostgresStore implements AtomicStore, ScanStore
+// and WatchStore.
+var (
+	_ AtomicStore = (*PostgresStore)(nil)
+	_ ScanStore   = (*PostgresStore)(nil)
+	_ WatchStore  = (*PostgresStore)(nil)
+)
@@ -0,0 +1,208 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// newTestPostgresStore connects to the database at POSTGRES_DSN and empties
+// it.
+func newTestPostgresStore(t *testing.T, opts ...PostgresOption) *PostgresStore {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_DSN is not set")
+	}
+
+	store, err := NewPostgresStore(dsn, append([]PostgresOption{WithPostgresCleanupInterval(time.Hour)}, opts...)...)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	if _, err := store.db.Exec("TRUNCATE kv"); err != nil {
+		t.Fatalf("failed to empty store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestPostgresStore_SetGet(t *testing.T) {
+	store := newTestPostgresStore(t)
+	ctx := context.Background()
+
+	if err := store.Set(ctx, "key1", []byte("value1"), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	value, err := store.Get(ctx, "key1")
+	if err != nil || string(value) != "value1" {
+		t.Errorf("expected value1, got %q (%v)", value, err)
+	}
+	if !store.Exists(ctx, "key1") {
+		t.Error("expected key1 to exist")
+	}
+
+	store.Delete(ctx, "key1")
+	if _, err := store.Get(ctx, "key1"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPostgresStore_TTL(t *testing.T) {
+	store := newTestPostgresStore(t, WithPostgresCleanupInterval(10*time.Millisecond))
+	ctx := context.Background()
+
+	store.Set(ctx, "temp", []byte("x"), 50*time.Millisecond)
+	if !store.Exists(ctx, "temp") {
+		t.Fatal("expected temp to exist")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if store.Exists(ctx, "temp") {
+		t.Error("expected temp to expire")
+	}
+
+	// The cleanup loop removes the row
+	var n int
+	store.db.QueryRow("SELECT COUNT(*) FROM kv WHERE key = 'temp'").Scan(&n)
+	if n != 0 {
+		t.Error("expected the expired row to be cleaned up")
+	}
+}
+
+func TestPostgresStore_Migrate(t *testing.T) {
+	store := newTestPostgresStore(t)
+
+	// Migrating again does nothing
+	if err := migratePostgres(context.Background(), store.db); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var version int
+	if err := store.db.QueryRow("SELECT version FROM kv_schema").Scan(&version); err != nil || version != len(postgresMigrations) {
+		t.Errorf("expected version %d, got %d (%v)", len(postgresMigrations), version, err)
+	}
+}
+
+func TestPostgresStore_Atomic(t *testing.T) {
+	testAtomicStore(t, func(t *testing.T) AtomicStore {
+		return newTestPostgresStore(t)
+	})
+}
+
+func TestPostgresStore_Scan(t *testing.T) {
+	testScanStore(t, func(t *testing.T) ScanStore {
+		return newTestPostgresStore(t)
+	})
+}
+
+func TestPostgresStore_Watch(t *testing.T) {
+	testWatchStore(t, func(t *testing.T) WatchStore {
+		return newTestPostgresStore(t, WithPostgresCleanupInterval(10*time.Millisecond))
+	})
+}
+
+func TestPostgresStore_Watch_OtherReplica(t *testing.T) {
+	writer := newTestPostgresStore(t)
+	watcher := newTestPostgresStore(t, WithPostgresPollInterval(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := watcher.Watch(ctx, "job:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writer.Set(ctx, "job:1", []byte("queued"), 0)
+	writer.MSet(ctx, map[string][]byte{"job:2": []byte("queued")}, 0)
+	writer.Delete(ctx, "job:1")
+
+	want := []Event{
+		{Type: EventSet, Key: "job:1"},
+		{Type: EventSet, Key: "job:2"},
+		{Type: EventDelete, Key: "job:1"},
+	}
+	for i, w := range want {
+		if got := nextEvent(t, events); got != w {
+			t.Fatalf("event %d: expected %+v, got %+v", i, w, got)
+		}
+	}
+}
+
+func TestPostgresStore_Watch_EnablesChangeLog(t *testing.T) {
+	store := newTestPostgresStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Start as a database nobody watched
+	if _, err := store.db.Exec("ALTER TABLE kv DISABLE TRIGGER kv_log"); err != nil {
+		t.Fatalf("failed to disable the change log: %v", err)
+	}
+	store.db.Exec("TRUNCATE kv_changes")
+
+	changes := func() int {
+		var n int
+		if err := store.db.QueryRow("SELECT COUNT(*) FROM kv_changes").Scan(&n); err != nil {
+			t.Fatalf("failed to count changes: %v", err)
+		}
+		return n
+	}
+
+	store.Set(ctx, "job:1", []byte("queued"), 0)
+	if n := changes(); n != 0 {
+		t.Errorf("expected no changes logged before Watch, got %d", n)
+	}
+
+	events, err := store.Watch(ctx, "job:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store.Set(ctx, "job:2", []byte("queued"), 0)
+	if got := nextEvent(t, events); got != (Event{Type: EventSet, Key: "job:2"}) {
+		t.Errorf("unexpected event %+v", got)
+	}
+	if n := changes(); n != 1 {
+		t.Errorf("expected 1 change logged after Watch, got %d", n)
+	}
+}
+
+func TestPostgresStore_Watch_ConcurrentWriters(t *testing.T) {
+	writers := []*PostgresStore{newTestPostgresStore(t), newTestPostgresStore(t)}
+	watcher := newTestPostgresStore(t, WithPostgresPollInterval(5*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := watcher.Watch(ctx, "job:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Writes from several replicas commit in any order; none may be missed
+	const perWriter = 100
+	var wg sync.WaitGroup
+	for i, w := range writers {
+		for g := range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := range perWriter {
+					w.Set(ctx, fmt.Sprintf("job:%d-%d-%d", i, g, n), []byte("queued"), 0)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for len(seen) < 2*len(writers)*perWriter {
+		e := nextEvent(t, events)
+		if seen[e.Key] {
+			t.Fatalf("duplicate event %+v", e)
+		}
+		seen[e.Key] = true
+	}
+}
@@ -2,15 +2,129 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// redisVersionKey names the counter that versions come from. A key's
+// version is kept next to it, under redisVersionKey + ":" + key, and
+// expires with it. Keys starting with redisVersionKey are reserved.
+const redisVersionKey = "__version"
+
+// redisLib is shared by the scripts. Their KEYS start with the version
+// counter, followed by each key and its version key.
+const redisLib = `
+local function bump(key, vkey)
+	local v = redis.call('INCR', KEYS[1])
+	local pttl = redis.call('PTTL', key)
+	if pttl > 0 then
+		redis.call('SET', vkey, v, 'PX', pttl)
+	else
+		redis.call('SET', vkey, v)
+	end
+	return v
+end
+
+local function version(key, vkey)
+	if redis.call('EXISTS', key) == 0 then
+		return 0
+	end
+	local v = redis.call('GET', vkey)
+	if not v then
+		return bump(key, vkey)
+	end
+	return tonumber(v)
+end
+
+local function put(key, vkey, value, ttl)
+	if tonumber(ttl) > 0 then
+		redis.call('SET', key, value, 'PX', ttl)
+	else
+		redis.call('SET', key, value)
+	end
+	return bump(key, vkey)
+end
+`
+
+var (
+	// redisSet stores ARGV[1] with TTL ARGV[2] ms.
+	redisSet = redis.NewScript(redisLib + `
+return put(KEYS[2], KEYS[3], ARGV[1], ARGV[2])`)
+
+	// redisSnapshot returns the value (or nil) and version of every key.
+	redisSnapshot = redis.NewScript(redisLib + `
+local result = {}
+for i = 2, #KEYS, 2 do
+	result[#result + 1] = redis.call('GET', KEYS[i])
+	result[#result + 1] = version(KEYS[i], KEYS[i + 1])
+end
+return result`)
+
+	// redisCAS stores ARGV[1] with TTL ARGV[2] if the version is ARGV[3].
+	redisCAS = redis.NewScript(redisLib + `
+if version(KEYS[2], KEYS[3]) ~= tonumber(ARGV[3]) then
+	return -1
+end
+return put(KEYS[2], KEYS[3], ARGV[1], ARGV[2])`)
+
+	// redisSetNX stores ARGV[1] with TTL ARGV[2] if the key is missing.
+	redisSetNX = redis.NewScript(redisLib + `
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+put(KEYS[2], KEYS[3], ARGV[1], ARGV[2])
+return 1`)
+
+	// redisIncr adds ARGV[1], creating the key with TTL ARGV[2].
+	redisIncr = redis.NewScript(redisLib + `
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	put(KEYS[2], KEYS[3], ARGV[1], ARGV[2])
+	return tonumber(ARGV[1])
+end
+local n = redis.call('INCRBY', KEYS[2], ARGV[1])
+bump(KEYS[2], KEYS[3])
+return n`)
+
+	// redisMSet stores ARGV[i+1] in each key with TTL ARGV[1].
+	redisMSet = redis.NewScript(redisLib + `
+for i = 2, #KEYS, 2 do
+	put(KEYS[i], KEYS[i + 1], ARGV[i / 2 + 1], ARGV[1])
+end
+return 1`)
+
+	// redisCommit checks that the first ARGV[1] keys still have the
+	// versions that follow, then applies a (value, ttl) write to each
+	// remaining key; a value of false deletes it.
+	redisCommit = redis.NewScript(redisLib + `
+local reads = tonumber(ARGV[1])
+for i = 1, reads do
+	if version(KEYS[2 * i], KEYS[2 * i + 1]) ~= tonumber(ARGV[i + 1]) then
+		return 0
+	end
+end
+local arg = reads + 2
+for i = 2 * reads + 2, #KEYS, 2 do
+	if ARGV[arg + 1] == 'delete' then
+		redis.call('DEL', KEYS[i], KEYS[i + 1])
+	else
+		put(KEYS[i], KEYS[i + 1], ARGV[arg], ARGV[arg + 1])
+	end
+	arg = arg + 2
+end
+return 1`)
+)
+
 // RedisStore implements Store using Redis as the backend.
 type RedisStore struct {
 	client    *redis.Client
 	keyPrefix string
+	db        int
+	feed      feed
 }
 
 // RedisOption configures the Redis store.
@@ -67,6 +181,7 @@ func NewRedisStore(addr string, opts ...RedisOption) (*RedisStore, error) {
 	return &RedisStore{
 		client:    client,
 		keyPrefix: cfg.keyPrefix,
+		db:        cfg.db,
 	}, nil
 }
 
@@ -75,6 +190,25 @@ func (s *RedisStore) prefixKey(key string) string {
 	return s.keyPrefix + key
 }
 
+// scriptKeys returns the KEYS of a script on keys: the version counter,
+// then each key with its version key.
+func (s *RedisStore) scriptKeys(keys ...string) []string {
+	result := make([]string, 0, 1+2*len(keys))
+	result = append(result, s.prefixKey(redisVersionKey))
+	for _, k := range keys {
+		result = append(result, s.prefixKey(k), s.prefixKey(redisVersionKey+":"+k))
+	}
+	return result
+}
+
+// redisTTL converts a TTL to the milliseconds the scripts take, 0 for none.
+func redisTTL(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return max(ttl.Milliseconds(), 1)
+}
+
 // Get retrieves a value by key.
 func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, error) {
 	result, err := s.client.Get(ctx, s.prefixKey(key)).Bytes()
@@ -89,12 +223,12 @@ func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, error) {
 
 // Set stores a value with an optional TTL.
 func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
-	return s.client.Set(ctx, s.prefixKey(key), value, ttl).Err()
+	return redisSet.Run(ctx, s.client, s.scriptKeys(key), value, redisTTL(ttl)).Err()
 }
 
 // Delete removes a key from the store.
 func (s *RedisStore) Delete(ctx context.Context, key string) error {
-	return s.client.Del(ctx, s.prefixKey(key)).Err()
+	return s.client.Del(ctx, s.prefixKey(key), s.prefixKey(redisVersionKey+":"+key)).Err()
 }
 
 // Exists checks if a key exists.
@@ -115,6 +249,9 @@ func (s *RedisStore) Keys(ctx context.Context, pattern string) ([]string, error)
 		if len(s.keyPrefix) > 0 && len(key) > len(s.keyPrefix) {
 			key = key[len(s.keyPrefix):]
 		}
+		if strings.HasPrefix(key, redisVersionKey) {
+			continue
+		}
 		keys = append(keys, key)
 	}
 
@@ -125,15 +262,338 @@ func (s *RedisStore) Keys(ctx context.Context, pattern string) ([]string, error)
 	return keys, nil
 }
 
+// unprefixKey removes the configured prefix from a key.
+func (s *RedisStore) unprefixKey(key string) string {
+	return strings.TrimPrefix(key, s.keyPrefix)
+}
+
+// Scan returns a page of the keys matching pattern using a Redis SCAN
+// cursor. Keys come in no particular order, a key may be returned more
+// than once, and a page may hold somewhat more than limit keys.
+func (s *RedisStore) Scan(ctx context.Context, pattern, cursor string, limit int) ([]string, string, error) {
+	limit = scanLimit(limit)
+
+	var next uint64
+	if cursor != "" {
+		var err error
+		if next, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", fmt.Errorf("invalid cursor %q", cursor)
+		}
+	}
+
+	var keys []string
+	for {
+		batch, c, err := s.client.Scan(ctx, next, s.prefixKey(pattern), int64(limit)).Result()
+		if err != nil {
+			return nil, "", err
+		}
+		for _, k := range batch {
+			k = s.unprefixKey(k)
+			if !strings.HasPrefix(k, redisVersionKey) && matchPattern(pattern, k) {
+				keys = append(keys, k)
+			}
+		}
+
+		next = c
+		if next == 0 {
+			return keys, "", nil
+		}
+		if len(keys) >= limit {
+			return keys, strconv.FormatUint(next, 10), nil
+		}
+	}
+}
+
+// Count returns how many keys match pattern, scanning them in batches. Like
+// Scan, it may count a key twice while keys are added or removed.
+func (s *RedisStore) Count(ctx context.Context, pattern string) (int64, error) {
+	var n int64
+	iter := s.client.Scan(ctx, 0, s.prefixKey(pattern), 1000).Iterator()
+	for iter.Next(ctx) {
+		k := s.unprefixKey(iter.Val())
+		if !strings.HasPrefix(k, redisVersionKey) && matchPattern(pattern, k) {
+			n++
+		}
+	}
+	return n, iter.Err()
+}
+
+// GetVersion retrieves a value by key with its version.
+func (s *RedisStore) GetVersion(ctx context.Context, key string) ([]byte, int64, error) {
+	snapshot, err := s.snapshot(ctx, []string{key})
+	if err != nil {
+		return nil, 0, err
+	}
+	if snapshot[0].version == 0 {
+		return nil, 0, ErrNotFound
+	}
+	return snapshot[0].value, snapshot[0].version, nil
+}
+
+// CompareAndSwap stores a value only if the key's version is still version.
+func (s *RedisStore) CompareAndSwap(ctx context.Context, key string, value []byte, version int64, ttl time.Duration) (int64, error) {
+	newVersion, err := redisCAS.Run(ctx, s.client, s.scriptKeys(key), value, redisTTL(ttl), version).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if newVersion < 0 {
+		return 0, ErrConflict
+	}
+	return newVersion, nil
+}
+
+// SetNX stores a value only if the key does not exist.
+func (s *RedisStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	set, err := redisSetNX.Run(ctx, s.client, s.scriptKeys(key), value, redisTTL(ttl)).Int64()
+	return set == 1, err
+}
+
+// Incr adds delta to the integer at key and returns the result.
+func (s *RedisStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	n, err := redisIncr.Run(ctx, s.client, s.scriptKeys(key), delta, redisTTL(ttl)).Int64()
+	if err != nil && strings.Contains(err.Error(), "not an integer") {
+		return 0, ErrNotInteger
+	}
+	return n, err
+}
+
+// MGet retrieves several keys.
+func (s *RedisStore) MGet(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, k := range keys {
+		prefixed[i] = s.prefixKey(k)
+	}
+	values, err := s.client.MGet(ctx, prefixed...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		if str, ok := v.(string); ok {
+			result[keys[i]] = []byte(str)
+		}
+	}
+	return result, nil
+}
+
+// MSet stores several values in one script.
+func (s *RedisStore) MSet(ctx context.Context, values map[string][]byte, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(values))
+	args := make([]any, 0, 1+len(values))
+	args = append(args, redisTTL(ttl))
+	for k, v := range values {
+		keys = append(keys, k)
+		args = append(args, v)
+	}
+	return redisMSet.Run(ctx, s.client, s.scriptKeys(keys...), args...).Err()
+}
+
+// Txn runs fn optimistically: its writes are applied by a script that
+// first checks the versions of keys, and fn runs again on conflict.
+func (s *RedisStore) Txn(ctx context.Context, keys []string, fn func(tx *Tx) error) error {
+	for range maxTxnAttempts {
+		snapshot, err := s.snapshot(ctx, keys)
+		if err != nil {
+			return err
+		}
+
+		values := make(map[string][]byte, len(keys))
+		for i, k := range keys {
+			if snapshot[i].version != 0 {
+				values[k] = snapshot[i].value
+			}
+		}
+
+		tx := newTx(keys, values)
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		scriptKeys := append([]string{}, keys...)
+		args := make([]any, 0, 1+len(keys)+2*len(tx.writes))
+		args = append(args, len(keys))
+		for _, v := range snapshot {
+			args = append(args, v.version)
+		}
+		for k, w := range tx.writes {
+			scriptKeys = append(scriptKeys, k)
+			if w.value == nil {
+				args = append(args, "", "delete")
+			} else {
+				args = append(args, w.value, redisTTL(w.ttl))
+			}
+		}
+
+		ok, err := redisCommit.Run(ctx, s.client, s.scriptKeys(scriptKeys...), args...).Int64()
+		if err != nil {
+			return err
+		}
+		if ok == 1 {
+			return nil
+		}
+	}
+	return ErrConflict
+}
+
+// redisVersioned is a key's value and version; version 0 means missing.
+type redisVersioned struct {
+	value   []byte
+	version int64
+}
+
+// snapshot reads the values and versions of keys in one script.
+func (s *RedisStore) snapshot(ctx context.Context, keys []string) ([]redisVersioned, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	reply, err := redisSnapshot.Run(ctx, s.client, s.scriptKeys(keys...)).Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 2*len(keys) {
+		return nil, errors.New("unexpected snapshot reply")
+	}
+
+	result := make([]redisVersioned, len(keys))
+	for i := range keys {
+		if str, ok := reply[2*i].(string); ok {
+			result[i].value = []byte(str)
+		}
+		result[i].version, _ = reply[2*i+1].(int64)
+	}
+	return result, nil
+}
+
 // Ping checks if the store is available.
 func (s *RedisStore) Ping(ctx context.Context) error {
 	return s.client.Ping(ctx).Err()
 }
 
-// Close closes the Redis connection.
+// redisNotifyFlags are the keyspace notifications Watch needs: keyspace
+// channels, generic and string commands, expiries and evictions.
+const redisNotifyFlags = "Kg$xe"
+
+// redisEvents maps keyspace notifications to event types. Others, such as
+// the expire that comes with a TTL, are not changes of their own.
+var redisEvents = map[string]EventType{
+	"set":     EventSet,
+	"incrby":  EventSet,
+	"del":     EventDelete,
+	"evicted": EventDelete,
+	"expired": EventExpire,
+}
+
+// Watch streams the changes to keys starting with prefix until ctx is
+// done, using keyspace notifications. Redis publishes them in the order it
+// runs commands. Changes made while the connection is being re-established
+// are missed.
+func (s *RedisStore) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	if err := s.enableNotifications(ctx); err != nil {
+		return nil, err
+	}
+
+	channel := fmt.Sprintf("__keyspace@%d__:", s.db)
+	pubsub := s.client.PSubscribe(ctx, channel+redisEscape(s.prefixKey(prefix))+"*")
+
+	// Wait for the subscription, so that no later change is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to watch keys: %w", err)
+	}
+
+	w := s.feed.watch(ctx, prefix, -1)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-w.done:
+		}
+		pubsub.Close()
+	}()
+
+	go func() {
+		for {
+			msg, err := pubsub.ReceiveMessage(ctx)
+			if err != nil {
+				if ctx.Err() != nil || errors.Is(err, redis.ErrClosed) {
+					return
+				}
+				// The next receive reconnects
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+
+			typ, ok := redisEvents[msg.Payload]
+			key := s.unprefixKey(strings.TrimPrefix(msg.Channel, channel))
+			if ok && !strings.HasPrefix(key, redisVersionKey) {
+				w.push(Event{Type: typ, Key: key})
+			}
+		}
+	}()
+
+	return w.ch, nil
+}
+
+// enableNotifications turns on the keyspace notifications Watch needs. If
+// CONFIG is not available, as on some hosted Redis, they are assumed to be
+// configured already.
+func (s *RedisStore) enableNotifications(ctx context.Context) error {
+	config, err := s.client.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return nil
+	}
+
+	flags := config["notify-keyspace-events"]
+	missing := ""
+	for _, f := range redisNotifyFlags {
+		// A is an alias for every class of event
+		if !strings.ContainsRune(flags, f) && (f == 'K' || !strings.ContainsRune(flags, 'A')) {
+			missing += string(f)
+		}
+	}
+	if missing == "" {
+		return nil
+	}
+
+	if err := s.client.ConfigSet(ctx, "notify-keyspace-events", flags+missing).Err(); err != nil {
+		return fmt.Errorf("failed to enable keyspace notifications (notify-keyspace-events needs %q): %w", redisNotifyFlags, err)
+	}
+	return nil
+}
+
+// redisEscape escapes the glob characters in s for a Redis pattern.
+func redisEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Close closes the Redis connection and stops the watchers.
 func (s *RedisStore) Close() error {
+	s.feed.close()
 	return s.client.Close()
 }
 
-// Verify RedisStore implements Store
-var _ Store = (*RedisStore)(nil)
+// Verify RedisStore implements AtomicStore, ScanStore and WatchStore
+var (
+	_ AtomicStore = (*RedisStore)(nil)
+	_ ScanStore   = (*RedisStore)(nil)
+	_ WatchStore  = (*RedisStore)(nil)
+)
@@ -231,3 +231,57 @@ func TestRedisStore_WithDB(t *testing.T) {
 	// Cleanup
 	store.Delete(ctx, "db-test")
 }
+
+func TestRedisStore_Atomic(t *testing.T) {
+	testAtomicStore(t, func(t *testing.T) AtomicStore {
+		prefix := "test:" + t.Name() + ":"
+		store, err := NewRedisStore(getRedisAddr(), WithKeyPrefix(prefix))
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+		t.Cleanup(func() {
+			keys, _ := store.client.Keys(context.Background(), prefix+"*").Result()
+			if len(keys) > 0 {
+				store.client.Del(context.Background(), keys...)
+			}
+			store.Close()
+		})
+		return store
+	})
+}
+
+func TestRedisStore_Scan(t *testing.T) {
+	testScanStore(t, func(t *testing.T) ScanStore {
+		prefix := "test:" + t.Name() + ":"
+		store, err := NewRedisStore(getRedisAddr(), WithKeyPrefix(prefix))
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+		t.Cleanup(func() {
+			keys, _ := store.client.Keys(context.Background(), prefix+"*").Result()
+			if len(keys) > 0 {
+				store.client.Del(context.Background(), keys...)
+			}
+			store.Close()
+		})
+		return store
+	})
+}
+
+func TestRedisStore_Watch(t *testing.T) {
+	testWatchStore(t, func(t *testing.T) WatchStore {
+		prefix := "test:" + t.Name() + ":"
+		store, err := NewRedisStore(getRedisAddr(), WithKeyPrefix(prefix))
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+		t.Cleanup(func() {
+			keys, _ := store.client.Keys(context.Background(), prefix+"*").Result()
+			if len(keys) > 0 {
+				store.client.Del(context.Background(), keys...)
+			}
+			store.Close()
+		})
+		return store
+	})
+}
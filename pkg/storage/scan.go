@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"iter"
+	"path"
+	"strings"
+)
+
+// DefaultScanLimit is the page size of Scan when none is given.
+const DefaultScanLimit = 100
+
+// ScanKeys iterates over the keys matching pattern, loading pageSize of
+// them at a time. Iteration stops at the first error, which is yielded.
+func ScanKeys(ctx context.Context, s ScanStore, pattern string, pageSize int) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		cursor := ""
+		for {
+			keys, next, err := s.Scan(ctx, pattern, cursor, pageSize)
+			if err != nil {
+				yield("", err)
+				return
+			}
+			for _, k := range keys {
+				if !yield(k, nil) {
+					return
+				}
+			}
+			if next == "" {
+				return
+			}
+			cursor = next
+		}
+	}
+}
+
+// scanLimit returns the page size for a Scan limit.
+func scanLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultScanLimit
+	}
+	return limit
+}
+
+// validPattern reports whether pattern is a well-formed glob. Keys match a
+// malformed pattern only by equality.
+func validPattern(pattern string) bool {
+	_, err := path.Match(pattern, "")
+	return err == nil
+}
+
+// literalPrefix returns the part of a glob pattern before its first
+// special character. Every matching key starts with it.
+func literalPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// prefixEnd returns the smallest string greater than every string starting
+// with prefix, or false if there is none.
+func prefixEnd(prefix string) (string, bool) {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1]), true
+		}
+	}
+	return "", false
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"path"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	_ "modernc.org/sqlite" // Pure Go SQLite driver
@@ -17,6 +20,14 @@ type SQLiteStore struct {
 	db              *sql.DB
 	cleanupInterval time.Duration
 	stopCleanup     chan struct{}
+
+	feed            feed
+	pollInterval    time.Duration
+	changeRetention time.Duration
+	changed         chan struct{}
+	watchMu         sync.Mutex
+	lastChange      int64
+	polling         bool
 }
 
 // SQLiteOption configures the SQLite store.
@@ -24,6 +35,8 @@ type SQLiteOption func(*sqliteConfig)
 
 type sqliteConfig struct {
 	cleanupInterval time.Duration
+	pollInterval    time.Duration
+	changeRetention time.Duration
 	pragmas         map[string]string
 }
 
@@ -34,6 +47,21 @@ func WithCleanupInterval(d time.Duration) SQLiteOption {
 	}
 }
 
+// WithPollInterval sets how often watchers check the change log for writes
+// from other processes.
+func WithPollInterval(d time.Duration) SQLiteOption {
+	return func(c *sqliteConfig) {
+		c.pollInterval = d
+	}
+}
+
+// WithChangeRetention sets how long the change log keeps changes.
+func WithChangeRetention(d time.Duration) SQLiteOption {
+	return func(c *sqliteConfig) {
+		c.changeRetention = d
+	}
+}
+
 // WithWALMode enables Write-Ahead Logging for better concurrent performance.
 func WithWALMode() SQLiteOption {
 	return func(c *sqliteConfig) {
@@ -53,6 +81,8 @@ func WithSyncMode(mode string) SQLiteOption {
 func NewSQLiteStore(dbPath string, opts ...SQLiteOption) (*SQLiteStore, error) {
 	cfg := &sqliteConfig{
 		cleanupInterval: 5 * time.Minute,
+		pollInterval:    time.Second,
+		changeRetention: time.Hour,
 		pragmas: map[string]string{
 			"journal_mode": "WAL",
 			"synchronous":  "NORMAL",
@@ -64,37 +94,28 @@ func NewSQLiteStore(dbPath string, opts ...SQLiteOption) (*SQLiteStore, error) {
 		opt(cfg)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	db, err := sql.Open("sqlite", sqliteDSN(dbPath, cfg.pragmas))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Apply pragmas
-	for k, v := range cfg.pragmas {
-		if _, err := db.Exec(fmt.Sprintf("PRAGMA %s = %s", k, v)); err != nil {
-			db.Close()
-			return nil, fmt.Errorf("failed to set pragma %s: %w", k, err)
-		}
+	// Every connection to an in-memory database opens a new, empty one
+	if dbPath == ":memory:" {
+		db.SetMaxOpenConns(1)
 	}
 
-	// Create schema
-	schema := `
-		CREATE TABLE IF NOT EXISTS kv (
-			key TEXT PRIMARY KEY,
-			value BLOB NOT NULL,
-			expires_at INTEGER
-		);
-		CREATE INDEX IF NOT EXISTS idx_expires_at ON kv(expires_at) WHERE expires_at IS NOT NULL;
-	`
-	if _, err := db.Exec(schema); err != nil {
+	if err := migrateSQLite(db); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to create schema: %w", err)
+		return nil, err
 	}
 
 	s := &SQLiteStore{
 		db:              db,
 		cleanupInterval: cfg.cleanupInterval,
 		stopCleanup:     make(chan struct{}),
+		pollInterval:    cfg.pollInterval,
+		changeRetention: cfg.changeRetention,
+		changed:         make(chan struct{}, 1),
 	}
 
 	// Start background cleanup goroutine
@@ -103,6 +124,95 @@ func NewSQLiteStore(dbPath string, opts ...SQLiteOption) (*SQLiteStore, error) {
 	return s, nil
 }
 
+// sqliteMigrations upgrade the schema. The database's user_version is the
+// number of migrations that ran.
+var sqliteMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS kv (
+		key TEXT PRIMARY KEY,
+		value BLOB NOT NULL,
+		expires_at INTEGER
+	);
+	CREATE INDEX IF NOT EXISTS idx_expires_at ON kv(expires_at) WHERE expires_at IS NOT NULL;`,
+
+	// Versions are row IDs: every write replaces the row, and AUTOINCREMENT
+	// never reuses an ID
+	`CREATE TABLE kv_versioned (
+		version INTEGER PRIMARY KEY AUTOINCREMENT,
+		key TEXT NOT NULL UNIQUE,
+		value BLOB NOT NULL,
+		expires_at INTEGER
+	);
+	INSERT INTO kv_versioned (key, value, expires_at) SELECT key, value, expires_at FROM kv;
+	DROP TABLE kv;
+	ALTER TABLE kv_versioned RENAME TO kv;
+	CREATE INDEX idx_expires_at ON kv(expires_at) WHERE expires_at IS NOT NULL;`,
+
+	// Triggers log every change, whichever process makes it, for Watch.
+	// Replacing a row fires only the insert trigger. Deleting an expired
+	// row is an expiry
+	`CREATE TABLE kv_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key TEXT NOT NULL,
+		type TEXT NOT NULL,
+		at INTEGER NOT NULL
+	);
+	CREATE INDEX idx_kv_changes_at ON kv_changes(at);
+	CREATE TRIGGER kv_set AFTER INSERT ON kv BEGIN
+		INSERT INTO kv_changes (key, type, at)
+		VALUES (NEW.key, 'set', ` + sqliteNow + `);
+	END;
+	CREATE TRIGGER kv_delete AFTER DELETE ON kv BEGIN
+		INSERT INTO kv_changes (key, type, at)
+		VALUES (OLD.key, CASE WHEN OLD.expires_at < ` + sqliteNow + ` THEN 'expire' ELSE 'delete' END, ` + sqliteNow + `);
+	END;`,
+}
+
+// sqliteNow is the current Unix time in milliseconds, in SQL.
+const sqliteNow = "CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)"
+
+// sqliteDSN adds the pragmas to the database path, so that they apply to
+// every connection, and makes transactions take the write lock up front.
+func sqliteDSN(dbPath string, pragmas map[string]string) string {
+	q := url.Values{}
+	for k, v := range pragmas {
+		q.Add("_pragma", fmt.Sprintf("%s(%s)", k, v))
+	}
+	q.Set("_txlock", "immediate")
+
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	return dbPath + sep + q.Encode()
+}
+
+// migrateSQLite runs the migrations the database has not seen yet.
+func migrateSQLite(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	if version >= len(sqliteMigrations) {
+		return nil
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			return fmt.Errorf("failed to migrate schema to version %d: %w", i+1, err)
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(sqliteMigrations))); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	return tx.Commit()
+}
+
 // Get retrieves a value by key.
 func (s *SQLiteStore) Get(ctx context.Context, key string) ([]byte, error) {
 	var value []byte
@@ -144,6 +254,7 @@ func (s *SQLiteStore) Set(ctx context.Context, key string, value []byte, ttl tim
 		return fmt.Errorf("failed to set key: %w", err)
 	}
 
+	s.notify()
 	return nil
 }
 
@@ -153,6 +264,7 @@ func (s *SQLiteStore) Delete(ctx context.Context, key string) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete key: %w", err)
 	}
+	s.notify()
 	return nil
 }
 
@@ -179,36 +291,433 @@ func (s *SQLiteStore) Exists(ctx context.Context, key string) bool {
 // Keys returns all keys matching a pattern.
 // Supports basic glob patterns with * wildcard.
 func (s *SQLiteStore) Keys(ctx context.Context, pattern string) ([]string, error) {
-	now := time.Now().UnixMilli()
+	var keys []string
+	_, _, err := s.eachKey(ctx, pattern, "", 0, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys, err
+}
 
-	// SQLite GLOB uses different syntax than path.Match
-	// Convert * to % for SQL LIKE, but we'll use path.Match for accurate matching
-	rows, err := s.db.QueryContext(ctx,
-		"SELECT key FROM kv WHERE (expires_at IS NULL OR expires_at > ?)", now,
-	)
+// Scan returns a page of the keys matching pattern, in key order. The
+// cursor is the last key of the previous page.
+func (s *SQLiteStore) Scan(ctx context.Context, pattern, cursor string, limit int) ([]string, string, error) {
+	limit = scanLimit(limit)
+
+	var keys []string
+	for {
+		last, read, err := s.eachKey(ctx, pattern, cursor, limit, func(key string) bool {
+			keys = append(keys, key)
+			return len(keys) < limit
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		if len(keys) == limit {
+			return keys, keys[limit-1], nil
+		}
+		if read < limit {
+			return keys, "", nil
+		}
+		cursor = last
+	}
+}
+
+// Count returns how many keys match pattern.
+func (s *SQLiteStore) Count(ctx context.Context, pattern string) (int64, error) {
+	// A literal prefix followed by * is counted in SQL
+	if prefix := literalPrefix(pattern); prefix+"*" == pattern {
+		where, args := sqliteKeyFilter(pattern, "")
+		var n int64
+		err := s.db.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM kv WHERE "+where+" AND instr(substr(key, ?), '/') = 0",
+			append(args, len(prefix)+1)...,
+		).Scan(&n)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count keys: %w", err)
+		}
+		return n, nil
+	}
+
+	var n int64
+	_, _, err := s.eachKey(ctx, pattern, "", 0, func(string) bool {
+		n++
+		return true
+	})
+	return n, err
+}
+
+// eachKey calls fn with the live keys matching pattern after cursor, in
+// key order, until it returns false. When limit is positive, at most limit
+// rows are read. Returns the last key read and how many rows were.
+func (s *SQLiteStore) eachKey(ctx context.Context, pattern, cursor string, limit int, fn func(key string) bool) (string, int, error) {
+	where, args := sqliteKeyFilter(pattern, cursor)
+	query := "SELECT key FROM kv WHERE " + where + " ORDER BY key"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query keys: %w", err)
+		return "", 0, fmt.Errorf("failed to query keys: %w", err)
 	}
 	defer rows.Close()
 
-	var keys []string
+	var last string
+	var read int
 	for rows.Next() {
-		var key string
-		if err := rows.Scan(&key); err != nil {
-			return nil, fmt.Errorf("failed to scan key: %w", err)
+		if err := rows.Scan(&last); err != nil {
+			return "", 0, fmt.Errorf("failed to scan key: %w", err)
 		}
+		read++
 
-		// Use path.Match for consistent pattern matching with MemoryStore
-		if matchPattern(pattern, key) {
-			keys = append(keys, key)
+		// GLOB narrows the rows down; path.Match decides, for consistency
+		// with MemoryStore
+		if matchPattern(pattern, last) && !fn(last) {
+			break
 		}
 	}
-
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows error: %w", err)
+		return "", 0, fmt.Errorf("rows error: %w", err)
+	}
+	return last, read, nil
+}
+
+// sqliteKeyFilter returns a WHERE clause for the live keys after cursor
+// that may match pattern. The pattern's literal prefix becomes a range on
+// the key index.
+func sqliteKeyFilter(pattern, cursor string) (string, []any) {
+	where := []string{"(expires_at IS NULL OR expires_at > ?)"}
+	args := []any{time.Now().UnixMilli()}
+
+	if cursor != "" {
+		where = append(where, "key > ?")
+		args = append(args, cursor)
+	}
+
+	if !validPattern(pattern) {
+		return strings.Join(append(where, "key = ?"), " AND "), append(args, pattern)
+	}
+
+	if prefix := literalPrefix(pattern); prefix != "" {
+		where = append(where, "key >= ?")
+		args = append(args, prefix)
+		if end, ok := prefixEnd(prefix); ok {
+			where = append(where, "key < ?")
+			args = append(args, end)
+		}
+	}
+
+	// GLOB has no escapes, so escaped patterns are only matched in Go
+	if !strings.Contains(pattern, `\`) {
+		where = append(where, "key GLOB ?")
+		args = append(args, pattern)
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// GetVersion retrieves a value by key with its version.
+func (s *SQLiteStore) GetVersion(ctx context.Context, key string) ([]byte, int64, error) {
+	var value []byte
+	var version int64
+	err := s.db.QueryRowContext(ctx,
+		"SELECT value, version FROM kv WHERE key = ? AND (expires_at IS NULL OR expires_at > ?)",
+		key, time.Now().UnixMilli(),
+	).Scan(&value, &version)
+
+	if err == sql.ErrNoRows {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get key: %w", err)
+	}
+	return value, version, nil
+}
+
+// CompareAndSwap stores a value only if the key's version is still version.
+func (s *SQLiteStore) CompareAndSwap(ctx context.Context, key string, value []byte, version int64, ttl time.Duration) (int64, error) {
+	var newVersion int64
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		_, current, _, err := sqliteLive(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if current != version {
+			return ErrConflict
+		}
+		newVersion, err = sqlitePut(ctx, tx, key, value, sqliteExpiry(ttl))
+		return err
+	})
+	return newVersion, err
+}
+
+// SetNX stores a value only if the key does not exist.
+func (s *SQLiteStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	set := false
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		_, current, _, err := sqliteLive(ctx, tx, key)
+		if err != nil || current != 0 {
+			return err
+		}
+		set = true
+		_, err = sqlitePut(ctx, tx, key, value, sqliteExpiry(ttl))
+		return err
+	})
+	return set, err
+}
+
+// Incr adds delta to the integer at key and returns the result.
+func (s *SQLiteStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	var n int64
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		value, current, expiresAt, err := sqliteLive(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			expiresAt = sqliteExpiry(ttl)
+		} else if n, err = parseInt(value); err != nil {
+			return err
+		}
+		n += delta
+		_, err = sqlitePut(ctx, tx, key, strconv.AppendInt(nil, n, 10), expiresAt)
+		return err
+	})
+	return n, err
+}
+
+// MGet retrieves several keys.
+func (s *SQLiteStore) MGet(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(keys))
+	now := time.Now().UnixMilli()
+
+	// Stay well below SQLite's limit on query parameters
+	for batch := range slices.Chunk(keys, 500) {
+		args := make([]any, 0, len(batch)+1)
+		args = append(args, now)
+		for _, k := range batch {
+			args = append(args, k)
+		}
+
+		rows, err := s.db.QueryContext(ctx,
+			"SELECT key, value FROM kv WHERE (expires_at IS NULL OR expires_at > ?) AND key IN (?"+strings.Repeat(", ?", len(batch)-1)+")",
+			args...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get keys: %w", err)
+		}
+		for rows.Next() {
+			var key string
+			var value []byte
+			if err := rows.Scan(&key, &value); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan key: %w", err)
+			}
+			result[key] = value
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("rows error: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// MSet stores several values in one SQL transaction.
+func (s *SQLiteStore) MSet(ctx context.Context, values map[string][]byte, ttl time.Duration) error {
+	expiresAt := sqliteExpiry(ttl)
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		for k, v := range values {
+			if _, err := sqlitePut(ctx, tx, k, v, expiresAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Txn runs fn in an SQL transaction that holds the write lock, so it runs
+// exactly once.
+func (s *SQLiteStore) Txn(ctx context.Context, keys []string, fn func(tx *Tx) error) error {
+	return s.inTx(ctx, func(sqlTx *sql.Tx) error {
+		values := make(map[string][]byte, len(keys))
+		for _, k := range keys {
+			value, version, _, err := sqliteLive(ctx, sqlTx, k)
+			if err != nil {
+				return err
+			}
+			if version != 0 {
+				values[k] = value
+			}
+		}
+
+		tx := newTx(keys, values)
+		if err := fn(tx); err != nil {
+			return err
+		}
+		for k, w := range tx.writes {
+			if w.value == nil {
+				if _, err := sqlTx.ExecContext(ctx, "DELETE FROM kv WHERE key = ?", k); err != nil {
+					return fmt.Errorf("failed to delete key: %w", err)
+				}
+				continue
+			}
+			if _, err := sqlitePut(ctx, sqlTx, k, w.value, sqliteExpiry(w.ttl)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// inTx runs fn in a transaction, committing when it returns nil.
+func (s *SQLiteStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.notify()
+	return nil
+}
+
+// sqliteLive reads a key in a transaction. The version is 0 when the key
+// does not exist or expired.
+func sqliteLive(ctx context.Context, tx *sql.Tx, key string) ([]byte, int64, sql.NullInt64, error) {
+	var value []byte
+	var version int64
+	var expiresAt sql.NullInt64
+	err := tx.QueryRowContext(ctx,
+		"SELECT value, version, expires_at FROM kv WHERE key = ?", key,
+	).Scan(&value, &version, &expiresAt)
+
+	if err == sql.ErrNoRows || err == nil && expiresAt.Valid && time.Now().UnixMilli() > expiresAt.Int64 {
+		return nil, 0, sql.NullInt64{}, nil
+	}
+	if err != nil {
+		return nil, 0, sql.NullInt64{}, fmt.Errorf("failed to get key: %w", err)
+	}
+	return value, version, expiresAt, nil
+}
+
+// sqlitePut writes a key in a transaction and returns its new version.
+func sqlitePut(ctx context.Context, tx *sql.Tx, key string, value []byte, expiresAt sql.NullInt64) (int64, error) {
+	if value == nil {
+		value = []byte{}
+	}
+
+	var version int64
+	err := tx.QueryRowContext(ctx,
+		"INSERT OR REPLACE INTO kv (key, value, expires_at) VALUES (?, ?, ?) RETURNING version",
+		key, value, expiresAt,
+	).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set key: %w", err)
+	}
+	return version, nil
+}
+
+// sqliteExpiry returns the expiry column value for a TTL.
+func sqliteExpiry(ttl time.Duration) sql.NullInt64 {
+	if ttl <= 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: time.Now().Add(ttl).UnixMilli(), Valid: true}
+}
+
+// Watch streams the changes to keys starting with prefix, in the order they
+// were committed, until ctx is done. Changes made through this store are
+// seen at once, and those of other processes within the poll interval.
+// Expire events come when the cleanup loop or a read removes the key.
+func (s *SQLiteStore) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	var last int64
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM kv_changes").Scan(&last)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch keys: %w", err)
+	}
+
+	// The change log is only read while someone watches
+	if !s.feed.active() {
+		s.lastChange = last
+	}
+	w := s.feed.watch(ctx, prefix, last)
+	if !s.polling {
+		s.polling = true
+		go s.pollLoop()
+	}
+	return w.ch, nil
+}
+
+// notify wakes the change log poller after a write.
+func (s *SQLiteStore) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// pollLoop publishes the change log to the watchers.
+func (s *SQLiteStore) pollLoop() {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.changed:
+		case <-s.stopCleanup:
+			return
+		}
+		s.poll()
 	}
+}
+
+// poll publishes the changes logged since the last poll.
+func (s *SQLiteStore) poll() {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
 
-	return keys, nil
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	const batch = 1000
+	for s.feed.active() {
+		rows, err := s.db.QueryContext(ctx,
+			"SELECT id, key, type FROM kv_changes WHERE id > ? ORDER BY id LIMIT ?",
+			s.lastChange, batch,
+		)
+		if err != nil {
+			return
+		}
+
+		var events []Event
+		for rows.Next() {
+			var e Event
+			if err := rows.Scan(&e.seq, &e.Key, &e.Type); err != nil {
+				break
+			}
+			events = append(events, e)
+		}
+		rows.Close()
+
+		if len(events) > 0 {
+			s.feed.publish(events...)
+			s.lastChange = events[len(events)-1].seq
+		}
+		if len(events) < batch {
+			return
+		}
+	}
 }
 
 // Ping checks if the store is available.
@@ -219,6 +728,7 @@ func (s *SQLiteStore) Ping(ctx context.Context) error {
 // Close closes the store and stops the cleanup goroutine.
 func (s *SQLiteStore) Close() error {
 	close(s.stopCleanup)
+	s.feed.close()
 	return s.db.Close()
 }
 
@@ -242,10 +752,16 @@ func (s *SQLiteStore) cleanup() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	now := time.Now()
 	_, _ = s.db.ExecContext(ctx,
 		"DELETE FROM kv WHERE expires_at IS NOT NULL AND expires_at < ?",
-		time.Now().UnixMilli(),
+		now.UnixMilli(),
+	)
+	_, _ = s.db.ExecContext(ctx,
+		"DELETE FROM kv_changes WHERE at < ?",
+		now.Add(-s.changeRetention).UnixMilli(),
 	)
+	s.notify()
 }
 
 // Stats returns statistics about the store.
@@ -277,24 +793,10 @@ func (s *SQLiteStore) Stats(ctx context.Context) (map[string]int64, error) {
 	return stats, nil
 }
 
-// globToSQLPattern converts a glob pattern to SQL LIKE pattern.
-// This is used for optimized queries when possible.
-func globToSQLPattern(pattern string) string {
-	// Simple conversion: * -> %, ? -> _
-	result := strings.ReplaceAll(pattern, "*", "%")
-	result = strings.ReplaceAll(result, "?", "_")
-	return result
-}
-
-// matchPattern checks if a key matches a glob pattern.
-// Uses path.Match for consistency with MemoryStore.
-func matchPatternLocal(pattern, key string) bool {
-	matched, err := path.Match(pattern, key)
-	if err != nil {
-		return pattern == key
-	}
-	return matched
-}
-
-// Compile-time check that SQLiteStore implements Store.
-var _ Store = (*SQLiteStore)(nil)
+// Compile-time check that SQLiteStore implements AtomicStore, ScanStore and
+// WatchStore.
+var (
+	_ AtomicStore = (*SQLiteStore)(nil)
+	_ ScanStore   = (*SQLiteStore)(nil)
+	_ WatchStore  = (*SQLiteStore)(nil)
+)
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 	"os"
 	"path/filepath"
 	"testing"
@@ -418,6 +419,144 @@ func TestSQLiteStore_FileCreation(t *testing.T) {
 	}
 }
 
+func TestSQLiteStore_Atomic(t *testing.T) {
+	testAtomicStore(t, func(t *testing.T) AtomicStore {
+		store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"), WithCleanupInterval(time.Hour))
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestSQLiteStore_Atomic_InMemory(t *testing.T) {
+	testAtomicStore(t, func(t *testing.T) AtomicStore {
+		store := newTestSQLiteStore(t)
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestSQLiteStore_Scan(t *testing.T) {
+	testScanStore(t, func(t *testing.T) ScanStore {
+		store := newTestSQLiteStore(t)
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestSQLiteStore_Scan_EscapedPattern(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLiteStore(t)
+	defer store.Close()
+
+	store.Set(ctx, "a*b", []byte("x"), 0)
+	store.Set(ctx, "axb", []byte("x"), 0)
+
+	keys, _, err := store.Scan(ctx, `a\*b`, "", 10)
+	if err != nil || len(keys) != 1 || keys[0] != "a*b" {
+		t.Errorf("expected only the literal key, got %v (%v)", keys, err)
+	}
+	if n, _ := store.Count(ctx, `a\*b`); n != 1 {
+		t.Errorf("expected 1, got %d", n)
+	}
+}
+
+func TestSQLiteStore_Watch(t *testing.T) {
+	testWatchStore(t, func(t *testing.T) WatchStore {
+		store, err := NewSQLiteStore(":memory:", WithCleanupInterval(10*time.Millisecond))
+		if err != nil {
+			t.Fatalf("failed to create store: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestSQLiteStore_Watch_OtherProcess(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "shared.db")
+
+	writer, err := NewSQLiteStore(dbPath, WithCleanupInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer writer.Close()
+
+	watcher, err := NewSQLiteStore(dbPath, WithCleanupInterval(time.Hour), WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer watcher.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := watcher.Watch(ctx, "job:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writer.Set(ctx, "job:1", []byte("queued"), 0)
+	writer.MSet(ctx, map[string][]byte{"job:2": []byte("queued")}, 0)
+	writer.Delete(ctx, "job:1")
+
+	want := []Event{
+		{Type: EventSet, Key: "job:1"},
+		{Type: EventSet, Key: "job:2"},
+		{Type: EventDelete, Key: "job:1"},
+	}
+	for i, w := range want {
+		if got := nextEvent(t, events); got != w {
+			t.Fatalf("event %d: expected %+v, got %+v", i, w, got)
+		}
+	}
+}
+
+func TestSQLiteStore_Migrate(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+
+	// A database created before versions were added
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE kv (key TEXT PRIMARY KEY, value BLOB NOT NULL, expires_at INTEGER);
+		INSERT INTO kv (key, value) VALUES ('a', 'one'), ('b', 'two');
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("failed to create old schema: %v", err)
+	}
+
+	store, err := NewSQLiteStore(dbPath, WithCleanupInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	value, version, err := store.GetVersion(ctx, "b")
+	if err != nil || string(value) != "two" || version <= 0 {
+		t.Errorf("unexpected migrated key %q %d (%v)", value, version, err)
+	}
+	if _, err := store.CompareAndSwap(ctx, "b", []byte("three"), version, 0); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	store.Close()
+
+	// Opening it again runs no migrations
+	store, err = NewSQLiteStore(dbPath, WithCleanupInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	defer store.Close()
+
+	if value, _ := store.Get(ctx, "b"); string(value) != "three" {
+		t.Errorf("expected three, got %q", value)
+	}
+}
+
 // newTestSQLiteStore creates an in-memory SQLite store for testing.
 func newTestSQLiteStore(t *testing.T) *SQLiteStore {
 	store, err := NewSQLiteStore(":memory:", WithCleanupInterval(time.Hour))
@@ -6,8 +6,21 @@ import (
 	"time"
 )
 
-// ErrNotFound is returned when a key is not found in the store.
-var ErrNotFound = errors.New("key not found")
+// Storage errors
+var (
+	// ErrNotFound is returned when a key is not found in the store.
+	ErrNotFound = errors.New("key not found")
+
+	// ErrConflict is returned when a key changed since its version was read.
+	ErrConflict = errors.New("version conflict")
+
+	// ErrNotInteger is returned by Incr when the value is not an integer.
+	ErrNotInteger = errors.New("value is not an integer")
+
+	// ErrNotInTx is returned when a transaction reads a key it was not
+	// started with.
+	ErrNotInTx = errors.New("key is not part of the transaction")
+)
 
 // Store is the interface for all storage backends.
 type Store interface {
@@ -34,3 +47,67 @@ type Store interface {
 	// Close closes the store connection.
 	Close() error
 }
+
+// AtomicStore is a Store with atomic and batch operations, for building
+// counters, locks and queues that are safe across goroutines and processes.
+//
+// Every write to a key gives it a new version. Versions increase and are
+// never reused for the same key, even after it is deleted.
+type AtomicStore interface {
+	Store
+
+	// GetVersion retrieves a value by key with its version.
+	GetVersion(ctx context.Context, key string) ([]byte, int64, error)
+
+	// CompareAndSwap stores a value only if the key's version is still
+	// version, where 0 means the key must not exist. Returns the new
+	// version, or ErrConflict.
+	CompareAndSwap(ctx context.Context, key string, value []byte, version int64, ttl time.Duration) (int64, error)
+
+	// SetNX stores a value only if the key does not exist, and reports
+	// whether it did.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+
+	// Incr adds delta to the decimal integer at key and returns the result.
+	// A missing key counts as 0 and is created with the TTL; an existing
+	// key keeps its expiry.
+	Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+
+	// MGet retrieves several keys. Missing keys are left out of the result.
+	MGet(ctx context.Context, keys ...string) (map[string][]byte, error)
+
+	// MSet stores several values at once, with the same TTL.
+	MSet(ctx context.Context, values map[string][]byte, ttl time.Duration) error
+
+	// Txn runs fn in a transaction that can read keys. Its writes are
+	// applied together when fn returns nil, and only if none of keys
+	// changed meanwhile. fn may run more than once and must not use the
+	// store directly.
+	Txn(ctx context.Context, keys []string, fn func(tx *Tx) error) error
+}
+
+// ScanStore is a Store that pages through keys, for keyspaces too large to
+// list with Keys. Patterns are the same globs Keys takes.
+type ScanStore interface {
+	Store
+
+	// Scan returns keys matching pattern from cursor on, "" being the
+	// start, and the cursor of the next page, "" after the last one. Pages
+	// hold about limit keys (DefaultScanLimit when limit is not positive).
+	Scan(ctx context.Context, pattern, cursor string, limit int) ([]string, string, error)
+
+	// Count returns how many keys match pattern.
+	Count(ctx context.Context, pattern string) (int64, error)
+}
+
+// WatchStore is a Store that streams changes to its keys, for caches and
+// coordination that react to writes instead of polling.
+type WatchStore interface {
+	Store
+
+	// Watch streams the changes to keys starting with prefix, from the
+	// call on, until ctx is done; the channel is then closed. Events come
+	// in the order the changes happened. Expire events may come late, when
+	// the backend notices the expiry.
+	Watch(ctx context.Context, prefix string) (<-chan Event, error)
+}
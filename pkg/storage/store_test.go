@@ -0,0 +1,497 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testAtomicStore is the conformance suite every AtomicStore must pass.
+// newStore returns an empty store for each subtest.
+func testAtomicStore(t *testing.T, newStore func(t *testing.T) AtomicStore) {
+	ctx := context.Background()
+
+	t.Run("Versions", func(t *testing.T) {
+		s := newStore(t)
+
+		if _, _, err := s.GetVersion(ctx, "k"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+
+		s.Set(ctx, "k", []byte("a"), 0)
+		value, v1, err := s.GetVersion(ctx, "k")
+		if err != nil || string(value) != "a" || v1 <= 0 {
+			t.Fatalf("unexpected version %q %d (%v)", value, v1, err)
+		}
+
+		s.Set(ctx, "k", []byte("a"), 0)
+		_, v2, _ := s.GetVersion(ctx, "k")
+		if v2 <= v1 {
+			t.Errorf("expected a write to increase the version, got %d then %d", v1, v2)
+		}
+
+		s.Delete(ctx, "k")
+		s.Set(ctx, "k", []byte("a"), 0)
+		_, v3, _ := s.GetVersion(ctx, "k")
+		if v3 <= v2 {
+			t.Errorf("expected a recreated key to get a new version, got %d then %d", v2, v3)
+		}
+	})
+
+	t.Run("CompareAndSwap", func(t *testing.T) {
+		s := newStore(t)
+
+		v1, err := s.CompareAndSwap(ctx, "k", []byte("a"), 0, 0)
+		if err != nil {
+			t.Fatalf("unexpected error creating the key: %v", err)
+		}
+		if _, err := s.CompareAndSwap(ctx, "k", []byte("b"), 0, 0); !errors.Is(err, ErrConflict) {
+			t.Errorf("expected ErrConflict creating an existing key, got %v", err)
+		}
+
+		v2, err := s.CompareAndSwap(ctx, "k", []byte("b"), v1, 0)
+		if err != nil || v2 <= v1 {
+			t.Fatalf("unexpected swap %d (%v)", v2, err)
+		}
+		if _, err := s.CompareAndSwap(ctx, "k", []byte("c"), v1, 0); !errors.Is(err, ErrConflict) {
+			t.Errorf("expected ErrConflict for a stale version, got %v", err)
+		}
+		if value, _ := s.Get(ctx, "k"); string(value) != "b" {
+			t.Errorf("expected b, got %q", value)
+		}
+
+		if _, err := s.CompareAndSwap(ctx, "short", []byte("x"), 0, 50*time.Millisecond); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if _, err := s.CompareAndSwap(ctx, "short", []byte("y"), 0, 0); err != nil {
+			t.Errorf("expected an expired key to count as missing, got %v", err)
+		}
+	})
+
+	t.Run("SetNX", func(t *testing.T) {
+		s := newStore(t)
+
+		if ok, err := s.SetNX(ctx, "lock", []byte("a"), 50*time.Millisecond); !ok || err != nil {
+			t.Fatalf("expected the first SetNX to succeed, got %v (%v)", ok, err)
+		}
+		if ok, _ := s.SetNX(ctx, "lock", []byte("b"), 0); ok {
+			t.Error("expected SetNX on an existing key to fail")
+		}
+		if value, _ := s.Get(ctx, "lock"); string(value) != "a" {
+			t.Errorf("expected a, got %q", value)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		if ok, _ := s.SetNX(ctx, "lock", []byte("c"), 0); !ok {
+			t.Error("expected SetNX on an expired key to succeed")
+		}
+	})
+
+	t.Run("Incr", func(t *testing.T) {
+		s := newStore(t)
+
+		if n, err := s.Incr(ctx, "n", 5, 0); n != 5 || err != nil {
+			t.Fatalf("expected 5, got %d (%v)", n, err)
+		}
+		if n, _ := s.Incr(ctx, "n", -2, 0); n != 3 {
+			t.Errorf("expected 3, got %d", n)
+		}
+		if value, _ := s.Get(ctx, "n"); string(value) != "3" {
+			t.Errorf("expected the decimal value 3, got %q", value)
+		}
+
+		// The TTL is set when the counter is created, not on every increment
+		s.Incr(ctx, "window", 1, 150*time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+		if n, _ := s.Incr(ctx, "window", 1, 150*time.Millisecond); n != 2 {
+			t.Errorf("expected 2, got %d", n)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if s.Exists(ctx, "window") {
+			t.Error("expected the counter to expire with its first TTL")
+		}
+
+		s.Set(ctx, "text", []byte("abc"), 0)
+		if _, err := s.Incr(ctx, "text", 1, 0); !errors.Is(err, ErrNotInteger) {
+			t.Errorf("expected ErrNotInteger, got %v", err)
+		}
+	})
+
+	t.Run("MGetMSet", func(t *testing.T) {
+		s := newStore(t)
+
+		err := s.MSet(ctx, map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")}, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.MSet(ctx, map[string][]byte{"short": []byte("x")}, 50*time.Millisecond)
+
+		values, err := s.MGet(ctx, "a", "c", "missing")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(values) != 2 || string(values["a"]) != "1" || string(values["c"]) != "3" {
+			t.Errorf("unexpected values %q", values)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		if values, _ := s.MGet(ctx, "short"); len(values) != 0 {
+			t.Errorf("expected expired keys to be left out, got %q", values)
+		}
+		if values, err := s.MGet(ctx); len(values) != 0 || err != nil {
+			t.Errorf("unexpected result for no keys %q (%v)", values, err)
+		}
+	})
+
+	t.Run("Txn", func(t *testing.T) {
+		s := newStore(t)
+		s.Set(ctx, "from", []byte("10"), 0)
+		s.Set(ctx, "old", []byte("x"), 0)
+
+		err := s.Txn(ctx, []string{"from", "to"}, func(tx *Tx) error {
+			from, err := tx.Get("from")
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Get("to"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected a missing key to be ErrNotFound, got %v", err)
+			}
+			if _, err := tx.Get("other"); !errors.Is(err, ErrNotInTx) {
+				t.Errorf("expected ErrNotInTx, got %v", err)
+			}
+
+			n, _ := strconv.Atoi(string(from))
+			tx.Set("from", []byte(strconv.Itoa(n-4)), 0)
+			tx.Set("to", []byte("4"), 0)
+			tx.Delete("old")
+
+			if value, _ := tx.Get("to"); string(value) != "4" {
+				t.Errorf("expected the transaction to read its own write, got %q", value)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		values, _ := s.MGet(ctx, "from", "to", "old")
+		if string(values["from"]) != "6" || string(values["to"]) != "4" || len(values) != 2 {
+			t.Errorf("unexpected values after commit %q", values)
+		}
+
+		abort := errors.New("abort")
+		err = s.Txn(ctx, []string{"from"}, func(tx *Tx) error {
+			tx.Set("from", []byte("0"), 0)
+			return abort
+		})
+		if !errors.Is(err, abort) {
+			t.Errorf("expected the function's error, got %v", err)
+		}
+		if value, _ := s.Get(ctx, "from"); string(value) != "6" {
+			t.Errorf("expected an aborted transaction to write nothing, got %q", value)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		s := newStore(t)
+		const workers, rounds = 8, 10
+
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Go(func() {
+				for range rounds {
+					if _, err := s.Incr(ctx, "incr", 1, 0); err != nil {
+						t.Errorf("incr: %v", err)
+					}
+
+					// Read-modify-write with compare-and-swap
+					for {
+						value, version, err := s.GetVersion(ctx, "cas")
+						if errors.Is(err, ErrNotFound) {
+							value, version = []byte("0"), 0
+						} else if err != nil {
+							t.Errorf("get version: %v", err)
+							return
+						}
+						n, _ := strconv.Atoi(string(value))
+						_, err = s.CompareAndSwap(ctx, "cas", []byte(strconv.Itoa(n+1)), version, 0)
+						if err == nil {
+							break
+						}
+						if !errors.Is(err, ErrConflict) {
+							t.Errorf("compare and swap: %v", err)
+							return
+						}
+					}
+
+					err := s.Txn(ctx, []string{"txn"}, func(tx *Tx) error {
+						value, err := tx.Get("txn")
+						if errors.Is(err, ErrNotFound) {
+							value = []byte("0")
+						}
+						n, _ := strconv.Atoi(string(value))
+						tx.Set("txn", []byte(strconv.Itoa(n+1)), 0)
+						return nil
+					})
+					if err != nil {
+						t.Errorf("txn: %v", err)
+					}
+				}
+			})
+		}
+		wg.Wait()
+
+		want := strconv.Itoa(workers * rounds)
+		values, _ := s.MGet(ctx, "incr", "cas", "txn")
+		for _, k := range []string{"incr", "cas", "txn"} {
+			if string(values[k]) != want {
+				t.Errorf("%s: expected %s, got %q", k, want, values[k])
+			}
+		}
+	})
+}
+
+// testScanStore is the conformance suite every ScanStore must pass.
+// newStore returns an empty store for each subtest.
+func testScanStore(t *testing.T, newStore func(t *testing.T) ScanStore) {
+	ctx := context.Background()
+
+	t.Run("Scan", func(t *testing.T) {
+		s := newStore(t)
+		for i := range 250 {
+			s.Set(ctx, fmt.Sprintf("session:%03d", i), []byte("x"), 0)
+		}
+		s.Set(ctx, "session:nested/key", []byte("x"), 0)
+		s.Set(ctx, "session:expired", []byte("x"), time.Millisecond)
+		s.Set(ctx, "sessions", []byte("x"), 0)
+		s.Set(ctx, "user:1", []byte("x"), 0)
+		time.Sleep(10 * time.Millisecond)
+
+		seen := make(map[string]bool)
+		pages := 0
+		cursor := ""
+		for {
+			keys, next, err := s.Scan(ctx, "session:*", cursor, 100)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			pages++
+			for _, k := range keys {
+				seen[k] = true
+			}
+			if next == "" {
+				break
+			}
+			if pages > 100 {
+				t.Fatal("scan did not finish")
+			}
+			cursor = next
+		}
+
+		if len(seen) != 250 || pages < 2 {
+			t.Errorf("expected 250 keys over several pages, got %d in %d", len(seen), pages)
+		}
+		if !seen["session:000"] || !seen["session:249"] {
+			t.Error("expected the first and last keys")
+		}
+
+		n := 0
+		for k, err := range ScanKeys(ctx, s, "session:00?", 3) {
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if k < "session:000" || k > "session:009" {
+				t.Errorf("unexpected key %s", k)
+			}
+			n++
+		}
+		if n < 10 {
+			t.Errorf("expected 10 keys from the iterator, got %d", n)
+		}
+
+		keys, next, err := s.Scan(ctx, "user:[0-9]", "", 0)
+		if err != nil || len(keys) != 1 || next != "" {
+			t.Errorf("unexpected single page %v %q (%v)", keys, next, err)
+		}
+	})
+
+	t.Run("Count", func(t *testing.T) {
+		s := newStore(t)
+		for i := range 30 {
+			s.Set(ctx, fmt.Sprintf("job:%02d", i), []byte("x"), 0)
+		}
+		s.Set(ctx, "job:nested/key", []byte("x"), 0)
+		s.Set(ctx, "job:expired", []byte("x"), time.Millisecond)
+		s.Set(ctx, "other", []byte("x"), 0)
+		time.Sleep(10 * time.Millisecond)
+
+		tests := []struct {
+			pattern string
+			want    int64
+		}{
+			{"job:*", 30},
+			{"job:1?", 10},
+			{"job:0[0-4]", 5},
+			{"job:*/*", 1},
+			{"*", 31},
+			{"other", 1},
+			{"missing:*", 0},
+		}
+		for _, tt := range tests {
+			n, err := s.Count(ctx, tt.pattern)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != tt.want {
+				t.Errorf("Count(%q): expected %d, got %d", tt.pattern, tt.want, n)
+			}
+		}
+	})
+}
+
+// testWatchStore is the conformance suite every WatchStore must pass.
+// newStore returns an empty store for each subtest, which notices expired
+// keys within a second.
+func testWatchStore(t *testing.T, newStore func(t *testing.T) WatchStore) {
+	ctx := context.Background()
+
+	t.Run("Order", func(t *testing.T) {
+		s := newStore(t)
+		s.Set(ctx, "w:before", []byte("x"), 0)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		events, err := s.Watch(ctx, "w:")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		s.Set(ctx, "w:a", []byte("1"), 0)
+		s.Set(ctx, "other", []byte("x"), 0)
+		s.Set(ctx, "w:b", []byte("2"), time.Hour)
+		s.Delete(ctx, "w:a")
+		s.Delete(ctx, "w:missing")
+		s.Set(ctx, "w:b", []byte("3"), 0)
+
+		want := []Event{
+			{Type: EventSet, Key: "w:a"},
+			{Type: EventSet, Key: "w:b"},
+			{Type: EventDelete, Key: "w:a"},
+			{Type: EventSet, Key: "w:b"},
+		}
+
+		// Atomic operations are changes too
+		if as, ok := s.(AtomicStore); ok {
+			as.Incr(ctx, "w:n", 1, 0)
+			as.Txn(ctx, []string{"w:b"}, func(tx *Tx) error {
+				tx.Delete("w:b")
+				return nil
+			})
+			want = append(want, Event{Type: EventSet, Key: "w:n"}, Event{Type: EventDelete, Key: "w:b"})
+		}
+
+		for i, w := range want {
+			if got := nextEvent(t, events); got != w {
+				t.Fatalf("event %d: expected %+v, got %+v", i, w, got)
+			}
+		}
+	})
+
+	t.Run("Expire", func(t *testing.T) {
+		s := newStore(t)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		events, err := s.Watch(ctx, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		s.Set(ctx, "temp", []byte("x"), 20*time.Millisecond)
+		if got := nextEvent(t, events); got != (Event{Type: EventSet, Key: "temp"}) {
+			t.Fatalf("expected a set event, got %+v", got)
+		}
+		if got := nextEvent(t, events); got != (Event{Type: EventExpire, Key: "temp"}) {
+			t.Fatalf("expected an expire event, got %+v", got)
+		}
+	})
+
+	t.Run("ConcurrentWriters", func(t *testing.T) {
+		s := newStore(t)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		events, err := s.Watch(ctx, "c:")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		const writers, writes = 4, 25
+		var wg sync.WaitGroup
+		for g := range writers {
+			wg.Go(func() {
+				for i := range writes {
+					s.Set(ctx, fmt.Sprintf("c:%d:%02d", g, i), []byte("x"), 0)
+				}
+			})
+		}
+		wg.Wait()
+
+		// Each writer's changes arrive in the order it made them
+		next := make([]int, writers)
+		for range writers * writes {
+			var g, i int
+			e := nextEvent(t, events)
+			if _, err := fmt.Sscanf(e.Key, "c:%d:%d", &g, &i); err != nil || e.Type != EventSet {
+				t.Fatalf("unexpected event %+v", e)
+			}
+			if i != next[g] {
+				t.Fatalf("writer %d: expected write %d, got %d", g, next[g], i)
+			}
+			next[g]++
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		s := newStore(t)
+
+		ctx, cancel := context.WithCancel(ctx)
+		events, err := s.Watch(ctx, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cancel()
+
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case _, ok := <-events:
+				if !ok {
+					return
+				}
+			case <-timeout:
+				t.Fatal("expected the channel to close")
+			}
+		}
+	})
+}
+
+// nextEvent waits for the next event on a watch channel.
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("watch channel closed")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return Event{}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"strconv"
+	"time"
+)
+
+// maxTxnAttempts is how many times an optimistic transaction runs before
+// giving up with ErrConflict.
+const maxTxnAttempts = 16
+
+// Tx is a transaction run by AtomicStore.Txn. Reads see the transaction's
+// keys as they were when it started, and its own writes.
+type Tx struct {
+	keys   map[string]bool
+	values map[string][]byte
+	writes map[string]txWrite
+}
+
+// txWrite is a staged write; a nil value deletes the key.
+type txWrite struct {
+	value []byte
+	ttl   time.Duration
+}
+
+// newTx starts a transaction over keys, whose current values are values.
+func newTx(keys []string, values map[string][]byte) *Tx {
+	tx := &Tx{
+		keys:   make(map[string]bool, len(keys)),
+		values: values,
+		writes: make(map[string]txWrite),
+	}
+	for _, k := range keys {
+		tx.keys[k] = true
+	}
+	return tx
+}
+
+// Get retrieves a value by key. Only the keys the transaction was started
+// with, and keys it wrote, can be read.
+func (tx *Tx) Get(key string) ([]byte, error) {
+	if w, ok := tx.writes[key]; ok {
+		if w.value == nil {
+			return nil, ErrNotFound
+		}
+		return cloneBytes(w.value), nil
+	}
+	if !tx.keys[key] {
+		return nil, ErrNotInTx
+	}
+	v, ok := tx.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneBytes(v), nil
+}
+
+// Set stores a value when the transaction commits.
+func (tx *Tx) Set(key string, value []byte, ttl time.Duration) {
+	if value == nil {
+		value = []byte{}
+	}
+	tx.writes[key] = txWrite{value: cloneBytes(value), ttl: ttl}
+}
+
+// Delete removes a key when the transaction commits.
+func (tx *Tx) Delete(key string) {
+	tx.writes[key] = txWrite{}
+}
+
+// cloneBytes returns a copy of b.
+func cloneBytes(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
+// parseInt parses a counter value for Incr.
+func parseInt(value []byte) (int64, error) {
+	n, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+	return n, nil
+}
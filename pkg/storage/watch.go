@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// EventType is the kind of change to a key.
+type EventType string
+
+// Event types
+const (
+	EventSet    EventType = "set"
+	EventDelete EventType = "delete"
+	EventExpire EventType = "expire"
+)
+
+// Event is a change to a key.
+type Event struct {
+	Type EventType `json:"type"`
+	Key  string    `json:"key"`
+
+	// seq orders the event in its store's change stream
+	seq int64
+}
+
+// feed fans a store's events out to its watchers.
+type feed struct {
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+// watch adds a watcher of the keys starting with prefix. It receives the
+// events published with a sequence number above after.
+func (f *feed) watch(ctx context.Context, prefix string, after int64) *watcher {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.watchers == nil {
+		f.watchers = make(map[*watcher]struct{})
+	}
+	w := newWatcher(ctx, prefix, after, func(w *watcher) {
+		f.mu.Lock()
+		delete(f.watchers, w)
+		f.mu.Unlock()
+	})
+	f.watchers[w] = struct{}{}
+	return w
+}
+
+// publish queues events for every watcher, in order. It never blocks.
+func (f *feed) publish(events ...Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for w := range f.watchers {
+		w.push(events...)
+	}
+}
+
+// active reports whether anyone is watching.
+func (f *feed) active() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.watchers) > 0
+}
+
+// close stops every watcher.
+func (f *feed) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for w := range f.watchers {
+		w.stop()
+	}
+	f.watchers = nil
+}
+
+// watcher delivers events on a channel. Events wait in an unbounded queue,
+// so a slow reader delays only itself.
+type watcher struct {
+	prefix string
+	after  int64
+	ch     chan Event
+
+	mu      sync.Mutex
+	queue   []Event
+	wake    chan struct{}
+	done    chan struct{}
+	stopped bool
+}
+
+// newWatcher starts a watcher that runs until ctx is done or it is
+// stopped, then calls onStop and closes its channel.
+func newWatcher(ctx context.Context, prefix string, after int64, onStop func(*watcher)) *watcher {
+	w := &watcher{
+		prefix: prefix,
+		after:  after,
+		ch:     make(chan Event),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go w.run(ctx, onStop)
+	return w
+}
+
+// push queues the events for the watcher's keys.
+func (w *watcher) push(events ...Event) {
+	w.mu.Lock()
+	for _, e := range events {
+		if e.seq > w.after && strings.HasPrefix(e.Key, w.prefix) {
+			e.seq = 0
+			w.queue = append(w.queue, e)
+		}
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop ends the watcher.
+func (w *watcher) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.stopped {
+		w.stopped = true
+		close(w.done)
+	}
+}
+
+// run forwards queued events to the channel.
+func (w *watcher) run(ctx context.Context, onStop func(*watcher)) {
+	defer close(w.ch)
+	if onStop != nil {
+		defer onStop(w)
+	}
+
+	for {
+		w.mu.Lock()
+		batch := w.queue
+		w.queue = nil
+		w.mu.Unlock()
+
+		for _, e := range batch {
+			select {
+			case w.ch <- e:
+			case <-ctx.Done():
+				return
+			case <-w.done:
+				return
+			}
+		}
+
+		select {
+		case <-w.wake:
+		case <-ctx.Done():
+			return
+		case <-w.done:
+			return
+		}
+	}
+}
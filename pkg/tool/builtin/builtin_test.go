@@ -237,6 +237,172 @@ func TestFSTool_ReadOnly(t *testing.T) {
 	}
 }
 
+// runFS executes the FS tool with params.
+func runFS(tool *FSTool, params map[string]any) (string, error) {
+	data, _ := json.Marshal(params)
+	return tool.Execute(context.Background(), data)
+}
+
+func TestFSTool_Containment(t *testing.T) {
+	parent := t.TempDir()
+	allowed := filepath.Join(parent, "data")
+	evil := filepath.Join(parent, "data-evil")
+	os.MkdirAll(allowed, 0755)
+	os.MkdirAll(evil, 0755)
+	os.WriteFile(filepath.Join(evil, "secret.txt"), []byte("secret"), 0644)
+	os.WriteFile(filepath.Join(allowed, "ok.txt"), []byte("ok"), 0644)
+	os.Symlink(evil, filepath.Join(allowed, "link"))
+	os.Symlink(filepath.Join(evil, "secret.txt"), filepath.Join(allowed, "secret-link.txt"))
+
+	tool := NewFSTool(WithAllowedPaths(allowed))
+
+	for _, path := range []string{
+		filepath.Join(evil, "secret.txt"),
+		filepath.Join(allowed, "..", "data-evil", "secret.txt"),
+		filepath.Join(allowed, "link", "secret.txt"),
+		filepath.Join(allowed, "secret-link.txt"),
+	} {
+		if out, err := runFS(tool, map[string]any{"action": "read_file", "path": path}); err == nil {
+			t.Errorf("%s: expected error, got %q", path, out)
+		}
+	}
+
+	if _, err := runFS(tool, map[string]any{"action": "write_file", "path": filepath.Join(allowed, "link", "new.txt"), "content": "x"}); err == nil {
+		t.Error("expected write through symlink to fail")
+	}
+	if _, err := os.Stat(filepath.Join(evil, "new.txt")); err == nil {
+		t.Error("file written outside the allowed path")
+	}
+
+	if out, err := runFS(tool, map[string]any{"action": "read_file", "path": filepath.Join(allowed, "ok.txt")}); err != nil || out != "ok" {
+		t.Errorf("expected allowed read, got %q, %v", out, err)
+	}
+}
+
+func TestFSTool_Operations(t *testing.T) {
+	dir := t.TempDir()
+	tool := NewFSTool(WithAllowedPaths(dir))
+	file := filepath.Join(dir, "src", "main.go")
+
+	if _, err := runFS(tool, map[string]any{"action": "write_file", "path": file, "content": "package main\n\nfunc main() {\n}\n"}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, err := runFS(tool, map[string]any{"action": "append_file", "path": file, "content": "// end\n"}); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+
+	if out, _ := runFS(tool, map[string]any{"action": "read_file", "path": file, "start_line": 3, "end_line": 4}); out != "func main() {\n}\n" {
+		t.Errorf("unexpected line range %q", out)
+	}
+
+	diff := `--- a/src/main.go
++++ b/src/main.go
+@@ -3,2 +3,3 @@
+ func main() {
++	println("hi")
+ }
+`
+	if _, err := runFS(tool, map[string]any{"action": "patch", "path": file, "content": diff}); err != nil {
+		t.Fatalf("patch failed: %v", err)
+	}
+	want := "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n// end\n"
+	if data, _ := os.ReadFile(file); string(data) != want {
+		t.Errorf("unexpected patched file %q", data)
+	}
+
+	if out, _ := runFS(tool, map[string]any{"action": "find", "path": dir, "pattern": "**/*.go"}); out != file {
+		t.Errorf("unexpected find result %q", out)
+	}
+	if out, _ := runFS(tool, map[string]any{"action": "grep", "path": dir, "pattern": "println", "include": "*.go"}); out != file+":4:\tprintln(\"hi\")" {
+		t.Errorf("unexpected grep result %q", out)
+	}
+
+	out, _ := runFS(tool, map[string]any{"action": "hash", "path": file})
+	var hash struct {
+		Algorithm string `json:"algorithm"`
+		Hash      string `json:"hash"`
+	}
+	json.Unmarshal([]byte(out), &hash)
+	if hash.Algorithm != "sha256" || len(hash.Hash) != 64 {
+		t.Errorf("unexpected hash %s", out)
+	}
+
+	moved := filepath.Join(dir, "cmd", "main.go")
+	if _, err := runFS(tool, map[string]any{"action": "move", "path": file, "destination": moved}); err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	if _, err := os.Stat(moved); err != nil {
+		t.Errorf("expected moved file: %v", err)
+	}
+	if _, err := runFS(tool, map[string]any{"action": "move", "path": moved, "destination": "/tmp/escaped.go"}); err == nil {
+		t.Error("expected move outside the allowed path to fail")
+	}
+}
+
+func TestFSTool_ReadOnlyOperations(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	os.WriteFile(file, []byte("a\n"), 0644)
+
+	tool := NewFSTool(WithAllowedPaths(dir), WithReadOnly(), WithMaxFileSize(4))
+
+	for _, action := range []string{"append_file", "move", "patch", "delete_file", "mkdir"} {
+		if _, err := runFS(tool, map[string]any{"action": action, "path": file, "destination": file + ".bak", "content": "x"}); err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Errorf("%s: expected 'not allowed' error, got %v", action, err)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "big.txt"), []byte("too large"), 0644)
+	if _, err := runFS(tool, map[string]any{"action": "hash", "path": filepath.Join(dir, "big.txt")}); err == nil {
+		t.Error("expected hash of a large file to fail")
+	}
+	if out, _ := runFS(tool, map[string]any{"action": "grep", "path": dir, "pattern": "large"}); out != "No matches found" {
+		t.Errorf("expected large files to be skipped, got %q", out)
+	}
+}
+
+func TestApplyUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name, text, diff, want string
+	}{
+		{
+			name: "offset hunk",
+			text: "a\nb\nc\nd\n",
+			diff: "@@ -1,2 +1,2 @@\n c\n-d\n+D\n",
+			want: "a\nb\nc\nD\n",
+		},
+		{
+			name: "new file",
+			text: "",
+			diff: "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n",
+			want: "one\ntwo\n",
+		},
+		{
+			name: "removed line looks like a header",
+			text: "x\n-- y\nz\n",
+			diff: "@@ -1,3 +1,2 @@\n x\n--- y\n z\n",
+			want: "x\nz\n",
+		},
+		{
+			name: "no newline at end",
+			text: "a\nb\n",
+			diff: "@@ -2 +2 @@\n-b\n+c\n\\ No newline at end of file\n",
+			want: "a\nc",
+		},
+	}
+
+	for _, tt := range tests {
+		got, _, err := applyUnifiedDiff(tt.text, tt.diff)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v", tt.name, got, err)
+		}
+	}
+
+	if _, _, err := applyUnifiedDiff("a\n", "@@ -1 +1 @@\n-b\n+c\n"); err == nil {
+		t.Error("expected error for mismatched context")
+	}
+}
+
 func TestShellTool_AllowedCommand(t *testing.T) {
 	tool := NewShellTool(WithAllowedCommands("echo", "date"))
 
@@ -297,6 +463,72 @@ func TestShellTool_Timeout(t *testing.T) {
 	// The error should indicate timeout or signal
 }
 
+func TestShellTool_RejectsMetachars(t *testing.T) {
+	tool := NewShellTool(WithAllowedCommands("ls", "echo"))
+
+	for _, command := range []string{"ls; rm -rf /", "ls | sh", "echo $(id)", "echo `id`", "ls > out", "ls && id"} {
+		params, _ := json.Marshal(map[string]string{"command": command})
+		if _, err := tool.Execute(context.Background(), params); err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Errorf("%q: expected 'not allowed' error, got %v", command, err)
+		}
+	}
+
+	// Quoted metacharacters are passed literally, without a shell
+	params, _ := json.Marshal(map[string]string{"command": `echo "a; b" '$HOME'`})
+	result, err := tool.Execute(context.Background(), params)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var output struct {
+		Stdout string `json:"stdout"`
+	}
+	json.Unmarshal([]byte(result), &output)
+	if output.Stdout != "a; b $HOME\n" {
+		t.Errorf("unexpected output %q", output.Stdout)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		line string
+		argv []string
+	}{
+		{"ls -la", []string{"ls", "-la"}},
+		{"  grep  'two words'  file ", []string{"grep", "two words", "file"}},
+		{`echo "it's" ""`, []string{"echo", "it's", ""}},
+	}
+	for _, tt := range tests {
+		argv, err := ParseCommand(tt.line)
+		if err != nil || strings.Join(argv, "|") != strings.Join(tt.argv, "|") || len(argv) != len(tt.argv) {
+			t.Errorf("%q: got %q, %v", tt.line, argv, err)
+		}
+	}
+
+	for _, line := range []string{"", "echo 'open", "cat *.go", "ls\nid"} {
+		if _, err := ParseCommand(line); err == nil {
+			t.Errorf("%q: expected error", line)
+		}
+	}
+}
+
+func TestShellTool_MaxOutput(t *testing.T) {
+	tool := NewShellTool(WithMaxOutput(100), WithShellTimeout(5*time.Second))
+
+	params, _ := json.Marshal(map[string]string{"command": "yes"})
+	result, _ := tool.Execute(context.Background(), params)
+
+	var output struct {
+		Stdout    string `json:"stdout"`
+		Truncated bool   `json:"truncated"`
+		Error     string `json:"error"`
+	}
+	json.Unmarshal([]byte(result), &output)
+
+	if !output.Truncated || len(output.Stdout) != 100 || !strings.Contains(output.Error, "output limit") {
+		t.Errorf("expected truncated output, got %d bytes, %v, %q", len(output.Stdout), output.Truncated, output.Error)
+	}
+}
+
 func TestHTTPTool_Name(t *testing.T) {
 	tool := NewHTTPTool()
 	if tool.Name() != "http" {
@@ -0,0 +1,295 @@
+package builtin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Egress errors
+var (
+	ErrEgressDenied = errors.New("egress denied")
+)
+
+// DefaultMaxRedirects is how many redirects an egress policy follows.
+const DefaultMaxRedirects = 5
+
+// DefaultHTTPMethods are the methods an egress policy allows by default.
+var DefaultHTTPMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD"}
+
+// blockedPrefixes are address ranges that are not on the public internet,
+// in addition to the loopback, private, link-local, multicast and
+// unspecified ones the net/netip predicates cover.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, may embed private IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),  // documentation
+}
+
+// EgressPolicy decides which URLs the HTTP tools may reach.
+//
+// By default any public host may be reached with the DefaultHTTPMethods.
+// Hosts are checked on the parsed URL, and every address a host resolves
+// to is checked when connecting, so that private, loopback and link-local
+// addresses such as 169.254.169.254 stay out of reach. The connection
+// goes to the address that was checked, which defeats DNS rebinding.
+// Redirects are checked like the first request.
+type EgressPolicy struct {
+	allowedHosts []string
+	methods      []string
+	allowPrivate bool
+	maxRedirects int
+	headers      []hostHeaders
+	resolver     *net.Resolver
+}
+
+// hostHeaders are headers added to requests to matching hosts.
+type hostHeaders struct {
+	host    string
+	headers map[string]string
+}
+
+// EgressOption configures an EgressPolicy.
+type EgressOption func(*EgressPolicy)
+
+// NewEgressPolicy creates an egress policy.
+func NewEgressPolicy(opts ...EgressOption) *EgressPolicy {
+	p := &EgressPolicy{
+		methods:      DefaultHTTPMethods,
+		maxRedirects: DefaultMaxRedirects,
+		resolver:     net.DefaultResolver,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// WithAllowedHosts restricts requests to hosts. A host matches exactly,
+// unless it starts with "*.", which matches any subdomain:
+// "*.example.com" allows api.example.com but not example.com.
+func WithAllowedHosts(hosts ...string) EgressOption {
+	return func(p *EgressPolicy) {
+		for _, h := range hosts {
+			p.allowedHosts = append(p.allowedHosts, strings.ToLower(strings.TrimSuffix(h, ".")))
+		}
+	}
+}
+
+// WithAllowedMethods restricts the HTTP methods that may be used.
+func WithAllowedMethods(methods ...string) EgressOption {
+	return func(p *EgressPolicy) {
+		p.methods = nil
+		for _, m := range methods {
+			p.methods = append(p.methods, strings.ToUpper(m))
+		}
+	}
+}
+
+// WithPrivateNetworks allows private, loopback and link-local addresses.
+// Use it for tools meant to call internal services.
+func WithPrivateNetworks() EgressOption {
+	return func(p *EgressPolicy) {
+		p.allowPrivate = true
+	}
+}
+
+// WithMaxRedirects sets how many redirects are followed (0 follows none).
+func WithMaxRedirects(n int) EgressOption {
+	return func(p *EgressPolicy) {
+		p.maxRedirects = n
+	}
+}
+
+// WithHostHeaders adds headers, such as API credentials, to every request
+// to a host, matched like WithAllowedHosts. The headers are added as the
+// request is sent, so the model never sees them, and they are not carried
+// over to other hosts on redirect.
+func WithHostHeaders(host string, headers map[string]string) EgressOption {
+	return func(p *EgressPolicy) {
+		p.headers = append(p.headers, hostHeaders{host: strings.ToLower(host), headers: headers})
+	}
+}
+
+// WithResolver sets the DNS resolver used to check hosts.
+func WithResolver(r *net.Resolver) EgressOption {
+	return func(p *EgressPolicy) {
+		p.resolver = r
+	}
+}
+
+// Methods returns the allowed HTTP methods.
+func (p *EgressPolicy) Methods() []string {
+	return p.methods
+}
+
+// CheckMethod returns an error wrapping ErrEgressDenied if a method is not
+// allowed.
+func (p *EgressPolicy) CheckMethod(method string) error {
+	if !slices.Contains(p.methods, strings.ToUpper(method)) {
+		return fmt.Errorf("%w: method %s is not allowed", ErrEgressDenied, method)
+	}
+	return nil
+}
+
+// CheckURL returns an error wrapping ErrEgressDenied if a URL may not be
+// requested. Addresses are checked again when connecting.
+func (p *EgressPolicy) CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q is not allowed", ErrEgressDenied, u.Scheme)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: URLs with credentials are not allowed", ErrEgressDenied)
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" {
+		return fmt.Errorf("%w: URL has no host", ErrEgressDenied)
+	}
+
+	if len(p.allowedHosts) > 0 && !slices.ContainsFunc(p.allowedHosts, func(pattern string) bool {
+		return matchHost(pattern, host)
+	}) {
+		return fmt.Errorf("%w: host %s is not allowed", ErrEgressDenied, host)
+	}
+
+	if ip, err := netip.ParseAddr(host); err == nil && !p.addrAllowed(ip) {
+		return fmt.Errorf("%w: address %s is not public", ErrEgressDenied, ip)
+	}
+	return nil
+}
+
+// matchHost reports whether host matches an allowed host pattern.
+func matchHost(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// addrAllowed reports whether an address may be connected to.
+func (p *EgressPolicy) addrAllowed(ip netip.Addr) bool {
+	if p.allowPrivate {
+		return true
+	}
+
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Client returns an HTTP client that enforces the policy on every
+// connection and redirect, and adds the per-host headers.
+func (p *EgressPolicy) Client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+
+	transport := &http.Transport{
+		// A proxy would connect on our behalf, past the address checks
+		Proxy:                 nil,
+		DialContext:           p.dialContext(dialer),
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &egressTransport{policy: p, next: transport},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > p.maxRedirects {
+				return fmt.Errorf("%w: more than %d redirects", ErrEgressDenied, p.maxRedirects)
+			}
+			if err := p.CheckMethod(req.Method); err != nil {
+				return err
+			}
+			return p.CheckURL(req.URL)
+		},
+	}
+}
+
+// dialContext resolves the host, drops addresses the policy denies and
+// connects to the first allowed one that answers.
+func (p *EgressPolicy) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		var addrs []netip.Addr
+		if ip, err := netip.ParseAddr(host); err == nil {
+			addrs = []netip.Addr{ip}
+		} else {
+			addrs, err = p.resolver.LookupNetIP(ctx, "ip", host)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var lastErr error
+		for _, ip := range addrs {
+			if !p.addrAllowed(ip) {
+				lastErr = fmt.Errorf("%w: %s resolves to %s, which is not public", ErrEgressDenied, host, ip)
+				continue
+			}
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no addresses for %s", host)
+		}
+		return nil, lastErr
+	}
+}
+
+// egressTransport adds the per-host headers to each request it sends.
+type egressTransport struct {
+	policy *EgressPolicy
+	next   http.RoundTripper
+}
+
+func (t *egressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+
+	var headers map[string]string
+	for _, h := range t.policy.headers {
+		if matchHost(h.host, host) {
+			headers = h.headers
+			break
+		}
+	}
+	if len(headers) == 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,231 @@
+package builtin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Execution errors
+var (
+	ErrShellMetachar      = errors.New("shell metacharacters are not allowed")
+	ErrOutputLimit        = errors.New("output limit exceeded")
+	ErrSandboxUnsupported = errors.New("sandboxed execution is not supported on this platform")
+)
+
+// ExecCommand is a command for an Executor to run.
+type ExecCommand struct {
+	// Argv is the program and its arguments. It is not interpreted by a
+	// shell.
+	Argv []string
+
+	// Stdin is passed to the command's standard input.
+	Stdin string
+
+	// Dir is the working directory.
+	Dir string
+
+	// MaxOutput caps stdout plus stderr, in bytes. A command writing more
+	// is killed. Zero means no limit.
+	MaxOutput int64
+}
+
+// ExecResult is the outcome of a command.
+type ExecResult struct {
+	Stdout    string
+	Stderr    string
+	ExitCode  int
+	Truncated bool
+}
+
+// Executor runs commands for the shell tool.
+//
+// Run returns a result once the command has started, even if it then
+// fails. The error is set when the command could not start, was killed
+// because ctx ended, or exceeded its output limit.
+type Executor interface {
+	Run(ctx context.Context, cmd *ExecCommand) (*ExecResult, error)
+}
+
+// waitDelay is how long a killed command's output pipes may stay open, for
+// example held by a daemonized grandchild, before Wait gives up on them.
+const waitDelay = time.Second
+
+// HostExecutor runs commands directly on the host, with the environment of
+// the current process. Each command gets its own process group, which is
+// killed as a whole when the context ends.
+type HostExecutor struct{}
+
+// NewHostExecutor creates a host executor.
+func NewHostExecutor() *HostExecutor {
+	return &HostExecutor{}
+}
+
+// Run runs the command.
+func (e *HostExecutor) Run(ctx context.Context, c *ExecCommand) (*ExecResult, error) {
+	if len(c.Argv) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	return runCommand(ctx, c, func(ctx context.Context) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, c.Argv[0], c.Argv[1:]...)
+		cmd.Dir = c.Dir
+		setProcessGroup(cmd)
+		return cmd
+	})
+}
+
+// runCommand runs the command built by newCmd, capturing its output up to
+// c.MaxOutput.
+func runCommand(ctx context.Context, c *ExecCommand, newCmd func(context.Context) *exec.Cmd) (*ExecResult, error) {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := newCmd(runCtx)
+	cmd.WaitDelay = waitDelay
+	if c.Stdin != "" {
+		cmd.Stdin = strings.NewReader(c.Stdin)
+	}
+
+	out := &outputLimit{max: c.MaxOutput, exceeded: cancel}
+	stdout, stderr := &limitedWriter{limit: out}, &limitedWriter{limit: out}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	err := cmd.Wait()
+
+	result := &ExecResult{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: out.truncated(),
+	}
+
+	switch {
+	case result.Truncated:
+		result.ExitCode = -1
+		return result, fmt.Errorf("%w: %d bytes", ErrOutputLimit, c.MaxOutput)
+	case ctx.Err() != nil:
+		result.ExitCode = -1
+		return result, ctx.Err()
+	case err != nil:
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+			return result, nil
+		}
+		result.ExitCode = -1
+		return result, err
+	}
+	return result, nil
+}
+
+// outputLimit is the output budget shared by a command's stdout and stderr.
+type outputLimit struct {
+	mu       sync.Mutex
+	max      int64
+	written  int64
+	over     bool
+	exceeded func()
+}
+
+// take returns how many of n bytes fit in the budget.
+func (l *outputLimit) take(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.max <= 0 {
+		return n
+	}
+	room := max(l.max-l.written, 0)
+	if int64(n) > room {
+		if !l.over {
+			l.over = true
+			l.exceeded()
+		}
+		n = int(room)
+	}
+	l.written += int64(n)
+	return n
+}
+
+func (l *outputLimit) truncated() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.over
+}
+
+// limitedWriter buffers output within an outputLimit, dropping the rest.
+type limitedWriter struct {
+	buf   bytes.Buffer
+	limit *outputLimit
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p[:w.limit.take(len(p))])
+	return len(p), nil
+}
+
+func (w *limitedWriter) String() string {
+	return w.buf.String()
+}
+
+// shellMetachars are characters a shell would interpret.
+const shellMetachars = ";&|$`<>(){}[]*?~!#\\\n\r"
+
+// ParseCommand splits a command line into argv without a shell. Words are
+// separated by spaces; single or double quotes group a word and are passed
+// literally. Shell metacharacters outside quotes, such as ";", "|", "$" or
+// ">", are rejected with ErrShellMetachar.
+func ParseCommand(line string) ([]string, error) {
+	var argv []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				argv = append(argv, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case strings.ContainsRune(shellMetachars, r):
+			return nil, fmt.Errorf("%w: %q", ErrShellMetachar, r)
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command")
+	}
+	if inWord {
+		argv = append(argv, word.String())
+	}
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return argv, nil
+}
+
+// Verify HostExecutor implements Executor
+var _ Executor = (*HostExecutor)(nil)
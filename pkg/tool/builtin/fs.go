@@ -2,14 +2,27 @@ package builtin
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
 // FSTool provides file system operations.
+//
+// With allowed paths, every path must lie inside one of them, and files
+// are accessed through an os.Root opened on that directory, so neither
+// ".." nor symlinks can reach outside it.
 type FSTool struct {
 	allowedPaths []string
 	maxFileSize  int64
@@ -51,6 +64,15 @@ func NewFSTool(opts ...FSOption) *FSTool {
 	return t
 }
 
+// fsMaxResults caps the matches returned by find and grep.
+const fsMaxResults = 200
+
+// fsReadActions and fsWriteActions are the tool's operations.
+var (
+	fsReadActions  = []string{"read_file", "list_dir", "file_info", "find", "grep", "hash"}
+	fsWriteActions = []string{"write_file", "append_file", "move", "patch", "delete_file", "mkdir"}
+)
+
 // Name returns the tool name.
 func (t *FSTool) Name() string {
 	return "fs"
@@ -58,18 +80,18 @@ func (t *FSTool) Name() string {
 
 // Description returns the tool description.
 func (t *FSTool) Description() string {
-	desc := "File system operations: read_file, list_dir, file_info"
+	desc := "File system operations: " + strings.Join(fsReadActions, ", ")
 	if !t.readOnly {
-		desc += ", write_file, delete_file, mkdir"
+		desc += ", " + strings.Join(fsWriteActions, ", ")
 	}
 	return desc
 }
 
 // Schema returns the JSON Schema for the tool parameters.
 func (t *FSTool) Schema() json.RawMessage {
-	actions := []string{"read_file", "list_dir", "file_info"}
+	actions := fsReadActions
 	if !t.readOnly {
-		actions = append(actions, "write_file", "delete_file", "mkdir")
+		actions = append(append([]string{}, fsReadActions...), fsWriteActions...)
 	}
 
 	actionsJSON, _ := json.Marshal(actions)
@@ -84,11 +106,36 @@ func (t *FSTool) Schema() json.RawMessage {
 			},
 			"path": {
 				"type": "string",
-				"description": "File or directory path"
+				"description": "File or directory path; for find and grep, the directory to search"
 			},
 			"content": {
 				"type": "string",
-				"description": "Content for write_file"
+				"description": "Content for write_file and append_file, or a unified diff for patch"
+			},
+			"destination": {
+				"type": "string",
+				"description": "New path for move"
+			},
+			"pattern": {
+				"type": "string",
+				"description": "Glob for find (e.g. *.go or src/**/*_test.go), regular expression for grep"
+			},
+			"include": {
+				"type": "string",
+				"description": "Glob of files to search with grep"
+			},
+			"start_line": {
+				"type": "integer",
+				"description": "First line to read with read_file, from 1"
+			},
+			"end_line": {
+				"type": "integer",
+				"description": "Last line to read with read_file (default: end of file)"
+			},
+			"algorithm": {
+				"type": "string",
+				"enum": ["sha256", "sha512", "sha1", "md5"],
+				"description": "Hash algorithm (default: sha256)"
 			}
 		},
 		"required": ["action", "path"]
@@ -97,9 +144,15 @@ func (t *FSTool) Schema() json.RawMessage {
 
 // fsParams are the parameters for the FS tool.
 type fsParams struct {
-	Action  string `json:"action"`
-	Path    string `json:"path"`
-	Content string `json:"content,omitempty"`
+	Action      string `json:"action"`
+	Path        string `json:"path"`
+	Content     string `json:"content,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Pattern     string `json:"pattern,omitempty"`
+	Include     string `json:"include,omitempty"`
+	StartLine   int    `json:"start_line,omitempty"`
+	EndLine     int    `json:"end_line,omitempty"`
+	Algorithm   string `json:"algorithm,omitempty"`
 }
 
 // Execute runs the FS tool.
@@ -109,108 +162,335 @@ func (t *FSTool) Execute(ctx context.Context, params json.RawMessage) (string, e
 		return "", fmt.Errorf("invalid parameters: %w", err)
 	}
 
-	// Validate path
-	absPath, err := filepath.Abs(p.Path)
-	if err != nil {
-		return "", fmt.Errorf("invalid path: %w", err)
+	isWrite := false
+	for _, a := range fsWriteActions {
+		isWrite = isWrite || a == p.Action
+	}
+	if isWrite && t.readOnly {
+		return "", fmt.Errorf("%s operations not allowed", strings.TrimSuffix(p.Action, "_file"))
 	}
 
-	if !t.isPathAllowed(absPath) {
-		return "", fmt.Errorf("path not allowed: %s", p.Path)
+	// Validate path
+	dir, err := t.open(p.Path)
+	if err != nil {
+		return "", err
 	}
+	defer dir.close()
 
 	switch p.Action {
 	case "read_file":
-		return t.readFile(absPath)
+		return t.readFile(dir, p.StartLine, p.EndLine)
 
 	case "write_file":
-		if t.readOnly {
-			return "", fmt.Errorf("write operations not allowed")
-		}
-		return t.writeFile(absPath, p.Content)
+		return t.writeFile(dir, p.Content)
+
+	case "append_file":
+		return t.appendFile(dir, p.Content)
 
 	case "list_dir":
-		return t.listDir(absPath)
+		return t.listDir(dir)
 
 	case "file_info":
-		return t.fileInfo(absPath)
+		return t.fileInfo(dir)
+
+	case "find":
+		return t.find(ctx, dir, p.Pattern)
+
+	case "grep":
+		return t.grep(ctx, dir, p.Pattern, p.Include)
+
+	case "hash":
+		return t.hash(dir, p.Algorithm)
+
+	case "move":
+		return t.move(dir, p.Destination)
+
+	case "patch":
+		return t.patch(dir, p.Content)
 
 	case "delete_file":
-		if t.readOnly {
-			return "", fmt.Errorf("delete operations not allowed")
-		}
-		return t.deleteFile(absPath)
+		return t.deleteFile(dir)
 
 	case "mkdir":
-		if t.readOnly {
-			return "", fmt.Errorf("mkdir operations not allowed")
-		}
-		return t.mkdir(absPath)
+		return t.mkdir(dir)
 
 	default:
 		return "", fmt.Errorf("unknown action: %s", p.Action)
 	}
 }
 
-// isPathAllowed checks if a path is within allowed directories.
-func (t *FSTool) isPathAllowed(absPath string) bool {
+// fsPath is a path that passed the tool's checks. Files under allowed
+// paths are accessed through root, with name relative to it; without
+// allowed paths, root is nil and name is absolute.
+type fsPath struct {
+	root *os.Root
+	base string
+	name string
+	abs  string
+}
+
+// open checks a path against the allowed paths and opens the root that
+// contains it.
+func (t *FSTool) open(path string) (*fsPath, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path: %w", err)
+	}
+
 	if len(t.allowedPaths) == 0 {
-		return true
+		return &fsPath{name: absPath, abs: absPath}, nil
+	}
+
+	base, rel, ok := t.containing(absPath)
+	if !ok {
+		return nil, fmt.Errorf("path not allowed: %s", path)
 	}
 
+	root, err := os.OpenRoot(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open allowed path: %w", err)
+	}
+	return &fsPath{root: root, base: base, name: rel, abs: absPath}, nil
+}
+
+// containing returns the allowed directory holding absPath, and absPath
+// relative to it. Allowed directories are also compared with their
+// symlinks resolved; the most specific match wins.
+func (t *FSTool) containing(absPath string) (base, rel string, ok bool) {
 	for _, allowed := range t.allowedPaths {
 		allowedAbs, err := filepath.Abs(allowed)
 		if err != nil {
 			continue
 		}
-		if strings.HasPrefix(absPath, allowedAbs) {
-			return true
+
+		candidates := []string{allowedAbs}
+		if resolved, err := filepath.EvalSymlinks(allowedAbs); err == nil && resolved != allowedAbs {
+			candidates = append(candidates, resolved)
+		}
+
+		for _, c := range candidates {
+			r, err := filepath.Rel(c, absPath)
+			if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+				continue
+			}
+			if !ok || len(c) > len(base) {
+				base, rel, ok = c, r, true
+			}
 		}
 	}
-	return false
+	return base, rel, ok
+}
+
+// sibling checks another path, which must be under the same root.
+func (t *FSTool) sibling(p *fsPath, path string) (*fsPath, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path: %w", err)
+	}
+
+	if p.root == nil {
+		return &fsPath{name: absPath, abs: absPath}, nil
+	}
+
+	base, rel, ok := t.containing(absPath)
+	if !ok {
+		return nil, fmt.Errorf("path not allowed: %s", path)
+	}
+	if base != p.base {
+		return nil, fmt.Errorf("cannot move between allowed paths: %s", path)
+	}
+	return &fsPath{root: p.root, base: base, name: rel, abs: absPath}, nil
+}
+
+func (p *fsPath) close() {
+	if p.root != nil {
+		p.root.Close()
+	}
+}
+
+func (p *fsPath) stat() (os.FileInfo, error) {
+	if p.root != nil {
+		return p.root.Stat(p.name)
+	}
+	return os.Stat(p.name)
+}
+
+func (p *fsPath) openFile(flag int, perm os.FileMode) (*os.File, error) {
+	if p.root != nil {
+		return p.root.OpenFile(p.name, flag, perm)
+	}
+	return os.OpenFile(p.name, flag, perm)
+}
+
+func (p *fsPath) mkdirAll(perm os.FileMode) error {
+	if p.root != nil {
+		return p.root.MkdirAll(p.name, perm)
+	}
+	return os.MkdirAll(p.name, perm)
+}
+
+func (p *fsPath) remove() error {
+	if p.root != nil {
+		return p.root.Remove(p.name)
+	}
+	return os.Remove(p.name)
+}
+
+func (p *fsPath) rename(to *fsPath) error {
+	if p.root != nil {
+		return p.root.Rename(p.name, to.name)
+	}
+	return os.Rename(p.name, to.name)
+}
+
+// fsys returns a file system rooted at p, for reading directories and
+// walking them, and a function to release it.
+func (p *fsPath) fsys() (fs.FS, func(), error) {
+	if p.root == nil {
+		return os.DirFS(p.name), func() {}, nil
+	}
+	sub, err := p.root.OpenRoot(p.name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sub.FS(), func() { sub.Close() }, nil
+}
+
+// parent returns the directory containing p.
+func (p *fsPath) parent() *fsPath {
+	return &fsPath{
+		root: p.root,
+		base: p.base,
+		name: filepath.Dir(p.name),
+		abs:  filepath.Dir(p.abs),
+	}
 }
 
-// readFile reads and returns the contents of a file.
-func (t *FSTool) readFile(path string) (string, error) {
-	info, err := os.Stat(path)
+// readAll reads a file no larger than the tool's maximum size.
+func (t *FSTool) readAll(p *fsPath) ([]byte, error) {
+	info, err := p.stat()
 	if err != nil {
-		return "", fmt.Errorf("file not found: %w", err)
+		return nil, fmt.Errorf("file not found: %w", err)
 	}
 
 	if info.Size() > t.maxFileSize {
-		return "", fmt.Errorf("file too large: %d bytes (max %d)", info.Size(), t.maxFileSize)
+		return nil, fmt.Errorf("file too large: %d bytes (max %d)", info.Size(), t.maxFileSize)
 	}
 
-	data, err := os.ReadFile(path)
+	f, err := p.openFile(os.O_RDONLY, 0)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %w", err)
+		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
+	defer f.Close()
 
-	return string(data), nil
+	data, err := io.ReadAll(io.LimitReader(f, t.maxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if int64(len(data)) > t.maxFileSize {
+		return nil, fmt.Errorf("file too large: more than %d bytes", t.maxFileSize)
+	}
+	return data, nil
+}
+
+// readFile reads and returns the contents of a file, or of the lines from
+// start to end (1-based, inclusive) when they are set.
+func (t *FSTool) readFile(p *fsPath, start, end int) (string, error) {
+	data, err := t.readAll(p)
+	if err != nil {
+		return "", err
+	}
+
+	if start <= 0 && end <= 0 {
+		return string(data), nil
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	start = max(start, 1)
+	if end <= 0 || end > len(lines) {
+		end = len(lines)
+	}
+	if start > end {
+		return "", fmt.Errorf("invalid line range %d-%d: file has %d lines", start, end, len(lines))
+	}
+
+	return strings.Join(lines[start-1:end], ""), nil
 }
 
 // writeFile writes content to a file.
-func (t *FSTool) writeFile(path, content string) (string, error) {
+func (t *FSTool) writeFile(p *fsPath, content string) (string, error) {
 	if int64(len(content)) > t.maxFileSize {
 		return "", fmt.Errorf("content too large: %d bytes (max %d)", len(content), t.maxFileSize)
 	}
 
 	// Create parent directories if needed
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := p.parent().mkdirAll(0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if err := t.write(p, []byte(content)); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Successfully wrote %d bytes to %s", len(content), p.abs), nil
+}
+
+// write replaces a file's contents, keeping its mode if it exists.
+func (t *FSTool) write(p *fsPath, data []byte) error {
+	f, err := p.openFile(os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// appendFile appends content to a file, creating it if needed.
+func (t *FSTool) appendFile(p *fsPath, content string) (string, error) {
+	var size int64
+	if info, err := p.stat(); err == nil {
+		size = info.Size()
+	}
+	if size+int64(len(content)) > t.maxFileSize {
+		return "", fmt.Errorf("file would be too large: %d bytes (max %d)", size+int64(len(content)), t.maxFileSize)
+	}
+
+	if err := p.parent().mkdirAll(0755); err != nil {
 		return "", fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
-		return "", fmt.Errorf("failed to write file: %w", err)
+	f, err := p.openFile(os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
 	}
+	defer f.Close()
 
-	return fmt.Sprintf("Successfully wrote %d bytes to %s", len(content), path), nil
+	if _, err := f.WriteString(content); err != nil {
+		return "", fmt.Errorf("failed to append to file: %w", err)
+	}
+
+	return fmt.Sprintf("Successfully appended %d bytes to %s", len(content), p.abs), nil
 }
 
 // listDir lists the contents of a directory.
-func (t *FSTool) listDir(path string) (string, error) {
-	entries, err := os.ReadDir(path)
+func (t *FSTool) listDir(p *fsPath) (string, error) {
+	fsys, release, err := p.fsys()
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory: %w", err)
+	}
+	defer release()
+
+	entries, err := fs.ReadDir(fsys, ".")
 	if err != nil {
 		return "", fmt.Errorf("failed to read directory: %w", err)
 	}
@@ -235,8 +515,8 @@ func (t *FSTool) listDir(path string) (string, error) {
 }
 
 // fileInfo returns information about a file or directory.
-func (t *FSTool) fileInfo(path string) (string, error) {
-	info, err := os.Stat(path)
+func (t *FSTool) fileInfo(p *fsPath) (string, error) {
+	info, err := p.stat()
 	if err != nil {
 		return "", fmt.Errorf("failed to get file info: %w", err)
 	}
@@ -253,18 +533,98 @@ func (t *FSTool) fileInfo(path string) (string, error) {
 	return string(output), nil
 }
 
+// hash returns a file's digest.
+func (t *FSTool) hash(p *fsPath, algorithm string) (string, error) {
+	var h hash.Hash
+	switch algorithm {
+	case "", "sha256":
+		algorithm, h = "sha256", sha256.New()
+	case "sha512":
+		h = sha512.New()
+	case "sha1":
+		h = sha1.New()
+	case "md5":
+		h = md5.New()
+	default:
+		return "", fmt.Errorf("unknown hash algorithm: %s", algorithm)
+	}
+
+	data, err := t.readAll(p)
+	if err != nil {
+		return "", err
+	}
+	h.Write(data)
+
+	result := map[string]any{
+		"path":      p.abs,
+		"algorithm": algorithm,
+		"hash":      hex.EncodeToString(h.Sum(nil)),
+		"size":      len(data),
+	}
+
+	output, _ := json.MarshalIndent(result, "", "  ")
+	return string(output), nil
+}
+
+// move renames a file or directory.
+func (t *FSTool) move(p *fsPath, destination string) (string, error) {
+	if destination == "" {
+		return "", fmt.Errorf("destination is required")
+	}
+
+	to, err := t.sibling(p, destination)
+	if err != nil {
+		return "", err
+	}
+
+	if err := to.parent().mkdirAll(0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := p.rename(to); err != nil {
+		return "", fmt.Errorf("failed to move: %w", err)
+	}
+
+	return fmt.Sprintf("Successfully moved %s to %s", p.abs, to.abs), nil
+}
+
+// patch applies a unified diff to a file. A diff from /dev/null creates
+// the file.
+func (t *FSTool) patch(p *fsPath, diff string) (string, error) {
+	data, err := t.readAll(p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	patched, hunks, err := applyUnifiedDiff(string(data), diff)
+	if err != nil {
+		return "", fmt.Errorf("failed to apply patch: %w", err)
+	}
+	if int64(len(patched)) > t.maxFileSize {
+		return "", fmt.Errorf("patched file too large: %d bytes (max %d)", len(patched), t.maxFileSize)
+	}
+
+	if err := p.parent().mkdirAll(0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := t.write(p, []byte(patched)); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Successfully applied %d hunks to %s", hunks, p.abs), nil
+}
+
 // deleteFile deletes a file.
-func (t *FSTool) deleteFile(path string) (string, error) {
-	if err := os.Remove(path); err != nil {
+func (t *FSTool) deleteFile(p *fsPath) (string, error) {
+	if err := p.remove(); err != nil {
 		return "", fmt.Errorf("failed to delete file: %w", err)
 	}
-	return fmt.Sprintf("Successfully deleted %s", path), nil
+	return fmt.Sprintf("Successfully deleted %s", p.abs), nil
 }
 
 // mkdir creates a directory.
-func (t *FSTool) mkdir(path string) (string, error) {
-	if err := os.MkdirAll(path, 0755); err != nil {
+func (t *FSTool) mkdir(p *fsPath) (string, error) {
+	if err := p.mkdirAll(0755); err != nil {
 		return "", fmt.Errorf("failed to create directory: %w", err)
 	}
-	return fmt.Sprintf("Successfully created directory %s", path), nil
+	return fmt.Sprintf("Successfully created directory %s", p.abs), nil
 }
@@ -0,0 +1,187 @@
+package builtin
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hunkHeader matches a unified diff hunk header, "@@ -1,3 +1,4 @@".
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// diffHunk is one hunk of a unified diff.
+type diffHunk struct {
+	oldStart int
+	old      []string // context and removed lines
+	new      []string // context and added lines
+
+	// oldNoEOL and newNoEOL are set by "\ No newline at end of file"
+	oldNoEOL bool
+	newNoEOL bool
+}
+
+// applyUnifiedDiff applies a single-file unified diff to text and returns
+// the result and the number of hunks applied. Hunks are located by their
+// context, so line numbers may be off; a hunk whose context is not found
+// fails the whole patch.
+func applyUnifiedDiff(text, diff string) (string, int, error) {
+	hunks, err := parseUnifiedDiff(diff)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(hunks) == 0 {
+		return "", 0, fmt.Errorf("no hunks in diff")
+	}
+
+	lines := strings.Split(text, "\n")
+	eol := strings.HasSuffix(text, "\n")
+	if eol || text == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	// Hunks apply in order; offset tracks how earlier hunks moved lines
+	var out []string
+	cursor, offset := 0, 0
+	for i, h := range hunks {
+		want := max(h.oldStart-1+offset, cursor)
+		if len(h.old) == 0 && h.oldStart > 0 {
+			// Pure insertion after line oldStart
+			want = max(h.oldStart+offset, cursor)
+		}
+
+		pos := findLines(lines, h.old, want, cursor)
+		if pos < 0 {
+			return "", 0, fmt.Errorf("hunk %d does not apply at line %d", i+1, h.oldStart)
+		}
+
+		out = append(out, lines[cursor:pos]...)
+		out = append(out, h.new...)
+		cursor = pos + len(h.old)
+		offset += len(h.new) - len(h.old)
+
+		if cursor == len(lines) {
+			switch {
+			case h.newNoEOL:
+				eol = false
+			case h.oldNoEOL || len(lines) == 0:
+				eol = true
+			}
+		}
+	}
+	out = append(out, lines[cursor:]...)
+
+	result := strings.Join(out, "\n")
+	if eol && len(out) > 0 {
+		result += "\n"
+	}
+	return result, len(hunks), nil
+}
+
+// findLines returns the position at or after min where block occurs in
+// lines, closest to want, or -1.
+func findLines(lines, block []string, want, min int) int {
+	matches := func(pos int) bool {
+		if pos < min || pos+len(block) > len(lines) {
+			return false
+		}
+		for i, l := range block {
+			if lines[pos+i] != l {
+				return false
+			}
+		}
+		return true
+	}
+
+	for d := 0; want-d >= min || want+d <= len(lines); d++ {
+		if matches(want + d) {
+			return want + d
+		}
+		if d > 0 && matches(want-d) {
+			return want - d
+		}
+	}
+	return -1
+}
+
+// parseUnifiedDiff reads the hunks of a unified diff. File headers are
+// skipped; a diff touching several files is rejected.
+func parseUnifiedDiff(diff string) ([]*diffHunk, error) {
+	var hunks []*diffHunk
+	var h *diffHunk
+	var last byte
+	oldLeft, newLeft := 0, 0
+	files := 0
+
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		if h != nil && strings.HasPrefix(line, `\`) {
+			if last == '-' {
+				h.oldNoEOL = true
+			} else {
+				h.newNoEOL = true
+				if last == ' ' {
+					h.oldNoEOL = true
+				}
+			}
+			continue
+		}
+
+		if oldLeft == 0 && newLeft == 0 {
+			// Between hunks: a hunk header, or file headers such as
+			// "diff --git", "index", "---" and "+++"
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				start, _ := strconv.Atoi(m[1])
+				oldLeft, newLeft = hunkCount(m[2]), hunkCount(m[4])
+				h = &diffHunk{oldStart: start}
+				hunks = append(hunks, h)
+			} else if strings.HasPrefix(line, "--- ") {
+				files++
+				if files > 1 {
+					return nil, fmt.Errorf("diff changes more than one file")
+				}
+			}
+			continue
+		}
+
+		switch {
+		case line == "" || line[0] == ' ':
+			// Some editors strip the space of empty context lines
+			text := strings.TrimPrefix(line, " ")
+			h.old = append(h.old, text)
+			h.new = append(h.new, text)
+			oldLeft--
+			newLeft--
+			last = ' '
+		case line[0] == '-':
+			h.old = append(h.old, line[1:])
+			oldLeft--
+			last = '-'
+		case line[0] == '+':
+			h.new = append(h.new, line[1:])
+			newLeft--
+			last = '+'
+		default:
+			return nil, fmt.Errorf("invalid diff line: %q", line)
+		}
+
+		if oldLeft < 0 || newLeft < 0 {
+			return nil, fmt.Errorf("hunk %d is longer than its header says", len(hunks))
+		}
+	}
+
+	if oldLeft > 0 || newLeft > 0 {
+		return nil, fmt.Errorf("hunk %d is shorter than its header says", len(hunks))
+	}
+	return hunks, nil
+}
+
+// hunkCount parses a hunk header line count, which defaults to 1.
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,186 @@
+package builtin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// find lists the files and directories under p whose path matches a glob.
+func (t *FSTool) find(ctx context.Context, p *fsPath, pattern string) (string, error) {
+	if pattern == "" {
+		return "", fmt.Errorf("pattern is required")
+	}
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return "", fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	var matches []string
+	truncated, err := t.walk(ctx, p, func(rel string, d fs.DirEntry) bool {
+		if matchGlob(pattern, rel) {
+			matches = append(matches, filepath.Join(p.abs, filepath.FromSlash(rel)))
+		}
+		return len(matches) < fsMaxResults
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(matches) == 0 {
+		return "No files found", nil
+	}
+	return resultList(matches, truncated), nil
+}
+
+// grep searches the files under p, or the file p, for lines matching a
+// regular expression. Binary files and files over the size limit are
+// skipped.
+func (t *FSTool) grep(ctx context.Context, p *fsPath, pattern, include string) (string, error) {
+	if pattern == "" {
+		return "", fmt.Errorf("pattern is required")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	info, err := p.stat()
+	if err != nil {
+		return "", fmt.Errorf("file not found: %w", err)
+	}
+
+	var matches []string
+	search := func(file *fsPath) bool {
+		data, err := t.readAll(file)
+		if err != nil || bytes.IndexByte(data, 0) >= 0 {
+			return true
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, len(data)+1)
+		for n := 1; scanner.Scan(); n++ {
+			if re.Match(scanner.Bytes()) {
+				matches = append(matches, fmt.Sprintf("%s:%d:%s", file.abs, n, scanner.Text()))
+				if len(matches) >= fsMaxResults {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	truncated := false
+	if !info.IsDir() {
+		search(p)
+	} else {
+		truncated, err = t.walk(ctx, p, func(rel string, d fs.DirEntry) bool {
+			if d.IsDir() || !d.Type().IsRegular() {
+				return true
+			}
+			if include != "" && !matchGlob(include, rel) {
+				return true
+			}
+			return search(&fsPath{
+				root: p.root,
+				base: p.base,
+				name: filepath.Join(p.name, filepath.FromSlash(rel)),
+				abs:  filepath.Join(p.abs, filepath.FromSlash(rel)),
+			})
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if len(matches) == 0 {
+		return "No matches found", nil
+	}
+	return resultList(matches, truncated || len(matches) >= fsMaxResults), nil
+}
+
+// walk calls fn with the slash-separated path, relative to p, of every
+// entry below p until fn returns false, which reports the results as
+// truncated. .git directories are skipped.
+func (t *FSTool) walk(ctx context.Context, p *fsPath, fn func(rel string, d fs.DirEntry) bool) (truncated bool, err error) {
+	fsys, release, err := p.fsys()
+	if err != nil {
+		return false, fmt.Errorf("failed to read directory: %w", err)
+	}
+	defer release()
+
+	err = fs.WalkDir(fsys, ".", func(rel string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable entries
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if rel == "." {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return fs.SkipDir
+		}
+		if !fn(rel, d) {
+			truncated = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to walk directory: %w", err)
+	}
+	return truncated, nil
+}
+
+// matchGlob reports whether a slash-separated path matches a glob. "**"
+// matches any number of directories. A pattern without a slash is matched
+// against the base name only, like find -name.
+func matchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// resultList formats find and grep results, one per line.
+func resultList(results []string, truncated bool) string {
+	out := strings.Join(results, "\n")
+	if truncated {
+		out += fmt.Sprintf("\n(results truncated at %d)", fsMaxResults)
+	}
+	return out
+}
@@ -0,0 +1,340 @@
+package builtin
+
+import (
+	"context"
+	"html"
+	"strings"
+)
+
+// Parser limits. Elements nested deeper than maxHTMLDepth are kept, but
+// their content goes to the enclosing element, and parsing stops after
+// maxHTMLNodes nodes, so that hostile pages cannot make parsing or
+// rendering slow.
+const (
+	maxHTMLDepth = 100
+	maxHTMLNodes = 200000
+)
+
+// htmlNode is an element or text node of a parsed HTML document.
+type htmlNode struct {
+	tag      string // lowercased; empty for text
+	attrs    map[string]string
+	text     string
+	children []*htmlNode
+	parent   *htmlNode
+	depth    int
+}
+
+// voidElements have no content or end tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// rawTextElements hold text that is not parsed as markup.
+var rawTextElements = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true,
+	"noscript": true, "template": true, "svg": true,
+}
+
+// closesParagraph lists elements whose start tag ends an open <p>.
+var closesParagraph = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"div": true, "dl": true, "fieldset": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "main": true, "nav": true, "ol": true,
+	"p": true, "pre": true, "section": true, "table": true, "ul": true,
+}
+
+// parseHTML parses a document into a tree. It is lenient rather than
+// conforming: unknown end tags are ignored, unclosed elements are closed
+// at the end, and the usual implied ends of <p>, <li>, <dt>, <dd>, <tr>,
+// <td>, <th> and <option> are handled.
+func parseHTML(ctx context.Context, src string) (*htmlNode, error) {
+	root := &htmlNode{tag: "#document"}
+	cur := root
+	nodes := 0
+
+	appendText := func(s string) {
+		if s == "" {
+			return
+		}
+		nodes++
+		cur.children = append(cur.children, &htmlNode{text: html.UnescapeString(s), parent: cur, depth: cur.depth + 1})
+	}
+
+	// closeTo pops the open elements up to and including the innermost tag
+	// in tags, stopping at any tag in stop. It reports whether one was found.
+	closeTo := func(tags []string, stop ...string) bool {
+		for n := cur; n != root; n = n.parent {
+			for _, s := range stop {
+				if n.tag == s {
+					return false
+				}
+			}
+			for _, t := range tags {
+				if n.tag == t {
+					cur = n.parent
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for i, steps := 0, 0; i < len(src) && nodes < maxHTMLNodes; steps++ {
+		if steps%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		lt := strings.IndexByte(src[i:], '<')
+		if lt < 0 {
+			appendText(src[i:])
+			break
+		}
+		appendText(src[i : i+lt])
+		i += lt
+
+		rest := src[i:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest[4:], "-->")
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += 4 + end + 3
+			}
+			continue
+
+		case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end + 1
+			}
+			continue
+
+		case strings.HasPrefix(rest, "</"):
+			name, _ := tagName(rest[2:])
+			end := strings.IndexByte(rest, '>')
+			if name == "" || end < 0 {
+				appendText("<")
+				i++
+				continue
+			}
+			i += end + 1
+			closeTo([]string{name})
+			continue
+		}
+
+		name, n := tagName(rest[1:])
+		if name == "" {
+			appendText("<")
+			i++
+			continue
+		}
+
+		attrs, length, selfClosing := parseAttrs(rest[1+n:])
+		i += 1 + n + length
+
+		// Implied end tags
+		switch {
+		case closesParagraph[name]:
+			closeTo([]string{"p"}, "button", "table", "li", "td", "th")
+		case name == "li":
+			closeTo([]string{"p"}, "li", "ul", "ol")
+			closeTo([]string{"li"}, "ul", "ol")
+		case name == "dt" || name == "dd":
+			closeTo([]string{"dt", "dd"}, "dl")
+		case name == "tr":
+			closeTo([]string{"tr"}, "table", "tbody", "thead", "tfoot")
+		case name == "td" || name == "th":
+			closeTo([]string{"td", "th"}, "tr", "table")
+		case name == "option":
+			closeTo([]string{"option"}, "select")
+		}
+
+		node := &htmlNode{tag: name, attrs: attrs, parent: cur, depth: cur.depth + 1}
+		cur.children = append(cur.children, node)
+		nodes++
+
+		if voidElements[name] || selfClosing {
+			continue
+		}
+
+		if rawTextElements[name] {
+			end := indexFold(src[i:], "</"+name)
+			if end < 0 {
+				end = len(src) - i
+			}
+			text := src[i : i+end]
+			if name == "title" || name == "textarea" {
+				text = html.UnescapeString(text)
+			}
+			node.children = append(node.children, &htmlNode{text: text, parent: node, depth: node.depth + 1})
+			i += end
+			if gt := strings.IndexByte(src[i:], '>'); gt >= 0 {
+				i += gt + 1
+			} else {
+				i = len(src)
+			}
+			continue
+		}
+
+		if node.depth < maxHTMLDepth {
+			cur = node
+		}
+	}
+
+	return root, nil
+}
+
+// tagName reads a tag name at the start of s and returns it lowercased
+// with its length.
+func tagName(s string) (string, int) {
+	n := 0
+	for n < len(s) {
+		c := s[n]
+		if c == '>' || c == '/' || c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' {
+			break
+		}
+		n++
+	}
+	if n == 0 || !isLetter(s[0]) {
+		return "", 0
+	}
+	return strings.ToLower(s[:n]), n
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// parseAttrs reads attributes up to the end of a start tag. It returns
+// them, the number of bytes read including ">", and whether the tag ended
+// with "/>".
+func parseAttrs(s string) (map[string]string, int, bool) {
+	attrs := make(map[string]string)
+	i := 0
+	for i < len(s) {
+		for i < len(s) && strings.IndexByte(" \t\n\r\f", s[i]) >= 0 {
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+		if s[i] == '>' {
+			return attrs, i + 1, false
+		}
+		if strings.HasPrefix(s[i:], "/>") {
+			return attrs, i + 2, true
+		}
+		if s[i] == '/' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(s) && strings.IndexByte(" \t\n\r\f=>", s[i]) < 0 && !strings.HasPrefix(s[i:], "/>") {
+			i++
+		}
+		name := strings.ToLower(s[start:i])
+		for i < len(s) && strings.IndexByte(" \t\n\r\f", s[i]) >= 0 {
+			i++
+		}
+
+		value := ""
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && strings.IndexByte(" \t\n\r\f", s[i]) >= 0 {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				q := s[i]
+				end := strings.IndexByte(s[i+1:], q)
+				if end < 0 {
+					value, i = s[i+1:], len(s)
+				} else {
+					value, i = s[i+1:i+1+end], i+1+end+1
+				}
+			} else {
+				start := i
+				for i < len(s) && strings.IndexByte(" \t\n\r\f>", s[i]) < 0 {
+					i++
+				}
+				value = s[start:i]
+			}
+		}
+		if name != "" {
+			if _, dup := attrs[name]; !dup {
+				attrs[name] = html.UnescapeString(value)
+			}
+		}
+	}
+	return attrs, len(s), false
+}
+
+// indexFold is strings.Index ignoring ASCII case.
+func indexFold(s, substr string) int {
+	n := len(substr)
+	for i := 0; i+n <= len(s); i++ {
+		if strings.EqualFold(s[i:i+n], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// find returns the first element, in document order, for which match is
+// true.
+func (n *htmlNode) find(match func(*htmlNode) bool) *htmlNode {
+	for _, c := range n.children {
+		if c.tag == "" {
+			continue
+		}
+		if match(c) {
+			return c
+		}
+		if found := c.find(match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll returns every element for which match is true.
+func (n *htmlNode) findAll(match func(*htmlNode) bool) []*htmlNode {
+	var found []*htmlNode
+	for _, c := range n.children {
+		if c.tag == "" {
+			continue
+		}
+		if match(c) {
+			found = append(found, c)
+		}
+		found = append(found, c.findAll(match)...)
+	}
+	return found
+}
+
+// textContent returns the node's text with whitespace collapsed.
+func (n *htmlNode) textContent() string {
+	var sb strings.Builder
+	var walk func(*htmlNode)
+	walk = func(n *htmlNode) {
+		if n.tag == "" {
+			sb.WriteString(n.text)
+			sb.WriteByte(' ')
+			return
+		}
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
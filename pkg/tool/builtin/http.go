@@ -6,13 +6,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
 
-// HTTPTool makes HTTP requests.
+// HTTPTool makes HTTP requests under an EgressPolicy.
 type HTTPTool struct {
 	client          *http.Client
+	egress          *EgressPolicy
 	allowedDomains  []string
 	maxResponseSize int64
 	userAgent       string
@@ -21,20 +23,31 @@ type HTTPTool struct {
 // HTTPOption configures the HTTP tool.
 type HTTPOption func(*HTTPTool)
 
-// WithHTTPClient sets a custom HTTP client.
+// WithHTTPClient sets a custom HTTP client. URLs and methods are still
+// checked against the egress policy, but the address checks and per-host
+// headers need a client from EgressPolicy.Client.
 func WithHTTPClient(client *http.Client) HTTPOption {
 	return func(t *HTTPTool) {
 		t.client = client
 	}
 }
 
-// WithAllowedDomains restricts requests to specific domains.
+// WithAllowedDomains restricts requests to specific domains and their
+// subdomains, on top of the egress policy.
 func WithAllowedDomains(domains ...string) HTTPOption {
 	return func(t *HTTPTool) {
 		t.allowedDomains = domains
 	}
 }
 
+// WithEgressPolicy sets the egress policy (default: NewEgressPolicy, which
+// allows any public host).
+func WithEgressPolicy(p *EgressPolicy) HTTPOption {
+	return func(t *HTTPTool) {
+		t.egress = p
+	}
+}
+
 // WithMaxResponseSize limits the response body size.
 func WithMaxResponseSize(size int64) HTTPOption {
 	return func(t *HTTPTool) {
@@ -52,15 +65,40 @@ func WithUserAgent(ua string) HTTPOption {
 // NewHTTPTool creates a new HTTP tool.
 func NewHTTPTool(opts ...HTTPOption) *HTTPTool {
 	t := &HTTPTool{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
 		maxResponseSize: 1024 * 1024, // 1MB
 		userAgent:       "Lattice-Agent/1.0",
 	}
 	for _, opt := range opts {
 		opt(t)
 	}
+
+	if t.egress == nil {
+		t.egress = NewEgressPolicy()
+	}
+	if t.client == nil {
+		t.client = t.egress.Client(30 * time.Second)
+	}
+
+	// Redirects must pass the same checks as the first request
+	client := *t.client
+	next := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := t.egress.CheckMethod(req.Method); err != nil {
+			return err
+		}
+		if err := t.checkURL(req.URL); err != nil {
+			return err
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		return nil
+	}
+	t.client = &client
+
 	return t
 }
 
@@ -76,12 +114,14 @@ func (t *HTTPTool) Description() string {
 
 // Schema returns the JSON Schema for the tool parameters.
 func (t *HTTPTool) Schema() json.RawMessage {
-	return json.RawMessage(`{
+	methodsJSON, _ := json.Marshal(t.egress.Methods())
+
+	return json.RawMessage(fmt.Sprintf(`{
 		"type": "object",
 		"properties": {
 			"method": {
 				"type": "string",
-				"enum": ["GET", "POST", "PUT", "DELETE", "PATCH", "HEAD"],
+				"enum": %s,
 				"description": "HTTP method"
 			},
 			"url": {
@@ -99,7 +139,7 @@ func (t *HTTPTool) Schema() json.RawMessage {
 			}
 		},
 		"required": ["method", "url"]
-	}`)
+	}`, string(methodsJSON)))
 }
 
 // httpParams are the parameters for the HTTP tool.
@@ -117,18 +157,20 @@ func (t *HTTPTool) Execute(ctx context.Context, params json.RawMessage) (string,
 		return "", fmt.Errorf("invalid parameters: %w", err)
 	}
 
-	// Validate domain if restrictions are set
-	if len(t.allowedDomains) > 0 {
-		allowed := false
-		for _, domain := range t.allowedDomains {
-			if strings.Contains(p.URL, domain) {
-				allowed = true
-				break
-			}
-		}
-		if !allowed {
-			return "", fmt.Errorf("domain not allowed: %s", p.URL)
-		}
+	method := strings.ToUpper(p.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if err := t.egress.CheckMethod(method); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid url: %w", err)
+	}
+	if err := t.checkURL(u); err != nil {
+		return "", err
 	}
 
 	// Create request
@@ -137,7 +179,7 @@ func (t *HTTPTool) Execute(ctx context.Context, params json.RawMessage) (string,
 		body = strings.NewReader(p.Body)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, p.Method, p.URL, body)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -182,3 +224,22 @@ func (t *HTTPTool) Execute(ctx context.Context, params json.RawMessage) (string,
 	output, _ := json.MarshalIndent(result, "", "  ")
 	return string(output), nil
 }
+
+// checkURL checks a URL against the allowed domains and the egress policy.
+func (t *HTTPTool) checkURL(u *url.URL) error {
+	if len(t.allowedDomains) > 0 {
+		host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+		allowed := false
+		for _, domain := range t.allowedDomains {
+			domain = strings.ToLower(domain)
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%w: domain not allowed: %s", ErrEgressDenied, host)
+		}
+	}
+	return t.egress.CheckURL(u)
+}
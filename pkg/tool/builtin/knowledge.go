@@ -0,0 +1,172 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/storo/lattice/pkg/knowledge"
+)
+
+// DefaultKnowledgeLimit is how many passages search_knowledge returns.
+const DefaultKnowledgeLimit = 5
+
+// maxKnowledgeLimit caps the limit the model may ask for.
+const maxKnowledgeLimit = 20
+
+// KnowledgeTool searches a knowledge base for passages relevant to a
+// query, so that agents can answer from indexed documents.
+type KnowledgeTool struct {
+	kb          *knowledge.Base
+	description string
+	limit       int
+	minScore    float64
+	filter      knowledge.Filter
+}
+
+// KnowledgeOption configures the knowledge tool.
+type KnowledgeOption func(*KnowledgeTool)
+
+// WithKnowledgeDescription describes what the knowledge base holds, which
+// helps the model decide when to search it.
+func WithKnowledgeDescription(desc string) KnowledgeOption {
+	return func(t *KnowledgeTool) {
+		t.description = desc
+	}
+}
+
+// WithKnowledgeLimit sets how many passages are returned by default.
+func WithKnowledgeLimit(n int) KnowledgeOption {
+	return func(t *KnowledgeTool) {
+		t.limit = n
+	}
+}
+
+// WithKnowledgeMinScore drops passages less similar to the query than
+// score.
+func WithKnowledgeMinScore(score float64) KnowledgeOption {
+	return func(t *KnowledgeTool) {
+		t.minScore = score
+	}
+}
+
+// WithKnowledgeFilter restricts every search to matching metadata. The
+// model's own filters cannot override it.
+func WithKnowledgeFilter(filter knowledge.Filter) KnowledgeOption {
+	return func(t *KnowledgeTool) {
+		t.filter = filter
+	}
+}
+
+// NewKnowledgeTool creates a search tool for a knowledge base.
+func NewKnowledgeTool(kb *knowledge.Base, opts ...KnowledgeOption) *KnowledgeTool {
+	t := &KnowledgeTool{
+		kb:          kb,
+		description: "Search the knowledge base of internal documents for passages relevant to a question.",
+		limit:       DefaultKnowledgeLimit,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Name returns the tool name.
+func (t *KnowledgeTool) Name() string {
+	return "search_knowledge"
+}
+
+// Description returns the tool description.
+func (t *KnowledgeTool) Description() string {
+	return t.description + " Returns the best matching passages with their source; cite the source when answering."
+}
+
+// Schema returns the JSON Schema for the tool parameters.
+func (t *KnowledgeTool) Schema() json.RawMessage {
+	return json.RawMessage(fmt.Sprintf(`{
+		"type": "object",
+		"properties": {
+			"query": {
+				"type": "string",
+				"description": "What to search for, as a question or keywords"
+			},
+			"limit": {
+				"type": "integer",
+				"description": "Number of passages to return (default %d, max %d)"
+			},
+			"filter": {
+				"type": "object",
+				"description": "Only return passages whose metadata has these values",
+				"additionalProperties": {"type": "string"}
+			}
+		},
+		"required": ["query"]
+	}`, t.limit, maxKnowledgeLimit))
+}
+
+// knowledgeParams are the parameters for the knowledge tool.
+type knowledgeParams struct {
+	Query  string            `json:"query"`
+	Limit  int               `json:"limit,omitempty"`
+	Filter map[string]string `json:"filter,omitempty"`
+}
+
+// knowledgeResult is a passage returned by the knowledge tool.
+type knowledgeResult struct {
+	Source   string            `json:"source"`
+	Text     string            `json:"text"`
+	Score    float64           `json:"score"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Execute runs the knowledge tool.
+func (t *KnowledgeTool) Execute(ctx context.Context, params json.RawMessage) (string, error) {
+	var p knowledgeParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return "", fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	limit := t.limit
+	if p.Limit > 0 {
+		limit = min(p.Limit, maxKnowledgeLimit)
+	}
+
+	filter := knowledge.Filter(p.Filter)
+	if len(t.filter) > 0 {
+		filter = maps.Clone(filter)
+		if filter == nil {
+			filter = knowledge.Filter{}
+		}
+		maps.Copy(filter, t.filter)
+	}
+
+	results, err := t.kb.Search(ctx, p.Query, limit, filter)
+	if errors.Is(err, knowledge.ErrEmptyQuery) {
+		return "", fmt.Errorf("query is required")
+	}
+	if err != nil {
+		return "", fmt.Errorf("search failed: %w", err)
+	}
+
+	var out []knowledgeResult
+	for _, r := range results {
+		if r.Score < t.minScore {
+			continue
+		}
+		out = append(out, knowledgeResult{
+			Source:   r.DocumentID,
+			Text:     r.Text,
+			Score:    r.Score,
+			Metadata: r.Metadata,
+		})
+	}
+
+	if len(out) == 0 {
+		return "No matching passages found", nil
+	}
+
+	output, _ := json.MarshalIndent(out, "", "  ")
+	return string(output), nil
+}
@@ -0,0 +1,84 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/storo/lattice/pkg/knowledge"
+)
+
+func newTestKnowledgeBase(t *testing.T) *knowledge.Base {
+	kb := knowledge.New(knowledge.NewMemoryIndex(), knowledge.NewHashEmbedder(0))
+	err := kb.Add(context.Background(),
+		knowledge.Document{ID: "handbook/vacation.md", Text: "Employees get 25 vacation days per year.", Metadata: map[string]string{"team": "hr"}},
+		knowledge.Document{ID: "runbooks/deploy.md", Text: "Deploy by merging to main; the pipeline rolls out to production.", Metadata: map[string]string{"team": "eng"}},
+		knowledge.Document{ID: "runbooks/vacation-coverage.md", Text: "During vacation days, on-call coverage is arranged by the team lead.", Metadata: map[string]string{"team": "eng"}},
+	)
+	if err != nil {
+		t.Fatalf("failed to add documents: %v", err)
+	}
+	return kb
+}
+
+func TestKnowledgeTool_Search(t *testing.T) {
+	tool := NewKnowledgeTool(newTestKnowledgeBase(t))
+
+	if tool.Name() != "search_knowledge" {
+		t.Errorf("unexpected name %q", tool.Name())
+	}
+
+	params, _ := json.Marshal(map[string]any{"query": "how many vacation days", "limit": 2})
+	result, err := tool.Execute(context.Background(), params)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var passages []knowledgeResult
+	if err := json.Unmarshal([]byte(result), &passages); err != nil {
+		t.Fatalf("invalid result %q: %v", result, err)
+	}
+	if len(passages) != 2 || passages[0].Source != "handbook/vacation.md" {
+		t.Fatalf("unexpected passages: %+v", passages)
+	}
+	if !strings.Contains(passages[0].Text, "25 vacation days") {
+		t.Errorf("unexpected text %q", passages[0].Text)
+	}
+
+	// The model's filter narrows the search
+	params, _ = json.Marshal(map[string]any{"query": "vacation days", "filter": map[string]string{"team": "eng"}})
+	result, _ = tool.Execute(context.Background(), params)
+	json.Unmarshal([]byte(result), &passages)
+	for _, p := range passages {
+		if p.Metadata["team"] != "eng" {
+			t.Errorf("filter not applied: %+v", p)
+		}
+	}
+
+	params, _ = json.Marshal(map[string]any{"query": ""})
+	if _, err := tool.Execute(context.Background(), params); err == nil {
+		t.Error("expected error for empty query")
+	}
+}
+
+func TestKnowledgeTool_FixedFilter(t *testing.T) {
+	tool := NewKnowledgeTool(newTestKnowledgeBase(t), WithKnowledgeFilter(knowledge.Filter{"team": "hr"}))
+
+	// The fixed filter wins over the model's
+	params, _ := json.Marshal(map[string]any{"query": "deploy to production", "filter": map[string]string{"team": "eng"}})
+	result, err := tool.Execute(context.Background(), params)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(result, "runbooks/") {
+		t.Errorf("fixed filter bypassed: %s", result)
+	}
+
+	tool = NewKnowledgeTool(newTestKnowledgeBase(t), WithKnowledgeMinScore(0.99))
+	params, _ = json.Marshal(map[string]any{"query": "kubernetes"})
+	result, _ = tool.Execute(context.Background(), params)
+	if result != "No matching passages found" {
+		t.Errorf("expected no passages, got %s", result)
+	}
+}
@@ -30,14 +30,13 @@ func AllTools(opts AllToolsOptions) []core.Tool {
 	tools := []core.Tool{
 		NewTimeTool(),
 		NewHTTPTool(),
+		NewWebFetchTool(),
 		NewFSTool(),
 	}
 
 	// Add shell tool only if commands are specified
-	if len(opts.ShellCommands) > 0 {
-		tools = append(tools, NewShellTool(WithAllowedCommands(opts.ShellCommands...)))
-	} else if opts.AllowAllShellCommands {
-		tools = append(tools, NewShellTool())
+	if shell := opts.shellTool(); shell != nil {
+		tools = append(tools, shell)
 	}
 
 	return tools
@@ -58,8 +57,30 @@ type AllToolsOptions struct {
 	// FSReadOnly makes file system read-only.
 	FSReadOnly bool
 
-	// HTTPAllowedDomains restricts HTTP to these domains.
+	// HTTPAllowedDomains restricts HTTP and web fetch to these domains and
+	// their subdomains.
 	HTTPAllowedDomains []string
+
+	// ShellExecutor runs shell commands (default: on the host). Use a
+	// SandboxExecutor for untrusted environments.
+	ShellExecutor Executor
+}
+
+// shellTool returns the configured shell tool, or nil if shell access is
+// not enabled.
+func (opts AllToolsOptions) shellTool() *ShellTool {
+	var shellOpts []ShellOption
+	switch {
+	case len(opts.ShellCommands) > 0:
+		shellOpts = append(shellOpts, WithAllowedCommands(opts.ShellCommands...))
+	case !opts.AllowAllShellCommands:
+		return nil
+	}
+
+	if opts.ShellExecutor != nil {
+		shellOpts = append(shellOpts, WithExecutor(opts.ShellExecutor))
+	}
+	return NewShellTool(shellOpts...)
 }
 
 // CustomTools creates tools with custom configuration.
@@ -71,11 +92,21 @@ func CustomTools(opts AllToolsOptions) []core.Tool {
 
 	// HTTP tool
 	var httpOpts []HTTPOption
+	var fetchOpts []WebFetchOption
 	if len(opts.HTTPAllowedDomains) > 0 {
 		httpOpts = append(httpOpts, WithAllowedDomains(opts.HTTPAllowedDomains...))
+
+		var hosts []string
+		for _, d := range opts.HTTPAllowedDomains {
+			hosts = append(hosts, d, "*."+d)
+		}
+		fetchOpts = append(fetchOpts, WithFetchEgressPolicy(NewEgressPolicy(WithAllowedHosts(hosts...))))
 	}
 	tools = append(tools, NewHTTPTool(httpOpts...))
 
+	// Web fetch tool, limited to the same domains
+	tools = append(tools, NewWebFetchTool(fetchOpts...))
+
 	// FS tool
 	var fsOpts []FSOption
 	if len(opts.FSAllowedPaths) > 0 {
@@ -87,10 +118,8 @@ func CustomTools(opts AllToolsOptions) []core.Tool {
 	tools = append(tools, NewFSTool(fsOpts...))
 
 	// Shell tool (only if configured)
-	if len(opts.ShellCommands) > 0 {
-		tools = append(tools, NewShellTool(WithAllowedCommands(opts.ShellCommands...)))
-	} else if opts.AllowAllShellCommands {
-		tools = append(tools, NewShellTool())
+	if shell := opts.shellTool(); shell != nil {
+		tools = append(tools, shell)
 	}
 
 	return tools
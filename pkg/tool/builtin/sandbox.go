@@ -0,0 +1,139 @@
+package builtin
+
+import "time"
+
+// Sandbox defaults
+const (
+	DefaultSandboxCPU       = 10 * time.Second
+	DefaultSandboxMemory    = 512 * 1024 * 1024 // 512MB of address space
+	DefaultSandboxOpenFiles = 64
+	DefaultSandboxFileSize  = 10 * 1024 * 1024 // 10MB per written file
+	DefaultSandboxProcesses = 256
+	DefaultSandboxPath      = "/usr/local/bin:/usr/bin:/bin"
+)
+
+// SandboxExecutor runs commands with hardened process settings. It is only
+// supported on Linux; elsewhere Run returns ErrSandboxUnsupported.
+//
+// Every command gets:
+//   - its own process group, killed as a whole on timeout
+//   - resource limits on CPU time, memory, open files, written file size
+//     and processes
+//   - a scrubbed environment holding only PATH and HOME, plus WithSandboxEnv
+//
+// Optionally, WithSandboxRoot confines the command to a directory with
+// chroot, and WithoutNetwork runs it in a network namespace with no
+// interfaces but loopback. Both use a user namespace, so the kernel must
+// allow unprivileged ones (most distributions do). The command runs with
+// the caller's user ID and no capabilities, or as nobody (65534) when the
+// caller is root.
+//
+// Commands are started through a copy of the current binary, which
+// confines itself and then execs the command, so /proc must be mounted.
+type SandboxExecutor struct {
+	cpu       time.Duration
+	memory    uint64
+	openFiles uint64
+	fileSize  uint64
+	processes uint64
+	env       []string
+	root      string
+	noNetwork bool
+}
+
+// SandboxOption configures a SandboxExecutor.
+type SandboxOption func(*SandboxExecutor)
+
+// NewSandboxExecutor creates a sandboxed executor.
+func NewSandboxExecutor(opts ...SandboxOption) *SandboxExecutor {
+	e := &SandboxExecutor{
+		cpu:       DefaultSandboxCPU,
+		memory:    DefaultSandboxMemory,
+		openFiles: DefaultSandboxOpenFiles,
+		fileSize:  DefaultSandboxFileSize,
+		processes: DefaultSandboxProcesses,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// WithCPULimit sets the CPU time a command may use (0 disables the limit).
+func WithCPULimit(d time.Duration) SandboxOption {
+	return func(e *SandboxExecutor) {
+		e.cpu = d
+	}
+}
+
+// WithMemoryLimit sets the address space a command may use, in bytes (0
+// disables the limit).
+func WithMemoryLimit(bytes uint64) SandboxOption {
+	return func(e *SandboxExecutor) {
+		e.memory = bytes
+	}
+}
+
+// WithOpenFilesLimit sets how many files a command may have open (0
+// disables the limit).
+func WithOpenFilesLimit(n uint64) SandboxOption {
+	return func(e *SandboxExecutor) {
+		e.openFiles = n
+	}
+}
+
+// WithFileSizeLimit sets the largest file a command may write, in bytes.
+// Writing past it fails with EFBIG (0 disables the limit).
+func WithFileSizeLimit(bytes uint64) SandboxOption {
+	return func(e *SandboxExecutor) {
+		e.fileSize = bytes
+	}
+}
+
+// WithProcessLimit sets how many processes the command's user may have,
+// counting every process of that user, not only the command's (0 disables
+// the limit). It does not apply to root outside a namespace.
+func WithProcessLimit(n uint64) SandboxOption {
+	return func(e *SandboxExecutor) {
+		e.processes = n
+	}
+}
+
+// WithSandboxEnv adds "KEY=value" entries to the scrubbed environment.
+func WithSandboxEnv(env ...string) SandboxOption {
+	return func(e *SandboxExecutor) {
+		e.env = append(e.env, env...)
+	}
+}
+
+// WithSandboxRoot confines commands to dir with chroot. The directory must
+// hold the programs to run and what they need, such as /bin and /lib;
+// command working directories are relative to it. Mount it read-only
+// (for example as a read-only bind mount) to keep commands from changing
+// it.
+func WithSandboxRoot(dir string) SandboxOption {
+	return func(e *SandboxExecutor) {
+		e.root = dir
+	}
+}
+
+// WithoutNetwork runs commands in a new network namespace, cut off from
+// the host's network.
+func WithoutNetwork() SandboxOption {
+	return func(e *SandboxExecutor) {
+		e.noNetwork = true
+	}
+}
+
+// environ returns the scrubbed environment for a command in dir.
+func (e *SandboxExecutor) environ(dir string) []string {
+	home := dir
+	if home == "" {
+		home = "/"
+	}
+	env := []string{"PATH=" + DefaultSandboxPath, "HOME=" + home}
+	return append(env, e.env...)
+}
+
+// Verify SandboxExecutor implements Executor
+var _ Executor = (*SandboxExecutor)(nil)
@@ -0,0 +1,254 @@
+//go:build linux
+
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// sandboxEnv passes a sandboxSpec to the re-executed binary.
+const sandboxEnv = "LATTICE_SANDBOX_SPEC"
+
+// sandboxStatusFD is the pipe on which the re-executed binary reports
+// setup failures. It is closed on exec, so the parent reads nothing once
+// the command started.
+const sandboxStatusFD = 3
+
+// sandboxNobody is the user and group a command runs as in a namespace
+// created by root.
+const sandboxNobody = 65534
+
+// Linux constants missing from package syscall.
+const (
+	rlimitNproc          = 6
+	capSysChroot         = 18
+	prSetNoNewPrivs      = 38
+	prCapAmbient         = 47
+	prCapAmbientClearAll = 4
+)
+
+// sandboxSpec is what the re-executed binary sets up before it execs the
+// command.
+type sandboxSpec struct {
+	Path   string         `json:"path"`
+	Argv   []string       `json:"argv"`
+	Env    []string       `json:"env"`
+	Root   string         `json:"root,omitempty"`
+	Dir    string         `json:"dir,omitempty"`
+	Limits map[int]uint64 `json:"limits,omitempty"`
+	Nobody bool           `json:"nobody,omitempty"`
+}
+
+// Commands start as a copy of the current binary, which applies the
+// limits and root to itself and then execs the command. Setting them in
+// the child, before exec, leaves no window in which the command runs
+// unconfined.
+func init() {
+	if spec := os.Getenv(sandboxEnv); spec != "" {
+		sandboxInit(spec)
+	}
+}
+
+// sandboxInit confines the current process as described by spec and execs
+// the command. It does not return.
+func sandboxInit(data string) {
+	status := os.NewFile(sandboxStatusFD, "sandbox-status")
+	syscall.CloseOnExec(sandboxStatusFD)
+	fail := func(format string, args ...any) {
+		fmt.Fprintf(status, format, args...)
+		os.Exit(127)
+	}
+
+	// Capabilities and no_new_privs are per thread: set them on the one
+	// that execs
+	runtime.LockOSThread()
+
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(data), &spec); err != nil {
+		fail("invalid spec: %v", err)
+	}
+
+	if spec.Root != "" {
+		if err := syscall.Chroot(spec.Root); err != nil {
+			fail("chroot: %v", err)
+		}
+		if err := os.Chdir("/"); err != nil {
+			fail("chdir: %v", err)
+		}
+	}
+	if spec.Dir != "" {
+		if err := os.Chdir(spec.Dir); err != nil {
+			fail("chdir: %v", err)
+		}
+	}
+
+	for resource, value := range spec.Limits {
+		if err := syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value}); err != nil {
+			fail("setrlimit: %v", err)
+		}
+	}
+
+	// Drop what chroot needed. Leaving root clears every capability;
+	// otherwise the ambient CAP_SYS_CHROOT would survive the exec.
+	if spec.Nobody {
+		if err := syscall.Setgroups(nil); err != nil {
+			fail("setgroups: %v", err)
+		}
+		if err := syscall.Setgid(sandboxNobody); err != nil {
+			fail("setgid: %v", err)
+		}
+		if err := syscall.Setuid(sandboxNobody); err != nil {
+			fail("setuid: %v", err)
+		}
+	}
+	if err := prctl(prCapAmbient, prCapAmbientClearAll); err != nil {
+		fail("clear ambient capabilities: %v", err)
+	}
+	if err := prctl(prSetNoNewPrivs, 1); err != nil {
+		fail("set no_new_privs: %v", err)
+	}
+
+	err := syscall.Exec(spec.Path, spec.Argv, spec.Env)
+	fail("exec %s: %v", spec.Path, err)
+}
+
+// prctl calls prctl(2) with two arguments.
+func prctl(option, arg uintptr) error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, option, arg, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Run runs the command in the sandbox.
+func (e *SandboxExecutor) Run(ctx context.Context, c *ExecCommand) (*ExecResult, error) {
+	if len(c.Argv) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	path, err := e.lookPath(c.Argv[0])
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := e.root != "" || e.noNetwork
+	asRoot := os.Getuid() == 0
+
+	spec, err := json.Marshal(sandboxSpec{
+		Path:   path,
+		Argv:   c.Argv,
+		Env:    e.environ(c.Dir),
+		Root:   e.root,
+		Dir:    c.Dir,
+		Limits: e.limits(),
+		Nobody: namespace && asRoot,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status, statusW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer status.Close()
+
+	newCmd := func(ctx context.Context) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, "/proc/self/exe")
+		cmd.Args = c.Argv
+		cmd.Env = []string{sandboxEnv + "=" + string(spec)}
+
+		setProcessGroup(cmd)
+		cmd.SysProcAttr.Pdeathsig = syscall.SIGKILL
+
+		if namespace {
+			cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWUSER
+			if e.noNetwork {
+				cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+			}
+			if asRoot {
+				// Map nobody too, to switch to it once confined, so the
+				// command is not root in the namespace
+				ids := []syscall.SysProcIDMap{{ContainerID: 0, HostID: 0, Size: 1}, {ContainerID: sandboxNobody, HostID: sandboxNobody, Size: 1}}
+				cmd.SysProcAttr.UidMappings = ids
+				cmd.SysProcAttr.GidMappings = ids
+				cmd.SysProcAttr.GidMappingsEnableSetgroups = true
+			} else {
+				// Keep our own IDs inside the namespace, so the command is
+				// not root there. Exec would drop the capability chroot
+				// needs, so keep it as ambient until the chroot is done.
+				cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+				cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+				if e.root != "" {
+					cmd.SysProcAttr.AmbientCaps = []uintptr{capSysChroot}
+				}
+			}
+		}
+		cmd.ExtraFiles = []*os.File{statusW}
+		return cmd
+	}
+
+	// Pdeathsig fires when the thread that started the command exits, not
+	// the process. Keep this goroutine on that thread until the command
+	// is done, so the runtime cannot retire the thread under it.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	result, err := runCommand(ctx, c, newCmd)
+
+	// The command has exited, so closing our end leaves the pipe with
+	// only what the sandbox wrote before exec
+	statusW.Close()
+	if msg, _ := io.ReadAll(status); len(msg) > 0 {
+		return nil, fmt.Errorf("sandbox: %s", msg)
+	}
+	return result, err
+}
+
+// limits returns the resource limits to set, by resource.
+func (e *SandboxExecutor) limits() map[int]uint64 {
+	limits := make(map[int]uint64)
+	if e.cpu > 0 {
+		// Whole seconds, rounded up
+		limits[syscall.RLIMIT_CPU] = uint64((e.cpu + 999999999) / 1000000000)
+	}
+	if e.memory > 0 {
+		limits[syscall.RLIMIT_AS] = e.memory
+	}
+	if e.openFiles > 0 {
+		limits[syscall.RLIMIT_NOFILE] = e.openFiles
+	}
+	if e.fileSize > 0 {
+		limits[syscall.RLIMIT_FSIZE] = e.fileSize
+	}
+	if e.processes > 0 {
+		limits[rlimitNproc] = e.processes
+	}
+	return limits
+}
+
+// lookPath finds a program in the sandbox's PATH, inside its root if set.
+// The returned path is as seen from inside the sandbox.
+func (e *SandboxExecutor) lookPath(name string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+
+	for _, dir := range filepath.SplitList(DefaultSandboxPath) {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(filepath.Join(e.root, path))
+		if err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0o111 != 0 {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("executable not found in sandbox: %s", name)
+}
@@ -0,0 +1,214 @@
+//go:build linux
+
+package builtin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// userNamespaces skips the test if unprivileged user namespaces are not
+// available.
+func userNamespaces(t *testing.T) {
+	t.Helper()
+	if err := exec.Command("unshare", "--user", "--net", "true").Run(); err != nil {
+		t.Skipf("user namespaces not available: %v", err)
+	}
+}
+
+func TestSandboxExecutor_Limits(t *testing.T) {
+	t.Setenv("LATTICE_TEST_SECRET", "leaked")
+	e := NewSandboxExecutor(WithOpenFilesLimit(32), WithFileSizeLimit(1024), WithProcessLimit(50), WithSandboxEnv("GREETING=hi"))
+
+	res, err := e.Run(context.Background(), &ExecCommand{
+		Argv: []string{"sh", "-c", "ulimit -n; ulimit -f; awk '/processes/ {print $3}' /proc/self/limits; echo $GREETING; echo ${LATTICE_TEST_SECRET:-none}"},
+		Dir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// ulimit -f counts 512-byte blocks
+	if want := "32\n2\n50\nhi\nnone\n"; res.Stdout != want {
+		t.Errorf("expected %q, got %q (stderr %q)", want, res.Stdout, res.Stderr)
+	}
+}
+
+func TestSandboxExecutor_KillsProcessGroup(t *testing.T) {
+	e := NewSandboxExecutor()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := e.Run(ctx, &ExecCommand{Argv: []string{"sh", "-c", "sleep 10; echo done"}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("command should have been killed")
+	}
+}
+
+func TestSandboxExecutor_WithoutNetwork(t *testing.T) {
+	userNamespaces(t)
+	e := NewSandboxExecutor(WithoutNetwork())
+
+	res, err := e.Run(context.Background(), &ExecCommand{Argv: []string{"cat", "/proc/net/dev"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Only the loopback interface is left
+	for _, line := range strings.Split(res.Stdout, "\n")[2:] {
+		if name, _, ok := strings.Cut(strings.TrimSpace(line), ":"); ok && name != "lo" {
+			t.Errorf("unexpected interface %s", name)
+		}
+	}
+}
+
+func TestSandboxExecutor_NotFound(t *testing.T) {
+	e := NewSandboxExecutor(WithSandboxRoot(t.TempDir()))
+
+	if _, err := e.Run(context.Background(), &ExecCommand{Argv: []string{"sh"}}); err == nil || !strings.Contains(err.Error(), "not found in sandbox") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+// sandboxHelperEnv makes TestSandboxHelperProcess report what a command in
+// the sandbox may do.
+const sandboxHelperEnv = "LATTICE_SANDBOX_HELPER"
+
+func TestSandboxHelperProcess(t *testing.T) {
+	if os.Getenv(sandboxHelperEnv) != "1" {
+		return
+	}
+	fmt.Printf("uid=%d chroot=%v\n", os.Getuid(), syscall.Chroot("/"))
+	os.Exit(0)
+}
+
+// sandboxRoot returns a root directory holding a copy of the test binary,
+// as /helper, and the libraries it loads.
+func sandboxRoot(t *testing.T) string {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	if err := os.Chmod(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	copyFile(t, exe, filepath.Join(root, "helper"))
+
+	// ldd fails on static binaries, which need nothing else
+	out, err := exec.Command("ldd", exe).Output()
+	if err != nil {
+		return root
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		for _, field := range strings.Fields(scanner.Text()) {
+			if strings.HasPrefix(field, "/") {
+				copyFile(t, field, filepath.Join(root, field))
+			}
+		}
+	}
+	return root
+}
+
+// copyFile copies an executable file, creating directories as needed.
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSandboxExecutor_Root(t *testing.T) {
+	userNamespaces(t)
+	if os.Getuid() == 0 {
+		t.Run("unprivileged", runUnprivileged)
+	}
+
+	// The Go runtime reserves more address space than the default limit
+	e := NewSandboxExecutor(WithSandboxRoot(sandboxRoot(t)), WithMemoryLimit(0), WithSandboxEnv(sandboxHelperEnv+"=1"))
+	res, err := e.Run(context.Background(), &ExecCommand{Argv: []string{"/helper", "-test.run=^TestSandboxHelperProcess$"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The command keeps our user ID, or is nobody under root, and cannot
+	// chroot again to escape
+	uid := os.Getuid()
+	if uid == 0 {
+		uid = sandboxNobody
+	}
+	if want := fmt.Sprintf("uid=%d chroot=%v\n", uid, syscall.EPERM); res.Stdout != want {
+		t.Errorf("expected %q, got %q (exit %d, stderr %q)", want, res.Stdout, res.ExitCode, res.Stderr)
+	}
+}
+
+// runUnprivileged runs TestSandboxExecutor_Root again as nobody.
+func runUnprivileged(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Not under t.TempDir, whose parent only we can enter
+	dir, err := os.MkdirTemp("", "sandbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	copyFile(t, exe, filepath.Join(dir, "test"))
+
+	cmd := exec.Command(filepath.Join(dir, "test"), "-test.run=^TestSandboxExecutor_Root$", "-test.v")
+	cmd.Dir = dir
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "TMPDIR=" + os.TempDir()}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: sandboxNobody, Gid: sandboxNobody}}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("unprivileged run failed: %v\n%s", err, out)
+	}
+	if bytes.Contains(out, []byte("--- SKIP")) {
+		t.Skipf("unprivileged run skipped:\n%s", out)
+	}
+}
+
+func TestSandboxExecutor_SetupError(t *testing.T) {
+	userNamespaces(t)
+	e := NewSandboxExecutor(WithSandboxRoot(sandboxRoot(t)))
+
+	_, err := e.Run(context.Background(), &ExecCommand{Argv: []string{"/helper"}, Dir: "/missing"})
+	if err == nil || !strings.Contains(err.Error(), "sandbox: chdir") {
+		t.Errorf("expected a chdir error, got %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package builtin
+
+import "context"
+
+// Run returns ErrSandboxUnsupported.
+func (e *SandboxExecutor) Run(ctx context.Context, c *ExecCommand) (*ExecResult, error) {
+	return nil, ErrSandboxUnsupported
+}
@@ -1,11 +1,10 @@
 package builtin
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os/exec"
 	"strings"
 	"time"
 )
@@ -16,13 +15,17 @@ type ShellTool struct {
 	timeout         time.Duration
 	workDir         string
 	shell           string
+	executor        Executor
+	maxOutput       int64
 }
 
 // ShellOption configures the shell tool.
 type ShellOption func(*ShellTool)
 
-// WithAllowedCommands restricts to specific commands.
-// If empty, all commands are allowed (dangerous!).
+// WithAllowedCommands restricts to specific commands. Commands are then
+// parsed into arguments and run without a shell, so metacharacters such as
+// ";" or "|" are rejected. If empty, all commands are allowed and run
+// through the shell (dangerous!).
 func WithAllowedCommands(commands ...string) ShellOption {
 	return func(t *ShellTool) {
 		t.allowedCommands = commands
@@ -50,12 +53,30 @@ func WithShell(shell string) ShellOption {
 	}
 }
 
+// WithExecutor sets how commands are run (default: NewHostExecutor). Use a
+// SandboxExecutor for agents that take untrusted input.
+func WithExecutor(e Executor) ShellOption {
+	return func(t *ShellTool) {
+		t.executor = e
+	}
+}
+
+// WithMaxOutput caps a command's combined stdout and stderr, in bytes. A
+// command writing more is killed.
+func WithMaxOutput(bytes int64) ShellOption {
+	return func(t *ShellTool) {
+		t.maxOutput = bytes
+	}
+}
+
 // NewShellTool creates a new shell tool.
 // WARNING: Without allowedCommands, this tool can execute any command!
 func NewShellTool(opts ...ShellOption) *ShellTool {
 	t := &ShellTool{
-		timeout: 30 * time.Second,
-		shell:   "/bin/sh",
+		timeout:   30 * time.Second,
+		shell:     "/bin/sh",
+		executor:  NewHostExecutor(),
+		maxOutput: 1024 * 1024, // 1MB
 	}
 	for _, opt := range opts {
 		opt(t)
@@ -113,76 +134,86 @@ func (t *ShellTool) Execute(ctx context.Context, params json.RawMessage) (string
 		return "", fmt.Errorf("invalid parameters: %w", err)
 	}
 
-	// Validate command
-	if !t.isCommandAllowed(p.Command) {
-		return "", fmt.Errorf("command not allowed: %s", p.Command)
+	argv, err := t.argv(p)
+	if err != nil {
+		return "", err
 	}
 
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(ctx, t.timeout)
 	defer cancel()
 
-	// Build command
-	var cmd *exec.Cmd
-	if len(p.Args) > 0 {
-		cmd = exec.CommandContext(ctx, p.Command, p.Args...)
-	} else {
-		// Execute through shell for complex commands
-		cmd = exec.CommandContext(ctx, t.shell, "-c", p.Command)
-	}
-
-	if t.workDir != "" {
-		cmd.Dir = t.workDir
-	}
-
-	// Set stdin if provided
-	if p.Stdin != "" {
-		cmd.Stdin = strings.NewReader(p.Stdin)
-	}
-
-	// Capture output
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	// Run command
-	err := cmd.Run()
+	res, err := t.executor.Run(ctx, &ExecCommand{
+		Argv:      argv,
+		Stdin:     p.Stdin,
+		Dir:       t.workDir,
+		MaxOutput: t.maxOutput,
+	})
 
 	// Build result
 	result := struct {
-		Stdout   string `json:"stdout"`
-		Stderr   string `json:"stderr"`
-		ExitCode int    `json:"exitCode"`
-		Error    string `json:"error,omitempty"`
+		Stdout    string `json:"stdout"`
+		Stderr    string `json:"stderr"`
+		ExitCode  int    `json:"exitCode"`
+		Truncated bool   `json:"truncated,omitempty"`
+		Error     string `json:"error,omitempty"`
 	}{
-		Stdout: stdout.String(),
-		Stderr: stderr.String(),
+		ExitCode: -1,
 	}
 
+	if res != nil {
+		result.Stdout = res.Stdout
+		result.Stderr = res.Stderr
+		result.ExitCode = res.ExitCode
+		result.Truncated = res.Truncated
+	}
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
-		} else {
-			result.Error = err.Error()
-			result.ExitCode = -1
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("command timed out after %s", t.timeout)
 		}
+		result.Error = err.Error()
 	}
 
 	output, _ := json.MarshalIndent(result, "", "  ")
 	return string(output), nil
 }
 
-// isCommandAllowed checks if a command is in the allowed list.
-func (t *ShellTool) isCommandAllowed(cmd string) bool {
+// argv returns the program and arguments to run. With an allowlist, the
+// command is parsed without a shell and its program must be allowed;
+// otherwise a command without args runs through the shell.
+func (t *ShellTool) argv(p shellParams) ([]string, error) {
+	if len(p.Args) > 0 {
+		if !t.isCommandAllowed([]string{p.Command}) {
+			return nil, fmt.Errorf("command not allowed: %s", p.Command)
+		}
+		return append([]string{p.Command}, p.Args...), nil
+	}
+
 	if len(t.allowedCommands) == 0 {
-		return true // No restrictions
+		// Execute through shell for complex commands
+		return []string{t.shell, "-c", p.Command}, nil
 	}
 
-	// Extract base command (first word)
-	baseCmd := strings.Fields(cmd)[0]
+	argv, err := ParseCommand(p.Command)
+	if err != nil {
+		return nil, fmt.Errorf("command not allowed: %w", err)
+	}
+	if !t.isCommandAllowed(argv) {
+		return nil, fmt.Errorf("command not allowed: %s", p.Command)
+	}
+	return argv, nil
+}
+
+// isCommandAllowed checks if a command's program, or the whole command, is
+// in the allowed list.
+func (t *ShellTool) isCommandAllowed(argv []string) bool {
+	if len(t.allowedCommands) == 0 {
+		return true // No restrictions
+	}
 
+	cmd := strings.Join(argv, " ")
 	for _, allowed := range t.allowedCommands {
-		if baseCmd == allowed || cmd == allowed {
+		if argv[0] == allowed || cmd == allowed {
 			return true
 		}
 	}
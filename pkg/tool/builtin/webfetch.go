@@ -0,0 +1,617 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// WebFetch defaults
+const (
+	DefaultFetchMaxChars = 10000
+	DefaultFetchMaxBytes = 5 * 1024 * 1024 // 5MB
+	maxFetchLinks        = 100
+)
+
+// WebFetchTool fetches a web page and returns its main content as
+// Markdown, with the page's title, metadata and links. Long pages are read
+// in chunks with offset.
+type WebFetchTool struct {
+	client    *http.Client
+	egress    *EgressPolicy
+	maxChars  int
+	maxBytes  int64
+	userAgent string
+}
+
+// WebFetchOption configures the web fetch tool.
+type WebFetchOption func(*WebFetchTool)
+
+// WithFetchEgressPolicy sets the egress policy (default: NewEgressPolicy).
+// Pass the HTTP tool's policy to apply the same rules to both.
+func WithFetchEgressPolicy(p *EgressPolicy) WebFetchOption {
+	return func(t *WebFetchTool) {
+		t.egress = p
+	}
+}
+
+// WithFetchMaxChars sets the most characters of content returned per call.
+func WithFetchMaxChars(n int) WebFetchOption {
+	return func(t *WebFetchTool) {
+		t.maxChars = n
+	}
+}
+
+// WithFetchMaxBytes limits the size of the downloaded page.
+func WithFetchMaxBytes(n int64) WebFetchOption {
+	return func(t *WebFetchTool) {
+		t.maxBytes = n
+	}
+}
+
+// WithFetchUserAgent sets the User-Agent header.
+func WithFetchUserAgent(ua string) WebFetchOption {
+	return func(t *WebFetchTool) {
+		t.userAgent = ua
+	}
+}
+
+// NewWebFetchTool creates a new web fetch tool.
+func NewWebFetchTool(opts ...WebFetchOption) *WebFetchTool {
+	t := &WebFetchTool{
+		maxChars:  DefaultFetchMaxChars,
+		maxBytes:  DefaultFetchMaxBytes,
+		userAgent: "Lattice-Agent/1.0",
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	if t.egress == nil {
+		t.egress = NewEgressPolicy()
+	}
+	t.client = t.egress.Client(30 * time.Second)
+	return t
+}
+
+// Name returns the tool name.
+func (t *WebFetchTool) Name() string {
+	return "web_fetch"
+}
+
+// Description returns the tool description.
+func (t *WebFetchTool) Description() string {
+	return fmt.Sprintf("Fetch a web page and return its main content as Markdown, with title, metadata and links. "+
+		"Returns at most %d characters per call; use next_offset as offset to read on.", t.maxChars)
+}
+
+// Schema returns the JSON Schema for the tool parameters.
+func (t *WebFetchTool) Schema() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"url": {
+				"type": "string",
+				"description": "The http or https URL of the page"
+			},
+			"offset": {
+				"type": "integer",
+				"description": "Character offset in the content to start from (default 0)"
+			},
+			"max_chars": {
+				"type": "integer",
+				"description": "Most characters of content to return"
+			}
+		},
+		"required": ["url"]
+	}`)
+}
+
+// webFetchParams are the parameters for the web fetch tool.
+type webFetchParams struct {
+	URL      string `json:"url"`
+	Offset   int    `json:"offset,omitempty"`
+	MaxChars int    `json:"max_chars,omitempty"`
+}
+
+// WebLink is a link found on a page.
+type WebLink struct {
+	Text string `json:"text,omitempty"`
+	URL  string `json:"url"`
+}
+
+// WebPage is the result of the web fetch tool.
+type WebPage struct {
+	URL         string            `json:"url"`
+	Title       string            `json:"title,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Content     string            `json:"content"`
+	Offset      int               `json:"offset"`
+	NextOffset  int               `json:"next_offset,omitempty"`
+	TotalChars  int               `json:"total_chars"`
+
+	// Links are only returned with the first chunk.
+	Links []WebLink `json:"links,omitempty"`
+}
+
+// Execute runs the web fetch tool.
+func (t *WebFetchTool) Execute(ctx context.Context, params json.RawMessage) (string, error) {
+	var p webFetchParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return "", fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	page, err := t.Fetch(ctx, p.URL)
+	if err != nil {
+		return "", err
+	}
+
+	limit := t.maxChars
+	if p.MaxChars > 0 && p.MaxChars < limit {
+		limit = p.MaxChars
+	}
+	page.paginate(max(p.Offset, 0), limit)
+
+	output, _ := json.MarshalIndent(page, "", "  ")
+	return string(output), nil
+}
+
+// Fetch downloads a page and extracts its full content.
+func (t *WebFetchTool) Fetch(ctx context.Context, rawURL string) (*WebPage, error) {
+	if err := t.egress.CheckMethod(http.MethodGet); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if err := t.egress.CheckURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", t.userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9,*/*;q=0.5")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("fetch failed: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, t.maxBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	text := strings.ToValidUTF8(string(body), "�")
+
+	page := &WebPage{URL: resp.Request.URL.String()}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml" ||
+		mediaType == "" && looksLikeHTML(text):
+		doc, err := parseHTML(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		if err := extractPage(ctx, page, doc, resp.Request.URL); err != nil {
+			return nil, err
+		}
+
+	case strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "json") || strings.HasSuffix(mediaType, "xml"):
+		page.Content = text
+
+	default:
+		return nil, fmt.Errorf("unsupported content type: %s", mediaType)
+	}
+
+	page.TotalChars = utf8.RuneCountInString(page.Content)
+	return page, nil
+}
+
+// paginate trims the content to limit characters from offset.
+func (p *WebPage) paginate(offset, limit int) {
+	runes := []rune(p.Content)
+	offset = min(offset, len(runes))
+	end := min(offset+limit, len(runes))
+
+	p.Content = string(runes[offset:end])
+	p.Offset = offset
+	if end < len(runes) {
+		p.NextOffset = end
+	}
+	if offset > 0 {
+		p.Links = nil
+	}
+}
+
+// looksLikeHTML reports whether an untyped body is an HTML document.
+func looksLikeHTML(s string) bool {
+	head := strings.ToLower(strings.TrimSpace(s[:min(len(s), 512)]))
+	return strings.HasPrefix(head, "<!doctype html") || strings.HasPrefix(head, "<html")
+}
+
+// extractPage fills a page's title, metadata, content and links from a
+// parsed document.
+func extractPage(ctx context.Context, page *WebPage, doc *htmlNode, base *url.URL) error {
+	meta := make(map[string]string)
+	for _, m := range doc.findAll(func(n *htmlNode) bool { return n.tag == "meta" }) {
+		key := m.attrs["name"]
+		if key == "" {
+			key = m.attrs["property"]
+		}
+		if key != "" && m.attrs["content"] != "" {
+			meta[strings.ToLower(key)] = strings.TrimSpace(m.attrs["content"])
+		}
+	}
+
+	if title := doc.find(func(n *htmlNode) bool { return n.tag == "title" }); title != nil {
+		page.Title = title.textContent()
+	}
+	page.Title = firstNonEmpty(page.Title, meta["og:title"])
+
+	page.Description = firstNonEmpty(meta["description"], meta["og:description"])
+
+	page.Metadata = make(map[string]string)
+	for key, name := range map[string]string{
+		"author":         "author",
+		"article:author": "author",
+		"og:site_name":   "site_name",
+		"og:type":        "type",
+		"keywords":       "keywords",
+	} {
+		if v := meta[key]; v != "" && page.Metadata[name] == "" {
+			page.Metadata[name] = v
+		}
+	}
+	if published := firstNonEmpty(meta["article:published_time"], meta["date"]); published != "" {
+		page.Metadata["published"] = published
+	}
+	if html := doc.find(func(n *htmlNode) bool { return n.tag == "html" }); html != nil && html.attrs["lang"] != "" {
+		page.Metadata["lang"] = html.attrs["lang"]
+	}
+	if canonical := doc.find(func(n *htmlNode) bool {
+		return n.tag == "link" && strings.EqualFold(n.attrs["rel"], "canonical")
+	}); canonical != nil {
+		if u := resolveLink(base, canonical.attrs["href"]); u != "" {
+			page.Metadata["canonical"] = u
+		}
+	}
+	if len(page.Metadata) == 0 {
+		page.Metadata = nil
+	}
+
+	main, inContent := mainContent(doc)
+	r := &markdownRenderer{ctx: ctx, base: base, skipHeader: !inContent, seen: make(map[string]bool)}
+	page.Content = r.render(main)
+	page.Links = r.links
+	return r.err
+}
+
+// mainContent picks the element holding the page's main content: the
+// largest <article>, else <main> or role="main", else <body>. It reports
+// whether a content element was found, rather than falling back to body.
+func mainContent(doc *htmlNode) (*htmlNode, bool) {
+	var best *htmlNode
+	bestLen := 0
+	for _, a := range doc.findAll(func(n *htmlNode) bool { return n.tag == "article" }) {
+		if l := len(a.textContent()); l > bestLen {
+			best, bestLen = a, l
+		}
+	}
+	if best != nil {
+		return best, true
+	}
+
+	if main := doc.find(func(n *htmlNode) bool {
+		return n.tag == "main" || n.attrs["role"] == "main"
+	}); main != nil {
+		return main, true
+	}
+
+	if body := doc.find(func(n *htmlNode) bool { return n.tag == "body" }); body != nil {
+		return body, false
+	}
+	return doc, false
+}
+
+// skippedElements never hold readable content.
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "canvas": true, "iframe": true, "object": true, "embed": true,
+	"nav": true, "aside": true, "footer": true, "form": true, "button": true,
+	"input": true, "select": true, "textarea": true, "dialog": true,
+	"head": true, "title": true, "meta": true, "link": true,
+}
+
+// blockElements start on a new paragraph.
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true,
+	"header": true, "figure": true, "figcaption": true, "address": true,
+	"dl": true, "dt": true, "dd": true, "details": true, "summary": true,
+	"body": true, "html": true, "center": true, "hgroup": true,
+}
+
+var (
+	blankLines = regexp.MustCompile(`\n{3,}`)
+	spaceRun   = regexp.MustCompile(`[ \t\r\n\f]+`)
+)
+
+// markdownRenderer turns an HTML tree into Markdown. It stops rendering
+// when ctx is done, and sets err.
+type markdownRenderer struct {
+	ctx        context.Context
+	base       *url.URL
+	skipHeader bool
+	links      []WebLink
+	seen       map[string]bool
+	nodes      int
+	err        error
+}
+
+// render returns the Markdown for a node.
+func (r *markdownRenderer) render(n *htmlNode) string {
+	out := r.node(n, 0)
+
+	lines := strings.Split(out, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t")
+	}
+	out = strings.Join(lines, "\n")
+	return strings.TrimSpace(blankLines.ReplaceAllString(out, "\n\n"))
+}
+
+// children renders the children of a node.
+func (r *markdownRenderer) children(n *htmlNode, depth int) string {
+	var sb strings.Builder
+	for _, c := range n.children {
+		sb.WriteString(r.node(c, depth))
+	}
+	return sb.String()
+}
+
+// node renders a node. depth is the list nesting level.
+func (r *markdownRenderer) node(n *htmlNode, depth int) string {
+	if r.err != nil {
+		return ""
+	}
+	if r.nodes++; r.nodes%1024 == 0 {
+		if r.err = r.ctx.Err(); r.err != nil {
+			return ""
+		}
+	}
+
+	if n.tag == "" {
+		return spaceRun.ReplaceAllString(n.text, " ")
+	}
+	if skippedElements[n.tag] || n.tag == "header" && r.skipHeader || hidden(n) {
+		return ""
+	}
+
+	switch n.tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		text := strings.TrimSpace(r.children(n, depth))
+		if text == "" {
+			return ""
+		}
+		return "\n\n" + strings.Repeat("#", int(n.tag[1]-'0')) + " " + text + "\n\n"
+
+	case "br":
+		return "\n"
+
+	case "hr":
+		return "\n\n---\n\n"
+
+	case "strong", "b":
+		return wrapInline(r.children(n, depth), "**")
+
+	case "em", "i":
+		return wrapInline(r.children(n, depth), "_")
+
+	case "code", "kbd", "samp":
+		if n.parent != nil && n.parent.tag == "pre" {
+			return r.children(n, depth)
+		}
+		return wrapInline(r.children(n, depth), "`")
+
+	case "pre":
+		code := strings.Trim(n.textRaw(), "\n")
+		return "\n\n```\n" + code + "\n```\n\n"
+
+	case "a":
+		text := strings.TrimSpace(r.children(n, depth))
+		href := resolveLink(r.base, n.attrs["href"])
+		if href == "" {
+			return text
+		}
+		r.addLink(text, href)
+		if text == "" {
+			return ""
+		}
+		return "[" + text + "](" + href + ")"
+
+	case "img":
+		alt := strings.TrimSpace(n.attrs["alt"])
+		src := resolveLink(r.base, n.attrs["src"])
+		if alt == "" || src == "" {
+			return ""
+		}
+		return "![" + alt + "](" + src + ")"
+
+	case "ul", "ol":
+		var sb strings.Builder
+		num := 0
+		for _, c := range n.children {
+			if c.tag != "li" {
+				sb.WriteString(strings.TrimSpace(r.node(c, depth)))
+				continue
+			}
+			num++
+			marker := "- "
+			if n.tag == "ol" {
+				marker = fmt.Sprintf("%d. ", num)
+			}
+			item := strings.TrimSpace(r.children(c, depth+1))
+			item = strings.ReplaceAll(item, "\n", "\n"+strings.Repeat(" ", len(marker)))
+			sb.WriteString("\n" + strings.Repeat("  ", depth) + marker + item)
+		}
+		if depth > 0 {
+			return sb.String() + "\n"
+		}
+		return "\n\n" + strings.TrimPrefix(sb.String(), "\n") + "\n\n"
+
+	case "blockquote":
+		text := strings.TrimSpace(r.children(n, depth))
+		if text == "" {
+			return ""
+		}
+		return "\n\n> " + strings.ReplaceAll(text, "\n", "\n> ") + "\n\n"
+
+	case "table":
+		return r.table(n)
+	}
+
+	if blockElements[n.tag] {
+		return "\n\n" + strings.TrimSpace(r.children(n, depth)) + "\n\n"
+	}
+	return r.children(n, depth)
+}
+
+// table renders a table as a Markdown table, with the first row as header.
+// Only the table's own rows are read; nested tables render in their cells.
+func (r *markdownRenderer) table(n *htmlNode) string {
+	var rows []*htmlNode
+	for _, c := range n.children {
+		switch c.tag {
+		case "tr":
+			rows = append(rows, c)
+		case "thead", "tbody", "tfoot":
+			for _, row := range c.children {
+				if row.tag == "tr" {
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n\n")
+	for i, row := range rows {
+		var cells []string
+		for _, c := range row.children {
+			if c.tag == "td" || c.tag == "th" {
+				cell := strings.TrimSpace(r.children(c, 0))
+				cell = strings.ReplaceAll(strings.ReplaceAll(cell, "\n", " "), "|", "\\|")
+				cells = append(cells, cell)
+			}
+		}
+		if len(cells) == 0 {
+			continue
+		}
+		sb.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		if i == 0 {
+			sb.WriteString("|" + strings.Repeat(" --- |", len(cells)) + "\n")
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// addLink records a link, once per URL, up to maxFetchLinks.
+func (r *markdownRenderer) addLink(text, href string) {
+	if r.seen[href] || len(r.links) >= maxFetchLinks {
+		return
+	}
+	r.seen[href] = true
+	r.links = append(r.links, WebLink{Text: text, URL: href})
+}
+
+// textRaw returns the node's text without collapsing whitespace.
+func (n *htmlNode) textRaw() string {
+	if n.tag == "" {
+		return n.text
+	}
+	var sb strings.Builder
+	for _, c := range n.children {
+		if c.tag == "br" {
+			sb.WriteString("\n")
+			continue
+		}
+		sb.WriteString(c.textRaw())
+	}
+	return sb.String()
+}
+
+// hidden reports whether an element is marked as not displayed.
+func hidden(n *htmlNode) bool {
+	if _, ok := n.attrs["hidden"]; ok {
+		return true
+	}
+	if n.attrs["aria-hidden"] == "true" {
+		return true
+	}
+	style := strings.ReplaceAll(strings.ToLower(n.attrs["style"]), " ", "")
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+// wrapInline surrounds inline text with a Markdown marker, keeping the
+// surrounding spaces outside it.
+func wrapInline(text, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:strings.Index(text, trimmed)]
+	trail := text[len(lead)+len(trimmed):]
+	return lead + marker + trimmed + marker + trail
+}
+
+// resolveLink returns href as an absolute http(s) or mailto URL, or "" for
+// fragments, scripts and invalid links.
+func resolveLink(base *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	switch u.Scheme {
+	case "http", "https", "mailto":
+		return u.String()
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
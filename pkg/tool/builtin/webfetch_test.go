@@ -0,0 +1,303 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testArticle = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <title>Release Notes &amp; More</title>
+  <meta name="description" content="What changed in 2.0">
+  <meta name="author" content="Jane Doe">
+  <meta property="og:site_name" content="Example Blog">
+  <meta property="article:published_time" content="2024-05-01">
+  <link rel="canonical" href="/blog/2.0">
+  <style>body { color: red }</style>
+  <script>var tracking = "<p>not content</p>";</script>
+</head>
+<body>
+  <header><a href="/">Home</a></header>
+  <nav><a href="/about">About</a></nav>
+  <article>
+    <h1>Version 2.0</h1>
+    <p>We shipped <strong>faster</strong> builds and <em>new</em> <a href="/docs">docs</a>.
+    <p>Second paragraph with <code>go build</code>.
+    <ul>
+      <li>First item
+      <li>Second item
+    </ul>
+    <pre><code>func main() {
+	fmt.Println("hi")
+}</code></pre>
+    <table>
+      <tr><th>Name</th><th>Value</th></tr>
+      <tr><td>a</td><td>1</td></tr>
+    </table>
+    <div hidden>secret</div>
+  </article>
+  <aside>Related posts</aside>
+  <footer>Copyright</footer>
+</body>
+</html>`
+
+func TestWebFetchTool_Extract(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(testArticle))
+	}))
+	defer server.Close()
+
+	tool := NewWebFetchTool(WithFetchEgressPolicy(NewEgressPolicy(WithPrivateNetworks())))
+	params, _ := json.Marshal(map[string]any{"url": server.URL + "/blog/2.0"})
+
+	result, err := tool.Execute(context.Background(), params)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var page WebPage
+	if err := json.Unmarshal([]byte(result), &page); err != nil {
+		t.Fatalf("invalid result: %v", err)
+	}
+
+	if page.Title != "Release Notes & More" {
+		t.Errorf("title = %q", page.Title)
+	}
+	if page.Description != "What changed in 2.0" {
+		t.Errorf("description = %q", page.Description)
+	}
+	for key, want := range map[string]string{
+		"author":    "Jane Doe",
+		"site_name": "Example Blog",
+		"published": "2024-05-01",
+		"lang":      "en",
+		"canonical": server.URL + "/blog/2.0",
+	} {
+		if page.Metadata[key] != want {
+			t.Errorf("metadata[%s] = %q, want %q", key, page.Metadata[key], want)
+		}
+	}
+
+	for _, want := range []string{
+		"# Version 2.0",
+		"We shipped **faster** builds and _new_ [docs](" + server.URL + "/docs).",
+		"Second paragraph with `go build`.",
+		"- First item\n- Second item",
+		"```\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n```",
+		"| Name | Value |\n| --- | --- |\n| a | 1 |",
+	} {
+		if !strings.Contains(page.Content, want) {
+			t.Errorf("content missing %q:\n%s", want, page.Content)
+		}
+	}
+	for _, unwanted := range []string{"Home", "About", "Related", "Copyright", "secret", "tracking", "color"} {
+		if strings.Contains(page.Content, unwanted) {
+			t.Errorf("content should not contain %q:\n%s", unwanted, page.Content)
+		}
+	}
+
+	if len(page.Links) != 1 || page.Links[0].URL != server.URL+"/docs" || page.Links[0].Text != "docs" {
+		t.Errorf("links = %+v", page.Links)
+	}
+	if page.NextOffset != 0 || page.TotalChars != len([]rune(page.Content)) {
+		t.Errorf("expected the whole page, got offset %d of %d", page.NextOffset, page.TotalChars)
+	}
+}
+
+func TestWebFetchTool_Pagination(t *testing.T) {
+	body := "<html><body><main><p>" + strings.Repeat("abcdefghij", 25) + "</p><a href=\"/x\">x</a></main></body></html>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	tool := NewWebFetchTool(
+		WithFetchEgressPolicy(NewEgressPolicy(WithPrivateNetworks())),
+		WithFetchMaxChars(100),
+	)
+
+	var content strings.Builder
+	offset, calls := 0, 0
+	for {
+		params, _ := json.Marshal(map[string]any{"url": server.URL, "offset": offset})
+		result, err := tool.Execute(context.Background(), params)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var page WebPage
+		json.Unmarshal([]byte(result), &page)
+
+		if len([]rune(page.Content)) > 100 {
+			t.Fatalf("chunk of %d chars exceeds the limit", len([]rune(page.Content)))
+		}
+		if calls == 0 && len(page.Links) != 1 {
+			t.Errorf("expected links with the first chunk, got %+v", page.Links)
+		}
+		if calls > 0 && len(page.Links) != 0 {
+			t.Errorf("expected no links after the first chunk, got %+v", page.Links)
+		}
+
+		content.WriteString(page.Content)
+		calls++
+		if page.NextOffset == 0 {
+			break
+		}
+		offset = page.NextOffset
+	}
+
+	if calls != 3 {
+		t.Errorf("expected 3 chunks, got %d", calls)
+	}
+	if !strings.HasPrefix(content.String(), strings.Repeat("abcdefghij", 25)) {
+		t.Errorf("chunks do not join up: %q", content.String())
+	}
+
+	// max_chars lowers the limit per call
+	params, _ := json.Marshal(map[string]any{"url": server.URL, "max_chars": 10})
+	result, _ := tool.Execute(context.Background(), params)
+	var page WebPage
+	json.Unmarshal([]byte(result), &page)
+	if page.Content != "abcdefghij" || page.NextOffset != 10 {
+		t.Errorf("unexpected chunk %q, next %d", page.Content, page.NextOffset)
+	}
+}
+
+func TestWebFetchTool_ContentTypes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("plain <b>text</b>"))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G'})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tool := NewWebFetchTool(WithFetchEgressPolicy(NewEgressPolicy(WithPrivateNetworks())))
+
+	page, err := tool.Fetch(context.Background(), server.URL+"/text")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if page.Content != "plain <b>text</b>" {
+		t.Errorf("expected text as is, got %q", page.Content)
+	}
+
+	if _, err := tool.Fetch(context.Background(), server.URL+"/image"); err == nil {
+		t.Error("expected error for an image")
+	}
+	if _, err := tool.Fetch(context.Background(), server.URL+"/missing"); err == nil {
+		t.Error("expected error for 404")
+	}
+}
+
+func TestWebFetchTool_Egress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>internal</body></html>"))
+	}))
+	defer server.Close()
+
+	// The default policy keeps private addresses out of reach
+	tool := NewWebFetchTool()
+	if _, err := tool.Fetch(context.Background(), server.URL); !errors.Is(err, ErrEgressDenied) {
+		t.Errorf("expected ErrEgressDenied, got %v", err)
+	}
+
+	tool = NewWebFetchTool(WithFetchEgressPolicy(NewEgressPolicy(WithAllowedHosts("example.com"))))
+	if _, err := tool.Fetch(context.Background(), "https://other.org/"); !errors.Is(err, ErrEgressDenied) {
+		t.Errorf("expected ErrEgressDenied, got %v", err)
+	}
+
+	tool = NewWebFetchTool(WithFetchEgressPolicy(NewEgressPolicy(WithAllowedMethods("POST"))))
+	if _, err := tool.Fetch(context.Background(), "https://example.com/"); !errors.Is(err, ErrEgressDenied) {
+		t.Errorf("expected ErrEgressDenied for GET, got %v", err)
+	}
+}
+
+func TestParseHTML(t *testing.T) {
+	doc, err := parseHTML(context.Background(), `<div class=a id="x"><p>one<p>two<br/>three</div><!-- <p>gone</p> --><ul><li>a<li>b</ul>`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	div := doc.find(func(n *htmlNode) bool { return n.tag == "div" })
+	if div == nil || div.attrs["class"] != "a" || div.attrs["id"] != "x" {
+		t.Fatalf("unexpected div: %+v", div)
+	}
+
+	ps := doc.findAll(func(n *htmlNode) bool { return n.tag == "p" })
+	if len(ps) != 2 || ps[0].textContent() != "one" || ps[1].textContent() != "two three" {
+		t.Errorf("unexpected paragraphs: %d", len(ps))
+	}
+
+	lis := doc.findAll(func(n *htmlNode) bool { return n.tag == "li" })
+	if len(lis) != 2 || lis[0].parent.tag != "ul" || lis[1].parent.tag != "ul" {
+		t.Errorf("expected two sibling list items, got %d", len(lis))
+	}
+
+	if strings.Contains(doc.textContent(), "gone") {
+		t.Error("comments should be dropped")
+	}
+}
+
+func TestExtractPage_DeepNesting(t *testing.T) {
+	for name, src := range map[string]string{
+		"tables": strings.Repeat("<table><tr><td>x", 30) + strings.Repeat("</td></tr></table>", 30),
+		"lists":  "<ul>" + strings.Repeat("<li><ul>", 16000) + "<li>x",
+		"divs":   strings.Repeat("<div>", 100000) + "x",
+	} {
+		t.Run(name, func(t *testing.T) {
+			done := make(chan string, 1)
+			go func() {
+				ctx := context.Background()
+				doc, err := parseHTML(ctx, src)
+				if err != nil {
+					done <- err.Error()
+					return
+				}
+				page := &WebPage{}
+				if err := extractPage(ctx, page, doc, nil); err != nil {
+					done <- err.Error()
+					return
+				}
+				done <- page.Content
+			}()
+
+			select {
+			case content := <-done:
+				if !strings.Contains(content, "x") {
+					t.Errorf("expected the innermost text, got %.200q", content)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("extraction did not finish")
+			}
+		})
+	}
+}
+
+func TestParseHTML_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := parseHTML(ctx, strings.Repeat("<p>x", 10000)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	doc, _ := parseHTML(context.Background(), strings.Repeat("<p>x", 10000))
+	if err := extractPage(ctx, &WebPage{}, doc, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+// Package tool provides helpers for building core.Tool implementations
+// from plain Go functions and for adapting tools between core and MCP.
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/storo/lattice/pkg/core"
+)
+
+// FuncTool is a core.Tool backed by a typed Go function.
+// Parameters are decoded into In and the result is encoded from Out.
+type FuncTool[In, Out any] struct {
+	name        string
+	description string
+	schema      json.RawMessage
+	fn          func(ctx context.Context, in In) (Out, error)
+}
+
+// Func creates a tool from a typed function. The parameter schema is
+// generated from In with core.SchemaFromStruct, so In is usually a struct
+// with json and schema tags.
+//
+// Parameters are validated against the schema before fn is called. A string
+// Out is returned as is; any other Out is encoded as JSON.
+func Func[In, Out any](name, description string, fn func(ctx context.Context, in In) (Out, error)) *FuncTool[In, Out] {
+	return &FuncTool[In, Out]{
+		name:        name,
+		description: description,
+		schema:      core.SchemaFromStruct(new(In)),
+		fn:          fn,
+	}
+}
+
+// Name returns the tool name.
+func (t *FuncTool[In, Out]) Name() string {
+	return t.name
+}
+
+// Description returns the tool description.
+func (t *FuncTool[In, Out]) Description() string {
+	return t.description
+}
+
+// Schema returns the JSON Schema generated from In.
+func (t *FuncTool[In, Out]) Schema() json.RawMessage {
+	return t.schema
+}
+
+// Execute decodes and validates params, calls the function and encodes
+// its result.
+func (t *FuncTool[In, Out]) Execute(ctx context.Context, params json.RawMessage) (string, error) {
+	if len(params) == 0 || string(params) == "null" {
+		params = json.RawMessage(`{}`)
+	}
+
+	if err := core.ValidateJSON(t.schema, params); err != nil {
+		return "", fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	var in In
+	if err := json.Unmarshal(params, &in); err != nil {
+		return "", fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	out, err := t.fn(ctx, in)
+	if err != nil {
+		return "", err
+	}
+
+	if s, ok := any(out).(string); ok {
+		return s, nil
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode result: %w", err)
+	}
+	return string(data), nil
+}
+
+// Verify FuncTool implements core.Tool
+var _ core.Tool = (*FuncTool[struct{}, string])(nil)
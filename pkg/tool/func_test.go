@@ -0,0 +1,95 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type addInput struct {
+	A int `json:"a" schema:"First operand"`
+	B int `json:"b" schema:"Second operand"`
+}
+
+type addOutput struct {
+	Sum int `json:"sum"`
+}
+
+func newAddTool() *FuncTool[addInput, addOutput] {
+	return Func("add", "Add two numbers", func(ctx context.Context, in addInput) (addOutput, error) {
+		return addOutput{Sum: in.A + in.B}, nil
+	})
+}
+
+func TestFunc_Schema(t *testing.T) {
+	add := newAddTool()
+
+	if add.Name() != "add" || add.Description() != "Add two numbers" {
+		t.Errorf("unexpected name/description: %s / %s", add.Name(), add.Description())
+	}
+
+	var schema struct {
+		Type       string                     `json:"type"`
+		Properties map[string]json.RawMessage `json:"properties"`
+		Required   []string                   `json:"required"`
+	}
+	if err := json.Unmarshal(add.Schema(), &schema); err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+	if schema.Type != "object" || len(schema.Properties) != 2 || len(schema.Required) != 2 {
+		t.Errorf("unexpected schema: %s", add.Schema())
+	}
+}
+
+func TestFunc_Execute(t *testing.T) {
+	add := newAddTool()
+
+	out, err := add.Execute(context.Background(), json.RawMessage(`{"a": 2, "b": 3}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != `{"sum":5}` {
+		t.Errorf("expected {\"sum\":5}, got %s", out)
+	}
+}
+
+func TestFunc_InvalidParams(t *testing.T) {
+	called := false
+	add := Func("add", "", func(ctx context.Context, in addInput) (int, error) {
+		called = true
+		return 0, nil
+	})
+
+	_, err := add.Execute(context.Background(), json.RawMessage(`{"a": "two"}`))
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	if !strings.Contains(err.Error(), "$.a: expected integer, got string") || !strings.Contains(err.Error(), `missing required field "b"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if called {
+		t.Error("function should not run with invalid parameters")
+	}
+}
+
+func TestFunc_StringOutputAndError(t *testing.T) {
+	greet := Func("greet", "", func(ctx context.Context, in struct {
+		Name string `json:"name"`
+	}) (string, error) {
+		if in.Name == "" {
+			return "", errors.New("name is empty")
+		}
+		return "hello " + in.Name, nil
+	})
+
+	out, err := greet.Execute(context.Background(), json.RawMessage(`{"name": "bob"}`))
+	if err != nil || out != "hello bob" {
+		t.Errorf("expected 'hello bob', got %q (%v)", out, err)
+	}
+
+	if _, err := greet.Execute(context.Background(), json.RawMessage(`{"name": ""}`)); err == nil || err.Error() != "name is empty" {
+		t.Errorf("expected function error, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/protocol/mcp"
+)
+
+// mcpTool adapts an mcp.Tool to core.Tool.
+type mcpTool struct {
+	tool mcp.Tool
+	def  mcp.ToolDefinition
+}
+
+// FromMCP adapts an MCP tool (such as an mcp.FunctionTool) so agents can
+// use it as a core.Tool.
+func FromMCP(t mcp.Tool) core.Tool {
+	return &mcpTool{tool: t, def: t.Definition()}
+}
+
+// Name returns the tool name.
+func (t *mcpTool) Name() string {
+	return t.def.Name
+}
+
+// Description returns the tool description.
+func (t *mcpTool) Description() string {
+	return t.def.Description
+}
+
+// Schema returns the MCP tool's input schema.
+func (t *mcpTool) Schema() json.RawMessage {
+	if len(t.def.InputSchema) == 0 {
+		return json.RawMessage(`{"type": "object"}`)
+	}
+	return t.def.InputSchema
+}
+
+// Execute decodes params into MCP arguments and runs the tool.
+func (t *mcpTool) Execute(ctx context.Context, params json.RawMessage) (string, error) {
+	args := map[string]any{}
+	if len(params) > 0 && string(params) != "null" {
+		if err := json.Unmarshal(params, &args); err != nil {
+			return "", fmt.Errorf("invalid parameters: %w", err)
+		}
+	}
+
+	return t.tool.Execute(ctx, args)
+}
+
+// ToMCP adapts a core.Tool into an mcp.FunctionTool so it can be
+// registered with an mcp.ToolExecutor.
+func ToMCP(t core.Tool) *mcp.FunctionTool {
+	return mcp.NewFunctionTool(t.Name(), t.Description(), t.Schema(), func(ctx context.Context, args map[string]any) (string, error) {
+		if args == nil {
+			args = map[string]any{}
+		}
+		params, err := json.Marshal(args)
+		if err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return t.Execute(ctx, params)
+	})
+}
+
+// Verify mcpTool implements core.Tool
+var _ core.Tool = (*mcpTool)(nil)
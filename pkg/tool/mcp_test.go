@@ -0,0 +1,67 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/storo/lattice/pkg/protocol/mcp"
+)
+
+func TestFromMCP(t *testing.T) {
+	var got map[string]any
+	fn := mcp.NewFunctionTool("echo", "Echo the message", json.RawMessage(`{"type":"object"}`),
+		func(ctx context.Context, args map[string]any) (string, error) {
+			got = args
+			return "ok", nil
+		})
+
+	tool := FromMCP(fn)
+	if tool.Name() != "echo" || tool.Description() != "Echo the message" {
+		t.Errorf("unexpected name/description: %s / %s", tool.Name(), tool.Description())
+	}
+	if string(tool.Schema()) != `{"type":"object"}` {
+		t.Errorf("unexpected schema: %s", tool.Schema())
+	}
+
+	out, err := tool.Execute(context.Background(), json.RawMessage(`{"message": "hi"}`))
+	if err != nil || out != "ok" {
+		t.Fatalf("expected ok, got %q (%v)", out, err)
+	}
+	if got["message"] != "hi" {
+		t.Errorf("expected decoded arguments, got %v", got)
+	}
+
+	if _, err := tool.Execute(context.Background(), nil); err != nil {
+		t.Errorf("expected empty params to be accepted, got %v", err)
+	}
+}
+
+func TestToMCP(t *testing.T) {
+	executor := mcp.NewToolExecutor()
+	executor.Register(ToMCP(newAddTool()))
+
+	defs := executor.List()
+	if len(defs) != 1 || defs[0].Name != "add" {
+		t.Fatalf("unexpected definitions: %+v", defs)
+	}
+
+	result, err := executor.Execute(context.Background(), mcp.ToolCall{
+		ID:        "call-1",
+		Name:      "add",
+		Arguments: map[string]any{"a": 1, "b": 2},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.IsError || result.Content != `{"sum":3}` {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	// Round trip back to a core.Tool
+	back := FromMCP(ToMCP(newAddTool()))
+	out, err := back.Execute(context.Background(), json.RawMessage(`{"a": 4, "b": 4}`))
+	if err != nil || out != `{"sum":8}` {
+		t.Errorf("expected {\"sum\":8}, got %q (%v)", out, err)
+	}
+}
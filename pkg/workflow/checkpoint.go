@@ -0,0 +1,353 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/patterns"
+	"github.com/storo/lattice/pkg/storage"
+)
+
+// Checkpoint errors
+var (
+	ErrRunNotFound      = errors.New("workflow run not found")
+	ErrRunCompleted     = errors.New("workflow run already completed")
+	ErrRunCancelled     = errors.New("workflow run cancelled")
+	ErrWorkflowMismatch = errors.New("run belongs to a different workflow")
+	ErrNoCheckpoints    = errors.New("workflow has no checkpoint store")
+	ErrRunActive        = errors.New("workflow run is running in another process")
+	ErrRunTakenOver     = errors.New("workflow run was taken over by another process")
+)
+
+// RunStatus is the state of a workflow run.
+type RunStatus string
+
+const (
+	RunRunning   RunStatus = "running"
+	RunCompleted RunStatus = "completed"
+	RunFailed    RunStatus = "failed"
+	RunCancelled RunStatus = "cancelled"
+)
+
+// RunState is the checkpoint of a workflow run: its input, status and the
+// input, output, status and messages of every node.
+type RunState struct {
+	ID        string            `json:"id"`
+	Workflow  string            `json:"workflow"`
+	Input     string            `json:"input"`
+	Status    RunStatus         `json:"status"`
+	Error     string            `json:"error,omitempty"`
+	Output    string            `json:"output,omitempty"`
+	Nodes     []*NodeReport     `json:"nodes"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	TraceID   string            `json:"trace_id,omitempty"`
+	TokensIn  int               `json:"tokens_in"`
+	TokensOut int               `json:"tokens_out"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Node returns the checkpoint of a node, or nil.
+func (s *RunState) Node(id string) *NodeReport {
+	for _, n := range s.Nodes {
+		if n.ID == id {
+			return n
+		}
+	}
+	return nil
+}
+
+// Checkpoint key prefixes
+const (
+	runKeyPrefix    = "workflow:run:"
+	cancelKeyPrefix = "workflow:cancel:"
+	leaseKeyPrefix  = "workflow:lease:"
+)
+
+// Defaults
+const (
+	// DefaultCancelPollInterval is how often a running workflow checks
+	// whether it was cancelled from elsewhere.
+	DefaultCancelPollInterval = time.Second
+
+	// DefaultLeaseTTL is how long a run stays leased to its process
+	// without a heartbeat.
+	DefaultLeaseTTL = 30 * time.Second
+)
+
+// Checkpoints saves workflow runs to a storage.Store, so that they can be
+// listed, resumed after a crash and cancelled from another process.
+//
+// With a storage.AtomicStore, a process holds a lease on each run it
+// executes and renews it while the run is live, so that a run is never
+// executed by two processes at once.
+type Checkpoints struct {
+	store        storage.Store
+	ttl          time.Duration
+	pollInterval time.Duration
+	leaseTTL     time.Duration
+	owner        string
+}
+
+// CheckpointOption configures Checkpoints.
+type CheckpointOption func(*Checkpoints)
+
+// NewCheckpoints creates a checkpoint store.
+func NewCheckpoints(store storage.Store, opts ...CheckpointOption) *Checkpoints {
+	c := &Checkpoints{
+		store:        store,
+		pollInterval: DefaultCancelPollInterval,
+		leaseTTL:     DefaultLeaseTTL,
+		owner:        uuid.New().String(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// WithCheckpointTTL expires run checkpoints after d (default: never).
+func WithCheckpointTTL(d time.Duration) CheckpointOption {
+	return func(c *Checkpoints) {
+		c.ttl = d
+	}
+}
+
+// WithCancelPollInterval sets how often running workflows check for
+// cancellation.
+func WithCancelPollInterval(d time.Duration) CheckpointOption {
+	return func(c *Checkpoints) {
+		c.pollInterval = d
+	}
+}
+
+// WithLeaseTTL sets how long a run stays leased to a process that stopped
+// renewing it, such as one that crashed. Resume fails with ErrRunActive
+// until then.
+func WithLeaseTTL(d time.Duration) CheckpointOption {
+	return func(c *Checkpoints) {
+		c.leaseTTL = d
+	}
+}
+
+// Pipeline returns a patterns.Checkpointer that runs Sequential pipelines
+// as workflows named name, built with Workflow.Chain. Their runs are
+// listed, inspected and cancelled like any other workflow run.
+func (c *Checkpoints) Pipeline(name string, opts ...Option) patterns.Checkpointer {
+	return &pipeline{checkpoints: c, name: name, opts: opts}
+}
+
+// pipeline checkpoints Sequential runs as workflow runs.
+type pipeline struct {
+	checkpoints *Checkpoints
+	name        string
+	opts        []Option
+}
+
+var _ patterns.Checkpointer = (*pipeline)(nil)
+
+// workflow builds the workflow for a pipeline's agents.
+func (p *pipeline) workflow(agents []core.Agent) *Workflow {
+	opts := append([]Option{WithCheckpoints(p.checkpoints)}, p.opts...)
+	return New(p.name, opts...).Chain(agents...)
+}
+
+// Run runs the agents as a new workflow run.
+func (p *pipeline) Run(ctx context.Context, runID, input string, agents []core.Agent) (*core.Result, error) {
+	return p.workflow(agents).RunWithID(ctx, runID, input)
+}
+
+// Resume continues a workflow run of the agents.
+func (p *pipeline) Resume(ctx context.Context, runID string, agents []core.Agent) (*core.Result, error) {
+	return p.workflow(agents).Resume(ctx, runID)
+}
+
+// Save stores a run checkpoint.
+func (c *Checkpoints) Save(ctx context.Context, state *RunState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+	return c.store.Set(ctx, runKeyPrefix+state.ID, data, c.ttl)
+}
+
+// Load retrieves a run checkpoint.
+func (c *Checkpoints) Load(ctx context.Context, id string) (*RunState, error) {
+	data, err := c.store.Get(ctx, runKeyPrefix+id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrRunNotFound, id)
+		}
+		return nil, err
+	}
+
+	var state RunState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode run %s: %w", id, err)
+	}
+	return &state, nil
+}
+
+// List returns all runs, newest first.
+func (c *Checkpoints) List(ctx context.Context) ([]*RunState, error) {
+	keys, err := c.store.Keys(ctx, runKeyPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]*RunState, 0, len(keys))
+	for _, key := range keys {
+		state, err := c.Load(ctx, strings.TrimPrefix(key, runKeyPrefix))
+		if err != nil {
+			// Expired between Keys and Get
+			if errors.Is(err, ErrRunNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		runs = append(runs, state)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].CreatedAt.After(runs[j].CreatedAt)
+	})
+	return runs, nil
+}
+
+// Delete removes a run checkpoint.
+func (c *Checkpoints) Delete(ctx context.Context, id string) error {
+	if err := c.store.Delete(ctx, cancelKeyPrefix+id); err != nil {
+		return err
+	}
+	return c.store.Delete(ctx, runKeyPrefix+id)
+}
+
+// Cancel asks a run to stop. A process running it stops within the poll
+// interval; a run whose process is gone is marked cancelled directly.
+func (c *Checkpoints) Cancel(ctx context.Context, id string) error {
+	state, err := c.Load(ctx, id)
+	if err != nil {
+		return err
+	}
+	if state.Status == RunCompleted {
+		return fmt.Errorf("%w: %s", ErrRunCompleted, id)
+	}
+
+	if err := c.store.Set(ctx, cancelKeyPrefix+id, []byte("1"), c.ttl); err != nil {
+		return err
+	}
+
+	state.Status = RunCancelled
+	state.UpdatedAt = time.Now()
+	return c.Save(ctx, state)
+}
+
+// cancelled reports whether a run was asked to stop.
+func (c *Checkpoints) cancelled(ctx context.Context, id string) bool {
+	return c.store.Exists(ctx, cancelKeyPrefix+id)
+}
+
+// clearCancel removes a cancellation request before a run resumes.
+func (c *Checkpoints) clearCancel(ctx context.Context, id string) error {
+	return c.store.Delete(ctx, cancelKeyPrefix+id)
+}
+
+// acquire takes the lease on a run. Returns ErrRunActive if another
+// process holds it.
+func (c *Checkpoints) acquire(ctx context.Context, id string) error {
+	store, ok := c.store.(storage.AtomicStore)
+	if !ok {
+		return nil
+	}
+
+	ok, err := store.SetNX(ctx, leaseKeyPrefix+id, []byte(c.owner), c.leaseTTL)
+	if err != nil {
+		return fmt.Errorf("failed to lease run %s: %w", id, err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRunActive, id)
+	}
+	return nil
+}
+
+// renew extends the lease on a run. It reports false when the lease was
+// lost to another process.
+func (c *Checkpoints) renew(ctx context.Context, id string) bool {
+	store, ok := c.store.(storage.AtomicStore)
+	if !ok {
+		return true
+	}
+
+	key := leaseKeyPrefix + id
+	owner, version, err := store.GetVersion(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		// Expired, but nobody took it over yet
+		ok, err := store.SetNX(ctx, key, []byte(c.owner), c.leaseTTL)
+		return ok || err != nil
+	}
+	if err != nil {
+		// Keep running through store hiccups; the lease may still be ours
+		return true
+	}
+	if string(owner) != c.owner {
+		return false
+	}
+	_, err = store.CompareAndSwap(ctx, key, []byte(c.owner), version, c.leaseTTL)
+	return !errors.Is(err, storage.ErrConflict)
+}
+
+// release gives up the lease on a run, unless another process holds it
+// by now.
+func (c *Checkpoints) release(ctx context.Context, id string) {
+	store, ok := c.store.(storage.AtomicStore)
+	if !ok {
+		return
+	}
+
+	key := leaseKeyPrefix + id
+	store.Txn(ctx, []string{key}, func(tx *storage.Tx) error {
+		if owner, err := tx.Get(key); err == nil && string(owner) == c.owner {
+			tx.Delete(key)
+		}
+		return nil
+	})
+}
+
+// saveLeased stores the checkpoint of a run this process executes, only
+// while it still holds the run's lease. Returns ErrRunTakenOver otherwise.
+func (c *Checkpoints) saveLeased(ctx context.Context, state *RunState) error {
+	store, ok := c.store.(storage.AtomicStore)
+	if !ok {
+		return c.Save(ctx, state)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+
+	key := leaseKeyPrefix + state.ID
+	return store.Txn(ctx, []string{key}, func(tx *storage.Tx) error {
+		owner, err := tx.Get(key)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			// Expired, but nobody took it over yet
+			tx.Set(key, []byte(c.owner), c.leaseTTL)
+		case err != nil:
+			return err
+		case string(owner) != c.owner:
+			return fmt.Errorf("%w: %s", ErrRunTakenOver, state.ID)
+		}
+		tx.Set(runKeyPrefix+state.ID, data, c.ttl)
+		return nil
+	})
+}
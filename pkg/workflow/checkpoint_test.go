@@ -0,0 +1,427 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/storo/lattice/pkg/agent"
+	"github.com/storo/lattice/pkg/approval"
+	"github.com/storo/lattice/pkg/patterns"
+	"github.com/storo/lattice/pkg/provider"
+	"github.com/storo/lattice/pkg/storage"
+	"github.com/storo/lattice/pkg/tool"
+)
+
+func TestCheckpoints_ResumeAfterFailure(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "runs.db")
+
+	var firstCalls atomic.Int32
+	first := func(ctx context.Context, input string, outputs map[string]string) (string, error) {
+		firstCalls.Add(1)
+		return "first:" + input, nil
+	}
+	broken := true
+	second := func(ctx context.Context, input string, outputs map[string]string) (string, error) {
+		if broken {
+			return "", errors.New("crashed")
+		}
+		return "second:" + input, nil
+	}
+
+	build := func(store storage.Store) *Workflow {
+		return New("durable", WithCheckpoints(NewCheckpoints(store)), WithLabels(map[string]string{"file": "durable.yaml"})).
+			AddNode(&Node{ID: "first", Func: first}, &Node{ID: "second", Func: second}).
+			Connect("first", "second")
+	}
+
+	store, err := storage.NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	result, err := build(store).Run(ctx, "x")
+	if !errors.Is(err, ErrNodeFailed) {
+		t.Fatalf("expected ErrNodeFailed, got %v", err)
+	}
+	runID := result.Metadata["run_id"].(string)
+	store.Close()
+
+	// A new process opens the same database and resumes the run
+	store, err = storage.NewSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	checkpoints := NewCheckpoints(store)
+	state, err := checkpoints.Load(ctx, runID)
+	if err != nil {
+		t.Fatalf("failed to load run: %v", err)
+	}
+	if state.Status != RunFailed || state.Node("first").Status != StatusDone || state.Node("second").Status != StatusFailed {
+		t.Fatalf("unexpected checkpoint %+v", state)
+	}
+	if state.Labels["file"] != "durable.yaml" || state.Input != "x" {
+		t.Errorf("unexpected labels or input: %v %q", state.Labels, state.Input)
+	}
+
+	broken = false
+	result, err = build(store).Resume(ctx, runID)
+	if err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+
+	if result.Output != "second:first:x" {
+		t.Errorf("unexpected output %q", result.Output)
+	}
+	if firstCalls.Load() != 1 {
+		t.Errorf("expected completed node not to run again, ran %d times", firstCalls.Load())
+	}
+
+	state, _ = checkpoints.Load(ctx, runID)
+	if state.Status != RunCompleted || state.Output != "second:first:x" {
+		t.Errorf("expected completed checkpoint, got %s %q", state.Status, state.Output)
+	}
+
+	if _, err := build(store).Resume(ctx, runID); !errors.Is(err, ErrRunCompleted) {
+		t.Errorf("expected ErrRunCompleted, got %v", err)
+	}
+	if _, err := New("other", WithCheckpoints(checkpoints)).AddNode(&Node{ID: "a", Func: first}).Resume(ctx, runID); !errors.Is(err, ErrWorkflowMismatch) {
+		t.Errorf("expected ErrWorkflowMismatch, got %v", err)
+	}
+	if _, err := New("plain").AddNode(&Node{ID: "a", Func: first}).Resume(ctx, runID); err != ErrNoCheckpoints {
+		t.Errorf("expected ErrNoCheckpoints, got %v", err)
+	}
+}
+
+func TestCheckpoints_Cancel(t *testing.T) {
+	ctx := context.Background()
+
+	checkpoints := NewCheckpoints(storage.NewMemoryStore(), WithCancelPollInterval(5*time.Millisecond))
+
+	started := make(chan struct{})
+	blocked := func(ctx context.Context, input string, outputs map[string]string) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+
+	w := New("cancel", WithCheckpoints(checkpoints)).AddNode(&Node{ID: "wait", Func: blocked})
+
+	go func() {
+		<-started
+		if err := checkpoints.Cancel(ctx, "run-1"); err != nil {
+			t.Errorf("failed to cancel: %v", err)
+		}
+	}()
+
+	_, err := w.RunWithID(ctx, "run-1", "")
+	if !errors.Is(err, ErrRunCancelled) {
+		t.Fatalf("expected ErrRunCancelled, got %v", err)
+	}
+
+	state, err := checkpoints.Load(ctx, "run-1")
+	if err != nil {
+		t.Fatalf("failed to load run: %v", err)
+	}
+	if state.Status != RunCancelled {
+		t.Errorf("expected cancelled status, got %s", state.Status)
+	}
+
+	if err := checkpoints.Cancel(ctx, "missing"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("expected ErrRunNotFound, got %v", err)
+	}
+}
+
+func TestCheckpoints_ListAndDelete(t *testing.T) {
+	ctx := context.Background()
+
+	checkpoints := NewCheckpoints(storage.NewMemoryStore())
+	w := New("list", WithCheckpoints(checkpoints)).AddNode(&Node{ID: "a", Func: echo("")})
+
+	for _, id := range []string{"run-1", "run-2"} {
+		if _, err := w.RunWithID(ctx, id, id); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	runs, err := checkpoints.List(ctx)
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != "run-2" {
+		t.Errorf("expected 2 runs, newest first, got %+v", runs)
+	}
+
+	if err := checkpoints.Delete(ctx, "run-1"); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if _, err := checkpoints.Load(ctx, "run-1"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("expected ErrRunNotFound, got %v", err)
+	}
+}
+
+func TestWorkflow_Chain(t *testing.T) {
+	ctx := context.Background()
+
+	upper := agent.New("editor").Model(provider.NewMockWithResponse("edited")).Build()
+	again := agent.New("editor").Model(provider.NewMockWithResponse("edited twice")).Build()
+
+	w := New("pipeline").Chain(upper, again)
+
+	if ids := []string{w.Nodes()[0].ID, w.Nodes()[1].ID}; ids[0] != "editor" || ids[1] != "editor-2" {
+		t.Errorf("unexpected node IDs %v", ids)
+	}
+
+	result, err := w.Run(ctx, "draft")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Output != "edited twice" {
+		t.Errorf("unexpected output %q", result.Output)
+	}
+}
+
+func TestWorkflow_Approval(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+
+	// Approvers poll the queue, as the HTTP server does
+	approver := approval.NewQueue(store)
+	decide := func(deny bool) {
+		for {
+			pending, _ := approver.List(ctx, approval.StatusPending)
+			if len(pending) == 0 {
+				time.Sleep(time.Millisecond)
+				continue
+			}
+			if pending[0].Agent != "workflow:deploy" || pending[0].Tool != "release" {
+				t.Errorf("unexpected approval %+v", pending[0])
+			}
+			if deny {
+				approver.Deny(ctx, pending[0].ID, "ops", "frozen")
+			} else {
+				approver.Approve(ctx, pending[0].ID, "ops", "")
+			}
+			return
+		}
+	}
+
+	newWorkflow := func() *Workflow {
+		return New("deploy",
+			WithCheckpoints(NewCheckpoints(store)),
+			WithApprovals(approval.NewQueue(store, approval.WithPollInterval(time.Millisecond))),
+		).
+			AddNode(
+				&Node{ID: "build", Func: echo("built ")},
+				&Node{ID: "release", Func: echo("released "), Approval: true},
+				&Node{ID: "rollback", Func: echo("rolled back ")},
+			).
+			Connect("build", "release").
+			AddEdge(Edge{From: "release", To: "rollback", On: EdgeFailure})
+	}
+
+	go decide(false)
+	result, err := newWorkflow().Run(ctx, "v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rep := report(t, result).Node("release"); rep.Status != StatusDone || rep.Output != "released built v1" {
+		t.Errorf("unexpected release report %+v", rep)
+	}
+
+	go decide(true)
+	result, err = newWorkflow().Run(ctx, "v2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rep := report(t, result).Node("release")
+	if rep.Status != StatusFailed || !strings.Contains(rep.Error, "frozen") || rep.Attempts != 0 {
+		t.Errorf("unexpected release report %+v", rep)
+	}
+
+	// Approval nodes need somewhere to wait
+	w := New("no-queue").AddNode(&Node{ID: "a", Func: echo(""), Approval: true})
+	if err := w.Validate(); !errors.Is(err, ErrInvalidWorkflow) {
+		t.Errorf("expected ErrInvalidWorkflow, got %v", err)
+	}
+}
+
+func TestWorkflow_ToolApprovals(t *testing.T) {
+	ctx := context.Background()
+
+	var dropped atomic.Int32
+	drop := tool.Func("drop_table", "Drops a table", func(ctx context.Context, in struct {
+		Table string `json:"table"`
+	}) (string, error) {
+		dropped.Add(1)
+		return "dropped " + in.Table, nil
+	})
+
+	var asked atomic.Int32
+	var q *approval.Queue
+	q = approval.NewQueue(storage.NewMemoryStore(), approval.WithPollInterval(time.Millisecond), approval.WithNotify(func(a *approval.Approval) {
+		asked.Add(1)
+		if a.Agent != "workflow:cleanup" || a.Tool != "drop_table" {
+			t.Errorf("unexpected approval %+v", a)
+		}
+		go q.Deny(context.Background(), a.ID, "dba", "not in production")
+	}))
+	policy, _ := approval.NewPolicy(approval.Rule{Tool: "drop_*"})
+
+	w := New("cleanup", WithToolApprovals(approval.NewGate(policy, q))).
+		AddNode(&Node{ID: "drop", Tool: drop, Retries: 2}, &Node{ID: "report", Func: echo("kept: ")}).
+		AddEdge(Edge{From: "drop", To: "report", On: EdgeFailure})
+
+	result, err := w.Run(ctx, `{"table": "users"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rep := report(t, result).Node("drop")
+	if rep.Status != StatusFailed || !strings.Contains(rep.Error, "not in production") || rep.Attempts != 1 {
+		t.Errorf("unexpected drop report %+v", rep)
+	}
+	if dropped.Load() != 0 || asked.Load() != 1 {
+		t.Errorf("expected one denied request and no drop, got %d requests and %d drops", asked.Load(), dropped.Load())
+	}
+}
+
+func TestCheckpoints_Lease(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	slow := func(ctx context.Context, input string, outputs map[string]string) (string, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		return "done", nil
+	}
+	build := func() *Workflow {
+		return New("leased", WithCheckpoints(NewCheckpoints(store))).AddNode(&Node{ID: "a", Func: slow})
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := build().RunWithID(ctx, "run-1", "")
+		done <- err
+	}()
+	<-started
+
+	// Another process must not run the live run a second time
+	if _, err := build().Resume(ctx, "run-1"); !errors.Is(err, ErrRunActive) {
+		t.Errorf("expected ErrRunActive on resume, got %v", err)
+	}
+	if _, err := build().RunWithID(ctx, "run-1", ""); !errors.Is(err, ErrRunActive) {
+		t.Errorf("expected ErrRunActive on run, got %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected one execution, got %d", calls.Load())
+	}
+	if store.Exists(ctx, leaseKeyPrefix+"run-1") {
+		t.Error("expected the lease to be released")
+	}
+}
+
+func TestCheckpoints_LeaseTakenOver(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	checkpoints := NewCheckpoints(store, WithCancelPollInterval(5*time.Millisecond))
+
+	started := make(chan struct{})
+	blocked := func(ctx context.Context, input string, outputs map[string]string) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	w := New("stolen", WithCheckpoints(checkpoints)).AddNode(&Node{ID: "wait", Func: blocked})
+
+	go func() {
+		<-started
+		// The lease expired and another process took the run over
+		store.Set(ctx, leaseKeyPrefix+"run-1", []byte("other"), time.Minute)
+	}()
+
+	if _, err := w.RunWithID(ctx, "run-1", ""); !errors.Is(err, ErrRunTakenOver) {
+		t.Fatalf("expected ErrRunTakenOver, got %v", err)
+	}
+
+	state, err := checkpoints.Load(ctx, "run-1")
+	if err != nil {
+		t.Fatalf("failed to load run: %v", err)
+	}
+	if state.Status != RunRunning {
+		t.Errorf("expected the checkpoint to be left to the new owner, got %s", state.Status)
+	}
+	if owner, _ := store.Get(ctx, leaseKeyPrefix+"run-1"); string(owner) != "other" {
+		t.Errorf("expected the new owner to keep the lease, got %q", owner)
+	}
+}
+
+func TestCheckpoints_Pipeline(t *testing.T) {
+	ctx := context.Background()
+	checkpoints := NewCheckpoints(storage.NewMemoryStore())
+
+	var researchCalls atomic.Int32
+	researcher := agent.New("researcher").Model(&provider.MockProvider{
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			researchCalls.Add(1)
+			return &provider.ChatResponse{Content: "notes", StopReason: provider.StopReasonEndTurn}, nil
+		},
+	}).Build()
+
+	broken := true
+	writer := agent.New("writer").Model(&provider.MockProvider{
+		ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+			if broken {
+				return nil, errors.New("crashed")
+			}
+			return &provider.ChatResponse{Content: "article from " + req.Messages[0].Content, StopReason: provider.StopReasonEndTurn}, nil
+		},
+	}).Build()
+
+	pipeline := patterns.NewSequential(researcher, writer).WithCheckpoints(checkpoints.Pipeline("article"))
+
+	if _, err := pipeline.RunWithID(ctx, "run-1", "topic"); !errors.Is(err, ErrNodeFailed) {
+		t.Fatalf("expected ErrNodeFailed, got %v", err)
+	}
+
+	state, err := checkpoints.Load(ctx, "run-1")
+	if err != nil {
+		t.Fatalf("failed to load run: %v", err)
+	}
+	rep := state.Node("researcher")
+	if rep == nil || rep.Status != StatusDone || len(rep.Messages) != 2 || rep.Messages[1].Content != "notes" {
+		t.Fatalf("expected the researcher's conversation in the checkpoint, got %+v", rep)
+	}
+
+	broken = false
+	result, err := pipeline.Resume(ctx, "run-1")
+	if err != nil {
+		t.Fatalf("failed to resume: %v", err)
+	}
+	if result.Output != "article from notes" {
+		t.Errorf("unexpected output %q", result.Output)
+	}
+	if researchCalls.Load() != 1 {
+		t.Errorf("expected the researcher not to run again, ran %d times", researchCalls.Load())
+	}
+
+	if _, err := patterns.NewSequential(researcher).Resume(ctx, "run-1"); !errors.Is(err, patterns.ErrNoCheckpointer) {
+		t.Errorf("expected ErrNoCheckpointer, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package workflow
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Condition decides whether an edge is taken, given the source node's
+// output.
+type Condition func(output string) bool
+
+// Contains matches outputs containing substr, ignoring case.
+func Contains(substr string) Condition {
+	substr = strings.ToLower(substr)
+	return func(output string) bool {
+		return strings.Contains(strings.ToLower(output), substr)
+	}
+}
+
+// Equals matches outputs equal to s, ignoring case and surrounding space.
+func Equals(s string) Condition {
+	return func(output string) bool {
+		return strings.EqualFold(strings.TrimSpace(output), strings.TrimSpace(s))
+	}
+}
+
+// Matches matches outputs against a regular expression.
+func Matches(re *regexp.Regexp) Condition {
+	return func(output string) bool {
+		return re.MatchString(output)
+	}
+}
+
+// Not negates a condition.
+func Not(c Condition) Condition {
+	return func(output string) bool {
+		return !c(output)
+	}
+}
+
+// All matches when every condition matches.
+func All(conds ...Condition) Condition {
+	return func(output string) bool {
+		for _, c := range conds {
+			if !c(output) {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,624 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/storo/lattice/pkg/approval"
+	"github.com/storo/lattice/pkg/core"
+)
+
+// NodeStatus is the state of a node in a run.
+type NodeStatus string
+
+const (
+	StatusPending NodeStatus = "pending"
+	StatusRunning NodeStatus = "running"
+	StatusDone    NodeStatus = "done"
+	StatusFailed  NodeStatus = "failed"
+	StatusSkipped NodeStatus = "skipped"
+)
+
+// NodeReport describes how a node ran.
+type NodeReport struct {
+	ID         string        `json:"id"`
+	Kind       string        `json:"kind"`
+	Status     NodeStatus    `json:"status"`
+	Input      string        `json:"input,omitempty"`
+	Output     string        `json:"output,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Attempts   int           `json:"attempts,omitempty"`
+	StartedAt  time.Time     `json:"started_at,omitzero"`
+	FinishedAt time.Time     `json:"finished_at,omitzero"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	TokensIn   int           `json:"tokens_in,omitempty"`
+	TokensOut  int           `json:"tokens_out,omitempty"`
+
+	// Messages is the conversation of an agent node, when its agent
+	// reports one.
+	Messages []core.Message `json:"messages,omitempty"`
+}
+
+// Report describes a workflow run. Nodes are in definition order.
+type Report struct {
+	Workflow  string        `json:"workflow"`
+	Nodes     []*NodeReport `json:"nodes"`
+	TokensIn  int           `json:"tokens_in"`
+	TokensOut int           `json:"tokens_out"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// Node returns the report of a node, or nil.
+func (r *Report) Node(id string) *NodeReport {
+	for _, n := range r.Nodes {
+		if n.ID == id {
+			return n
+		}
+	}
+	return nil
+}
+
+// Run executes the workflow. Nodes whose incoming edges are resolved run
+// concurrently. A node that fails without an outgoing failure or always
+// edge stops the run: no new nodes start and Run returns ErrNodeFailed
+// along with the partial result.
+//
+// Metadata holds the "run_id", the "report" (*Report), "outputs" (node ID
+// to output), "tokens_in" and "tokens_out".
+func (w *Workflow) Run(ctx context.Context, input string) (*core.Result, error) {
+	return w.RunWithID(ctx, uuid.New().String(), input)
+}
+
+// RunWithID is Run with a caller-chosen run ID, used as the checkpoint key.
+func (w *Workflow) RunWithID(ctx context.Context, runID, input string) (*core.Result, error) {
+	now := time.Now()
+	state := &RunState{
+		ID:        runID,
+		Workflow:  w.name,
+		Input:     input,
+		Labels:    w.labels,
+		CreatedAt: now,
+	}
+
+	if w.checkpoints != nil {
+		if err := w.checkpoints.acquire(ctx, runID); err != nil {
+			return nil, err
+		}
+		defer w.checkpoints.release(context.WithoutCancel(ctx), runID)
+	}
+	return w.execute(ctx, state)
+}
+
+// Resume continues a checkpointed run. Nodes that completed keep their
+// outputs; failed, skipped and unfinished nodes run again. Returns
+// ErrRunActive while another process holds the run's lease.
+func (w *Workflow) Resume(ctx context.Context, runID string) (*core.Result, error) {
+	if w.checkpoints == nil {
+		return nil, ErrNoCheckpoints
+	}
+
+	// Hold the lease before reading the run, so that it is not resumed
+	// twice
+	if err := w.checkpoints.acquire(ctx, runID); err != nil {
+		return nil, err
+	}
+	defer w.checkpoints.release(context.WithoutCancel(ctx), runID)
+
+	state, err := w.checkpoints.Load(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	if state.Workflow != w.name {
+		return nil, fmt.Errorf("%w: run %s is from %q", ErrWorkflowMismatch, runID, state.Workflow)
+	}
+	if state.Status == RunCompleted {
+		return nil, fmt.Errorf("%w: %s", ErrRunCompleted, runID)
+	}
+	if err := w.checkpoints.clearCancel(ctx, runID); err != nil {
+		return nil, err
+	}
+
+	if state.TraceID != "" && core.TraceID(ctx) == "" {
+		ctx = core.WithTraceID(ctx, state.TraceID)
+	}
+	return w.execute(ctx, state)
+}
+
+// execute runs the workflow from a checkpoint state.
+func (w *Workflow) execute(ctx context.Context, state *RunState) (*core.Result, error) {
+	g, err := w.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure we have a trace ID shared by all nodes
+	if core.TraceID(ctx) == "" {
+		ctx = core.WithTraceID(ctx, uuid.New().String())
+	}
+
+	r := &run{
+		w:       w,
+		g:       g,
+		state:   state,
+		input:   state.Input,
+		start:   time.Now(),
+		reports: make(map[string]*NodeReport, len(w.nodes)),
+		outputs: make(map[string]string, len(w.nodes)),
+	}
+	for _, n := range w.nodes {
+		r.reports[n.ID] = &NodeReport{ID: n.ID, Kind: n.kind(), Status: StatusPending}
+
+		// Completed nodes from an earlier attempt are kept
+		if prev := state.Node(n.ID); prev != nil && prev.Status == StatusDone {
+			r.reports[n.ID] = prev
+			r.outputs[n.ID] = prev.Output
+		}
+	}
+
+	state.Status = RunRunning
+	state.Error = ""
+	state.TraceID = core.TraceID(ctx)
+	if err := r.checkpoint(ctx); err != nil {
+		return nil, err
+	}
+
+	err = r.execute(ctx)
+
+	state.Status = RunCompleted
+	switch {
+	case r.takenOver.Load():
+		// The process that took the run over owns its checkpoint now
+		return r.result(ctx), fmt.Errorf("%w: %s", ErrRunTakenOver, state.ID)
+	case r.cancelled.Load():
+		state.Status = RunCancelled
+		err = fmt.Errorf("%w: %s", ErrRunCancelled, state.ID)
+	case err != nil:
+		state.Status = RunFailed
+	}
+	if err != nil {
+		state.Error = err.Error()
+	}
+
+	result := r.result(ctx)
+	state.Output = result.Output
+	if cpErr := r.checkpoint(context.WithoutCancel(ctx)); cpErr != nil && err == nil {
+		err = cpErr
+	}
+
+	return result, err
+}
+
+// run is the state of one Run.
+type run struct {
+	w         *Workflow
+	g         *graph
+	state     *RunState
+	input     string
+	start     time.Time
+	reports   map[string]*NodeReport
+	outputs   map[string]string
+	cancelled atomic.Bool
+	takenOver atomic.Bool
+}
+
+// checkpoint saves the run state, if the workflow has checkpoints.
+func (r *run) checkpoint(ctx context.Context) error {
+	if r.w.checkpoints == nil {
+		return nil
+	}
+
+	r.state.Nodes = r.state.Nodes[:0]
+	r.state.TokensIn, r.state.TokensOut = 0, 0
+	for _, n := range r.w.nodes {
+		rep := r.reports[n.ID]
+		r.state.Nodes = append(r.state.Nodes, rep)
+		r.state.TokensIn += rep.TokensIn
+		r.state.TokensOut += rep.TokensOut
+	}
+	r.state.UpdatedAt = time.Now()
+
+	if err := r.w.checkpoints.saveLeased(ctx, r.state); err != nil {
+		if errors.Is(err, ErrRunTakenOver) {
+			r.takenOver.Store(true)
+		}
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// heartbeat renews the run's lease and cancels the run when
+// Checkpoints.Cancel is called for it or when the lease is lost.
+func (r *run) heartbeat(ctx context.Context, cancel context.CancelFunc) {
+	c := r.w.checkpoints
+	ticker := time.NewTicker(min(c.pollInterval, c.leaseTTL/3))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if c.cancelled(ctx, r.state.ID) {
+				r.cancelled.Store(true)
+				cancel()
+				return
+			}
+			if !c.renew(ctx, r.state.ID) {
+				r.takenOver.Store(true)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// outcome is the result of running one node.
+type outcome struct {
+	id       string
+	result   *core.Result
+	attempts int
+	err      error
+}
+
+// execute schedules nodes until none can run.
+func (r *run) execute(parent context.Context) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	if r.w.checkpoints != nil {
+		go r.heartbeat(ctx, cancel)
+	}
+
+	done := make(chan outcome)
+	running := 0
+	var failure error
+
+	for {
+		for progress := true; progress && failure == nil; {
+			progress = false
+			for _, n := range r.w.nodes {
+				if failure != nil {
+					break
+				}
+
+				rep := r.reports[n.ID]
+				if rep.Status != StatusPending {
+					continue
+				}
+
+				ready, taken := r.ready(n)
+				if !ready {
+					continue
+				}
+				if !taken {
+					rep.Status = StatusSkipped
+					progress = true
+					continue
+				}
+				if r.w.maxConcurrency > 0 && running >= r.w.maxConcurrency {
+					continue
+				}
+
+				rep.Status = StatusRunning
+				rep.StartedAt = time.Now()
+				progress = true
+
+				input, err := r.nodeInput(n)
+				if err != nil {
+					if err := r.finish(outcome{id: n.ID, err: err}); err != nil {
+						failure = err
+						cancel()
+					}
+					continue
+				}
+				rep.Input = input
+
+				running++
+				outputs := r.copyOutputs()
+				go func(n *Node) {
+					result, attempts, err := r.runNode(ctx, n, input, outputs)
+					done <- outcome{id: n.ID, result: result, attempts: attempts, err: err}
+				}(n)
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		o := <-done
+		running--
+		if err := r.finish(o); err != nil && failure == nil {
+			failure = err
+			cancel()
+		}
+		if err := r.checkpoint(context.WithoutCancel(parent)); err != nil && failure == nil {
+			failure = err
+			cancel()
+		}
+	}
+
+	// Anything that never started was cut off by a failure
+	for _, rep := range r.reports {
+		if rep.Status == StatusPending {
+			rep.Status = StatusSkipped
+		}
+	}
+
+	if err := parent.Err(); err != nil {
+		return err
+	}
+	if r.takenOver.Load() {
+		return ErrRunTakenOver
+	}
+	if r.cancelled.Load() {
+		return ErrRunCancelled
+	}
+	return failure
+}
+
+// ready reports whether all of a node's upstream nodes are resolved and,
+// if so, whether enough incoming edges were taken for it to run.
+func (r *run) ready(n *Node) (ready, taken bool) {
+	edges := r.g.incoming[n.ID]
+	if len(edges) == 0 {
+		return true, true
+	}
+
+	count := 0
+	for _, e := range edges {
+		switch r.reports[e.From].Status {
+		case StatusPending, StatusRunning:
+			return false, false
+		}
+		if r.taken(e) {
+			count++
+		}
+	}
+
+	if n.Join == JoinAny {
+		return true, count > 0
+	}
+	return true, count == len(edges)
+}
+
+// taken reports whether a resolved edge is followed.
+func (r *run) taken(e Edge) bool {
+	rep := r.reports[e.From]
+
+	var value string
+	switch rep.Status {
+	case StatusDone:
+		if e.On == EdgeFailure {
+			return false
+		}
+		value = rep.Output
+	case StatusFailed:
+		if e.On != EdgeFailure && e.On != EdgeAlways {
+			return false
+		}
+		value = rep.Error
+	default:
+		return false
+	}
+
+	return e.When == nil || e.When(value)
+}
+
+// nodeInput renders a node's input template, or joins the outputs of the
+// upstream nodes that succeeded.
+func (r *run) nodeInput(n *Node) (string, error) {
+	if tmpl, ok := r.g.templates[n.ID]; ok {
+		var sb strings.Builder
+		data := map[string]any{"Input": r.input, "Outputs": r.outputs}
+		if err := tmpl.Execute(&sb, data); err != nil {
+			return "", fmt.Errorf("failed to render input: %w", err)
+		}
+		return sb.String(), nil
+	}
+
+	var parts []string
+	for _, e := range r.g.incoming[n.ID] {
+		if r.reports[e.From].Status == StatusDone && r.taken(e) {
+			parts = append(parts, r.outputs[e.From])
+		}
+	}
+	if len(parts) == 0 {
+		return r.input, nil
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// finish records a node's outcome. Returns an error if the node failed
+// and no edge handles the failure.
+func (r *run) finish(o outcome) error {
+	rep := r.reports[o.id]
+	rep.FinishedAt = time.Now()
+	rep.Duration = rep.FinishedAt.Sub(rep.StartedAt)
+	rep.Attempts = o.attempts
+
+	if o.result != nil {
+		rep.TokensIn = o.result.TokensIn
+		rep.TokensOut = o.result.TokensOut
+		rep.Messages, _ = o.result.Metadata["messages"].([]core.Message)
+	}
+
+	if o.err != nil {
+		rep.Status = StatusFailed
+		rep.Error = o.err.Error()
+
+		for _, e := range r.g.outgoing[o.id] {
+			if e.On == EdgeFailure || e.On == EdgeAlways {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s: %v", ErrNodeFailed, o.id, o.err)
+	}
+
+	rep.Status = StatusDone
+	rep.Output = o.result.Output
+	r.outputs[o.id] = o.result.Output
+	return nil
+}
+
+// copyOutputs snapshots the outputs for a node running concurrently.
+func (r *run) copyOutputs() map[string]string {
+	outputs := make(map[string]string, len(r.outputs))
+	for id, out := range r.outputs {
+		outputs[id] = out
+	}
+	return outputs
+}
+
+// runNode executes a node, retrying failed attempts.
+func (r *run) runNode(ctx context.Context, n *Node, input string, outputs map[string]string) (*core.Result, int, error) {
+	var (
+		result *core.Result
+		err    error
+	)
+
+	if n.Approval {
+		params, _ := json.Marshal(map[string]string{"run_id": r.state.ID, "input": input})
+		err := r.w.approvalQueue().Authorize(ctx, &approval.Approval{
+			Agent:   "workflow:" + r.w.name,
+			Tool:    n.ID,
+			Params:  params,
+			Reason:  fmt.Sprintf("workflow step %s requires approval", n.ID),
+			TraceID: core.TraceID(ctx),
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	attempts := 0
+	for attempts <= n.Retries {
+		if attempts > 0 && n.RetryDelay > 0 {
+			select {
+			case <-time.After(n.RetryDelay):
+			case <-ctx.Done():
+				return nil, attempts, ctx.Err()
+			}
+		}
+		attempts++
+
+		// A denied tool call would only be asked again
+		result, err = r.attempt(ctx, n, input, outputs)
+		if err == nil || ctx.Err() != nil || errors.Is(err, approval.ErrDenied) {
+			break
+		}
+	}
+
+	return result, attempts, err
+}
+
+// attempt executes a node once, within its timeout.
+func (r *run) attempt(ctx context.Context, n *Node, input string, outputs map[string]string) (result *core.Result, err error) {
+	if n.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.Timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			result, err = nil, fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	switch {
+	case n.Agent != nil:
+		// Agents run as the mesh runs them, with its delegation tools
+		if p, ok := r.w.delegator.(agentPreparer); ok {
+			if err := p.PrepareAgent(ctx, n.Agent); err != nil {
+				return nil, err
+			}
+		}
+		return n.Agent.Run(ctx, input)
+	case n.Capability != "":
+		return r.w.delegator.Delegate(ctx, n.Capability, input)
+	case n.Tool != nil:
+		params := json.RawMessage(input)
+		if strings.TrimSpace(input) == "" {
+			params = json.RawMessage(`{}`)
+		}
+		if err := core.ValidateJSON(n.Tool.Schema(), params); err != nil {
+			return nil, err
+		}
+		if r.w.toolGate != nil {
+			if err := r.w.toolGate.Check(ctx, "workflow:"+r.w.name, n.Tool.Name(), params); err != nil {
+				return nil, fmt.Errorf("tool call not approved: %w", err)
+			}
+		}
+		output, err := n.Tool.Execute(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		return &core.Result{Output: output}, nil
+	default:
+		output, err := n.Func(ctx, input, outputs)
+		if err != nil {
+			return nil, err
+		}
+		return &core.Result{Output: output}, nil
+	}
+}
+
+// result builds the Run result from the current state.
+func (r *run) result(ctx context.Context) *core.Result {
+	report := &Report{
+		Workflow: r.w.name,
+		Duration: time.Since(r.start),
+	}
+	for _, n := range r.w.nodes {
+		rep := r.reports[n.ID]
+		report.Nodes = append(report.Nodes, rep)
+		report.TokensIn += rep.TokensIn
+		report.TokensOut += rep.TokensOut
+	}
+
+	return &core.Result{
+		Output:    r.output(),
+		TokensIn:  report.TokensIn,
+		TokensOut: report.TokensOut,
+		Duration:  report.Duration,
+		TraceID:   core.TraceID(ctx),
+		CallChain: core.CallChain(ctx),
+		Metadata: map[string]any{
+			"run_id":     r.state.ID,
+			"report":     report,
+			"outputs":    r.outputs,
+			"tokens_in":  report.TokensIn,
+			"tokens_out": report.TokensOut,
+		},
+	}
+}
+
+// output is the output node's output, or that of the last completed node
+// without outgoing edges.
+func (r *run) output() string {
+	if r.w.output != "" {
+		return r.outputs[r.w.output]
+	}
+
+	var last *NodeReport
+	for _, n := range r.w.nodes {
+		rep := r.reports[n.ID]
+		if len(r.g.outgoing[n.ID]) > 0 || rep.Status != StatusDone {
+			continue
+		}
+		if last == nil || rep.FinishedAt.After(last.FinishedAt) {
+			last = rep
+		}
+	}
+	if last == nil {
+		return ""
+	}
+	return last.Output
+}
@@ -0,0 +1,424 @@
+// Package workflow runs agents, tools and Go functions as a directed
+// acyclic graph. Edges can be conditional, independent nodes run
+// concurrently, and every run produces a per-node report.
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/storo/lattice/pkg/approval"
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/patterns"
+)
+
+// Workflow errors
+var (
+	ErrInvalidWorkflow = errors.New("invalid workflow")
+	ErrCycle           = errors.New("workflow has a cycle")
+	ErrNodeFailed      = errors.New("workflow node failed")
+	ErrNoDelegator     = errors.New("capability node needs a delegator")
+)
+
+// Func is a Go function used as a node. It receives the node's rendered
+// input and the outputs of the nodes completed so far.
+type Func func(ctx context.Context, input string, outputs map[string]string) (string, error)
+
+// JoinMode decides whether a node with several incoming edges runs.
+type JoinMode string
+
+const (
+	// JoinAll runs the node only if every incoming edge is taken.
+	JoinAll JoinMode = "all"
+
+	// JoinAny runs the node if at least one incoming edge is taken.
+	JoinAny JoinMode = "any"
+)
+
+// Node is a step of a workflow. Exactly one of Agent, Capability, Tool or
+// Func must be set.
+type Node struct {
+	ID string
+
+	// Agent runs the node on a specific agent.
+	Agent core.Agent
+
+	// Capability runs the node on any agent with the capability, through
+	// the workflow's delegator (a mesh or a supervisor).
+	Capability core.Capability
+
+	// Tool executes a tool. The rendered input must be its JSON params.
+	Tool core.Tool
+
+	// Func calls a Go function.
+	Func Func
+
+	// Input is a text/template for the node's input, with .Input (the
+	// workflow input), .Outputs (node ID to output) and a json function
+	// that quotes a string. When empty, the node receives the outputs of
+	// the upstream nodes that succeeded, separated by blank lines, or the
+	// workflow input if there are none.
+	Input string
+
+	// Join applies when the node has several incoming edges (default: all).
+	Join JoinMode
+
+	// Retries is the number of extra attempts after a failure.
+	Retries int
+
+	// RetryDelay is the pause between attempts.
+	RetryDelay time.Duration
+
+	// Timeout bounds each attempt. Zero means no timeout.
+	Timeout time.Duration
+
+	// Approval holds the node, once its input is ready, until a human
+	// approves it through the workflow's approval queue. A denied node
+	// fails without retries, so failure edges can handle it.
+	Approval bool
+}
+
+// kind describes what the node runs, for error messages and reports.
+func (n *Node) kind() string {
+	switch {
+	case n.Agent != nil:
+		return "agent"
+	case n.Capability != "":
+		return "capability"
+	case n.Tool != nil:
+		return "tool"
+	case n.Func != nil:
+		return "func"
+	}
+	return ""
+}
+
+// EdgeType decides which outcome of the source node takes an edge.
+type EdgeType string
+
+const (
+	// EdgeSuccess is taken when the source succeeds (the default).
+	EdgeSuccess EdgeType = "success"
+
+	// EdgeFailure is taken when the source fails after all retries.
+	// A failure edge marks the failure as handled.
+	EdgeFailure EdgeType = "failure"
+
+	// EdgeAlways is taken whether the source succeeds or fails.
+	EdgeAlways EdgeType = "always"
+)
+
+// Edge connects two nodes. When is evaluated on the source's output (or
+// its error message, for a failed source); a nil When always matches.
+type Edge struct {
+	From string
+	To   string
+	On   EdgeType
+	When Condition
+}
+
+// Workflow is a graph of nodes and edges.
+type Workflow struct {
+	name           string
+	nodes          []*Node
+	edges          []Edge
+	output         string
+	delegator      patterns.Delegator
+	maxConcurrency int
+	checkpoints    *Checkpoints
+	approvals      *approval.Queue
+	toolGate       *approval.Gate
+	labels         map[string]string
+}
+
+// Option configures a workflow.
+type Option func(*Workflow)
+
+// New creates an empty workflow.
+func New(name string, opts ...Option) *Workflow {
+	w := &Workflow{name: name}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// WithDelegator sets how capability nodes are run. Both *mesh.Mesh and
+// *patterns.Supervisor can be used. A mesh also prepares agent nodes
+// before they run, giving them its delegation tools.
+func WithDelegator(d patterns.Delegator) Option {
+	return func(w *Workflow) {
+		w.delegator = d
+	}
+}
+
+// agentPreparer is implemented by delegators, such as *mesh.Mesh, that
+// prepare agents before running them.
+type agentPreparer interface {
+	PrepareAgent(ctx context.Context, a core.Agent) error
+}
+
+// WithMaxConcurrency limits how many nodes run at once (default: no limit).
+func WithMaxConcurrency(n int) Option {
+	return func(w *Workflow) {
+		w.maxConcurrency = n
+	}
+}
+
+// WithOutput sets the node whose output is the workflow's output. By
+// default it is the last completed node without outgoing edges.
+func WithOutput(nodeID string) Option {
+	return func(w *Workflow) {
+		w.output = nodeID
+	}
+}
+
+// WithCheckpoints saves a checkpoint after every node, so that runs can
+// be resumed with Resume and cancelled with Checkpoints.Cancel.
+func WithCheckpoints(c *Checkpoints) Option {
+	return func(w *Workflow) {
+		w.checkpoints = c
+	}
+}
+
+// WithApprovals sets the queue that approval nodes wait on. Without it,
+// workflows with checkpoints use an approval queue on the checkpoint store.
+func WithApprovals(q *approval.Queue) Option {
+	return func(w *Workflow) {
+		w.approvals = q
+	}
+}
+
+// WithToolApprovals checks the calls of tool nodes with g, as agents check
+// their own tool calls. Approvals are requested by "workflow:<name>", and
+// a denied call fails its node without retries.
+func WithToolApprovals(g *approval.Gate) Option {
+	return func(w *Workflow) {
+		w.toolGate = g
+	}
+}
+
+// WithLabels attaches labels to the runs' checkpoints, for example the
+// file the workflow was loaded from.
+func WithLabels(labels map[string]string) Option {
+	return func(w *Workflow) {
+		w.labels = labels
+	}
+}
+
+// Name returns the workflow name.
+func (w *Workflow) Name() string {
+	return w.name
+}
+
+// AddNode adds nodes to the workflow.
+func (w *Workflow) AddNode(nodes ...*Node) *Workflow {
+	w.nodes = append(w.nodes, nodes...)
+	return w
+}
+
+// AddEdge adds edges to the workflow.
+func (w *Workflow) AddEdge(edges ...Edge) *Workflow {
+	w.edges = append(w.edges, edges...)
+	return w
+}
+
+// Connect adds a success edge between each consecutive pair of nodes.
+func (w *Workflow) Connect(ids ...string) *Workflow {
+	for i := 1; i < len(ids); i++ {
+		w.edges = append(w.edges, Edge{From: ids[i-1], To: ids[i]})
+	}
+	return w
+}
+
+// Chain adds an agent node for each agent, connected in order like a
+// patterns.Sequential pipeline. Node IDs are the agent names, with a
+// numeric suffix for repeats.
+func (w *Workflow) Chain(agents ...core.Agent) *Workflow {
+	used := make(map[string]bool, len(w.nodes))
+	for _, n := range w.nodes {
+		used[n.ID] = true
+	}
+
+	var ids []string
+	for _, a := range agents {
+		id := a.Name()
+		for i := 2; used[id]; i++ {
+			id = fmt.Sprintf("%s-%d", a.Name(), i)
+		}
+		used[id] = true
+
+		w.nodes = append(w.nodes, &Node{ID: id, Agent: a})
+		ids = append(ids, id)
+	}
+
+	return w.Connect(ids...)
+}
+
+// Nodes returns the workflow's nodes.
+func (w *Workflow) Nodes() []*Node {
+	return w.nodes
+}
+
+// Edges returns the workflow's edges.
+func (w *Workflow) Edges() []Edge {
+	return w.edges
+}
+
+// Validate checks that the workflow is a well-formed acyclic graph.
+func (w *Workflow) Validate() error {
+	_, err := w.compile()
+	return err
+}
+
+// approvalQueue returns the queue approval nodes wait on, or nil.
+func (w *Workflow) approvalQueue() *approval.Queue {
+	if w.approvals != nil {
+		return w.approvals
+	}
+	if w.checkpoints != nil {
+		return approval.NewQueue(w.checkpoints.store)
+	}
+	return nil
+}
+
+// graph is a validated workflow, ready to run.
+type graph struct {
+	nodes     map[string]*Node
+	incoming  map[string][]Edge
+	outgoing  map[string][]Edge
+	templates map[string]*template.Template
+}
+
+// compile validates the workflow and indexes its edges.
+func (w *Workflow) compile() (*graph, error) {
+	g := &graph{
+		nodes:     make(map[string]*Node, len(w.nodes)),
+		incoming:  make(map[string][]Edge),
+		outgoing:  make(map[string][]Edge),
+		templates: make(map[string]*template.Template),
+	}
+
+	if len(w.nodes) == 0 {
+		return nil, fmt.Errorf("%w: no nodes", ErrInvalidWorkflow)
+	}
+
+	for _, n := range w.nodes {
+		if n.ID == "" {
+			return nil, fmt.Errorf("%w: node without an ID", ErrInvalidWorkflow)
+		}
+		if _, exists := g.nodes[n.ID]; exists {
+			return nil, fmt.Errorf("%w: duplicate node %q", ErrInvalidWorkflow, n.ID)
+		}
+
+		set := 0
+		for _, ok := range []bool{n.Agent != nil, n.Capability != "", n.Tool != nil, n.Func != nil} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("%w: node %q must have exactly one of agent, capability, tool or func", ErrInvalidWorkflow, n.ID)
+		}
+		if n.Capability != "" && w.delegator == nil {
+			return nil, fmt.Errorf("%w: node %q", ErrNoDelegator, n.ID)
+		}
+		if n.Approval && w.approvalQueue() == nil {
+			return nil, fmt.Errorf("%w: node %q needs approval but the workflow has no approval queue or checkpoints", ErrInvalidWorkflow, n.ID)
+		}
+
+		switch n.Join {
+		case "", JoinAll, JoinAny:
+		default:
+			return nil, fmt.Errorf("%w: node %q has unknown join %q", ErrInvalidWorkflow, n.ID, n.Join)
+		}
+
+		if n.Input != "" {
+			tmpl, err := template.New(n.ID).Funcs(templateFuncs).Option("missingkey=zero").Parse(n.Input)
+			if err != nil {
+				return nil, fmt.Errorf("%w: node %q input: %v", ErrInvalidWorkflow, n.ID, err)
+			}
+			g.templates[n.ID] = tmpl
+		}
+
+		g.nodes[n.ID] = n
+	}
+
+	for _, e := range w.edges {
+		if _, ok := g.nodes[e.From]; !ok {
+			return nil, fmt.Errorf("%w: edge from unknown node %q", ErrInvalidWorkflow, e.From)
+		}
+		if _, ok := g.nodes[e.To]; !ok {
+			return nil, fmt.Errorf("%w: edge to unknown node %q", ErrInvalidWorkflow, e.To)
+		}
+		switch e.On {
+		case "", EdgeSuccess, EdgeFailure, EdgeAlways:
+		default:
+			return nil, fmt.Errorf("%w: edge %s -> %s has unknown type %q", ErrInvalidWorkflow, e.From, e.To, e.On)
+		}
+		g.outgoing[e.From] = append(g.outgoing[e.From], e)
+		g.incoming[e.To] = append(g.incoming[e.To], e)
+	}
+
+	if w.output != "" {
+		if _, ok := g.nodes[w.output]; !ok {
+			return nil, fmt.Errorf("%w: output node %q does not exist", ErrInvalidWorkflow, w.output)
+		}
+	}
+
+	if err := g.checkAcyclic(w.nodes); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// checkAcyclic removes nodes without unvisited predecessors until none
+// are left; anything remaining is part of a cycle.
+func (g *graph) checkAcyclic(nodes []*Node) error {
+	pending := make(map[string]int, len(nodes))
+	var queue []string
+	for _, n := range nodes {
+		pending[n.ID] = len(g.incoming[n.ID])
+		if pending[n.ID] == 0 {
+			queue = append(queue, n.ID)
+		}
+	}
+
+	visited := 0
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		visited++
+
+		for _, e := range g.outgoing[id] {
+			pending[e.To]--
+			if pending[e.To] == 0 {
+				queue = append(queue, e.To)
+			}
+		}
+	}
+
+	if visited != len(nodes) {
+		for _, n := range nodes {
+			if pending[n.ID] > 0 {
+				return fmt.Errorf("%w: through node %q", ErrCycle, n.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// templateFuncs are available in node input templates.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
@@ -0,0 +1,369 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/storo/lattice/pkg/agent"
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/mesh"
+	"github.com/storo/lattice/pkg/provider"
+	"github.com/storo/lattice/pkg/tool"
+)
+
+// echo returns a func node that prefixes its input.
+func echo(prefix string) Func {
+	return func(ctx context.Context, input string, outputs map[string]string) (string, error) {
+		return prefix + input, nil
+	}
+}
+
+func report(t *testing.T, result *core.Result) *Report {
+	t.Helper()
+	return result.Metadata["report"].(*Report)
+}
+
+func TestWorkflow_FanOutFanIn(t *testing.T) {
+	ctx := context.Background()
+
+	var running, maxRunning atomic.Int32
+	slow := func(name string) Func {
+		return func(ctx context.Context, input string, outputs map[string]string) (string, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			return name + ":" + input, nil
+		}
+	}
+
+	w := New("fan").
+		AddNode(
+			&Node{ID: "start", Func: echo("")},
+			&Node{ID: "a", Func: slow("a")},
+			&Node{ID: "b", Func: slow("b")},
+			&Node{ID: "join", Func: echo("joined\n")},
+		).
+		Connect("start", "a", "join").
+		Connect("start", "b", "join")
+
+	result, err := w.Run(ctx, "x")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Output != "joined\na:x\n\nb:x" {
+		t.Errorf("unexpected output %q", result.Output)
+	}
+	if maxRunning.Load() != 2 {
+		t.Errorf("expected independent nodes to run concurrently, max running %d", maxRunning.Load())
+	}
+	if rep := report(t, result).Node("join"); rep.Status != StatusDone || rep.Attempts != 1 {
+		t.Errorf("unexpected join report %+v", rep)
+	}
+}
+
+func TestWorkflow_MaxConcurrency(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	fn := func(ctx context.Context, input string, outputs map[string]string) (string, error) {
+		if n := running.Add(1); n > maxRunning.Load() {
+			maxRunning.Store(n)
+		}
+		time.Sleep(10 * time.Millisecond)
+		running.Add(-1)
+		return "ok", nil
+	}
+
+	w := New("limited", WithMaxConcurrency(1)).
+		AddNode(&Node{ID: "a", Func: fn}, &Node{ID: "b", Func: fn}, &Node{ID: "c", Func: fn})
+
+	if _, err := w.Run(context.Background(), ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if maxRunning.Load() != 1 {
+		t.Errorf("expected at most 1 running node, got %d", maxRunning.Load())
+	}
+}
+
+func TestWorkflow_ConditionalBranches(t *testing.T) {
+	ctx := context.Background()
+
+	w := New("support", WithOutput("reply")).
+		AddNode(
+			&Node{ID: "classify", Func: echo("")},
+			&Node{ID: "refund", Func: echo("refund: ")},
+			&Node{ID: "question", Func: echo("answer: ")},
+			&Node{ID: "reply", Func: echo(""), Join: JoinAny},
+		).
+		AddEdge(
+			Edge{From: "classify", To: "refund", When: Contains("refund")},
+			Edge{From: "classify", To: "question", When: Not(Contains("refund"))},
+			Edge{From: "refund", To: "reply"},
+			Edge{From: "question", To: "reply"},
+		)
+
+	result, err := w.Run(ctx, "I want a REFUND")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Output != "refund: I want a REFUND" {
+		t.Errorf("unexpected output %q", result.Output)
+	}
+	if rep := report(t, result).Node("question"); rep.Status != StatusSkipped {
+		t.Errorf("expected question branch skipped, got %s", rep.Status)
+	}
+}
+
+func TestWorkflow_JoinAllSkipsOnUntakenEdge(t *testing.T) {
+	w := New("join").
+		AddNode(
+			&Node{ID: "a", Func: echo("")},
+			&Node{ID: "b", Func: echo("")},
+			&Node{ID: "c", Func: echo("")},
+		).
+		AddEdge(
+			Edge{From: "a", To: "c"},
+			Edge{From: "b", To: "c", When: Equals("never")},
+		)
+
+	result, err := w.Run(context.Background(), "x")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rep := report(t, result).Node("c"); rep.Status != StatusSkipped {
+		t.Errorf("expected c skipped, got %s", rep.Status)
+	}
+}
+
+func TestWorkflow_RetriesAndTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	flaky := func(ctx context.Context, input string, outputs map[string]string) (string, error) {
+		if calls.Add(1) < 3 {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}
+		return "finally", nil
+	}
+
+	w := New("retry").AddNode(&Node{
+		ID:      "flaky",
+		Func:    flaky,
+		Retries: 2,
+		Timeout: 10 * time.Millisecond,
+	})
+
+	result, err := w.Run(ctx, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Output != "finally" {
+		t.Errorf("expected 'finally', got %q", result.Output)
+	}
+	if rep := report(t, result).Node("flaky"); rep.Attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", rep.Attempts)
+	}
+}
+
+func TestWorkflow_FailureEdge(t *testing.T) {
+	ctx := context.Background()
+
+	fail := func(ctx context.Context, input string, outputs map[string]string) (string, error) {
+		return "", errors.New("service down")
+	}
+
+	w := New("fallback").
+		AddNode(
+			&Node{ID: "primary", Func: fail},
+			&Node{ID: "fallback", Func: echo("fallback: ")},
+			&Node{ID: "notify", Func: echo("")},
+		).
+		AddEdge(
+			Edge{From: "primary", To: "fallback", On: EdgeFailure},
+			Edge{From: "primary", To: "notify"},
+		)
+
+	result, err := w.Run(ctx, "task")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Output != "fallback: task" {
+		t.Errorf("unexpected output %q", result.Output)
+	}
+	rep := report(t, result)
+	if rep.Node("primary").Error != "service down" || rep.Node("notify").Status != StatusSkipped {
+		t.Errorf("unexpected report %+v %+v", rep.Node("primary"), rep.Node("notify"))
+	}
+}
+
+func TestWorkflow_UnhandledFailureStops(t *testing.T) {
+	ctx := context.Background()
+
+	fail := func(ctx context.Context, input string, outputs map[string]string) (string, error) {
+		return "", errors.New("boom")
+	}
+	blocked := func(ctx context.Context, input string, outputs map[string]string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+
+	w := New("fail").
+		AddNode(
+			&Node{ID: "bad", Func: fail},
+			&Node{ID: "slow", Func: blocked},
+			&Node{ID: "after", Func: echo("")},
+		).
+		Connect("slow", "after")
+
+	result, err := w.Run(ctx, "")
+	if !errors.Is(err, ErrNodeFailed) || !strings.Contains(err.Error(), "bad: boom") {
+		t.Fatalf("expected ErrNodeFailed for bad, got %v", err)
+	}
+
+	rep := report(t, result)
+	if rep.Node("slow").Status != StatusFailed || rep.Node("after").Status != StatusSkipped {
+		t.Errorf("expected in-flight node cancelled and rest skipped, got %+v", rep.Nodes)
+	}
+}
+
+func TestWorkflow_TemplatesAndTools(t *testing.T) {
+	ctx := context.Background()
+
+	type searchInput struct {
+		Query string `json:"query"`
+	}
+	search := tool.Func("search", "Search", func(ctx context.Context, in searchInput) (string, error) {
+		return "results for " + in.Query, nil
+	})
+
+	w := New("tools").
+		AddNode(
+			&Node{ID: "topic", Func: echo("go ")},
+			&Node{ID: "search", Tool: search, Input: `{"query": {{json .Outputs.topic}}}`},
+			&Node{ID: "summary", Func: echo(""), Input: `{{.Input}} / {{index .Outputs "search"}}`},
+		).
+		Connect("topic", "search", "summary")
+
+	result, err := w.Run(ctx, "lang")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Output != "lang / results for go lang" {
+		t.Errorf("unexpected output %q", result.Output)
+	}
+}
+
+func TestWorkflow_AgentsAndMesh(t *testing.T) {
+	ctx := context.Background()
+
+	researcher := agent.New("researcher").
+		Model(&provider.MockProvider{
+			ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+				return &provider.ChatResponse{
+					Content:    "facts",
+					StopReason: provider.StopReasonEndTurn,
+					Usage:      provider.Usage{InputTokens: 5, OutputTokens: 3},
+				}, nil
+			},
+		}).
+		Provides(core.CapResearch).
+		Build()
+
+	// The writer can delegate research itself, through the mesh
+	var writerTools []int
+	writer := agent.New("writer").
+		Model(&provider.MockProvider{
+			ChatFunc: func(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+				writerTools = append(writerTools, len(req.Tools))
+				return &provider.ChatResponse{Content: "article", StopReason: provider.StopReasonEndTurn}, nil
+			},
+		}).
+		Needs(core.CapResearch).
+		Build()
+
+	m := mesh.New()
+	m.Register(researcher, writer)
+
+	w := New("article", WithDelegator(m)).
+		AddNode(
+			&Node{ID: "research", Capability: core.CapResearch},
+			&Node{ID: "write", Agent: writer},
+		).
+		Connect("research", "write")
+
+	result, err := w.Run(ctx, "topic")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Output != "article" {
+		t.Errorf("expected 'article', got %q", result.Output)
+	}
+	if result.TokensIn != 5 || result.Metadata["tokens_out"] != 3 {
+		t.Errorf("expected tokens from the research node, got %d/%v", result.TokensIn, result.Metadata["tokens_out"])
+	}
+	if result.TraceID == "" {
+		t.Error("expected trace ID to be set")
+	}
+
+	// Running again does not add the delegation tool twice
+	if _, err := w.Run(ctx, "topic"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(writerTools) != 2 || writerTools[0] != 1 || writerTools[1] != 1 {
+		t.Errorf("expected the writer to get one delegation tool per run, got %v", writerTools)
+	}
+}
+
+func TestWorkflow_Validate(t *testing.T) {
+	fn := echo("")
+	tests := []struct {
+		name string
+		w    *Workflow
+		err  error
+	}{
+		{"empty", New("w"), ErrInvalidWorkflow},
+		{"duplicate", New("w").AddNode(&Node{ID: "a", Func: fn}, &Node{ID: "a", Func: fn}), ErrInvalidWorkflow},
+		{"no kind", New("w").AddNode(&Node{ID: "a"}), ErrInvalidWorkflow},
+		{"unknown edge", New("w").AddNode(&Node{ID: "a", Func: fn}).Connect("a", "b"), ErrInvalidWorkflow},
+		{"bad template", New("w").AddNode(&Node{ID: "a", Func: fn, Input: "{{.Input"}), ErrInvalidWorkflow},
+		{"no delegator", New("w").AddNode(&Node{ID: "a", Capability: core.CapResearch}), ErrNoDelegator},
+		{"cycle", New("w").AddNode(&Node{ID: "a", Func: fn}, &Node{ID: "b", Func: fn}).Connect("a", "b", "a"), ErrCycle},
+	}
+
+	for _, tt := range tests {
+		if err := tt.w.Validate(); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestReport_JSON(t *testing.T) {
+	w := New("json").AddNode(&Node{ID: "a", Func: echo("")})
+
+	result, err := w.Run(context.Background(), "x")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := json.Marshal(report(t, result))
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `"id":"a","kind":"func","status":"done"`) {
+		t.Errorf("unexpected report JSON %s", data)
+	}
+}
@@ -0,0 +1,235 @@
+package workflow
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/storo/lattice/pkg/core"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the YAML form of a workflow.
+type Spec struct {
+	Name           string     `yaml:"name"`
+	Output         string     `yaml:"output,omitempty"`
+	MaxConcurrency int        `yaml:"max_concurrency,omitempty"`
+	Nodes          []NodeSpec `yaml:"nodes"`
+	Edges          []EdgeSpec `yaml:"edges,omitempty"`
+}
+
+// NodeSpec is the YAML form of a node. Agent, tool and func refer to
+// names registered with WithAgents, WithTools and WithFunc.
+type NodeSpec struct {
+	ID         string `yaml:"id"`
+	Agent      string `yaml:"agent,omitempty"`
+	Capability string `yaml:"capability,omitempty"`
+	Tool       string `yaml:"tool,omitempty"`
+	Func       string `yaml:"func,omitempty"`
+	Input      string `yaml:"input,omitempty"`
+	Join       string `yaml:"join,omitempty"`
+	Retries    int    `yaml:"retries,omitempty"`
+	RetryDelay string `yaml:"retry_delay,omitempty"`
+	Timeout    string `yaml:"timeout,omitempty"`
+	Approval   bool   `yaml:"approval,omitempty"`
+
+	// After is shorthand for success edges from each listed node.
+	After []string `yaml:"after,omitempty"`
+}
+
+// EdgeSpec is the YAML form of an edge.
+type EdgeSpec struct {
+	From string         `yaml:"from"`
+	To   string         `yaml:"to"`
+	On   string         `yaml:"on,omitempty"`
+	When *ConditionSpec `yaml:"when,omitempty"`
+}
+
+// ConditionSpec is the YAML form of an edge condition. Every field that is
+// set must match.
+type ConditionSpec struct {
+	Contains    string `yaml:"contains,omitempty"`
+	NotContains string `yaml:"not_contains,omitempty"`
+	Equals      string `yaml:"equals,omitempty"`
+	Matches     string `yaml:"matches,omitempty"`
+}
+
+// LoadOption configures how a YAML workflow is resolved.
+type LoadOption func(*loader)
+
+// loader resolves the names used in a Spec.
+type loader struct {
+	agents map[string]core.Agent
+	tools  map[string]core.Tool
+	funcs  map[string]Func
+	opts   []Option
+}
+
+// WithAgents makes agents available to nodes by name or ID.
+func WithAgents(agents ...core.Agent) LoadOption {
+	return func(l *loader) {
+		for _, a := range agents {
+			l.agents[a.Name()] = a
+			l.agents[a.ID()] = a
+		}
+	}
+}
+
+// WithTools makes tools available to nodes by name.
+func WithTools(tools ...core.Tool) LoadOption {
+	return func(l *loader) {
+		for _, t := range tools {
+			l.tools[t.Name()] = t
+		}
+	}
+}
+
+// WithFunc makes a Go function available to nodes by name.
+func WithFunc(name string, fn Func) LoadOption {
+	return func(l *loader) {
+		l.funcs[name] = fn
+	}
+}
+
+// WithOptions applies workflow options, such as WithDelegator, to the
+// loaded workflow.
+func WithOptions(opts ...Option) LoadOption {
+	return func(l *loader) {
+		l.opts = append(l.opts, opts...)
+	}
+}
+
+// LoadFile reads a workflow from a YAML file.
+func LoadFile(path string, opts ...LoadOption) (*Workflow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, opts...)
+}
+
+// Parse reads a workflow from YAML and validates it.
+func Parse(data []byte, opts ...LoadOption) (*Workflow, error) {
+	var spec Spec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWorkflow, err)
+	}
+	return FromSpec(spec, opts...)
+}
+
+// FromSpec builds a workflow from its YAML form and validates it.
+func FromSpec(spec Spec, opts ...LoadOption) (*Workflow, error) {
+	l := &loader{
+		agents: make(map[string]core.Agent),
+		tools:  make(map[string]core.Tool),
+		funcs:  make(map[string]Func),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	wfOpts := []Option{WithOutput(spec.Output), WithMaxConcurrency(spec.MaxConcurrency)}
+	w := New(spec.Name, append(wfOpts, l.opts...)...)
+
+	for _, ns := range spec.Nodes {
+		n, err := l.node(ns)
+		if err != nil {
+			return nil, err
+		}
+		w.AddNode(n)
+
+		for _, from := range ns.After {
+			w.AddEdge(Edge{From: from, To: ns.ID})
+		}
+	}
+
+	for _, es := range spec.Edges {
+		when, err := es.When.condition()
+		if err != nil {
+			return nil, fmt.Errorf("%w: edge %s -> %s: %v", ErrInvalidWorkflow, es.From, es.To, err)
+		}
+		w.AddEdge(Edge{From: es.From, To: es.To, On: EdgeType(es.On), When: when})
+	}
+
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// node resolves a NodeSpec.
+func (l *loader) node(ns NodeSpec) (*Node, error) {
+	n := &Node{
+		ID:         ns.ID,
+		Capability: core.Capability(ns.Capability),
+		Input:      ns.Input,
+		Join:       JoinMode(ns.Join),
+		Retries:    ns.Retries,
+		Approval:   ns.Approval,
+	}
+
+	if ns.Agent != "" {
+		if n.Agent = l.agents[ns.Agent]; n.Agent == nil {
+			return nil, fmt.Errorf("%w: node %q: unknown agent %q", ErrInvalidWorkflow, ns.ID, ns.Agent)
+		}
+	}
+	if ns.Tool != "" {
+		if n.Tool = l.tools[ns.Tool]; n.Tool == nil {
+			return nil, fmt.Errorf("%w: node %q: unknown tool %q", ErrInvalidWorkflow, ns.ID, ns.Tool)
+		}
+	}
+	if ns.Func != "" {
+		if n.Func = l.funcs[ns.Func]; n.Func == nil {
+			return nil, fmt.Errorf("%w: node %q: unknown func %q", ErrInvalidWorkflow, ns.ID, ns.Func)
+		}
+	}
+
+	var err error
+	if n.RetryDelay, err = parseDuration(ns.RetryDelay); err != nil {
+		return nil, fmt.Errorf("%w: node %q retry_delay: %v", ErrInvalidWorkflow, ns.ID, err)
+	}
+	if n.Timeout, err = parseDuration(ns.Timeout); err != nil {
+		return nil, fmt.Errorf("%w: node %q timeout: %v", ErrInvalidWorkflow, ns.ID, err)
+	}
+
+	return n, nil
+}
+
+// condition builds the edge condition, or nil if none is set.
+func (c *ConditionSpec) condition() (Condition, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	var conds []Condition
+	if c.Contains != "" {
+		conds = append(conds, Contains(c.Contains))
+	}
+	if c.NotContains != "" {
+		conds = append(conds, Not(Contains(c.NotContains)))
+	}
+	if c.Equals != "" {
+		conds = append(conds, Equals(c.Equals))
+	}
+	if c.Matches != "" {
+		re, err := regexp.Compile(c.Matches)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, Matches(re))
+	}
+
+	if len(conds) == 0 {
+		return nil, nil
+	}
+	return All(conds...), nil
+}
+
+// parseDuration parses an optional duration.
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
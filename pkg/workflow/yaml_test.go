@@ -0,0 +1,105 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/storo/lattice/pkg/agent"
+	"github.com/storo/lattice/pkg/core"
+	"github.com/storo/lattice/pkg/patterns"
+	"github.com/storo/lattice/pkg/provider"
+)
+
+const supportWorkflow = `
+name: support
+output: reply
+max_concurrency: 2
+nodes:
+  - id: classify
+    agent: classifier
+    retries: 1
+    retry_delay: 1ms
+    timeout: 5s
+  - id: refund
+    capability: billing
+    input: "Refund request: {{.Input}}"
+  - id: answer
+    func: answer
+  - id: reply
+    func: upper
+    join: any
+    after: [refund, answer]
+edges:
+  - from: classify
+    to: refund
+    when: {contains: refund}
+  - from: classify
+    to: answer
+    when: {not_contains: refund}
+`
+
+func TestParse(t *testing.T) {
+	ctx := context.Background()
+
+	classifier := agent.New("classifier").Model(provider.NewMockWithResponse("refund")).Build()
+	billing := agent.New("billing").
+		Model(provider.NewMockWithResponse("refunded")).
+		Provides(core.Capability("billing")).
+		Build()
+
+	upper := func(ctx context.Context, input string, outputs map[string]string) (string, error) {
+		return "reply: " + input, nil
+	}
+
+	w, err := Parse([]byte(supportWorkflow),
+		WithAgents(classifier),
+		WithFunc("answer", echo("answer: ")),
+		WithFunc("upper", upper),
+		WithOptions(WithDelegator(patterns.NewSupervisor(patterns.WithWorkers(billing)))),
+	)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	if w.Name() != "support" || len(w.Nodes()) != 4 || len(w.Edges()) != 4 {
+		t.Fatalf("unexpected workflow %s: %d nodes, %d edges", w.Name(), len(w.Nodes()), len(w.Edges()))
+	}
+	if n := w.Nodes()[0]; n.Retries != 1 || n.RetryDelay != time.Millisecond || n.Timeout != 5*time.Second {
+		t.Errorf("unexpected classify node %+v", n)
+	}
+
+	result, err := w.Run(ctx, "my order")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Output != "reply: refunded" {
+		t.Errorf("unexpected output %q", result.Output)
+	}
+	if rep := report(t, result).Node("refund"); rep.Input != "Refund request: my order" {
+		t.Errorf("unexpected refund input %q", rep.Input)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{"syntax", "nodes: [:"},
+		{"unknown agent", "nodes: [{id: a, agent: missing}]"},
+		{"unknown tool", "nodes: [{id: a, tool: missing}]"},
+		{"unknown func", "nodes: [{id: a, func: missing}]"},
+		{"bad timeout", "nodes: [{id: a, func: f, timeout: soon}]"},
+		{"bad regex", "nodes: [{id: a, func: f}, {id: b, func: f}]\nedges: [{from: a, to: b, when: {matches: '('}}]"},
+		{"bad edge type", "nodes: [{id: a, func: f}, {id: b, func: f}]\nedges: [{from: a, to: b, on: maybe}]"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.yaml), WithFunc("f", echo("")))
+		if !errors.Is(err, ErrInvalidWorkflow) {
+			t.Errorf("%s: expected ErrInvalidWorkflow, got %v", tt.name, err)
+		}
+	}
+}